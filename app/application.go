@@ -5,6 +5,7 @@ import (
 	"embed"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -23,6 +24,7 @@ type Application struct {
 	tftpServer    *tftp.Server
 	staticFS      embed.FS
 	staticHandler *handlers.StaticHandlers
+	cancel        context.CancelFunc
 }
 
 // NewApplicationWithStatic creates a new application instance with embedded static files
@@ -45,19 +47,65 @@ func NewApplicationWithStatic(staticFS embed.FS) (*Application, error) {
 // Start starts all application services including static file serving
 func (a *Application) Start() error {
 	// Start TFTP server
-	a.tftpServer = tftp.NewServer(a.container.Config.TFTP.Dir)
+	tftpConfig := a.container.Config.TFTP
+	a.tftpServer = tftp.NewServer(tftpConfig.Dir)
+	a.tftpServer.SetListenerConfig(tftp.ListenerConfig{
+		Address:      tftpConfig.Address,
+		Port:         tftpConfig.Port,
+		MaxBlockSize: tftpConfig.MaxBlockSize,
+		Timeout:      tftpConfig.Timeout,
+		Retries:      tftpConfig.Retries,
+		SinglePort:   tftpConfig.SinglePort,
+	})
+	a.tftpServer.SetRootResolver(a.tftpRootForClient)
+	a.tftpServer.SetOverrideDir(tftpConfig.OverrideDir)
+	if tftpConfig.Defaults {
+		a.tftpServer.SetDefaults(tftp.DefaultAssets())
+	}
+	if a.container.BootMenuRenderer != nil {
+		a.tftpServer.SetVirtualFiles(a.container.BootMenuRenderer)
+	}
+	if a.container.TFTPCache != nil {
+		a.tftpServer.SetCache(a.container.TFTPCache)
+	}
+	if a.container.TransferLog != nil {
+		a.tftpServer.AddTransferObserver(a.container.TransferLog.Record)
+	}
+	if a.container.LeaseService != nil {
+		a.tftpServer.AddTransferObserver(tftp.NewLeaseStateTracker(a.container.LeaseService).Record)
+	}
+	a.tftpServer.SetUploadPolicy(a.container.TFTPUploads)
+	a.tftpServer.SetAccessPolicy(a.container.TFTPAccess)
 	if err := a.tftpServer.Start(); err != nil {
 		return fmt.Errorf("failed to start TFTP server: %w", err)
 	}
-	log.Printf("TFTP server started on port 69, serving from %s", a.container.Config.TFTP.Dir)
+	log.Printf("TFTP server started on %s, serving from %s", a.tftpServer.Addr(), tftpConfig.Dir)
+
+	// Start background probing for rogue DHCP servers
+	ctx, cancel := context.WithCancel(context.Background())
+	a.cancel = cancel
+	a.container.RogueDetector.Start(ctx)
 
 	// Setup HTTP handlers with dependency injection
 	handlerContainer := &handlers.Container{
 		ServerService:   a.container.ServerService,
 		LeaseService:    a.container.LeaseService,
 		OSImageService:  a.container.OSImageService,
+		OSCatalog:       a.container.OSCatalog,
 		SyslinuxService: a.container.SyslinuxService,
 		IPXEService:     a.container.IPXEService,
+		RogueDetector:   a.container.RogueDetector,
+		TransferLog:     a.container.TransferLog,
+		TFTPCache:       a.container.TFTPCache,
+		TFTPFiles:       a.tftpServer.Files(nil),
+		TFTPBackups:     a.container.TFTPBackups,
+		Uploads:         a.container.Uploads,
+		TFTPManager:     a.container.TFTPManager,
+		BootFiles:       a.tftpServer.Files,
+		TFTPAccess:      a.container.TFTPAccess,
+		BootAccess:      a.container.BootAccess,
+		BootMenus:       a.container.BootMenuRenderer,
+		BootConfigs:     a.container.ConfigRenderer,
 		Config:          a.container.Config,
 	}
 
@@ -82,11 +130,34 @@ func (a *Application) Start() error {
 	return nil
 }
 
+// tftpRootForClient returns the TFTP root of the DHCP server whose subnet contains ip
+func (a *Application) tftpRootForClient(ip net.IP) string {
+	servers, err := a.container.ServerService.GetAllServers(context.Background())
+	if err != nil {
+		log.Printf("Failed to look up TFTP root for %s: %v", ip, err)
+		return ""
+	}
+
+	for _, server := range servers {
+		if server.TFTPRoot == "" || server.IP == nil || server.Options.SubnetMask == nil {
+			continue
+		}
+		if server.GetSubnet().Contains(ip) {
+			return server.TFTPRoot
+		}
+	}
+	return ""
+}
+
 // Rest of the Application methods remain the same...
 func (a *Application) Stop() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	if a.cancel != nil {
+		a.cancel()
+	}
+
 	if a.httpServer != nil {
 		if err := a.httpServer.Shutdown(ctx); err != nil {
 			log.Printf("Error shutting down HTTP server: %v", err)
@@ -126,12 +197,32 @@ func (a *Application) Run() error {
 
 // GetContainer returns the application's container for access to services
 func (a *Application) GetContainer() *handlers.Container {
+	var tftpFiles *tftp.LayeredFS
+	var bootFiles func(net.IP) *tftp.LayeredFS
+	if a.tftpServer != nil {
+		tftpFiles = a.tftpServer.Files(nil)
+		bootFiles = a.tftpServer.Files
+	}
+
 	return &handlers.Container{
 		ServerService:   a.container.ServerService,
 		LeaseService:    a.container.LeaseService,
 		OSImageService:  a.container.OSImageService,
+		OSCatalog:       a.container.OSCatalog,
 		SyslinuxService: a.container.SyslinuxService,
 		IPXEService:     a.container.IPXEService,
+		RogueDetector:   a.container.RogueDetector,
+		TransferLog:     a.container.TransferLog,
+		TFTPCache:       a.container.TFTPCache,
+		TFTPFiles:       tftpFiles,
+		TFTPBackups:     a.container.TFTPBackups,
+		Uploads:         a.container.Uploads,
+		TFTPManager:     a.container.TFTPManager,
+		BootFiles:       bootFiles,
+		TFTPAccess:      a.container.TFTPAccess,
+		BootAccess:      a.container.BootAccess,
+		BootMenus:       a.container.BootMenuRenderer,
+		BootConfigs:     a.container.ConfigRenderer,
 		Config:          a.container.Config,
 	}
 }
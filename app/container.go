@@ -1,15 +1,25 @@
 package app
 
 import (
+	"context"
 	"fmt"
+	"ignite/bootmenu"
 	"ignite/config"
 	"ignite/db"
 	"ignite/dhcp"
 	"ignite/ipxe"
+	"ignite/network"
 	"ignite/osimage"
 	"ignite/syslinux"
+	"ignite/tftp"
+	"ignite/upload"
+	"log"
+	"path/filepath"
 )
 
+// transferHistoryPerHost is how many TFTP transfers are kept for each client
+const transferHistoryPerHost = 100
+
 // Container holds all application dependencies
 type Container struct {
 	Config             *config.Config
@@ -21,9 +31,21 @@ type Container struct {
 	OSImageRepo        osimage.OSImageRepository
 	DownloadStatusRepo osimage.DownloadStatusRepository
 	OSImageService     osimage.OSImageService
+	OSCatalog          *osimage.Catalog
 	SyslinuxRepo       syslinux.Repository
 	SyslinuxService    syslinux.Service
 	IPXEService        *ipxe.Service
+	RogueDetector      *dhcp.RogueDetector
+	BootMenuRenderer   *bootmenu.Renderer
+	ConfigRenderer     *bootmenu.ConfigRenderer
+	TransferLog        *tftp.TransferLog
+	TFTPCache          *tftp.FileCache
+	TFTPUploads        tftp.UploadPolicy
+	TFTPBackups        *tftp.BackupStore
+	Uploads            *upload.Store
+	TFTPManager        *tftp.FileManager
+	TFTPAccess         tftp.AccessPolicy
+	BootAccess         tftp.AccessPolicy
 }
 
 // NewContainer creates and wires up all dependencies
@@ -51,11 +73,45 @@ func NewContainer() (*Container, error) {
 	}
 
 	// Create services
-	serverService := dhcp.NewDHCPServerService(serverRepo, leaseRepo)
+	serverService := dhcp.NewDHCPServerService(serverRepo, leaseRepo).SetVLANManager(network.NewVLANManager())
 	leaseService := dhcp.NewDHCPLeaseService(leaseRepo, serverRepo)
-	osImageService := osimage.NewOSImageService(osImageRepo, downloadStatusRepo, cfg)
+	osCatalog := osimage.NewCatalog(cfg.OSImages)
+	if err := osCatalog.Refresh(context.Background()); err != nil {
+		// Skipped sources are shown on the OS images page
+		log.Printf("Some OS catalog sources were skipped: %v", err)
+	}
+	osImageService := osimage.NewOSImageService(osImageRepo, downloadStatusRepo, cfg, osCatalog)
 	syslinuxService := syslinux.NewService(syslinuxRepo, syslinux.GetDefaultConfig())
 	ipxeService := ipxe.NewService(cfg, osImageService)
+	var tftpCache *tftp.FileCache
+	if cfg.TFTP.CacheSizeMB > 0 {
+		tftpCache = tftp.NewFileCache(int64(cfg.TFTP.CacheSizeMB) << 20)
+	}
+	tftpUploads, err := tftp.NewUploadPolicy(cfg.TFTP.UploadDirs, cfg.TFTP.UploadSubnets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure TFTP uploads: %w", err)
+	}
+	tftpUploads.Versions = cfg.TFTP.UploadVersions
+	tftpUploads.MaxAge = cfg.TFTP.UploadMaxAge
+	var hostLeases dhcp.LeaseService
+	if cfg.TFTP.BindHostFiles {
+		hostLeases = leaseService
+	}
+	tftpAccess, err := tftp.NewAccessPolicy(cfg.TFTP.ReadSubnets, cfg.TFTP.AccessRules, hostLeases)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure TFTP access control: %w", err)
+	}
+	bootAccess, err := tftp.NewAccessPolicy(cfg.HTTP.BootSubnets, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure HTTP boot access: %w", err)
+	}
+	bootMenuRenderer := bootmenu.NewRenderer(filepath.Join(cfg.Provision.Dir, "templates", "bootmenu"), serverService, leaseService, osImageService).SetHTTPPort(cfg.HTTP.Port)
+
+	rogueDetector := dhcp.NewRogueDetector(serverRepo, dhcp.NewDiscoverProber(cfg.DHCP.RogueScanTimeout), cfg.DHCP.RogueScanInterval)
+	rogueDetector.AddAlertHook(dhcp.LogAlertHook)
+	if cfg.DHCP.RogueAlertWebhook != "" {
+		rogueDetector.AddAlertHook(dhcp.NewWebhookAlertHook(cfg.DHCP.RogueAlertWebhook))
+	}
 
 	return &Container{
 		Config:             cfg,
@@ -67,9 +123,21 @@ func NewContainer() (*Container, error) {
 		OSImageRepo:        osImageRepo,
 		DownloadStatusRepo: downloadStatusRepo,
 		OSImageService:     osImageService,
+		OSCatalog:          osCatalog,
 		SyslinuxRepo:       syslinuxRepo,
 		SyslinuxService:    syslinuxService,
 		IPXEService:        ipxeService,
+		RogueDetector:      rogueDetector,
+		BootMenuRenderer:   bootMenuRenderer,
+		ConfigRenderer:     bootmenu.NewConfigRenderer(filepath.Join(cfg.Provision.Dir, "templates"), serverService, leaseService).SetHTTPPort(cfg.HTTP.Port),
+		TransferLog:        tftp.NewTransferLog(transferHistoryPerHost),
+		TFTPCache:          tftpCache,
+		TFTPUploads:        tftpUploads,
+		TFTPBackups:        tftp.NewBackupStore(cfg.TFTP.Dir, tftpUploads),
+		Uploads:            upload.NewStore(cfg.TFTP.Dir, int64(cfg.TFTP.WebUploadMaxMB)<<20, cfg.TFTP.WebUploadExpiry),
+		TFTPManager:        tftp.NewFileManager(cfg.TFTP.Dir, int64(cfg.TFTP.ExtractMaxMB)<<20),
+		TFTPAccess:         tftpAccess,
+		BootAccess:         bootAccess,
 	}, nil
 }
 
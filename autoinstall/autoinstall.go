@@ -0,0 +1,169 @@
+package autoinstall
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"ignite/dhcp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// StorageLayouts are the guided storage layouts subiquity supports
+var StorageLayouts = []string{"lvm", "direct", "zfs", "hybrid"}
+
+// usernamePattern matches the user names subiquity accepts
+var usernamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_-]*$`)
+
+// Check validates the settings on a boot menu before they are saved
+func Check(in *dhcp.AutoinstallSettings) error {
+	if in == nil {
+		return nil
+	}
+	if in.StorageLayout != "" && !contains(StorageLayouts, in.StorageLayout) {
+		return fmt.Errorf("unknown storage layout %q", in.StorageLayout)
+	}
+	if in.Username != "" && !usernamePattern.MatchString(in.Username) {
+		return fmt.Errorf("invalid username %q", in.Username)
+	}
+	if in.PasswordHash != "" && !isCryptHash(in.PasswordHash) {
+		return fmt.Errorf("password must be a crypt hash, such as the output of mkpasswd -m sha-512")
+	}
+	return nil
+}
+
+// Render merges the boot menu's settings and the host's hostname into a rendered autoinstall
+// template and validates the result. The template is either cloud-config
+// user-data with an autoinstall section, or the autoinstall section alone;
+// the result is always user-data.
+func Render(content []byte, hostname string, inputs *dhcp.AutoinstallSettings) ([]byte, error) {
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("invalid autoinstall YAML: %w", err)
+	}
+
+	section, ok := doc["autoinstall"].(map[string]interface{})
+	if !ok {
+		if _, bare := doc["version"]; !bare {
+			return nil, fmt.Errorf("no autoinstall section in template")
+		}
+		section = doc
+		doc = map[string]interface{}{"autoinstall": section}
+	}
+
+	apply(section, inputs, hostname)
+
+	out, err := yaml.Marshal(section)
+	if err != nil {
+		return nil, err
+	}
+	if err := Validate(out); err != nil {
+		return nil, err
+	}
+
+	userData, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte("#cloud-config\n"), userData...), nil
+}
+
+// apply sets the boot menu's settings on an autoinstall section
+func apply(section map[string]interface{}, in *dhcp.AutoinstallSettings, hostname string) {
+	if in != nil {
+		applyInputs(section, in)
+	}
+
+	// Templates that leave out the hostname get the one on the boot menu
+	if identity, ok := section["identity"].(map[string]interface{}); ok && hostname != "" {
+		if _, set := identity["hostname"]; !set {
+			identity["hostname"] = hostname
+		}
+	}
+}
+
+// applyInputs sets the structured settings on an autoinstall section
+func applyInputs(section map[string]interface{}, in *dhcp.AutoinstallSettings) {
+	for key, value := range map[string]string{"username": in.Username, "realname": in.RealName, "password": in.PasswordHash} {
+		if value != "" {
+			child(section, "identity")[key] = value
+		}
+	}
+
+	// A layout replaces any storage config, since subiquity ignores one when
+	// given the other
+	if in.StorageLayout != "" {
+		section["storage"] = map[string]interface{}{
+			"layout": map[string]interface{}{"name": in.StorageLayout},
+		}
+	}
+
+	if len(in.AuthorizedKeys) > 0 {
+		ssh := child(section, "ssh")
+		ssh["install-server"] = true
+		ssh["authorized-keys"] = appendUnique(ssh["authorized-keys"], in.AuthorizedKeys)
+	}
+	if len(in.Packages) > 0 {
+		section["packages"] = appendUnique(section["packages"], in.Packages)
+	}
+	if len(in.LateCommands) > 0 {
+		commands, _ := section["late-commands"].([]interface{})
+		for _, command := range in.LateCommands {
+			commands = append(commands, command)
+		}
+		section["late-commands"] = commands
+	}
+}
+
+// child returns the mapping under key in m, creating it if needed
+func child(m map[string]interface{}, key string) map[string]interface{} {
+	c, ok := m[key].(map[string]interface{})
+	if !ok {
+		c = map[string]interface{}{}
+		m[key] = c
+	}
+	return c
+}
+
+// appendUnique appends values missing from a YAML sequence
+func appendUnique(existing interface{}, values []string) []interface{} {
+	list, _ := existing.([]interface{})
+	seen := make(map[string]bool, len(list))
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			seen[s] = true
+		}
+	}
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			list = append(list, value)
+		}
+	}
+	return list
+}
+
+// isCryptHash reports whether s looks like a crypt(3) hash such as $6$salt$hash
+func isCryptHash(s string) bool {
+	parts := strings.Split(s, "$")
+	return len(parts) >= 4 && parts[0] == "" && parts[1] != "" && parts[len(parts)-1] != ""
+}
+
+// contains reports whether list contains s
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeStrict decodes YAML into v, rejecting unknown fields
+func decodeStrict(data []byte, v interface{}) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	return decoder.Decode(v)
+}
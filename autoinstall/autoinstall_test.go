@@ -0,0 +1,131 @@
+package autoinstall
+
+import (
+	"strings"
+	"testing"
+
+	"ignite/dhcp"
+
+	"gopkg.in/yaml.v3"
+)
+
+const passwordHash = "$6$ignitedefault$qZh7MyUWy7i5voQne9O81HVS7K3CoFNsg7UYXAIzOL2VhP.mnzuF84ff.z8KgXq4Jfz/N719MWO4Ecz83VF72/"
+
+const template = `#cloud-config
+autoinstall:
+  version: 1
+  identity:
+    username: ubuntu
+    password: "` + passwordHash + `"
+  storage:
+    layout:
+      name: direct
+  packages:
+    - curl
+  late-commands:
+    - curtin in-target -- systemctl enable ssh
+`
+
+func TestRender(t *testing.T) {
+	inputs := &dhcp.AutoinstallSettings{
+		StorageLayout:  "lvm",
+		Username:       "admin",
+		AuthorizedKeys: []string{"ssh-ed25519 AAAA admin"},
+		Packages:       []string{"curl", "vim"},
+		LateCommands:   []string{"echo done"},
+	}
+
+	out, err := Render([]byte(template), "node1", inputs)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if !strings.HasPrefix(string(out), "#cloud-config\n") {
+		t.Errorf("Render() output is not cloud-config user-data:\n%s", out)
+	}
+
+	var doc struct {
+		Autoinstall Config `yaml:"autoinstall"`
+	}
+	if err := yaml.Unmarshal(out, &doc); err != nil {
+		t.Fatalf("Render() produced invalid YAML: %v", err)
+	}
+	cfg := doc.Autoinstall
+
+	if cfg.Identity.Hostname != "node1" || cfg.Identity.Username != "admin" || cfg.Identity.Password != passwordHash {
+		t.Errorf("identity = %+v", cfg.Identity)
+	}
+	if cfg.Storage.Layout == nil || cfg.Storage.Layout.Name != "lvm" {
+		t.Errorf("storage layout not overridden: %+v", cfg.Storage)
+	}
+	if cfg.SSH == nil || cfg.SSH.InstallServer == nil || !*cfg.SSH.InstallServer || len(cfg.SSH.AuthorizedKeys) != 1 {
+		t.Errorf("ssh = %+v", cfg.SSH)
+	}
+	if strings.Join(cfg.Packages, ",") != "curl,vim" {
+		t.Errorf("packages = %v, want curl,vim", cfg.Packages)
+	}
+	if len(cfg.LateCommands) != 2 || cfg.LateCommands[1][0] != "echo done" {
+		t.Errorf("late-commands = %v", cfg.LateCommands)
+	}
+}
+
+func TestRender_BareSection(t *testing.T) {
+	bare := "version: 1\nidentity:\n  hostname: template-host\n  username: ubuntu\n  password: \"" + passwordHash + "\"\n"
+
+	out, err := Render([]byte(bare), "node1", nil)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	// The template's hostname wins over the boot menu's
+	if !strings.Contains(string(out), "autoinstall:") || !strings.Contains(string(out), "hostname: template-host") {
+		t.Errorf("Render() output:\n%s", out)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	identity := "identity: {hostname: node1, username: ubuntu, password: \"" + passwordHash + "\"}\n"
+
+	tests := []struct {
+		name    string
+		section string
+		wantErr bool
+	}{
+		{"Minimal", "version: 1\n" + identity, false},
+		{"Interactive identity", "version: 1\ninteractive-sections: [identity]\n", false},
+		{"Commands as lists", "version: 1\n" + identity + "late-commands:\n  - [curtin, in-target, --, true]\n  - echo done\n", false},
+		{"Open-ended sections", "version: 1\n" + identity + "network:\n  version: 2\n  ethernets: {}\napt:\n  preserve_sources_list: false\n", false},
+		{"Wrong version", "version: 2\n" + identity, true},
+		{"Missing identity", "version: 1\n", true},
+		{"Unknown section", "version: 1\n" + identity + "partitions: []\n", true},
+		{"Unknown identity field", "version: 1\nidentity: {hostname: node1, username: ubuntu, password: \"" + passwordHash + "\", shell: /bin/sh}\n", true},
+		{"Plaintext password", "version: 1\nidentity: {hostname: node1, username: ubuntu, password: changeme}\n", true},
+		{"Bad username", "version: 1\nidentity: {hostname: node1, username: Ubuntu, password: \"" + passwordHash + "\"}\n", true},
+		{"Unknown layout", "version: 1\n" + identity + "storage:\n  layout:\n    name: btrfs\n", true},
+		{"Empty storage", "version: 1\n" + identity + "storage: {}\n", true},
+		{"Bad shutdown", "version: 1\n" + identity + "shutdown: halt\n", true},
+		{"Packages not a list", "version: 1\n" + identity + "packages: vim\n", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate([]byte(tt.section))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	if err := Check(&dhcp.AutoinstallSettings{StorageLayout: "zfs", Username: "admin", PasswordHash: passwordHash}); err != nil {
+		t.Errorf("Check() error = %v", err)
+	}
+	for _, in := range []*dhcp.AutoinstallSettings{
+		{StorageLayout: "raid"},
+		{Username: "Admin"},
+		{PasswordHash: "changeme"},
+	} {
+		if err := Check(in); err == nil {
+			t.Errorf("Check(%+v) expected an error", in)
+		}
+	}
+}
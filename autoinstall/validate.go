@@ -0,0 +1,262 @@
+package autoinstall
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// sections are the top-level autoinstall keys, as listed in subiquity's
+// autoinstall schema
+var sections = []string{
+	"version", "interactive-sections", "early-commands", "locale", "refresh-installer",
+	"keyboard", "source", "network", "proxy", "apt", "storage", "identity",
+	"active-directory", "ubuntu-pro", "ssh", "codecs", "drivers", "oem", "snaps",
+	"debconf-selections", "packages", "kernel", "kernel-crash-dumps", "timezone",
+	"updates", "shutdown", "late-commands", "error-commands", "reporting",
+	"user-data", "zdevs",
+}
+
+// Config is an autoinstall section. Sections whose schema is open-ended, such
+// as network and apt, are accepted without inspection.
+type Config struct {
+	Version             int               `yaml:"version"`
+	InteractiveSections []string          `yaml:"interactive-sections"`
+	EarlyCommands       []Command         `yaml:"early-commands"`
+	Locale              string            `yaml:"locale"`
+	RefreshInstaller    *RefreshInstaller `yaml:"refresh-installer"`
+	Keyboard            *Keyboard         `yaml:"keyboard"`
+	Source              *Source           `yaml:"source"`
+	Network             yaml.Node         `yaml:"network"`
+	Proxy               yaml.Node         `yaml:"proxy"`
+	Apt                 yaml.Node         `yaml:"apt"`
+	Storage             *Storage          `yaml:"storage"`
+	Identity            *Identity         `yaml:"identity"`
+	ActiveDirectory     yaml.Node         `yaml:"active-directory"`
+	UbuntuPro           yaml.Node         `yaml:"ubuntu-pro"`
+	SSH                 *SSH              `yaml:"ssh"`
+	Codecs              *Install          `yaml:"codecs"`
+	Drivers             *Install          `yaml:"drivers"`
+	OEM                 yaml.Node         `yaml:"oem"`
+	Snaps               []Snap            `yaml:"snaps"`
+	DebconfSelections   string            `yaml:"debconf-selections"`
+	Packages            []string          `yaml:"packages"`
+	Kernel              *Kernel           `yaml:"kernel"`
+	KernelCrashDumps    yaml.Node         `yaml:"kernel-crash-dumps"`
+	Timezone            string            `yaml:"timezone"`
+	Updates             string            `yaml:"updates"`
+	Shutdown            string            `yaml:"shutdown"`
+	LateCommands        []Command         `yaml:"late-commands"`
+	ErrorCommands       []Command         `yaml:"error-commands"`
+	Reporting           yaml.Node         `yaml:"reporting"`
+	UserData            yaml.Node         `yaml:"user-data"`
+	Zdevs               yaml.Node         `yaml:"zdevs"`
+}
+
+// RefreshInstaller controls updating subiquity before the install
+type RefreshInstaller struct {
+	Update  bool   `yaml:"update"`
+	Channel string `yaml:"channel"`
+}
+
+// Keyboard is the keyboard layout of the installed system
+type Keyboard struct {
+	Layout  string `yaml:"layout"`
+	Variant string `yaml:"variant"`
+	Toggle  string `yaml:"toggle"`
+}
+
+// Source selects the installation source
+type Source struct {
+	SearchDrivers *bool  `yaml:"search_drivers"`
+	ID            string `yaml:"id"`
+}
+
+// Storage is either a guided layout or an explicit curtin storage config
+type Storage struct {
+	Layout *StorageLayout `yaml:"layout"`
+	Config yaml.Node      `yaml:"config"`
+	Swap   yaml.Node      `yaml:"swap"`
+	Grub   yaml.Node      `yaml:"grub"`
+}
+
+// StorageLayout is a guided storage layout
+type StorageLayout struct {
+	Name           string    `yaml:"name"`
+	Match          yaml.Node `yaml:"match"`
+	SizingPolicy   string    `yaml:"sizing-policy"`
+	Password       string    `yaml:"password"`
+	ResetPartition yaml.Node `yaml:"reset-partition"`
+}
+
+// Identity is the first user and hostname of the installed system
+type Identity struct {
+	Realname string `yaml:"realname"`
+	Username string `yaml:"username"`
+	Hostname string `yaml:"hostname"`
+	Password string `yaml:"password"`
+}
+
+// SSH configures the OpenSSH server of the installed system
+type SSH struct {
+	InstallServer  *bool    `yaml:"install-server"`
+	AuthorizedKeys []string `yaml:"authorized-keys"`
+	AllowPW        *bool    `yaml:"allow-pw"`
+}
+
+// Install toggles installing optional components such as drivers
+type Install struct {
+	Install *bool `yaml:"install"`
+}
+
+// Snap is a snap to install
+type Snap struct {
+	Name    string `yaml:"name"`
+	Channel string `yaml:"channel"`
+	Classic bool   `yaml:"classic"`
+}
+
+// Kernel selects the kernel package or flavor to install
+type Kernel struct {
+	Package string `yaml:"package"`
+	Flavor  string `yaml:"flavor"`
+}
+
+// Command is an early, late or error command, given either as a shell
+// command line or as an argument list
+type Command []string
+
+// UnmarshalYAML accepts a string or a list of strings
+func (c *Command) UnmarshalYAML(value *yaml.Node) error {
+	switch value.Kind {
+	case yaml.ScalarNode:
+		var s string
+		if err := value.Decode(&s); err != nil {
+			return err
+		}
+		*c = Command{s}
+		return nil
+	case yaml.SequenceNode:
+		var args []string
+		if err := value.Decode(&args); err != nil {
+			return err
+		}
+		*c = args
+		return nil
+	}
+	return fmt.Errorf("line %d: command must be a string or a list of strings", value.Line)
+}
+
+// Validate checks an autoinstall section against the subiquity autoinstall
+// schema: version 1, known sections with the right types, and the required
+// identity fields.
+func Validate(section []byte) error {
+	var cfg Config
+	if err := decodeStrict(section, &cfg); err != nil {
+		return fmt.Errorf("invalid autoinstall config: %w", err)
+	}
+
+	if cfg.Version != 1 {
+		return fmt.Errorf("invalid autoinstall config: version must be 1")
+	}
+
+	for _, name := range cfg.InteractiveSections {
+		if name != "*" && !contains(sections, name) {
+			return fmt.Errorf("invalid autoinstall config: unknown interactive section %q", name)
+		}
+	}
+	interactive := func(name string) bool {
+		return contains(cfg.InteractiveSections, name) || contains(cfg.InteractiveSections, "*")
+	}
+
+	if err := validateIdentity(cfg.Identity); err != nil {
+		return err
+	}
+	if cfg.Identity == nil && cfg.UserData.IsZero() && !interactive("identity") {
+		return fmt.Errorf("invalid autoinstall config: identity or user-data is required")
+	}
+
+	if err := validateStorage(cfg.Storage); err != nil {
+		return err
+	}
+
+	if cfg.SSH != nil {
+		for i, key := range cfg.SSH.AuthorizedKeys {
+			if key == "" {
+				return fmt.Errorf("invalid autoinstall config: ssh.authorized-keys[%d] is empty", i)
+			}
+		}
+	}
+
+	for i, snap := range cfg.Snaps {
+		if snap.Name == "" {
+			return fmt.Errorf("invalid autoinstall config: snaps[%d]: name is required", i)
+		}
+	}
+
+	for field, commands := range map[string][]Command{
+		"early-commands": cfg.EarlyCommands,
+		"late-commands":  cfg.LateCommands,
+		"error-commands": cfg.ErrorCommands,
+	} {
+		for i, command := range commands {
+			if len(command) == 0 || command[0] == "" {
+				return fmt.Errorf("invalid autoinstall config: %s[%d] is empty", field, i)
+			}
+		}
+	}
+
+	if cfg.Updates != "" && cfg.Updates != "security" && cfg.Updates != "all" {
+		return fmt.Errorf("invalid autoinstall config: updates must be security or all")
+	}
+	if cfg.Shutdown != "" && cfg.Shutdown != "reboot" && cfg.Shutdown != "poweroff" {
+		return fmt.Errorf("invalid autoinstall config: shutdown must be reboot or poweroff")
+	}
+	return nil
+}
+
+// validateIdentity checks the required identity fields
+func validateIdentity(identity *Identity) error {
+	if identity == nil {
+		return nil
+	}
+	for field, value := range map[string]string{
+		"hostname": identity.Hostname,
+		"username": identity.Username,
+		"password": identity.Password,
+	} {
+		if value == "" {
+			return fmt.Errorf("invalid autoinstall config: identity.%s is required", field)
+		}
+	}
+	if !usernamePattern.MatchString(identity.Username) {
+		return fmt.Errorf("invalid autoinstall config: invalid identity.username %q", identity.Username)
+	}
+	if !isCryptHash(identity.Password) {
+		return fmt.Errorf("invalid autoinstall config: identity.password must be a crypt hash")
+	}
+	return nil
+}
+
+// validateStorage checks a guided layout, or that an explicit config is given
+func validateStorage(storage *Storage) error {
+	if storage == nil {
+		return nil
+	}
+	if storage.Layout == nil {
+		if storage.Config.IsZero() {
+			return fmt.Errorf("invalid autoinstall config: storage needs a layout or a config")
+		}
+		return nil
+	}
+
+	if !contains(StorageLayouts, storage.Layout.Name) {
+		return fmt.Errorf("invalid autoinstall config: unknown storage layout %q", storage.Layout.Name)
+	}
+	switch storage.Layout.SizingPolicy {
+	case "", "scaled", "all":
+	default:
+		return fmt.Errorf("invalid autoinstall config: storage.layout.sizing-policy must be scaled or all")
+	}
+	return nil
+}
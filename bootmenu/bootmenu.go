@@ -0,0 +1,236 @@
+package bootmenu
+
+import (
+	"context"
+	"fmt"
+	"ignite/config"
+	"ignite/dhcp"
+	"ignite/osimage"
+	"net"
+	"strings"
+)
+
+// Data holds the data used for generating a boot menu configuration.
+type Data struct {
+	Name     string
+	Kernel   string
+	Initrd   string   // The first initrd
+	Initrds  []string // Every initrd, in load order
+	Options  string
+	Hostname string
+}
+
+// InitrdList joins the initrds with sep, as pxelinux's initrd= expects with ","
+func (d Data) InitrdList(sep string) string {
+	return strings.Join(d.Initrds, sep)
+}
+
+// Builder derives boot menu data from the boot settings stored on a lease.
+type Builder struct {
+	osImageService osimage.OSImageService
+	httpPort       string
+}
+
+// NewBuilder creates a new Builder instance
+func NewBuilder(osImageService osimage.OSImageService) *Builder {
+	return &Builder{osImageService: osImageService}
+}
+
+// MACFileName formats a MAC address the way PXE config file names expect it.
+func MACFileName(mac string) string {
+	return strings.ReplaceAll(strings.ToLower(mac), ":", "-")
+}
+
+// ConfigPath returns the provisioning config path for a host, relative to the
+// provision directory and served over HTTP.
+func ConfigPath(templateType, mac string) string {
+	return fmt.Sprintf("configs/%s/%s", templateType, MACFileName(mac))
+}
+
+// BootURL returns the URL of the unauthenticated HTTP boot tree on a server,
+// which serves the TFTP directory and, under configs/, provisioning configs.
+func BootURL(serverIP, port string) string {
+	host := serverIP
+	if port != "" && port != "80" {
+		host = net.JoinHostPort(serverIP, port)
+	}
+	return "http://" + host + "/boot"
+}
+
+// Build constructs the boot configuration data for a host from its boot menu.
+func (b *Builder) Build(ctx context.Context, menu dhcp.BootMenu, mac, serverIP string) Data {
+	dns := ""
+	if menu.DNS != nil {
+		dns = menu.DNS.String()
+	}
+	configFile := ConfigPath(menu.TemplateType, mac)
+	bootURL := BootURL(serverIP, b.httpPort)
+
+	image := b.findImage(ctx, menu.OS, menu.Version)
+	initrds := b.osToInitrds(image, menu.OS)
+	artifactArgs := ""
+	if image != nil {
+		artifactArgs = image.BootArgs(bootURL)
+	}
+
+	return Data{
+		Name:     b.osToName(menu.OS),
+		Kernel:   b.osToKernel(image, menu.OS),
+		Initrd:   initrds[0],
+		Initrds:  initrds,
+		Options:  BootOptions(menu.OS, menu.TemplateType, dns, bootURL, configFile, artifactArgs, menu.InstallDevice, menu.KernelOptions),
+		Hostname: menu.Hostname,
+	}
+}
+
+// BootOptions returns the appropriate boot options string based on the operating system and template type.
+// Config files are fetched relative to bootURL, as returned by BootURL.
+// artifactArgs, from osimage.OSImage.BootArgs, load the image's other artifacts.
+// installDevice is the disk CoreOS installs to; without one it boots live.
+func BootOptions(os, templateType, dns, bootURL, configFile, artifactArgs, installDevice, kernelOptions string) string {
+	var baseOptions string
+
+	// Determine boot parameters based on template type and OS
+	switch templateType {
+	case "cloud-init":
+		baseOptions = fmt.Sprintf(`url=%s/%s autoinstall ds=nocloud-net;s=%s nameserver=%s`,
+			bootURL, configFile, NoCloudSeedURL(bootURL), dns)
+	case "autoinstall":
+		// Subiquity reads the autoinstall user-data from the NoCloud seed
+		baseOptions = fmt.Sprintf(`ip=dhcp autoinstall ds=nocloud-net;s=%s nameserver=%s`,
+			NoCloudSeedURL(bootURL), dns)
+	case "kickstart":
+		baseOptions = fmt.Sprintf(`ks=%s/%s nameserver=%s`,
+			bootURL, configFile, dns)
+	case "preseed":
+		baseOptions = fmt.Sprintf(`url=%s/%s auto=true priority=critical nameserver=%s`,
+			bootURL, configFile, dns)
+	case "autoyast":
+		baseOptions = fmt.Sprintf(`autoyast=%s/%s nameserver=%s`,
+			bootURL, configFile, dns)
+	case "ipxe":
+		baseOptions = fmt.Sprintf(`initrd=%s/%s nameserver=%s`,
+			bootURL, configFile, dns)
+	case "ignition":
+		switch os {
+		case "flatcar", "Flatcar":
+			// Flatcar's PXE image runs from RAM and applies the config on first boot
+			baseOptions = fmt.Sprintf(`flatcar.first_boot=1 ignition.config.url=%s/%s nameserver=%s`,
+				bootURL, configFile, dns)
+		default:
+			if installDevice == "" {
+				// Nothing is written to disk unless a device is chosen, so the
+				// live image, with its rootfs from artifactArgs, applies the config
+				baseOptions = fmt.Sprintf(`ignition.firstboot ignition.platform.id=metal ignition.config.url=%s/%s nameserver=%s`,
+					bootURL, configFile, dns)
+				break
+			}
+			// The CoreOS live image installs to disk with the config for the
+			// installed system
+			baseOptions = fmt.Sprintf(`ignition.firstboot ignition.platform.id=metal coreos.inst.install_dev=%s coreos.inst.ignition_url=%s/%s nameserver=%s`,
+				installDevice, bootURL, configFile, dns)
+		}
+	default:
+		// Fallback to OS-based detection for backward compatibility
+		switch os {
+		case "ubuntu", "Ubuntu", "nixos", "NixOS":
+			baseOptions = fmt.Sprintf(`url=%s/%s autoinstall ds=nocloud-net;s=%s nameserver=%s`,
+				bootURL, configFile, NoCloudSeedURL(bootURL), dns)
+		case "debian", "Debian":
+			baseOptions = fmt.Sprintf(`url=%s/%s auto=true priority=critical nameserver=%s`,
+				bootURL, configFile, dns)
+		case "redhat", "Redhat", "centos", "CentOS", "fedora", "Fedora":
+			baseOptions = fmt.Sprintf(`ks=%s/%s nameserver=%s`,
+				bootURL, configFile, dns)
+		case "opensuse", "openSUSE", "suse", "SUSE":
+			baseOptions = fmt.Sprintf(`autoyast=%s/%s nameserver=%s`,
+				bootURL, configFile, dns)
+		default:
+			baseOptions = ""
+		}
+	}
+
+	// Add artifact arguments, then additional kernel options if provided
+	var options []string
+	for _, opts := range []string{artifactArgs, baseOptions, kernelOptions} {
+		if opts != "" {
+			options = append(options, opts)
+		}
+	}
+	return strings.Join(options, " ")
+}
+
+// osToName maps the OS name to a standardized name used in file paths.
+func (b *Builder) osToName(os string) string {
+	switch os {
+	case "ubuntu", "Ubuntu":
+		return "ubuntu"
+	case "debian", "Debian":
+		return "debian"
+	case "fedora", "Fedora":
+		return "fedora"
+	case "centos", "CentOS":
+		return "centos"
+	case "opensuse", "openSUSE":
+		return "opensuse"
+	case "nixos", "NixOS":
+		return "nixos"
+	case "redhat", "Redhat":
+		return "redhat"
+	case "fcos", "FCOS":
+		return "fcos"
+	case "flatcar", "Flatcar":
+		return "flatcar"
+	}
+	return strings.ToLower(os)
+}
+
+// findImage returns the image for the OS and version, falling back to the default version.
+func (b *Builder) findImage(ctx context.Context, os, version string) *osimage.OSImage {
+	if b.osImageService == nil {
+		return nil
+	}
+
+	// If a specific version is requested, try to find that exact version
+	if version != "" {
+		if allImages, err := b.osImageService.GetAllOSImages(ctx); err == nil {
+			for _, image := range allImages {
+				if image.OS == os && image.Version == version {
+					return image
+				}
+			}
+		}
+	}
+
+	// Fallback to default version
+	if image, err := b.osImageService.GetDefaultVersion(ctx, os); err == nil {
+		return image
+	}
+	return nil
+}
+
+// osToKernel returns the kernel path of image, falling back to the legacy path
+// structure when the OS has no downloaded image.
+func (b *Builder) osToKernel(image *osimage.OSImage, os string) string {
+	if image != nil {
+		if kernel := image.Path(config.RoleKernel); kernel != "" {
+			return kernel
+		}
+	}
+
+	// Final fallback to legacy path structure
+	return fmt.Sprintf("%s/vmlinuz", b.osToName(os))
+}
+
+// osToInitrds returns the initrd paths of image in load order, falling back to
+// the legacy path structure when the OS has no downloaded image.
+func (b *Builder) osToInitrds(image *osimage.OSImage, os string) []string {
+	if image != nil {
+		if initrds := image.Paths(config.RoleInitrd); len(initrds) > 0 {
+			return initrds
+		}
+	}
+
+	// Final fallback to legacy path structure
+	return []string{fmt.Sprintf("%s/initrd.img", b.osToName(os))}
+}
@@ -0,0 +1,549 @@
+package bootmenu
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ignite/config"
+	"ignite/dhcp"
+	"ignite/osimage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockServerService is a mock implementation of dhcp.ServerService
+type MockServerService struct {
+	mock.Mock
+}
+
+func (m *MockServerService) CreateServer(ctx context.Context, config dhcp.ServerConfig) (*dhcp.Server, error) {
+	args := m.Called(ctx, config)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*dhcp.Server), args.Error(1)
+}
+
+func (m *MockServerService) UpdateServer(ctx context.Context, serverID string, config dhcp.ServerConfig) error {
+	return m.Called(ctx, serverID, config).Error(0)
+}
+
+func (m *MockServerService) MigrateServer(ctx context.Context, serverID string, req dhcp.MigrationRequest) (*dhcp.MigrationResult, error) {
+	args := m.Called(ctx, serverID, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*dhcp.MigrationResult), args.Error(1)
+}
+
+func (m *MockServerService) StartServer(ctx context.Context, serverID string) error {
+	return m.Called(ctx, serverID).Error(0)
+}
+
+func (m *MockServerService) StopServer(ctx context.Context, serverID string) error {
+	return m.Called(ctx, serverID).Error(0)
+}
+
+func (m *MockServerService) DeleteServer(ctx context.Context, serverID string) error {
+	return m.Called(ctx, serverID).Error(0)
+}
+
+func (m *MockServerService) GetServer(ctx context.Context, serverID string) (*dhcp.Server, error) {
+	args := m.Called(ctx, serverID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*dhcp.Server), args.Error(1)
+}
+
+func (m *MockServerService) GetAllServers(ctx context.Context) ([]*dhcp.Server, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*dhcp.Server), args.Error(1)
+}
+
+// MockLeaseService is a mock implementation of dhcp.LeaseService
+type MockLeaseService struct {
+	mock.Mock
+}
+
+func (m *MockLeaseService) AssignLease(ctx context.Context, serverID string, mac string, requestedIP net.IP) (*dhcp.Lease, error) {
+	args := m.Called(ctx, serverID, mac, requestedIP)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*dhcp.Lease), args.Error(1)
+}
+
+func (m *MockLeaseService) ReleaseLease(ctx context.Context, mac string) error {
+	return m.Called(ctx, mac).Error(0)
+}
+
+func (m *MockLeaseService) ReserveLease(ctx context.Context, serverID string, mac string, ip net.IP) error {
+	return m.Called(ctx, serverID, mac, ip).Error(0)
+}
+
+func (m *MockLeaseService) UnreserveLease(ctx context.Context, mac string) error {
+	return m.Called(ctx, mac).Error(0)
+}
+
+func (m *MockLeaseService) GetLeaseByMAC(ctx context.Context, mac string) (*dhcp.Lease, error) {
+	args := m.Called(ctx, mac)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*dhcp.Lease), args.Error(1)
+}
+
+func (m *MockLeaseService) GetLeaseByIP(ctx context.Context, ip net.IP) (*dhcp.Lease, error) {
+	args := m.Called(ctx, ip)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*dhcp.Lease), args.Error(1)
+}
+
+func (m *MockLeaseService) GetLeasesByServer(ctx context.Context, serverID string) ([]*dhcp.Lease, error) {
+	args := m.Called(ctx, serverID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*dhcp.Lease), args.Error(1)
+}
+
+func (m *MockLeaseService) CleanupExpiredLeases(ctx context.Context) error {
+	return m.Called(ctx).Error(0)
+}
+
+func (m *MockLeaseService) UpdateLease(ctx context.Context, lease *dhcp.Lease) error {
+	return m.Called(ctx, lease).Error(0)
+}
+
+func (m *MockLeaseService) UpdateLeaseState(ctx context.Context, mac string, newState string, source string) error {
+	return m.Called(ctx, mac, newState, source).Error(0)
+}
+
+func (m *MockLeaseService) RecordHeartbeat(ctx context.Context, mac string) error {
+	return m.Called(ctx, mac).Error(0)
+}
+
+func (m *MockLeaseService) GetLeaseStateHistory(ctx context.Context, mac string) ([]dhcp.StateTransition, error) {
+	args := m.Called(ctx, mac)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]dhcp.StateTransition), args.Error(1)
+}
+
+func (m *MockLeaseService) GetLeasesByState(ctx context.Context, state string) ([]*dhcp.Lease, error) {
+	args := m.Called(ctx, state)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*dhcp.Lease), args.Error(1)
+}
+
+func (m *MockLeaseService) MarkOfflineLeases(ctx context.Context, offlineThreshold time.Duration) error {
+	return m.Called(ctx, offlineThreshold).Error(0)
+}
+
+func newTestRenderer(t *testing.T) (*Renderer, *MockServerService, *MockLeaseService) {
+	t.Helper()
+
+	templateDir := t.TempDir()
+	templates := map[string]string{
+		PXELinuxTemplate: "default {{.Name}}\nKERNEL {{.Kernel}}\nAPPEND initrd={{.Initrd}} {{.Options}}\n",
+		GRUBTemplate:     "menuentry \"{{.Name}}\" {\n  linux /{{.Kernel}} {{.Options}}\n}\n",
+		IPXETemplate:     "#!ipxe\nkernel {{.Kernel}} {{.Options}}\n",
+	}
+	for name, content := range templates {
+		require.NoError(t, os.WriteFile(filepath.Join(templateDir, name), []byte(content), 0644))
+	}
+
+	servers := new(MockServerService)
+	leases := new(MockLeaseService)
+	return NewRenderer(templateDir, servers, leases, nil), servers, leases
+}
+
+func testServer() *dhcp.Server {
+	return &dhcp.Server{
+		ID: "server-1",
+		IP: net.ParseIP("192.168.1.2"),
+		Options: dhcp.DHCPOptions{
+			SubnetMask: net.ParseIP("255.255.255.0"),
+		},
+	}
+}
+
+func testLease() *dhcp.Lease {
+	return &dhcp.Lease{
+		MAC:      "aa:bb:cc:dd:ee:ff",
+		IP:       net.ParseIP("192.168.1.100"),
+		ServerID: "server-1",
+		Expiry:   time.Now().Add(time.Hour),
+		Menu: dhcp.BootMenu{
+			OS:            "ubuntu",
+			Version:       "22.04",
+			TemplateType:  "kickstart",
+			Hostname:      "node1",
+			DNS:           net.ParseIP("8.8.8.8"),
+			KernelOptions: "console=ttyS0",
+		},
+	}
+}
+
+func TestRenderer_PXELinuxByMAC(t *testing.T) {
+	renderer, servers, leases := newTestRenderer(t)
+	leases.On("GetLeaseByMAC", mock.Anything, "aa:bb:cc:dd:ee:ff").Return(testLease(), nil)
+	servers.On("GetServer", mock.Anything, "server-1").Return(testServer(), nil)
+
+	data, err := renderer.Render("boot-bios/pxelinux.cfg/01-AA-BB-CC-DD-EE-FF", nil)
+	require.NoError(t, err)
+
+	content := string(data)
+	assert.Contains(t, content, "default ubuntu")
+	assert.Contains(t, content, "KERNEL ubuntu/vmlinuz")
+	assert.Contains(t, content, "ks=http://192.168.1.2/boot/configs/kickstart/aa-bb-cc-dd-ee-ff nameserver=8.8.8.8 console=ttyS0")
+}
+
+func TestRenderer_GRUBByHexIP(t *testing.T) {
+	renderer, servers, leases := newTestRenderer(t)
+	servers.On("GetServer", mock.Anything, "server-1").Return(testServer(), nil)
+	leases.On("GetLeaseByIP", mock.Anything, net.ParseIP("192.168.1.100")).Return(testLease(), nil)
+
+	data, err := renderer.Render("grub/grub.cfg-C0A80164", nil)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "menuentry \"ubuntu\""))
+}
+
+func TestRenderer_GRUBEscapesOptions(t *testing.T) {
+	renderer, servers, leases := newTestRenderer(t)
+	grub, err := os.ReadFile("../public/provision/templates/bootmenu/grub.templ")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(renderer.templateDir, GRUBTemplate), grub, 0644))
+	lease := testLease()
+	lease.Menu.TemplateType = "autoinstall"
+	servers.On("GetServer", mock.Anything, "server-1").Return(testServer(), nil)
+	leases.On("GetLeaseByIP", mock.Anything, net.ParseIP("192.168.1.100")).Return(lease, nil)
+	leases.On("GetLeaseByMAC", mock.Anything, "aa:bb:cc:dd:ee:ff").Return(lease, nil)
+
+	// GRUB would otherwise end the linux command at the ;
+	data, err := renderer.Render("grub/grub.cfg-C0A80164", nil)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `autoinstall ds=nocloud-net\;s=http://192.168.1.2/boot/nocloud/ nameserver=8.8.8.8`)
+
+	// Other boot loaders take the option as is
+	data, err = renderer.Render("boot-bios/pxelinux.cfg/01-aa-bb-cc-dd-ee-ff", nil)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "ds=nocloud-net;s=")
+}
+
+func TestRenderer_IPXEByClientIP(t *testing.T) {
+	renderer, servers, leases := newTestRenderer(t)
+	servers.On("GetServer", mock.Anything, "server-1").Return(testServer(), nil)
+	leases.On("GetLeaseByIP", mock.Anything, net.ParseIP("192.168.1.100")).Return(testLease(), nil)
+	leases.On("GetLeaseByIP", mock.Anything, net.ParseIP("10.0.0.5")).Return(nil, errors.New("lease not found"))
+
+	data, err := renderer.Render("boot.ipxe", net.ParseIP("192.168.1.100"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "kernel ubuntu/vmlinuz")
+
+	// Hosts without a lease get the boot.ipxe on disk
+	_, err = renderer.Render("boot.ipxe", net.ParseIP("10.0.0.5"))
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+}
+
+func TestRenderer_FallsBackToDisk(t *testing.T) {
+	renderer, _, leases := newTestRenderer(t)
+	noMenu := testLease()
+	noMenu.Menu = dhcp.BootMenu{}
+	leases.On("GetLeaseByMAC", mock.Anything, "aa:bb:cc:dd:ee:ff").Return(noMenu, nil)
+	leases.On("GetLeaseByMAC", mock.Anything, "11:22:33:44:55:66").Return(nil, errors.New("lease not found"))
+
+	for _, filename := range []string{
+		"pxelinux.cfg/01-aa-bb-cc-dd-ee-ff",
+		"pxelinux.cfg/01-11-22-33-44-55-66",
+		"pxelinux.cfg/default",
+		"pxelinux.cfg/01-not-a-mac",
+		"grub.cfg-zz",
+		"pxelinux.0",
+	} {
+		_, err := renderer.Render(filename, nil)
+		assert.Truef(t, errors.Is(err, fs.ErrNotExist), "Render(%s) = %v, expected fs.ErrNotExist", filename, err)
+	}
+}
+
+func TestBootURL(t *testing.T) {
+	assert.Equal(t, "http://10.0.0.1/boot", BootURL("10.0.0.1", ""))
+	assert.Equal(t, "http://10.0.0.1/boot", BootURL("10.0.0.1", "80"))
+	assert.Equal(t, "http://10.0.0.1:8080/boot", BootURL("10.0.0.1", "8080"))
+}
+
+func newTestConfigRenderer(t *testing.T) (*ConfigRenderer, *MockServerService, *MockLeaseService) {
+	t.Helper()
+
+	templateDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(templateDir, "kickstart"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(templateDir, "kickstart", "default.templ"),
+		[]byte("network --ip={{ .ip }} --hostname={{ .hostname }} --nameserver={{ .dns }}\n%post\necho 'done' && curl -d token={{ .token }} '{{ .phone_home }}'\n"), 0644))
+
+	servers := new(MockServerService)
+	leases := new(MockLeaseService)
+	return NewConfigRenderer(templateDir, servers, leases).SetHTTPPort("8080"), servers, leases
+}
+
+func TestConfigRenderer_RendersCurrentLease(t *testing.T) {
+	renderer, servers, leases := newTestConfigRenderer(t)
+	lease := testLease()
+	lease.Menu.TemplateName = "default.templ"
+	lease.Menu.IP = net.ParseIP("192.168.1.100")
+	lease.Token = "secret"
+	servers.On("GetServer", mock.Anything, "server-1").Return(testServer(), nil)
+	leases.On("GetLeaseByMAC", mock.Anything, "aa:bb:cc:dd:ee:ff").Return(lease, nil)
+
+	data, got, err := renderer.Render(context.Background(), "kickstart", "aa-bb-cc-dd-ee-ff", lease.IP)
+	require.NoError(t, err)
+	assert.Equal(t, lease, got)
+	// Configs are not HTML, so nothing is escaped
+	assert.Equal(t, "network --ip=192.168.1.100 --hostname=node1 --nameserver=8.8.8.8\n%post\necho 'done' && curl -d token=secret 'http://192.168.1.2:8080/boot/phone-home?mac=aa%3Abb%3Acc%3Add%3Aee%3Aff'\n", string(data))
+
+	// Edits to the lease reach the next fetch
+	lease.Menu.Hostname = "node2"
+	data, _, err = renderer.Render(context.Background(), "kickstart", "aa:bb:cc:dd:ee:ff", lease.IP)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "--hostname=node2")
+}
+
+func TestConfigRenderer_GeneratesToken(t *testing.T) {
+	renderer, servers, leases := newTestConfigRenderer(t)
+	lease := testLease()
+	lease.Menu.TemplateName = "default.templ"
+	servers.On("GetServer", mock.Anything, "server-1").Return(testServer(), nil)
+	leases.On("GetLeaseByMAC", mock.Anything, "aa:bb:cc:dd:ee:ff").Return(lease, nil)
+	leases.On("UpdateLease", mock.Anything, lease).Return(nil).Once()
+
+	data, _, err := renderer.Render(context.Background(), "kickstart", "aa-bb-cc-dd-ee-ff", lease.IP)
+	require.NoError(t, err)
+	require.NotEmpty(t, lease.Token)
+	assert.Contains(t, string(data), "token="+lease.Token)
+
+	// The token is kept on later fetches
+	token := lease.Token
+	_, _, err = renderer.Render(context.Background(), "kickstart", "aa-bb-cc-dd-ee-ff", lease.IP)
+	require.NoError(t, err)
+	assert.Equal(t, token, lease.Token)
+	leases.AssertExpectations(t)
+}
+
+func TestConfigRenderer_TokenOnlyForLeasedIP(t *testing.T) {
+	renderer, servers, leases := newTestConfigRenderer(t)
+	lease := testLease()
+	lease.Menu.TemplateName = "default.templ"
+	servers.On("GetServer", mock.Anything, "server-1").Return(testServer(), nil)
+	leases.On("GetLeaseByMAC", mock.Anything, "aa:bb:cc:dd:ee:ff").Return(lease, nil)
+
+	// Fetches from elsewhere neither issue a token nor see one
+	for _, clientIP := range []net.IP{nil, net.ParseIP("192.168.1.200")} {
+		data, _, err := renderer.Render(context.Background(), "kickstart", "aa-bb-cc-dd-ee-ff", clientIP)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "curl -d token= ")
+		assert.Empty(t, lease.Token)
+	}
+
+	lease.Token = "secret"
+	data, _, err := renderer.Render(context.Background(), "kickstart", "aa-bb-cc-dd-ee-ff", net.ParseIP("192.168.1.200"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "secret")
+
+	// Once the lease expires its address may belong to another host
+	lease.Expiry = time.Now().Add(-time.Hour)
+	data, _, err = renderer.Render(context.Background(), "kickstart", "aa-bb-cc-dd-ee-ff", lease.IP)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "secret")
+	leases.AssertNotCalled(t, "UpdateLease", mock.Anything, mock.Anything)
+}
+
+func TestConfigRenderer_NoConfig(t *testing.T) {
+	renderer, _, leases := newTestConfigRenderer(t)
+	traversal := testLease()
+	traversal.MAC = "11:22:33:44:55:66"
+	traversal.Menu.TemplateName = "../../../etc/passwd"
+	leases.On("GetLeaseByMAC", mock.Anything, "aa:bb:cc:dd:ee:ff").Return(testLease(), nil)
+	leases.On("GetLeaseByMAC", mock.Anything, "11:22:33:44:55:66").Return(traversal, nil)
+	leases.On("GetLeaseByMAC", mock.Anything, mock.Anything).Return(nil, errors.New("lease not found"))
+
+	for _, tt := range []struct{ templateType, mac string }{
+		{"preseed", "aa-bb-cc-dd-ee-ff"},
+		{"kickstart", "aa-bb-cc-dd-ee-ff"}, // no template name selected
+		{"kickstart", "11-22-33-44-55-66"},
+		{"kickstart", "66-55-44-33-22-11"},
+		{"kickstart", "not-a-mac"},
+	} {
+		_, _, err := renderer.Render(context.Background(), tt.templateType, tt.mac, nil)
+		assert.Truef(t, errors.Is(err, fs.ErrNotExist), "Render(%s, %s) = %v, expected fs.ErrNotExist", tt.templateType, tt.mac, err)
+	}
+}
+
+func TestConfigRenderer_RendersIgnition(t *testing.T) {
+	renderer, servers, _ := newTestConfigRenderer(t)
+	butane, err := os.ReadFile("../public/provision/templates/ignition/default.templ")
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(renderer.templateDir, "ignition"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(renderer.templateDir, "ignition", "default.templ"), butane, 0644))
+	servers.On("GetServer", mock.Anything, "server-1").Return(testServer(), nil)
+
+	lease := testLease()
+	lease.Menu.OS = "fcos"
+	lease.Menu.TemplateType = "ignition"
+	lease.Menu.TemplateName = "default.templ"
+	lease.Menu.IP = net.ParseIP("192.168.1.100")
+	lease.Menu.Subnet = net.ParseIP("255.255.255.0")
+	lease.Token = "secret"
+
+	// The shipped Butane template is translated to a valid Ignition config
+	data, err := renderer.RenderLease(context.Background(), lease, lease.IP)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"version":"3.4.0"`)
+	assert.Contains(t, string(data), `"name":"ignite-phone-home.service"`)
+	assert.Equal(t, "application/vnd.coreos.ignition+json", ConfigContentType("ignition"))
+}
+
+func TestConfigRenderer_RendersAutoinstall(t *testing.T) {
+	renderer, servers, _ := newTestConfigRenderer(t)
+	userData, err := os.ReadFile("../public/provision/templates/autoinstall/default.templ")
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(renderer.templateDir, "autoinstall"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(renderer.templateDir, "autoinstall", "default.templ"), userData, 0644))
+	servers.On("GetServer", mock.Anything, "server-1").Return(testServer(), nil)
+
+	lease := testLease()
+	lease.Menu.TemplateType = "autoinstall"
+	lease.Menu.TemplateName = "default.templ"
+	lease.Menu.IP = net.ParseIP("192.168.1.100")
+	lease.Menu.Subnet = net.ParseIP("255.255.255.0")
+	lease.Menu.Gateway = net.ParseIP("192.168.1.1")
+	lease.Menu.Autoinstall = &dhcp.AutoinstallSettings{StorageLayout: "direct", AuthorizedKeys: []string{"ssh-ed25519 AAAA admin"}}
+	lease.Token = "secret"
+
+	// The shipped template validates, with the boot menu's settings merged in
+	data, err := renderer.RenderLease(context.Background(), lease, lease.IP)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "#cloud-config\nautoinstall:\n"))
+	assert.Contains(t, string(data), "name: direct")
+	assert.Contains(t, string(data), "ssh-ed25519 AAAA admin")
+	assert.Contains(t, string(data), "192.168.1.100/24")
+
+	options := BootOptions("ubuntu", "autoinstall", "8.8.8.8", "http://192.168.1.2/boot", "configs/autoinstall/aa-bb-cc-dd-ee-ff", "", "", "")
+	assert.Contains(t, options, "autoinstall ds=nocloud-net;s=http://192.168.1.2/boot/nocloud/")
+}
+
+func TestBootOptions_Ignition(t *testing.T) {
+	bootURL := "http://192.168.1.2/boot"
+
+	fcos := BootOptions("fcos", "ignition", "8.8.8.8", bootURL, "configs/ignition/aa-bb-cc-dd-ee-ff", "coreos.live.rootfs_url=http://192.168.1.2/boot/fcos/41/rootfs.img", "/dev/nvme0n1", "")
+	assert.True(t, strings.HasPrefix(fcos, "coreos.live.rootfs_url=http://192.168.1.2/boot/fcos/41/rootfs.img "))
+	assert.Contains(t, fcos, "coreos.inst.ignition_url=http://192.168.1.2/boot/configs/ignition/aa-bb-cc-dd-ee-ff")
+	assert.Contains(t, fcos, "coreos.inst.install_dev=/dev/nvme0n1 ")
+
+	// Without an install device nothing is written to disk
+	live := BootOptions("fcos", "ignition", "8.8.8.8", bootURL, "configs/ignition/aa-bb-cc-dd-ee-ff", "", "", "")
+	assert.Contains(t, live, "ignition.config.url=http://192.168.1.2/boot/configs/ignition/aa-bb-cc-dd-ee-ff")
+	assert.NotContains(t, live, "coreos.inst.")
+
+	flatcar := BootOptions("flatcar", "ignition", "8.8.8.8", bootURL, "configs/ignition/aa-bb-cc-dd-ee-ff", "", "", "console=ttyS0")
+	assert.Contains(t, flatcar, "ignition.config.url=http://192.168.1.2/boot/configs/ignition/aa-bb-cc-dd-ee-ff")
+	assert.True(t, strings.HasSuffix(flatcar, " console=ttyS0"))
+}
+
+// stubOSImages is an OS image service with a single default image
+type stubOSImages struct {
+	osimage.OSImageService
+	image *osimage.OSImage
+}
+
+func (s stubOSImages) GetDefaultVersion(ctx context.Context, os string) (*osimage.OSImage, error) {
+	return s.image, nil
+}
+
+func TestBuilder_ImageArtifacts(t *testing.T) {
+	image := &osimage.OSImage{
+		OS:      "centos",
+		Version: "9",
+		Artifacts: []osimage.ImageArtifact{
+			{Role: config.RoleKernel, Path: "centos/9/vmlinuz"},
+			{Role: config.RoleInitrd, Path: "centos/9/initrd.img"},
+			{Role: config.RoleInitrd, Path: "centos/9/microcode.img"},
+			{Role: config.RoleStage2, Path: "centos/9/install.img"},
+		},
+	}
+	builder := NewBuilder(stubOSImages{image: image})
+
+	data := builder.Build(context.Background(), dhcp.BootMenu{OS: "centos", TemplateType: "kickstart"}, "aa:bb:cc:dd:ee:ff", "192.168.1.2")
+	assert.Equal(t, "centos/9/vmlinuz", data.Kernel)
+	assert.Equal(t, "centos/9/initrd.img", data.Initrd)
+	assert.Equal(t, "centos/9/initrd.img,centos/9/microcode.img", data.InitrdList(","))
+	assert.True(t, strings.HasPrefix(data.Options, "inst.stage2=http://192.168.1.2/boot/centos/9/install.img ks="))
+}
+
+func TestConfigRenderer_RecordFetch(t *testing.T) {
+	renderer, _, leases := newTestConfigRenderer(t)
+	leases.On("UpdateLease", mock.Anything, mock.Anything).Return(nil)
+
+	lease := testLease()
+	lease.State = dhcp.StateBooting
+	require.NoError(t, renderer.RecordFetch(context.Background(), lease, net.ParseIP("192.168.1.50")))
+	assert.Equal(t, dhcp.StateBooting, lease.State, "fetches from other addresses must not advance the lease")
+	assert.False(t, lease.ConfigFetchedAt.IsZero())
+
+	require.NoError(t, renderer.RecordFetch(context.Background(), lease, lease.IP))
+	assert.Equal(t, dhcp.StateImaging, lease.State)
+
+	lease.State = dhcp.StateComplete
+	require.NoError(t, renderer.RecordFetch(context.Background(), lease, lease.IP))
+	assert.Equal(t, dhcp.StateComplete, lease.State)
+	leases.AssertNumberOfCalls(t, "UpdateLease", 3)
+}
+
+func TestNoCloudMetaData(t *testing.T) {
+	lease := testLease()
+	lease.Token = "0123456789abcdef"
+
+	assert.Equal(t, "instance-id: \"ignite-aa-bb-cc-dd-ee-ff-9f9f5111\"\nlocal-hostname: \"node1\"\nhostname: \"node1\"\n", string(MetaData(lease)))
+	assert.NotContains(t, string(MetaData(lease)), lease.Token[:8], "meta-data must not reveal the token")
+}
+
+func TestNoCloudNetworkConfig(t *testing.T) {
+	lease := testLease()
+	lease.Menu.IP = net.ParseIP("192.168.1.100")
+	lease.Menu.Subnet = net.ParseIP("255.255.255.0")
+	lease.Menu.Gateway = net.ParseIP("192.168.1.1")
+
+	assert.Equal(t, `version: 2
+ethernets:
+  primary:
+    match:
+      macaddress: "aa:bb:cc:dd:ee:ff"
+    dhcp4: false
+    addresses: ["192.168.1.100/24"]
+    routes:
+      - to: default
+        via: "192.168.1.1"
+    nameservers:
+      addresses: ["8.8.8.8"]
+`, string(NetworkConfig(lease)))
+
+	// Without a static address the interface uses DHCP
+	lease.Menu.IP = nil
+	assert.Contains(t, string(NetworkConfig(lease)), "dhcp4: true")
+}
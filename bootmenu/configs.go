@@ -0,0 +1,200 @@
+package bootmenu
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"ignite/autoinstall"
+	"ignite/dhcp"
+	"ignite/ignition"
+	"io/fs"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+// configFetchSource is recorded on lease state transitions caused by config fetches
+const configFetchSource = "config"
+
+// ConfigRenderer renders provisioning configs such as kickstart, cloud-init
+// and preseed files from the template selected on a lease at request time, so
+// edits to the template or lease reach the next install.
+type ConfigRenderer struct {
+	templateDir   string
+	httpPort      string
+	serverService dhcp.ServerService
+	leaseService  dhcp.LeaseService
+}
+
+// NewConfigRenderer creates a ConfigRenderer reading templates from
+// templateDir/<type>/<name>
+func NewConfigRenderer(templateDir string, serverService dhcp.ServerService, leaseService dhcp.LeaseService) *ConfigRenderer {
+	return &ConfigRenderer{
+		templateDir:   templateDir,
+		serverService: serverService,
+		leaseService:  leaseService,
+	}
+}
+
+// SetHTTPPort sets the port of the HTTP boot tree that rendered configs
+// phone home to
+func (c *ConfigRenderer) SetHTTPPort(port string) *ConfigRenderer {
+	c.httpPort = port
+	return c
+}
+
+// PhoneHomeURL returns the URL installers report progress to
+func PhoneHomeURL(bootURL, mac string) string {
+	return bootURL + "/phone-home?" + url.Values{"mac": {mac}}.Encode()
+}
+
+// ConfigData returns the values provisioning templates are rendered with
+func ConfigData(lease *dhcp.Lease, serverIP string) map[string]string {
+	menu := lease.Menu
+	return map[string]string{
+		"tftpip":         serverIP,
+		"mac":            lease.MAC,
+		"os":             menu.OS,
+		"version":        menu.Version,
+		"typeSelect":     menu.TemplateType,
+		"template_name":  menu.TemplateName,
+		"hostname":       menu.Hostname,
+		"ip":             ipString(menu.IP),
+		"subnet":         ipString(menu.Subnet),
+		"prefix":         strconv.Itoa(prefixLength(menu.Subnet)),
+		"gateway":        ipString(menu.Gateway),
+		"dns":            ipString(menu.DNS),
+		"kernel_options": menu.KernelOptions,
+		"token":          lease.Token,
+	}
+}
+
+// ConfigContentType returns the content type installers expect for a config
+func ConfigContentType(templateType string) string {
+	switch templateType {
+	case "cloud-init", "autoinstall":
+		return "text/cloud-config; charset=utf-8"
+	case "autoyast":
+		return "application/xml; charset=utf-8"
+	case "ignition":
+		return ignition.ContentType
+	default:
+		return "text/plain; charset=utf-8"
+	}
+}
+
+// Render renders the config of templateType for the host with mac, written
+// either as aa:bb:cc:dd:ee:ff or as in config file names, as fetched by
+// clientIP. It returns the lease it was rendered for, or an error wrapping
+// fs.ErrNotExist if the host has no template of that type selected.
+func (c *ConfigRenderer) Render(ctx context.Context, templateType, mac string, clientIP net.IP) ([]byte, *dhcp.Lease, error) {
+	hw, ok := parsePXEMAC(mac)
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid MAC %q: %w", mac, fs.ErrNotExist)
+	}
+	lease, err := c.leaseService.GetLeaseByMAC(ctx, hw)
+	if err != nil {
+		return nil, nil, notExist(err)
+	}
+	if lease.Menu.TemplateType != templateType {
+		return nil, nil, fmt.Errorf("no %s config for %s: %w", templateType, mac, fs.ErrNotExist)
+	}
+	data, err := c.RenderLease(ctx, lease, clientIP)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, lease, nil
+}
+
+// RenderLease renders the template selected on lease for clientIP, or returns
+// an error wrapping fs.ErrNotExist if it has none. Configs are served without
+// logging in, so the phone-home token is only rendered for the IP the host was
+// leased; anyone else gets the config with an empty token.
+func (c *ConfigRenderer) RenderLease(ctx context.Context, lease *dhcp.Lease, clientIP net.IP) ([]byte, error) {
+	menu := lease.Menu
+	if menu.TemplateType == "" || menu.TemplateName == "" {
+		return nil, fmt.Errorf("no config for %s: %w", lease.MAC, fs.ErrNotExist)
+	}
+	if !safeName(menu.TemplateType) || !safeName(menu.TemplateName) {
+		return nil, fmt.Errorf("invalid template %s/%s: %w", menu.TemplateType, menu.TemplateName, fs.ErrNotExist)
+	}
+
+	// Hosts armed before tokens existed get one on their first fetch
+	leased := lease.Holds(clientIP)
+	if leased && lease.Token == "" {
+		var err error
+		if lease.Token, err = dhcp.NewToken(); err != nil {
+			return nil, err
+		}
+		if err := c.leaseService.UpdateLease(ctx, lease); err != nil {
+			return nil, fmt.Errorf("failed to save phone-home token for %s: %w", lease.MAC, err)
+		}
+	}
+
+	serverIP := ""
+	if server, err := c.serverService.GetServer(ctx, lease.ServerID); err == nil && server.IP != nil {
+		serverIP = server.IP.String()
+	}
+
+	tmpl, err := template.ParseFiles(filepath.Join(c.templateDir, menu.TemplateType, menu.TemplateName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s template: %w", menu.TemplateType, err)
+	}
+
+	data := ConfigData(lease, serverIP)
+	data["phone_home"] = PhoneHomeURL(BootURL(serverIP, c.httpPort), lease.MAC)
+	if !leased {
+		data["token"] = ""
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to execute %s template: %w", menu.TemplateType, err)
+	}
+
+	// Ignition templates may be written in Butane and are translated, and
+	// always validated, since Ignition fails the boot on a bad config
+	switch menu.TemplateType {
+	case "ignition":
+		return ignition.Render(buf.Bytes())
+	case "autoinstall":
+		// The boot menu's structured settings are merged in before validating
+		return autoinstall.Render(buf.Bytes(), menu.Hostname, menu.Autoinstall)
+	}
+	return buf.Bytes(), nil
+}
+
+// RecordFetch notes on the lease that its config was fetched by clientIP. A
+// fetch from the host's own leased IP moves it to imaging unless it is already
+// further along; fetches from anywhere else leave its state alone.
+func (c *ConfigRenderer) RecordFetch(ctx context.Context, lease *dhcp.Lease, clientIP net.IP) error {
+	lease.ConfigFetchedAt = time.Now()
+	if lease.Holds(clientIP) {
+		switch lease.State {
+		case dhcp.StateImaging, dhcp.StateImaged, dhcp.StateConfiguring, dhcp.StateComplete:
+			lease.LastSeen = lease.ConfigFetchedAt
+		default:
+			lease.UpdateState(dhcp.StateImaging, configFetchSource)
+		}
+	}
+
+	if err := c.leaseService.UpdateLease(ctx, lease); err != nil {
+		return fmt.Errorf("failed to record config fetch for %s: %w", lease.MAC, err)
+	}
+	return nil
+}
+
+// safeName reports whether name is a single path element
+func safeName(name string) bool {
+	return name != "" && name != "." && name != ".." && filepath.Base(name) == name
+}
+
+// ipString formats ip, or returns an empty string if it is unset
+func ipString(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
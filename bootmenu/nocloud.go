@@ -0,0 +1,106 @@
+package bootmenu
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"ignite/dhcp"
+	"net"
+)
+
+// NoCloud datasource files, as cloud-init requests them from the seed URL
+const (
+	NoCloudUserData      = "user-data"
+	NoCloudMetaData      = "meta-data"
+	NoCloudVendorData    = "vendor-data"
+	NoCloudNetworkConfig = "network-config"
+)
+
+// NoCloudPath is where the NoCloud datasource is served in the HTTP boot tree
+const NoCloudPath = "nocloud"
+
+// NoCloudSeedURL returns the seed URL passed to cloud-init as ds=nocloud-net;s=<url>
+func NoCloudSeedURL(bootURL string) string {
+	return bootURL + "/" + NoCloudPath + "/"
+}
+
+// DefaultUserData is served to hosts that have no cloud-init template selected
+func DefaultUserData(lease *dhcp.Lease) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("#cloud-config\n")
+	if lease.Menu.Hostname != "" {
+		fmt.Fprintf(&buf, "hostname: %s\n", yamlString(lease.Menu.Hostname))
+	}
+	return buf.Bytes()
+}
+
+// MetaData returns NoCloud meta-data for a lease. The instance ID changes
+// each time the host is armed, so cloud-init runs again after a reinstall. It
+// is derived from a hash of the phone-home token, since meta-data is served to
+// anyone who knows the host's MAC.
+func MetaData(lease *dhcp.Lease) []byte {
+	instanceID := "ignite-" + MACFileName(lease.MAC)
+	if lease.Token != "" {
+		sum := sha256.Sum256([]byte(lease.Token))
+		instanceID += "-" + hex.EncodeToString(sum[:4])
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "instance-id: %s\n", yamlString(instanceID))
+	if lease.Menu.Hostname != "" {
+		fmt.Fprintf(&buf, "local-hostname: %s\n", yamlString(lease.Menu.Hostname))
+		fmt.Fprintf(&buf, "hostname: %s\n", yamlString(lease.Menu.Hostname))
+	}
+	return buf.Bytes()
+}
+
+// NetworkConfig returns network config version 2 for the interface with the
+// lease's MAC, using the static address on its boot menu or DHCP without one
+func NetworkConfig(lease *dhcp.Lease) []byte {
+	menu := lease.Menu
+
+	var buf bytes.Buffer
+	buf.WriteString("version: 2\n")
+	buf.WriteString("ethernets:\n")
+	buf.WriteString("  primary:\n")
+	buf.WriteString("    match:\n")
+	fmt.Fprintf(&buf, "      macaddress: %s\n", yamlString(lease.MAC))
+
+	ip := menu.IP.To4()
+	if ip == nil {
+		buf.WriteString("    dhcp4: true\n")
+		return buf.Bytes()
+	}
+
+	buf.WriteString("    dhcp4: false\n")
+	fmt.Fprintf(&buf, "    addresses: [%s]\n", yamlString(fmt.Sprintf("%s/%d", ip, prefixLength(menu.Subnet))))
+	if menu.Gateway != nil {
+		buf.WriteString("    routes:\n")
+		buf.WriteString("      - to: default\n")
+		fmt.Fprintf(&buf, "        via: %s\n", yamlString(menu.Gateway.String()))
+	}
+	if menu.DNS != nil {
+		buf.WriteString("    nameservers:\n")
+		fmt.Fprintf(&buf, "      addresses: [%s]\n", yamlString(menu.DNS.String()))
+	}
+	return buf.Bytes()
+}
+
+// prefixLength converts a dotted subnet mask to a prefix length, assuming a
+// /24 if the mask is missing or not contiguous
+func prefixLength(mask net.IP) int {
+	if mask4 := mask.To4(); mask4 != nil {
+		if ones, bits := net.IPMask(mask4).Size(); bits != 0 {
+			return ones
+		}
+	}
+	return 24
+}
+
+// yamlString quotes s as a YAML double-quoted scalar
+func yamlString(s string) string {
+	quoted, _ := json.Marshal(s)
+	return string(quoted)
+}
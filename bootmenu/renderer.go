@@ -0,0 +1,163 @@
+package bootmenu
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"ignite/dhcp"
+	"ignite/osimage"
+	"io/fs"
+	"net"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// Templates used to render each kind of boot file, relative to the template directory
+const (
+	PXELinuxTemplate = "default.templ"
+	GRUBTemplate     = "grub.templ"
+	IPXETemplate     = "ipxe.templ"
+)
+
+// grubEscaper escapes the characters GRUB reads as command separators or
+// redirections, such as the ; in ds=nocloud-net;s=, so kernel options reach
+// the kernel whole
+var grubEscaper = strings.NewReplacer(`;`, `\;`, `&`, `\&`, `|`, `\|`, `<`, `\<`, `>`, `\>`)
+
+// Renderer renders per-host boot files from lease boot menus at request time,
+// so they always match what is stored on the lease.
+type Renderer struct {
+	builder       *Builder
+	serverService dhcp.ServerService
+	leaseService  dhcp.LeaseService
+	templateDir   string
+}
+
+// NewRenderer creates a Renderer reading boot menu templates from templateDir
+func NewRenderer(templateDir string, serverService dhcp.ServerService, leaseService dhcp.LeaseService, osImageService osimage.OSImageService) *Renderer {
+	return &Renderer{
+		builder:       NewBuilder(osImageService),
+		serverService: serverService,
+		leaseService:  leaseService,
+		templateDir:   templateDir,
+	}
+}
+
+// SetHTTPPort sets the port of the HTTP boot tree that rendered menus point
+// installers at for their configs
+func (r *Renderer) SetHTTPPort(port string) *Renderer {
+	r.builder.httpPort = port
+	return r
+}
+
+// Render returns the boot file for filename as requested by clientIP. It
+// handles pxelinux.cfg/01-<mac>, grub.cfg-01-<mac>, grub.cfg-<hex ip> and
+// boot.ipxe, and returns an error wrapping fs.ErrNotExist for anything else or
+// for hosts without a boot menu.
+func (r *Renderer) Render(filename string, clientIP net.IP) ([]byte, error) {
+	ctx := context.Background()
+
+	lease, templateName, err := r.leaseForFile(ctx, filename, clientIP)
+	if err != nil {
+		return nil, err
+	}
+	if lease == nil || lease.Menu.OS == "" {
+		return nil, fmt.Errorf("no boot menu for %s: %w", filename, fs.ErrNotExist)
+	}
+	return r.RenderLease(ctx, lease, templateName)
+}
+
+// RenderLease renders templateName, one of the boot menu templates, for the
+// boot menu stored on lease
+func (r *Renderer) RenderLease(ctx context.Context, lease *dhcp.Lease, templateName string) ([]byte, error) {
+	serverIP := ""
+	if server, err := r.serverService.GetServer(ctx, lease.ServerID); err == nil && server.IP != nil {
+		serverIP = server.IP.String()
+	}
+
+	tmpl, err := template.ParseFiles(filepath.Join(r.templateDir, templateName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse boot menu template: %w", err)
+	}
+
+	data := r.builder.Build(ctx, lease.Menu, lease.MAC, serverIP)
+	if templateName == GRUBTemplate {
+		data.Options = grubEscaper.Replace(data.Options)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to execute boot menu template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// leaseForFile finds the lease a boot file name refers to and the template it is rendered from
+func (r *Renderer) leaseForFile(ctx context.Context, filename string, clientIP net.IP) (*dhcp.Lease, string, error) {
+	dir, base := path.Split(filename)
+
+	switch {
+	case path.Base(dir) == "pxelinux.cfg" && strings.HasPrefix(base, "01-"):
+		mac, ok := parsePXEMAC(strings.TrimPrefix(base, "01-"))
+		if !ok {
+			return nil, "", fs.ErrNotExist
+		}
+		lease, err := r.leaseService.GetLeaseByMAC(ctx, mac)
+		return lease, PXELinuxTemplate, notExist(err)
+
+	case strings.HasPrefix(base, "grub.cfg-"):
+		suffix := strings.TrimPrefix(base, "grub.cfg-")
+		if strings.HasPrefix(suffix, "01-") {
+			mac, ok := parsePXEMAC(strings.TrimPrefix(suffix, "01-"))
+			if !ok {
+				return nil, "", fs.ErrNotExist
+			}
+			lease, err := r.leaseService.GetLeaseByMAC(ctx, mac)
+			return lease, GRUBTemplate, notExist(err)
+		}
+		ip, ok := parseHexIP(suffix)
+		if !ok {
+			return nil, "", fs.ErrNotExist
+		}
+		lease, err := r.leaseService.GetLeaseByIP(ctx, ip)
+		return lease, GRUBTemplate, notExist(err)
+
+	case base == "boot.ipxe" && clientIP != nil:
+		lease, err := r.leaseService.GetLeaseByIP(ctx, clientIP)
+		return lease, IPXETemplate, notExist(err)
+	}
+
+	return nil, "", fs.ErrNotExist
+}
+
+// parsePXEMAC converts a dash separated MAC such as aa-bb-cc-dd-ee-ff to its canonical form
+func parsePXEMAC(s string) (string, bool) {
+	mac, err := net.ParseMAC(strings.ReplaceAll(s, "-", ":"))
+	if err != nil || len(mac) != 6 {
+		return "", false
+	}
+	return mac.String(), true
+}
+
+// parseHexIP parses an IPv4 address written as eight hex digits, as GRUB requests it
+func parseHexIP(s string) (net.IP, bool) {
+	if len(s) != 8 {
+		return nil, false
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, false
+	}
+	return net.IPv4(b[0], b[1], b[2], b[3]), true
+}
+
+// notExist reports lookup failures as missing files so disk files are tried instead
+func notExist(err error) error {
+	if err != nil {
+		return fmt.Errorf("%v: %w", err, fs.ErrNotExist)
+	}
+	return nil
+}
@@ -1,8 +1,17 @@
 package config
 
 import (
+	"crypto/ed25519"
+	"encoding/base64"
 	"fmt"
+	"log"
+	"net"
+	"net/url"
 	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Config represents the application configuration with immutable design
@@ -24,15 +33,44 @@ type DBConfig struct {
 type DHCPConfig struct {
 	BiosFile string
 	EFIFile  string
+
+	RogueScanInterval time.Duration // How often to probe for rogue DHCP servers, 0 disables
+	RogueScanTimeout  time.Duration // How long to wait for offers after each probe
+	RogueAlertWebhook string        // URL to POST rogue server alerts to, empty to only log
 }
 
 type TFTPConfig struct {
-	Dir string
+	Dir         string
+	OverrideDir string // Directory whose files take precedence over Dir and per-network roots
+	Defaults    bool   // Serve built-in boot menus and scripts for files missing from disk
+
+	Address      string        // Address to listen on, empty for all IPv4 addresses
+	Port         int           // UDP port to listen on
+	MaxBlockSize int           // Largest blocksize granted to clients, 0 for the client's choice up to the path MTU
+	Timeout      time.Duration // Time to wait for an ACK before retransmitting
+	Retries      int           // Retransmissions before a transfer is abandoned
+	SinglePort   bool          // Serve every transfer from Port instead of ephemeral ports, for NAT and firewalls
+	CacheSizeMB  int           // Memory for caching served files, 0 disables the cache
+
+	UploadDirs     []string      // Upload areas under Dir, as "name=dir" or "dir"; none makes the server read-only
+	UploadSubnets  []string      // CIDRs of clients allowed to write
+	UploadVersions int           // Versions kept of each uploaded file, 0 keeps all
+	UploadMaxAge   time.Duration // Uploaded versions older than this are removed, 0 keeps them forever
+
+	WebUploadMaxMB  int           // Largest file accepted through the web interface, 0 for no limit
+	WebUploadExpiry time.Duration // Unfinished web uploads idle for longer than this are discarded
+	ExtractMaxMB    int           // Largest total size of files extracted from one archive, 0 for no limit
+
+	ReadSubnets   []string // CIDRs of clients allowed to read; none allows any client
+	AccessRules   []string // Per-file restrictions written as "pattern=cidr cidr ..."
+	BindHostFiles bool     // Only serve per-host files such as pxelinux.cfg/01-<mac> to the IP leased to that host
 }
 
 type HTTPConfig struct {
 	Dir  string
 	Port string
+
+	BootSubnets []string // CIDRs of clients allowed to fetch from the /boot/ tree; none allows any client
 }
 
 type ProvisionConfig struct {
@@ -40,20 +78,129 @@ type ProvisionConfig struct {
 }
 
 type OSImageConfig struct {
-	Sources map[string]OSDefinition `json:"sources"`
+	Sources map[string]OSDefinition `json:"sources"` // Built-in catalog
+
+	CatalogDir  string   // Directory of YAML or JSON catalog files merged over the built-in catalog
+	CatalogURLs []string // Remote catalogs, each signed by a detached signature at <url>.sig
+	CatalogKeys []string // Base64 ed25519 public keys trusted to sign remote catalogs
+
+	DownloadWorkers int // Images downloaded at the same time
+	DownloadRetries int // Retries of a failed artifact transfer, each resuming where the last stopped
 }
 
 type OSDefinition struct {
 	DisplayName string               `json:"display_name"`
-	KernelFile  string               `json:"kernel_file"`
-	InitrdFile  string               `json:"initrd_file"`
+	KernelFile  string               `json:"kernel_file,omitempty"` // Legacy; used when no artifacts are listed
+	InitrdFile  string               `json:"initrd_file,omitempty"` // Legacy; used when no artifacts are listed
+	Artifacts   []Artifact           `json:"artifacts,omitempty"`   // Shared by versions that list none
 	Versions    map[string]OSVersion `json:"versions"`
 }
 
 type OSVersion struct {
-	DisplayName   string   `json:"display_name"`
-	BaseURL       string   `json:"base_url"`
-	Architectures []string `json:"architectures"`
+	DisplayName   string     `json:"display_name"`
+	BaseURL       string     `json:"base_url"`
+	Architectures []string   `json:"architectures"`
+	Artifacts     []Artifact `json:"artifacts,omitempty"` // Replaces the OS's artifacts for this version
+}
+
+// Artifact roles decide how a downloaded file is used at boot
+const (
+	RoleKernel   = "kernel"
+	RoleInitrd   = "initrd"   // May repeat; initrds are loaded in order
+	RoleSquashfs = "squashfs" // Ubuntu casper live filesystem
+	RoleRootfs   = "rootfs"   // CoreOS live root filesystem
+	RoleStage2   = "stage2"   // Anaconda install.img
+)
+
+// ArtifactRoles lists the known artifact roles
+var ArtifactRoles = []string{RoleKernel, RoleInitrd, RoleSquashfs, RoleRootfs, RoleStage2}
+
+// Artifact is a file downloaded for an OS version. Name and URL may contain a
+// {version} placeholder.
+type Artifact struct {
+	Name     string `json:"name,omitempty"`     // Relative to the version's base URL
+	URL      string `json:"url,omitempty"`      // Full URL, used instead of Name
+	Checksum string `json:"checksum,omitempty"` // Expected digest, as sha256:<hex>
+	Dest     string `json:"dest,omitempty"`     // File name under <tftp>/<os>/<version>/, defaulting to the source's
+	Role     string `json:"role"`
+}
+
+// VersionArtifacts returns the artifacts to download for a version, with
+// placeholders replaced, URLs resolved against the version's base URL and
+// destination names filled in. Definitions without artifacts get a kernel
+// and initrd from KernelFile and InitrdFile.
+func (d OSDefinition) VersionArtifacts(version string) ([]Artifact, error) {
+	v, ok := d.Versions[version]
+	if !ok {
+		return nil, fmt.Errorf("unsupported version %q", version)
+	}
+
+	artifacts := v.Artifacts
+	if len(artifacts) == 0 {
+		artifacts = d.Artifacts
+	}
+	if len(artifacts) == 0 {
+		artifacts = []Artifact{
+			{Name: d.KernelFile, Dest: "vmlinuz", Role: RoleKernel},
+			{Name: d.InitrdFile, Dest: "initrd.img", Role: RoleInitrd},
+		}
+	}
+
+	resolved := make([]Artifact, 0, len(artifacts))
+	dests := make(map[string]bool, len(artifacts))
+	kernels := 0
+	for _, a := range artifacts {
+		a.Name = strings.ReplaceAll(a.Name, "{version}", version)
+		a.URL = strings.ReplaceAll(a.URL, "{version}", version)
+
+		if a.URL == "" {
+			if a.Name == "" {
+				return nil, fmt.Errorf("%s artifact has neither a name nor a URL", a.Role)
+			}
+			base, err := url.Parse(v.BaseURL)
+			if err != nil || !base.IsAbs() {
+				return nil, fmt.Errorf("%s artifact %s needs an absolute base URL", a.Role, a.Name)
+			}
+			ref, err := url.Parse(a.Name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid artifact name %q: %w", a.Name, err)
+			}
+			a.URL = base.ResolveReference(ref).String()
+		}
+
+		if a.Dest == "" {
+			u, err := url.Parse(a.URL)
+			if err != nil {
+				return nil, fmt.Errorf("invalid artifact URL %q: %w", a.URL, err)
+			}
+			a.Dest = path.Base(u.Path)
+		}
+		if a.Dest == "." || a.Dest == ".." || a.Dest == "/" || strings.ContainsAny(a.Dest, `/\`) {
+			return nil, fmt.Errorf("invalid destination %q for %s artifact", a.Dest, a.Role)
+		}
+		if dests[a.Dest] {
+			return nil, fmt.Errorf("more than one artifact is saved as %s", a.Dest)
+		}
+		dests[a.Dest] = true
+
+		switch a.Role {
+		case RoleKernel:
+			kernels++
+		case RoleInitrd, RoleSquashfs, RoleRootfs, RoleStage2:
+		default:
+			return nil, fmt.Errorf("unknown role %q for artifact %s", a.Role, a.Dest)
+		}
+
+		if a.Checksum != "" && !strings.HasPrefix(a.Checksum, "sha256:") {
+			return nil, fmt.Errorf("unsupported checksum %q for artifact %s, expected sha256:<hex>", a.Checksum, a.Dest)
+		}
+		resolved = append(resolved, a)
+	}
+
+	if kernels != 1 {
+		return nil, fmt.Errorf("expected one kernel artifact, found %d", kernels)
+	}
+	return resolved, nil
 }
 
 // ConfigBuilder provides a builder pattern for configuration
@@ -73,13 +220,42 @@ func NewConfigBuilder() *ConfigBuilder {
 			DHCP: DHCPConfig{
 				BiosFile: getEnv("BIOS_FILE", "boot-bios/pxelinux.0"),
 				EFIFile:  getEnv("EFI_FILE", "boot-efi/syslinux.efi"),
+
+				RogueScanInterval: getEnvDuration("ROGUE_DHCP_INTERVAL", 5*time.Minute),
+				RogueScanTimeout:  getEnvDuration("ROGUE_DHCP_TIMEOUT", 3*time.Second),
+				RogueAlertWebhook: getEnv("ROGUE_DHCP_WEBHOOK", ""),
 			},
 			TFTP: TFTPConfig{
-				Dir: getEnv("TFTP_DIR", "./public/tftp"),
+				Dir:         getEnv("TFTP_DIR", "./public/tftp"),
+				OverrideDir: getEnv("TFTP_OVERRIDE_DIR", ""),
+				Defaults:    getEnvBool("TFTP_DEFAULTS", true),
+
+				Address:      getEnv("TFTP_ADDRESS", ""),
+				Port:         getEnvInt("TFTP_PORT", 69),
+				MaxBlockSize: getEnvInt("TFTP_MAX_BLOCKSIZE", 0),
+				Timeout:      getEnvDuration("TFTP_TIMEOUT", 5*time.Second),
+				Retries:      getEnvInt("TFTP_RETRIES", 5),
+				SinglePort:   getEnvBool("TFTP_SINGLE_PORT", false),
+				CacheSizeMB:  getEnvInt("TFTP_CACHE_MB", 256),
+
+				UploadDirs:     getEnvList("TFTP_UPLOAD_DIRS"),
+				UploadSubnets:  getEnvList("TFTP_UPLOAD_SUBNETS"),
+				UploadVersions: getEnvInt("TFTP_UPLOAD_VERSIONS", 10),
+				UploadMaxAge:   getEnvDuration("TFTP_UPLOAD_MAX_AGE", 0),
+
+				WebUploadMaxMB:  getEnvInt("TFTP_WEB_UPLOAD_MAX_MB", 16384),
+				WebUploadExpiry: getEnvDuration("TFTP_WEB_UPLOAD_EXPIRY", 24*time.Hour),
+				ExtractMaxMB:    getEnvInt("TFTP_EXTRACT_MAX_MB", 32768),
+
+				ReadSubnets:   getEnvList("TFTP_READ_SUBNETS"),
+				AccessRules:   getEnvList("TFTP_ACCESS_RULES"),
+				BindHostFiles: getEnvBool("TFTP_BIND_HOST_FILES", true),
 			},
 			HTTP: HTTPConfig{
 				Dir:  getEnv("HTTP_DIR", "./public/http"),
 				Port: getEnv("HTTP_PORT", "8080"),
+
+				BootSubnets: getEnvList("HTTP_BOOT_SUBNETS"),
 			},
 			Provision: ProvisionConfig{
 				Dir: getEnv("PROV_DIR", "./public/provision"),
@@ -129,6 +305,68 @@ func (cb *ConfigBuilder) validate() error {
 	if cb.config.DB.Bucket == "" {
 		return fmt.Errorf("database bucket cannot be empty")
 	}
+	if err := cb.config.TFTP.validate(); err != nil {
+		return err
+	}
+	return cb.config.OSImages.validate()
+}
+
+// validate checks the TFTP listener settings
+func (c TFTPConfig) validate() error {
+	if c.Address != "" && net.ParseIP(c.Address) == nil {
+		return fmt.Errorf("invalid TFTP address %q", c.Address)
+	}
+	if c.Port < 1 || c.Port > 65535 {
+		return fmt.Errorf("TFTP port %d out of range", c.Port)
+	}
+	// pin/tftp ignores blocksize limits of 512 and below, so 512 would silently mean "client's choice"
+	if c.MaxBlockSize != 0 && (c.MaxBlockSize <= 512 || c.MaxBlockSize > 65464) {
+		return fmt.Errorf("TFTP blocksize %d must be between 513 and 65464", c.MaxBlockSize)
+	}
+	if c.Timeout <= 0 {
+		return fmt.Errorf("TFTP timeout must be positive")
+	}
+	if c.Retries < 1 {
+		return fmt.Errorf("TFTP retries must be at least 1")
+	}
+	if c.CacheSizeMB < 0 {
+		return fmt.Errorf("TFTP cache size cannot be negative")
+	}
+	if c.UploadVersions < 0 || c.UploadMaxAge < 0 {
+		return fmt.Errorf("TFTP upload retention cannot be negative")
+	}
+	if c.WebUploadMaxMB < 0 || c.ExtractMaxMB < 0 {
+		return fmt.Errorf("TFTP upload and extraction size limits cannot be negative")
+	}
+	if c.WebUploadExpiry <= 0 {
+		return fmt.Errorf("TFTP web upload expiry must be positive")
+	}
+	return nil
+}
+
+// validate checks the download settings and the remote catalog URLs and
+// signing keys
+func (c OSImageConfig) validate() error {
+	if c.DownloadWorkers < 1 {
+		return fmt.Errorf("OS image download workers must be at least 1")
+	}
+	if c.DownloadRetries < 0 {
+		return fmt.Errorf("OS image download retries cannot be negative")
+	}
+	for _, raw := range c.CatalogURLs {
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid OS catalog URL %q", raw)
+		}
+	}
+	if len(c.CatalogURLs) > 0 && len(c.CatalogKeys) == 0 {
+		return fmt.Errorf("remote OS catalogs need at least one signing key")
+	}
+	for _, key := range c.CatalogKeys {
+		if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != ed25519.PublicKeySize {
+			return fmt.Errorf("invalid OS catalog key %q: expected a base64 ed25519 public key", key)
+		}
+	}
 	return nil
 }
 
@@ -145,14 +383,76 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+// getEnvList splits a comma separated environment variable, dropping empty entries
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getEnvDuration parses the environment variable key as a duration, falling back on a missing or invalid value
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid duration %q for %s, using %s", value, key, fallback)
+		return fallback
+	}
+	return duration
+}
+
+// getEnvInt parses the environment variable key as an integer, falling back on a missing or invalid value
+func getEnvInt(key string, fallback int) int {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid integer %q for %s, using %d", value, key, fallback)
+		return fallback
+	}
+	return n
+}
+
+// getEnvBool parses the environment variable key as a boolean, falling back on a missing or invalid value
+func getEnvBool(key string, fallback bool) bool {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid boolean %q for %s, using %t", value, key, fallback)
+		return fallback
+	}
+	return b
+}
+
 // getDefaultOSImageConfig returns the default OS image configuration
 func getDefaultOSImageConfig() OSImageConfig {
 	return OSImageConfig{
+		CatalogDir:  getEnv("OS_CATALOG_DIR", "./public/catalog"),
+		CatalogURLs: getEnvList("OS_CATALOG_URLS"),
+		CatalogKeys: getEnvList("OS_CATALOG_KEYS"),
+
+		DownloadWorkers: getEnvInt("OS_DOWNLOAD_WORKERS", 2),
+		DownloadRetries: getEnvInt("OS_DOWNLOAD_RETRIES", 5),
 		Sources: map[string]OSDefinition{
 			"ubuntu": {
 				DisplayName: "Ubuntu",
-				KernelFile:  "vmlinuz",
-				InitrdFile:  "initrd",
+				Artifacts: []Artifact{
+					{Name: "vmlinuz", Dest: "vmlinuz", Role: RoleKernel},
+					{Name: "initrd", Dest: "initrd.img", Role: RoleInitrd},
+					{Name: "filesystem.squashfs", Role: RoleSquashfs},
+				},
 				Versions: map[string]OSVersion{
 					"20.04": {
 						DisplayName:   "20.04 LTS",
@@ -173,8 +473,11 @@ func getDefaultOSImageConfig() OSImageConfig {
 			},
 			"centos": {
 				DisplayName: "CentOS",
-				KernelFile:  "vmlinuz",
-				InitrdFile:  "initrd.img",
+				Artifacts: []Artifact{
+					{Name: "vmlinuz", Role: RoleKernel},
+					{Name: "initrd.img", Role: RoleInitrd},
+					{Name: "../install.img", Role: RoleStage2},
+				},
 				Versions: map[string]OSVersion{
 					"9": {
 						DisplayName:   "9 Stream",
@@ -251,8 +554,11 @@ func getDefaultOSImageConfig() OSImageConfig {
 			},
 			"fedora": {
 				DisplayName: "Fedora",
-				KernelFile:  "vmlinuz",
-				InitrdFile:  "initrd.img",
+				Artifacts: []Artifact{
+					{Name: "vmlinuz", Role: RoleKernel},
+					{Name: "initrd.img", Role: RoleInitrd},
+					{Name: "../install.img", Role: RoleStage2},
+				},
 				Versions: map[string]OSVersion{
 					"39": {
 						DisplayName:   "39",
@@ -271,6 +577,21 @@ func getDefaultOSImageConfig() OSImageConfig {
 					},
 				},
 			},
+			"fcos": {
+				DisplayName: "Fedora CoreOS",
+				Artifacts: []Artifact{
+					{Name: "fedora-coreos-{version}-live-kernel-x86_64", Dest: "vmlinuz", Role: RoleKernel},
+					{Name: "fedora-coreos-{version}-live-initramfs.x86_64.img", Dest: "initrd.img", Role: RoleInitrd},
+					{Name: "fedora-coreos-{version}-live-rootfs.x86_64.img", Dest: "rootfs.img", Role: RoleRootfs},
+				},
+				Versions: map[string]OSVersion{
+					"41.20250130.3.0": {
+						DisplayName:   "41 (stable)",
+						BaseURL:       "https://builds.coreos.fedoraproject.org/prod/streams/stable/builds/41.20250130.3.0/x86_64/",
+						Architectures: []string{"x86_64"},
+					},
+				},
+			},
 		},
 	}
 }
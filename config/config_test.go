@@ -1,7 +1,10 @@
 package config
 
 import (
+	"crypto/ed25519"
+	"encoding/base64"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -16,6 +19,113 @@ func TestLoadConfig_Defaults(t *testing.T) {
 	assert.Equal(t, "./public/tftp", cfg.TFTP.Dir)
 	assert.Equal(t, "./public/http", cfg.HTTP.Dir)
 	assert.Equal(t, "dhcp", cfg.DB.Bucket)
+	assert.Equal(t, 5*time.Minute, cfg.DHCP.RogueScanInterval)
+	assert.Empty(t, cfg.TFTP.UploadDirs, "TFTP is read-only by default")
+	assert.Equal(t, 69, cfg.TFTP.Port)
+	assert.False(t, cfg.TFTP.SinglePort)
+	assert.Equal(t, 256, cfg.TFTP.CacheSizeMB)
+	assert.Empty(t, cfg.TFTP.OverrideDir)
+	assert.True(t, cfg.TFTP.Defaults)
+	assert.Empty(t, cfg.TFTP.ReadSubnets, "TFTP reads are open to any client by default")
+	assert.True(t, cfg.TFTP.BindHostFiles)
+	assert.Equal(t, 10, cfg.TFTP.UploadVersions)
+}
+
+func TestGetEnvList(t *testing.T) {
+	t.Setenv("TFTP_UPLOAD_SUBNETS", "10.0.0.0/24, ,192.168.1.0/24,")
+	assert.Equal(t, []string{"10.0.0.0/24", "192.168.1.0/24"}, getEnvList("TFTP_UPLOAD_SUBNETS"))
+
+	t.Setenv("TFTP_UPLOAD_SUBNETS", "")
+	assert.Empty(t, getEnvList("TFTP_UPLOAD_SUBNETS"))
+}
+
+func TestGetEnvDuration(t *testing.T) {
+	t.Setenv("ROGUE_DHCP_INTERVAL", "30s")
+	assert.Equal(t, 30*time.Second, getEnvDuration("ROGUE_DHCP_INTERVAL", time.Minute))
+
+	t.Setenv("ROGUE_DHCP_INTERVAL", "0")
+	assert.Equal(t, time.Duration(0), getEnvDuration("ROGUE_DHCP_INTERVAL", time.Minute))
+
+	t.Setenv("ROGUE_DHCP_INTERVAL", "soon")
+	assert.Equal(t, time.Minute, getEnvDuration("ROGUE_DHCP_INTERVAL", time.Minute))
+}
+
+func TestGetEnvIntAndBool(t *testing.T) {
+	t.Setenv("TFTP_PORT", "6969")
+	assert.Equal(t, 6969, getEnvInt("TFTP_PORT", 69))
+	t.Setenv("TFTP_PORT", "tftp")
+	assert.Equal(t, 69, getEnvInt("TFTP_PORT", 69))
+
+	t.Setenv("TFTP_SINGLE_PORT", "true")
+	assert.True(t, getEnvBool("TFTP_SINGLE_PORT", false))
+	t.Setenv("TFTP_SINGLE_PORT", "maybe")
+	assert.False(t, getEnvBool("TFTP_SINGLE_PORT", false))
+}
+
+func TestTFTPConfigValidation(t *testing.T) {
+	valid := TFTPConfig{Port: 69, Timeout: 5 * time.Second, Retries: 5, WebUploadExpiry: 24 * time.Hour}
+	assert.NoError(t, valid.validate())
+
+	tests := []struct {
+		name   string
+		modify func(c *TFTPConfig)
+	}{
+		{"Invalid address", func(c *TFTPConfig) { c.Address = "not-an-ip" }},
+		{"Port out of range", func(c *TFTPConfig) { c.Port = 70000 }},
+		{"Blocksize too small", func(c *TFTPConfig) { c.MaxBlockSize = 100 }},
+		{"Blocksize of 512", func(c *TFTPConfig) { c.MaxBlockSize = 512 }},
+		{"Blocksize too large", func(c *TFTPConfig) { c.MaxBlockSize = 65465 }},
+		{"Zero timeout", func(c *TFTPConfig) { c.Timeout = 0 }},
+		{"Zero retries", func(c *TFTPConfig) { c.Retries = 0 }},
+		{"Negative cache size", func(c *TFTPConfig) { c.CacheSizeMB = -1 }},
+		{"Negative upload versions", func(c *TFTPConfig) { c.UploadVersions = -1 }},
+		{"Zero web upload expiry", func(c *TFTPConfig) { c.WebUploadExpiry = 0 }},
+		{"Negative extraction limit", func(c *TFTPConfig) { c.ExtractMaxMB = -1 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid
+			tt.modify(&c)
+			assert.Error(t, c.validate())
+		})
+	}
+
+	t.Setenv("TFTP_PORT", "0")
+	_, err := LoadDefault()
+	assert.Error(t, err)
+}
+
+func TestOSImageConfigValidation(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(make([]byte, ed25519.PublicKeySize))
+
+	valid := OSImageConfig{DownloadWorkers: 2, DownloadRetries: 5}
+	assert.NoError(t, valid.validate())
+
+	tests := []struct {
+		name   string
+		modify func(c *OSImageConfig)
+		valid  bool
+	}{
+		{"Signed remote catalog", func(c *OSImageConfig) {
+			c.CatalogURLs, c.CatalogKeys = []string{"https://example.com/catalog.yaml"}, []string{key}
+		}, true},
+		{"Unsigned remote catalog", func(c *OSImageConfig) { c.CatalogURLs = []string{"https://example.com/catalog.yaml"} }, false},
+		{"Non-HTTP catalog URL", func(c *OSImageConfig) {
+			c.CatalogURLs, c.CatalogKeys = []string{"file:///etc/catalog.yaml"}, []string{key}
+		}, false},
+		{"Short key", func(c *OSImageConfig) { c.CatalogKeys = []string{"c2hvcnQ="} }, false},
+		{"No download workers", func(c *OSImageConfig) { c.DownloadWorkers = 0 }, false},
+		{"Negative retries", func(c *OSImageConfig) { c.DownloadRetries = -1 }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid
+			tt.modify(&c)
+			assert.Equal(t, tt.valid, c.validate() == nil)
+		})
+	}
 }
 
 func TestConfigBuilder(t *testing.T) {
@@ -31,3 +141,67 @@ func TestConfigBuilder(t *testing.T) {
 	assert.Equal(t, "test.db", cfg.DB.DBFile)
 	assert.Equal(t, "test", cfg.DB.Bucket)
 }
+
+func TestVersionArtifacts(t *testing.T) {
+	sources := getDefaultOSImageConfig().Sources
+
+	// Every built-in version resolves
+	for name, def := range sources {
+		for version := range def.Versions {
+			_, err := def.VersionArtifacts(version)
+			assert.NoError(t, err, "%s %s", name, version)
+		}
+	}
+
+	fedora, err := sources["fedora"].VersionArtifacts("41")
+	assert.NoError(t, err)
+	if assert.Len(t, fedora, 3) {
+		assert.Equal(t, Artifact{
+			Name: "../install.img",
+			URL:  "https://download.fedoraproject.org/pub/fedora/linux/releases/41/Everything/x86_64/os/images/install.img",
+			Dest: "install.img",
+			Role: RoleStage2,
+		}, fedora[2])
+	}
+
+	fcos, err := sources["fcos"].VersionArtifacts("41.20250130.3.0")
+	assert.NoError(t, err)
+	if assert.Len(t, fcos, 3) {
+		assert.Equal(t, "https://builds.coreos.fedoraproject.org/prod/streams/stable/builds/41.20250130.3.0/x86_64/fedora-coreos-41.20250130.3.0-live-rootfs.x86_64.img", fcos[2].URL)
+		assert.Equal(t, "rootfs.img", fcos[2].Dest)
+	}
+
+	// Definitions without artifacts download a kernel and initrd
+	debian, err := sources["debian"].VersionArtifacts("12")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"vmlinuz", "initrd.img"}, []string{debian[0].Dest, debian[1].Dest})
+	assert.Equal(t, "http://deb.debian.org/debian/dists/bookworm/main/installer-amd64/current/images/netboot/debian-installer/amd64/linux", debian[0].URL)
+
+	_, err = sources["debian"].VersionArtifacts("13")
+	assert.Error(t, err)
+}
+
+func TestVersionArtifacts_Invalid(t *testing.T) {
+	tests := []struct {
+		name      string
+		artifacts []Artifact
+	}{
+		{"No kernel", []Artifact{{Name: "initrd", Role: RoleInitrd}}},
+		{"Two kernels", []Artifact{{Name: "a", Role: RoleKernel}, {Name: "b", Role: RoleKernel}}},
+		{"Unknown role", []Artifact{{Name: "vmlinuz", Role: RoleKernel}, {Name: "modules.img", Role: "modules"}}},
+		{"Duplicate destination", []Artifact{{Name: "vmlinuz", Role: RoleKernel}, {Name: "initrd", Dest: "vmlinuz", Role: RoleInitrd}}},
+		{"Destination outside the image", []Artifact{{Name: "vmlinuz", Dest: "../vmlinuz", Role: RoleKernel}}},
+		{"Unsupported checksum", []Artifact{{Name: "vmlinuz", Checksum: "md5:abc", Role: RoleKernel}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			def := OSDefinition{
+				Artifacts: tt.artifacts,
+				Versions:  map[string]OSVersion{"1": {BaseURL: "http://example.com/os/"}},
+			}
+			_, err := def.VersionArtifacts("1")
+			assert.Error(t, err)
+		})
+	}
+}
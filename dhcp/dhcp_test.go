@@ -116,6 +116,7 @@ func TestDHCPServerService_CreateServer(t *testing.T) {
 
 	// Mock expectations
 	mockServerRepo.On("GetByIP", ctx, config.IP).Return(nil, assert.AnError)
+	mockServerRepo.On("GetAll", ctx).Return([]*Server{}, nil)
 	mockServerRepo.On("Save", ctx, mock.AnythingOfType("*dhcp.Server")).Return(nil)
 
 	// Execute
@@ -34,6 +34,7 @@ type LeaseRepository interface {
 type ServerService interface {
 	CreateServer(ctx context.Context, config ServerConfig) (*Server, error)
 	UpdateServer(ctx context.Context, serverID string, config ServerConfig) error
+	MigrateServer(ctx context.Context, serverID string, req MigrationRequest) (*MigrationResult, error)
 	StartServer(ctx context.Context, serverID string) error
 	StopServer(ctx context.Context, serverID string) error
 	DeleteServer(ctx context.Context, serverID string) error
@@ -48,6 +49,7 @@ type LeaseService interface {
 	ReserveLease(ctx context.Context, serverID string, mac string, ip net.IP) error
 	UnreserveLease(ctx context.Context, mac string) error
 	GetLeaseByMAC(ctx context.Context, mac string) (*Lease, error)
+	GetLeaseByIP(ctx context.Context, ip net.IP) (*Lease, error)
 	GetLeasesByServer(ctx context.Context, serverID string) ([]*Lease, error)
 	CleanupExpiredLeases(ctx context.Context) error
 	UpdateLease(ctx context.Context, lease *Lease) error
@@ -68,6 +70,10 @@ type DHCPHandler interface {
 // ServerConfig represents configuration for creating a new DHCP server
 type ServerConfig struct {
 	IP            net.IP
+	Interface     string // Network interface to bind to, empty to bind to IP only
+	VLANID        int    // 802.1Q VLAN the server is scoped to, 0 for untagged
+	VLANParent    string // Create the VLAN subinterface on this interface if set
+	TFTPRoot      string // Directory under the TFTP root served to this server's clients
 	SubnetMask    net.IP
 	Gateway       net.IP
 	DNS           net.IP
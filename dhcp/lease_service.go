@@ -145,6 +145,31 @@ func (s *DHCPLeaseService) GetLeaseByMAC(ctx context.Context, mac string) (*Leas
 	return s.leaseRepo.GetByMAC(ctx, mac)
 }
 
+// GetLeaseByIP retrieves the lease holding an IP address on any server.
+// Expired leases are skipped unless reserved, since their address may since
+// have been handed to another host.
+func (s *DHCPLeaseService) GetLeaseByIP(ctx context.Context, ip net.IP) (*Lease, error) {
+	servers, err := s.serverRepo.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get servers: %w", err)
+	}
+
+	for _, server := range servers {
+		leases, err := s.leaseRepo.GetByServerID(ctx, server.ID)
+		if err != nil {
+			continue // Skip servers that can't be queried
+		}
+
+		for _, lease := range leases {
+			if lease.Holds(ip) {
+				return lease, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("lease for IP %s not found", ip)
+}
+
 // GetLeasesByServer retrieves all leases for a server
 func (s *DHCPLeaseService) GetLeasesByServer(ctx context.Context, serverID string) ([]*Lease, error) {
 	return s.leaseRepo.GetByServerID(ctx, serverID)
@@ -0,0 +1,17 @@
+//go:build linux
+
+// dhcp/listener_linux.go - Interface bound DHCP sockets on Linux
+package dhcp
+
+import (
+	"fmt"
+
+	"github.com/krolaw/dhcp4/conn"
+)
+
+// listenOnInterface opens a UDP socket on 0.0.0.0 bound to the named device
+// with SO_BINDTODEVICE. SO_REUSEADDR is set so servers on different
+// interfaces can share the DHCP port. Requires CAP_NET_RAW.
+func listenOnInterface(name string, port int) (packetListener, error) {
+	return conn.NewUDP4BoundListener(name, fmt.Sprintf("0.0.0.0:%d", port))
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+// dhcp/listener_other.go - Interface filtered DHCP sockets on other platforms
+package dhcp
+
+import (
+	"fmt"
+
+	"github.com/krolaw/dhcp4/conn"
+)
+
+// listenOnInterface opens a UDP socket on 0.0.0.0 that drops packets received
+// on other interfaces and sends replies out of the named one. Only one such
+// server can run per host since the port is not shared.
+func listenOnInterface(name string, port int) (packetListener, error) {
+	return conn.NewUDP4FilterListener(name, fmt.Sprintf("0.0.0.0:%d", port))
+}
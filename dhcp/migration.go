@@ -0,0 +1,300 @@
+// dhcp/migration.go - Server re-addressing and lease migration
+package dhcp
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Lease remap modes for MigrateServer
+const (
+	RemapByOffset  = "offset"  // Keep each lease's host offset within the subnet
+	RemapByMapping = "mapping" // Use an explicit MAC to IP mapping for every lease
+)
+
+// MigrationRequest describes how to move a server and its leases to a new subnet
+type MigrationRequest struct {
+	Config  ServerConfig      // New server configuration, including the new IP
+	Mode    string            // RemapByOffset or RemapByMapping
+	Mapping map[string]net.IP // MAC address to new IP, used in mapping mode
+	DryRun  bool              // Compute the result without saving anything
+}
+
+// LeaseMigration records where a single lease moves to
+type LeaseMigration struct {
+	LeaseID  string `json:"lease_id"`
+	MAC      string `json:"mac"`
+	OldIP    net.IP `json:"old_ip"`
+	NewIP    net.IP `json:"new_ip,omitempty"`
+	Reserved bool   `json:"reserved"`
+	Error    string `json:"error,omitempty"`
+}
+
+// MigrationResult describes the outcome, or the planned outcome for a dry run
+type MigrationResult struct {
+	DryRun bool             `json:"dry_run"`
+	OldIP  net.IP           `json:"old_ip"`
+	Server *Server          `json:"server"`
+	Leases []LeaseMigration `json:"leases"`
+}
+
+// HasConflicts returns true if any lease could not be remapped
+func (r *MigrationResult) HasConflicts() bool {
+	for _, lease := range r.Leases {
+		if lease.Error != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// MigrateServer moves a server to a new IP and subnet and remaps all of its
+// leases, keeping boot menus, IPMI settings and state history intact. With
+// DryRun set the planned result is returned and nothing is saved.
+func (s *DHCPServerService) MigrateServer(ctx context.Context, serverID string, req MigrationRequest) (*MigrationResult, error) {
+	if req.Mode == "" {
+		req.Mode = RemapByOffset
+	}
+	if req.Mode != RemapByOffset && req.Mode != RemapByMapping {
+		return nil, fmt.Errorf("unknown remap mode: %s", req.Mode)
+	}
+
+	server, err := s.serverRepo.Get(ctx, serverID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get server: %w", err)
+	}
+
+	if err := s.validateServerConfig(ctx, req.Config, serverID); err != nil {
+		return nil, fmt.Errorf("invalid server configuration: %w", err)
+	}
+
+	leases, err := s.leaseRepo.GetByServerID(ctx, serverID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get server leases: %w", err)
+	}
+	sort.Slice(leases, func(i, j int) bool {
+		return ipToInt(leases[i].IP) < ipToInt(leases[j].IP)
+	})
+
+	oldSubnet := server.GetSubnet()
+	newSubnet := subnetFor(req.Config.IP, req.Config.SubnetMask)
+	newBroadcast := broadcastAddress(newSubnet)
+
+	result := &MigrationResult{
+		DryRun: req.DryRun,
+		OldIP:  server.IP,
+		Leases: make([]LeaseMigration, 0, len(leases)),
+	}
+
+	assigned := make(map[string]string) // new IP -> MAC
+	for _, lease := range leases {
+		migration := LeaseMigration{
+			LeaseID:  lease.ID,
+			MAC:      lease.MAC,
+			OldIP:    lease.IP,
+			Reserved: lease.Reserved,
+		}
+
+		newIP, err := remapLeaseIP(lease, req, oldSubnet, newSubnet)
+		switch {
+		case err != nil:
+			migration.Error = err.Error()
+		case !newSubnet.Contains(newIP):
+			migration.Error = fmt.Sprintf("%s is not within subnet %s", newIP, newSubnet)
+		case newIP.Equal(newSubnet.IP) || newIP.Equal(newBroadcast):
+			migration.Error = fmt.Sprintf("%s is the network or broadcast address of %s", newIP, newSubnet)
+		case newIP.Equal(req.Config.IP.To4()):
+			migration.Error = fmt.Sprintf("%s is the new server IP", newIP)
+		case newIP.Equal(req.Config.Gateway.To4()):
+			migration.Error = fmt.Sprintf("%s is the new gateway", newIP)
+		case assigned[newIP.String()] != "":
+			migration.Error = fmt.Sprintf("%s is already assigned to %s", newIP, assigned[newIP.String()])
+		default:
+			assigned[newIP.String()] = lease.MAC
+		}
+		migration.NewIP = newIP
+
+		result.Leases = append(result.Leases, migration)
+	}
+
+	migrated := *server
+	migrated.IP = req.Config.IP
+	if server.VLANParent == "" {
+		migrated.Interface = req.Config.Interface
+	}
+	migrated.IPStart = req.Config.StartIP
+	migrated.LeaseRange = req.Config.LeaseRange
+	migrated.LeaseDuration = req.Config.LeaseDuration
+	migrated.Options = DHCPOptions{
+		SubnetMask: req.Config.SubnetMask,
+		Gateway:    req.Config.Gateway,
+		DNS:        req.Config.DNS,
+		TFTPServer: req.Config.IP,
+	}
+	result.Server = &migrated
+
+	if req.DryRun {
+		return result, nil
+	}
+	if result.HasConflicts() {
+		return result, fmt.Errorf("cannot migrate server %s: some leases could not be remapped", server.IP)
+	}
+
+	// Stop the server while its address changes
+	wasRunning := server.Started
+	if wasRunning {
+		if err := s.StopServer(ctx, serverID); err != nil {
+			return nil, fmt.Errorf("failed to stop server for migration: %w", err)
+		}
+		migrated.Started = false
+	}
+
+	// The VLAN subinterface ignite addressed moves with the server
+	if err := s.moveVLANAddress(server, &migrated); err != nil {
+		if wasRunning {
+			if startErr := s.StartServer(ctx, serverID); startErr != nil {
+				log.Printf("Warning: failed to restart server after failed migration: %v", startErr)
+			}
+		}
+		return nil, err
+	}
+
+	migrated.UpdatedAt = time.Now()
+	originals := make([]Lease, len(leases))
+	for i, lease := range leases {
+		originals[i] = *lease
+		applyLeaseMigration(lease, result.Leases[i].NewIP, server, &migrated)
+	}
+	saveErr := s.saveMigration(ctx, server, &migrated, leases, originals)
+	if saveErr != nil {
+		if err := s.moveVLANAddress(&migrated, server); err != nil {
+			log.Printf("Warning: failed to restore the address of %s after failed migration: %v", server.Interface, err)
+		}
+	}
+
+	// Restart the server at whichever address it was left with
+	if wasRunning {
+		if err := s.StartServer(ctx, serverID); err != nil {
+			log.Printf("Warning: failed to restart server after migration: %v", err)
+		} else if saveErr == nil {
+			migrated.Started = true
+		}
+	}
+	if saveErr != nil {
+		return nil, saveErr
+	}
+
+	return result, nil
+}
+
+// saveMigration saves a migrated server and its leases. If any save fails, the
+// original server and the leases already saved are put back, so a failure
+// never leaves the server half migrated.
+func (s *DHCPServerService) saveMigration(ctx context.Context, original, migrated *Server, leases []*Lease, originals []Lease) error {
+	if err := s.serverRepo.Save(ctx, migrated); err != nil {
+		return fmt.Errorf("failed to save migrated server: %w", err)
+	}
+
+	for i, lease := range leases {
+		if err := s.leaseRepo.Save(ctx, lease); err != nil {
+			s.rollbackMigration(ctx, original, migrated.Started, originals[:i])
+			return fmt.Errorf("failed to save migrated lease for MAC %s, migration rolled back: %w", lease.MAC, err)
+		}
+	}
+	return nil
+}
+
+// moveVLANAddress re-addresses the VLAN subinterface of a server moving from
+// from to to. Servers on other interfaces are left alone.
+func (s *DHCPServerService) moveVLANAddress(from, to *Server) error {
+	if from.VLANParent == "" || from.Interface == "" {
+		return nil
+	}
+	if s.vlanManager == nil {
+		return fmt.Errorf("cannot re-address %s: VLAN management is not enabled", from.Interface)
+	}
+	if err := s.vlanManager.ReplaceAddress(from.Interface, serverAddress(from), serverAddress(to)); err != nil {
+		return fmt.Errorf("failed to re-address %s: %w", from.Interface, err)
+	}
+	return nil
+}
+
+// serverAddress returns the address and prefix a server holds on its interface
+func serverAddress(server *Server) *net.IPNet {
+	return &net.IPNet{IP: server.IP, Mask: net.IPMask(server.Options.SubnetMask.To4())}
+}
+
+// rollbackMigration restores a server and the leases saved before a migration
+// failed. started is the server's state while it is being migrated.
+func (s *DHCPServerService) rollbackMigration(ctx context.Context, server *Server, started bool, leases []Lease) {
+	restored := *server
+	restored.Started = started
+	restored.UpdatedAt = time.Now()
+	if err := s.serverRepo.Save(ctx, &restored); err != nil {
+		log.Printf("Warning: failed to restore server %s after failed migration: %v", server.ID, err)
+	}
+
+	for i := range leases {
+		if err := s.leaseRepo.Save(ctx, &leases[i]); err != nil {
+			log.Printf("Warning: failed to restore lease for MAC %s after failed migration: %v", leases[i].MAC, err)
+		}
+	}
+}
+
+// remapLeaseIP works out the new address for a lease
+func remapLeaseIP(lease *Lease, req MigrationRequest, oldSubnet, newSubnet *net.IPNet) (net.IP, error) {
+	if req.Mode == RemapByMapping {
+		newIP, ok := lookupMapping(req.Mapping, lease.MAC)
+		if !ok {
+			return nil, fmt.Errorf("no mapping provided for %s", lease.MAC)
+		}
+		if newIP.To4() == nil {
+			return nil, fmt.Errorf("mapped address %s is not IPv4", newIP)
+		}
+		return newIP.To4(), nil
+	}
+
+	if !oldSubnet.Contains(lease.IP) {
+		return nil, fmt.Errorf("%s is outside the old subnet %s", lease.IP, oldSubnet)
+	}
+	offset := ipToInt(lease.IP) - ipToInt(oldSubnet.IP)
+	return incrementIP(newSubnet.IP, int(offset)), nil
+}
+
+// lookupMapping finds a MAC in a mapping, ignoring case and separator style
+func lookupMapping(mapping map[string]net.IP, mac string) (net.IP, bool) {
+	normalize := func(m string) string {
+		return strings.ToLower(strings.ReplaceAll(m, "-", ":"))
+	}
+	for key, ip := range mapping {
+		if normalize(key) == normalize(mac) {
+			return ip, true
+		}
+	}
+	return nil, false
+}
+
+// applyLeaseMigration moves a lease to its new address and rewrites boot menu
+// network settings that pointed at the old server's values
+func applyLeaseMigration(lease *Lease, newIP net.IP, oldServer, newServer *Server) {
+	if lease.Menu.IP != nil && lease.Menu.IP.Equal(lease.IP) {
+		lease.Menu.IP = newIP
+	}
+	if lease.Menu.Subnet != nil && lease.Menu.Subnet.Equal(oldServer.Options.SubnetMask) {
+		lease.Menu.Subnet = newServer.Options.SubnetMask
+	}
+	if lease.Menu.Gateway != nil && lease.Menu.Gateway.Equal(oldServer.Options.Gateway) {
+		lease.Menu.Gateway = newServer.Options.Gateway
+	}
+	if lease.Menu.DNS != nil && lease.Menu.DNS.Equal(oldServer.Options.DNS) {
+		lease.Menu.DNS = newServer.Options.DNS
+	}
+
+	lease.IP = newIP
+	lease.ServerID = newServer.ID
+}
@@ -0,0 +1,258 @@
+package dhcp
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func migrationTestServer() *Server {
+	return &Server{
+		ID:            "server-1",
+		IP:            net.ParseIP("192.168.1.10").To4(),
+		IPStart:       net.ParseIP("192.168.1.100").To4(),
+		LeaseRange:    50,
+		LeaseDuration: 2 * time.Hour,
+		Options: DHCPOptions{
+			SubnetMask: net.ParseIP("255.255.255.0").To4(),
+			Gateway:    net.ParseIP("192.168.1.1").To4(),
+			DNS:        net.ParseIP("8.8.8.8").To4(),
+		},
+	}
+}
+
+func migrationTestLeases() []*Lease {
+	return []*Lease{
+		{
+			ID:       "lease-1",
+			MAC:      "00:11:22:33:44:55",
+			IP:       net.ParseIP("192.168.1.120").To4(),
+			Reserved: true,
+			ServerID: "server-1",
+			State:    StateComplete,
+			Menu: BootMenu{
+				OS:       "ubuntu",
+				Hostname: "node1",
+				IP:       net.ParseIP("192.168.1.120").To4(),
+				Subnet:   net.ParseIP("255.255.255.0").To4(),
+				Gateway:  net.ParseIP("192.168.1.1").To4(),
+			},
+			IPMI: IPMI{Username: "admin", IP: net.ParseIP("10.99.0.5")},
+		},
+		{
+			ID:       "lease-2",
+			MAC:      "00:11:22:33:44:66",
+			IP:       net.ParseIP("192.168.1.121").To4(),
+			ServerID: "server-1",
+		},
+	}
+}
+
+func migrationTestConfig() ServerConfig {
+	return ServerConfig{
+		IP:            net.ParseIP("10.20.0.10"),
+		SubnetMask:    net.ParseIP("255.255.255.0"),
+		Gateway:       net.ParseIP("10.20.0.1"),
+		DNS:           net.ParseIP("10.20.0.2"),
+		StartIP:       net.ParseIP("10.20.0.100"),
+		LeaseRange:    50,
+		LeaseDuration: 2 * time.Hour,
+	}
+}
+
+func TestDHCPServerService_MigrateServer_DryRunByOffset(t *testing.T) {
+	ctx := context.Background()
+	mockServerRepo := &MockServerRepository{}
+	mockLeaseRepo := &MockLeaseRepository{}
+	service := NewDHCPServerService(mockServerRepo, mockLeaseRepo)
+
+	server := migrationTestServer()
+	mockServerRepo.On("Get", ctx, server.ID).Return(server, nil)
+	mockServerRepo.On("GetAll", ctx).Return([]*Server{server}, nil)
+	mockLeaseRepo.On("GetByServerID", ctx, server.ID).Return(migrationTestLeases(), nil)
+
+	result, err := service.MigrateServer(ctx, server.ID, MigrationRequest{
+		Config: migrationTestConfig(),
+		DryRun: true,
+	})
+
+	require.NoError(t, err)
+	assert.True(t, result.DryRun)
+	assert.False(t, result.HasConflicts())
+	assert.Equal(t, "10.20.0.10", result.Server.IP.String())
+	require.Len(t, result.Leases, 2)
+	assert.Equal(t, "10.20.0.120", result.Leases[0].NewIP.String())
+	assert.Equal(t, "10.20.0.121", result.Leases[1].NewIP.String())
+
+	mockServerRepo.AssertNotCalled(t, "Save", mock.Anything, mock.Anything)
+	mockLeaseRepo.AssertNotCalled(t, "Save", mock.Anything, mock.Anything)
+}
+
+func TestDHCPServerService_MigrateServer_ByMapping(t *testing.T) {
+	ctx := context.Background()
+	mockServerRepo := &MockServerRepository{}
+	mockLeaseRepo := &MockLeaseRepository{}
+	service := NewDHCPServerService(mockServerRepo, mockLeaseRepo)
+
+	server := migrationTestServer()
+	leases := migrationTestLeases()
+	mockServerRepo.On("Get", ctx, server.ID).Return(server, nil)
+	mockServerRepo.On("GetAll", ctx).Return([]*Server{server}, nil)
+	mockServerRepo.On("Save", ctx, mock.AnythingOfType("*dhcp.Server")).Return(nil)
+	mockLeaseRepo.On("GetByServerID", ctx, server.ID).Return(leases, nil)
+	mockLeaseRepo.On("Save", ctx, mock.AnythingOfType("*dhcp.Lease")).Return(nil)
+
+	result, err := service.MigrateServer(ctx, server.ID, MigrationRequest{
+		Config: migrationTestConfig(),
+		Mode:   RemapByMapping,
+		Mapping: map[string]net.IP{
+			"00-11-22-33-44-55": net.ParseIP("10.20.0.50"),
+			"00:11:22:33:44:66": net.ParseIP("10.20.0.51"),
+		},
+	})
+
+	require.NoError(t, err)
+	assert.False(t, result.DryRun)
+
+	// Lease metadata is carried over and boot menu network settings follow the server
+	migrated := leases[0]
+	assert.Equal(t, "10.20.0.50", migrated.IP.String())
+	assert.Equal(t, "10.20.0.50", migrated.Menu.IP.String())
+	assert.Equal(t, "10.20.0.1", migrated.Menu.Gateway.String())
+	assert.Equal(t, "node1", migrated.Menu.Hostname)
+	assert.Equal(t, "admin", migrated.IPMI.Username)
+	assert.Equal(t, "10.99.0.5", migrated.IPMI.IP.String())
+	assert.Equal(t, StateComplete, migrated.State)
+	assert.True(t, migrated.Reserved)
+	assert.Equal(t, "10.20.0.51", leases[1].IP.String())
+
+	mockServerRepo.AssertCalled(t, "Save", ctx, mock.MatchedBy(func(s *Server) bool {
+		return s.IP.Equal(net.ParseIP("10.20.0.10")) && s.Options.TFTPServer.Equal(net.ParseIP("10.20.0.10"))
+	}))
+}
+
+func TestDHCPServerService_MigrateServer_Conflicts(t *testing.T) {
+	ctx := context.Background()
+	mockServerRepo := &MockServerRepository{}
+	mockLeaseRepo := &MockLeaseRepository{}
+	service := NewDHCPServerService(mockServerRepo, mockLeaseRepo)
+
+	server := migrationTestServer()
+	mockServerRepo.On("Get", ctx, server.ID).Return(server, nil)
+	mockServerRepo.On("GetAll", ctx).Return([]*Server{server}, nil)
+	mockLeaseRepo.On("GetByServerID", ctx, server.ID).Return(migrationTestLeases(), nil)
+
+	result, err := service.MigrateServer(ctx, server.ID, MigrationRequest{
+		Config: migrationTestConfig(),
+		Mode:   RemapByMapping,
+		Mapping: map[string]net.IP{
+			"00:11:22:33:44:55": net.ParseIP("10.20.0.1"),
+		},
+	})
+
+	require.Error(t, err)
+	require.NotNil(t, result)
+	assert.True(t, result.HasConflicts())
+	assert.Contains(t, result.Leases[0].Error, "gateway")
+	assert.Contains(t, result.Leases[1].Error, "no mapping")
+	mockServerRepo.AssertNotCalled(t, "Save", mock.Anything, mock.Anything)
+}
+
+func TestDHCPServerService_MigrateServer_RollsBackOnSaveFailure(t *testing.T) {
+	ctx := context.Background()
+	mockServerRepo := &MockServerRepository{}
+	mockLeaseRepo := &MockLeaseRepository{}
+	service := NewDHCPServerService(mockServerRepo, mockLeaseRepo)
+
+	server := migrationTestServer()
+	mockServerRepo.On("Get", ctx, server.ID).Return(server, nil)
+	mockServerRepo.On("GetAll", ctx).Return([]*Server{server}, nil)
+	mockServerRepo.On("Save", ctx, mock.AnythingOfType("*dhcp.Server")).Return(nil)
+	mockLeaseRepo.On("GetByServerID", ctx, server.ID).Return(migrationTestLeases(), nil)
+	mockLeaseRepo.On("Save", ctx, mock.MatchedBy(func(l *Lease) bool { return l.ID == "lease-1" })).Return(nil)
+	mockLeaseRepo.On("Save", ctx, mock.MatchedBy(func(l *Lease) bool { return l.ID == "lease-2" })).Return(assert.AnError)
+
+	_, err := service.MigrateServer(ctx, server.ID, MigrationRequest{Config: migrationTestConfig()})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "rolled back")
+
+	// The server and the lease saved before the failure are put back
+	serverSaves := savedArgs[*Server](mockServerRepo.Calls)
+	require.Len(t, serverSaves, 2)
+	assert.Equal(t, "10.20.0.10", serverSaves[0].IP.String())
+	assert.Equal(t, "192.168.1.10", serverSaves[1].IP.String())
+
+	leaseSaves := savedArgs[*Lease](mockLeaseRepo.Calls)
+	require.Len(t, leaseSaves, 3)
+	assert.Equal(t, "lease-1", leaseSaves[2].ID)
+	assert.Equal(t, "192.168.1.120", leaseSaves[2].IP.String())
+	assert.Equal(t, "192.168.1.120", leaseSaves[2].Menu.IP.String())
+}
+
+func TestDHCPServerService_MigrateServer_ReaddressesVLAN(t *testing.T) {
+	ctx := context.Background()
+	oldAddr := mock.MatchedBy(func(a *net.IPNet) bool { return a.String() == "192.168.1.10/24" })
+	newAddr := mock.MatchedBy(func(a *net.IPNet) bool { return a.String() == "10.20.0.10/24" })
+
+	setup := func(leaseErr error) (*DHCPServerService, *MockVLANManager) {
+		mockServerRepo := &MockServerRepository{}
+		mockLeaseRepo := &MockLeaseRepository{}
+		mockVLANs := &MockVLANManager{}
+		service := NewDHCPServerService(mockServerRepo, mockLeaseRepo).SetVLANManager(mockVLANs)
+
+		server := migrationTestServer()
+		server.Interface, server.VLANID, server.VLANParent, server.VLANManaged = "eth0.100", 100, "eth0", true
+		mockServerRepo.On("Get", ctx, server.ID).Return(server, nil)
+		mockServerRepo.On("GetAll", ctx).Return([]*Server{server}, nil)
+		mockServerRepo.On("Save", ctx, mock.AnythingOfType("*dhcp.Server")).Return(nil)
+		mockLeaseRepo.On("GetByServerID", ctx, server.ID).Return(migrationTestLeases(), nil)
+		mockLeaseRepo.On("Save", ctx, mock.AnythingOfType("*dhcp.Lease")).Return(leaseErr)
+		mockVLANs.On("ReplaceAddress", "eth0.100", mock.Anything, mock.Anything).Return(nil)
+		return service, mockVLANs
+	}
+
+	service, mockVLANs := setup(nil)
+	result, err := service.MigrateServer(ctx, "server-1", MigrationRequest{Config: migrationTestConfig()})
+	require.NoError(t, err)
+	assert.Equal(t, "eth0.100", result.Server.Interface)
+	mockVLANs.AssertCalled(t, "ReplaceAddress", "eth0.100", oldAddr, newAddr)
+	mockVLANs.AssertNumberOfCalls(t, "ReplaceAddress", 1)
+
+	// A failed migration gives the subinterface its old address back
+	service, mockVLANs = setup(assert.AnError)
+	_, err = service.MigrateServer(ctx, "server-1", MigrationRequest{Config: migrationTestConfig()})
+	require.Error(t, err)
+	mockVLANs.AssertCalled(t, "ReplaceAddress", "eth0.100", oldAddr, newAddr)
+	mockVLANs.AssertCalled(t, "ReplaceAddress", "eth0.100", newAddr, oldAddr)
+}
+
+// savedArgs returns the values passed to Save, in call order
+func savedArgs[T any](calls []mock.Call) []T {
+	var saved []T
+	for _, call := range calls {
+		if call.Method == "Save" {
+			saved = append(saved, call.Arguments.Get(1).(T))
+		}
+	}
+	return saved
+}
+
+func TestDHCPServerService_UpdateServer_RejectsIPChange(t *testing.T) {
+	ctx := context.Background()
+	mockServerRepo := &MockServerRepository{}
+	mockLeaseRepo := &MockLeaseRepository{}
+	service := NewDHCPServerService(mockServerRepo, mockLeaseRepo)
+
+	server := migrationTestServer()
+	mockServerRepo.On("Get", ctx, server.ID).Return(server, nil)
+
+	err := service.UpdateServer(ctx, server.ID, migrationTestConfig())
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "migrate")
+}
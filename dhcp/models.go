@@ -1,6 +1,10 @@
 package dhcp
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
 	"net"
 	"time"
 )
@@ -9,6 +13,11 @@ import (
 type Server struct {
 	ID            string        `json:"id"`
 	IP            net.IP        `json:"ip"`
+	Interface     string        `json:"interface,omitempty"`
+	VLANID        int           `json:"vlan_id,omitempty"`
+	VLANParent    string        `json:"vlan_parent,omitempty"`
+	VLANManaged   bool          `json:"vlan_managed,omitempty"` // Subinterface was created by ignite
+	TFTPRoot      string        `json:"tftp_root,omitempty"`
 	Options       DHCPOptions   `json:"options"`
 	IPStart       net.IP        `json:"ip_start"`
 	Started       bool          `json:"started"`
@@ -28,18 +37,20 @@ type DHCPOptions struct {
 
 // Lease represents an IP lease assignment
 type Lease struct {
-	ID             string            `json:"id"`
-	IP             net.IP            `json:"ip"`
-	MAC            string            `json:"mac"`
-	Expiry         time.Time         `json:"expiry"`
-	Reserved       bool              `json:"reserved"`
-	ServerID       string            `json:"server_id"`
-	Menu           BootMenu          `json:"menu"`
-	IPMI           IPMI              `json:"ipmi"`
-	State          string            `json:"state"`
-	StateUpdatedAt time.Time         `json:"state_updated_at"`
-	LastSeen       time.Time         `json:"last_seen"`
-	StateHistory   []StateTransition `json:"state_history"`
+	ID              string            `json:"id"`
+	IP              net.IP            `json:"ip"`
+	MAC             string            `json:"mac"`
+	Expiry          time.Time         `json:"expiry"`
+	Reserved        bool              `json:"reserved"`
+	ServerID        string            `json:"server_id"`
+	Menu            BootMenu          `json:"menu"`
+	IPMI            IPMI              `json:"ipmi"`
+	State           string            `json:"state"`
+	StateUpdatedAt  time.Time         `json:"state_updated_at"`
+	LastSeen        time.Time         `json:"last_seen"`
+	StateHistory    []StateTransition `json:"state_history"`
+	ConfigFetchedAt time.Time         `json:"config_fetched_at,omitempty"` // When the installer last fetched its provisioning config
+	Token           string            `json:"token,omitempty"`             // Authenticates the installer's phone-home reports
 }
 
 // StateTransition represents a state change event
@@ -47,7 +58,8 @@ type StateTransition struct {
 	FromState string    `json:"from_state"`
 	ToState   string    `json:"to_state"`
 	Timestamp time.Time `json:"timestamp"`
-	Source    string    `json:"source"` // "dhcp", "pxe", "imaging", "manual", "heartbeat"
+	Source    string    `json:"source"`            // "dhcp", "pxe", "imaging", "manual", "heartbeat", "installer"
+	Message   string    `json:"message,omitempty"` // Payload of an installer report
 }
 
 // LeaseState constants
@@ -132,11 +144,83 @@ func (l *Lease) UpdateState(newState, source string) {
 	l.LastSeen = time.Now()
 }
 
+// Report records a state report from the host's installer. Unlike
+// UpdateState it also records reports of the current state, so every message
+// is kept in the history.
+func (l *Lease) Report(state, source, message string) {
+	now := time.Now()
+	l.StateHistory = append(l.StateHistory, StateTransition{
+		FromState: l.State,
+		ToState:   state,
+		Timestamp: now,
+		Source:    source,
+		Message:   message,
+	})
+	if l.State != state {
+		l.State = state
+		l.StateUpdatedAt = now
+	}
+	l.LastSeen = now
+}
+
+// Heartbeat records that the host's installer is still running. A message is
+// kept in the history, replacing the previous heartbeat's if nothing else was
+// recorded since, so periodic heartbeats don't grow the history.
+func (l *Lease) Heartbeat(message string) {
+	now := time.Now()
+	l.LastSeen = now
+	if message == "" {
+		return
+	}
+	if n := len(l.StateHistory); n > 0 {
+		last := &l.StateHistory[n-1]
+		if last.Source == "heartbeat" && last.FromState == l.State && last.ToState == l.State {
+			last.Timestamp = now
+			last.Message = message
+			return
+		}
+	}
+	l.StateHistory = append(l.StateHistory, StateTransition{
+		FromState: l.State,
+		ToState:   l.State,
+		Timestamp: now,
+		Source:    "heartbeat",
+		Message:   message,
+	})
+}
+
+// CheckToken returns true if token is the lease's phone-home token
+func (l *Lease) CheckToken(token string) bool {
+	return l.Token != "" && subtle.ConstantTimeCompare([]byte(l.Token), []byte(token)) == 1
+}
+
+// NewToken returns a random phone-home token for a lease
+func NewToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
 // IsActive returns true if the lease is in an active state
 func (l *Lease) IsActive() bool {
 	return l.State != StateOffline && l.State != StateFailed
 }
 
+// IsArmed returns true if the host should boot its installer rather than
+// its local disk: it has a boot menu and has not finished installing
+func (l *Lease) IsArmed() bool {
+	if l.Menu.OS == "" {
+		return false
+	}
+	switch l.State {
+	case StateImaged, StateConfiguring, StateComplete:
+		return false
+	}
+	return true
+}
+
 // BootMenu contains PXE boot configuration
 type BootMenu struct {
 	Filename      string `json:"filename"`
@@ -150,6 +234,29 @@ type BootMenu struct {
 	Gateway       net.IP `json:"gateway"`
 	DNS           net.IP `json:"dns"`
 	KernelOptions string `json:"kernel_options"`
+	InstallDevice string `json:"install_device,omitempty"` // Disk image-based installers such as CoreOS write to
+
+	// Autoinstall holds the structured settings for autoinstall templates
+	Autoinstall *AutoinstallSettings `json:"autoinstall,omitempty"`
+}
+
+// AutoinstallSettings are the structured Ubuntu autoinstall settings set on a
+// host's boot menu. They override the matching sections of the autoinstall
+// template; packages and late-commands are added to the template's own.
+type AutoinstallSettings struct {
+	StorageLayout  string   `json:"storage_layout,omitempty"`
+	Username       string   `json:"username,omitempty"`
+	RealName       string   `json:"realname,omitempty"`
+	PasswordHash   string   `json:"password_hash,omitempty"`
+	AuthorizedKeys []string `json:"authorized_keys,omitempty"`
+	Packages       []string `json:"packages,omitempty"`
+	LateCommands   []string `json:"late_commands,omitempty"`
+}
+
+// IsZero reports whether no settings are set
+func (a *AutoinstallSettings) IsZero() bool {
+	return a == nil || (a.StorageLayout == "" && a.Username == "" && a.RealName == "" &&
+		a.PasswordHash == "" && len(a.AuthorizedKeys) == 0 && len(a.Packages) == 0 && len(a.LateCommands) == 0)
 }
 
 // IPMI holds IPMI configuration for remote server management
@@ -166,6 +273,13 @@ func (l *Lease) IsExpired() bool {
 	return time.Now().After(l.Expiry)
 }
 
+// Holds reports whether the lease currently holds ip. An expired lease only
+// does if it is reserved, since its address may since have been handed to
+// another host.
+func (l *Lease) Holds(ip net.IP) bool {
+	return ip != nil && l.IP.Equal(ip) && (l.Reserved || !l.IsExpired())
+}
+
 // Extend extends the lease expiry time
 func (l *Lease) Extend(duration time.Duration) {
 	l.Expiry = time.Now().Add(duration)
@@ -176,6 +290,16 @@ func (s *Server) GetNetworkAddress() net.IP {
 	return s.IP.Mask(net.IPMask(s.Options.SubnetMask))
 }
 
+// GetSubnet returns the IPv4 network the server is attached to
+func (s *Server) GetSubnet() *net.IPNet {
+	return subnetFor(s.IP, s.Options.SubnetMask)
+}
+
+// GetRangeEnd returns the last address of the server's lease range
+func (s *Server) GetRangeEnd() net.IP {
+	return incrementIP(s.IPStart, s.LeaseRange-1)
+}
+
 // IsInRange checks if an IP is within the server's lease range
 func (s *Server) IsInRange(ip net.IP) bool {
 	if s.IPStart == nil || len(s.IPStart) != len(ip) {
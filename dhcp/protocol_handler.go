@@ -13,11 +13,21 @@ import (
 	d4 "github.com/krolaw/dhcp4"
 )
 
+// dhcpServerPort is the port DHCP servers listen on
+const dhcpServerPort = 67
+
+// packetListener is the socket a ProtocolHandler serves DHCP packets on
+type packetListener interface {
+	d4.ServeConn
+	Close() error
+}
+
 // ProtocolHandler handles DHCP protocol packets for a specific server
 type ProtocolHandler struct {
 	server    *Server
 	leaseRepo LeaseRepository
-	listener  net.PacketConn
+	listener  packetListener
+	port      int
 	ctx       context.Context
 	cancel    context.CancelFunc
 }
@@ -27,6 +37,7 @@ func NewProtocolHandler(server *Server, leaseRepo LeaseRepository) *ProtocolHand
 	return &ProtocolHandler{
 		server:    server,
 		leaseRepo: leaseRepo,
+		port:      dhcpServerPort,
 	}
 }
 
@@ -39,10 +50,9 @@ func (h *ProtocolHandler) Start() error {
 	h.ctx, h.cancel = context.WithCancel(context.Background())
 
 	var err error
-	addr := &net.UDPAddr{IP: h.server.IP, Port: 67}
-	h.listener, err = net.ListenUDP("udp4", addr)
+	h.listener, err = h.listen()
 	if err != nil {
-		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+		return err
 	}
 
 	go func() {
@@ -60,6 +70,49 @@ func (h *ProtocolHandler) Start() error {
 	return nil
 }
 
+// listen opens the server socket. A server bound to an interface listens on
+// 0.0.0.0 restricted to that interface, so it sees broadcasts from clients
+// without an address and its replies leave on the same link. Otherwise it
+// listens on the server IP only.
+func (h *ProtocolHandler) listen() (packetListener, error) {
+	if h.server.Interface == "" {
+		addr := &net.UDPAddr{IP: h.server.IP, Port: h.port}
+		listener, err := net.ListenUDP("udp4", addr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+		}
+		return listener, nil
+	}
+
+	iface, err := net.InterfaceByName(h.server.Interface)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find interface %s: %w", h.server.Interface, err)
+	}
+	if !interfaceHasIP(iface, h.server.IP) {
+		log.Printf("Warning: interface %s does not have server IP %s assigned", iface.Name, h.server.IP)
+	}
+
+	listener, err := listenOnInterface(iface.Name, h.port)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on interface %s port %d: %w", iface.Name, h.port, err)
+	}
+	return listener, nil
+}
+
+// interfaceHasIP checks whether ip is one of the addresses assigned to iface
+func interfaceHasIP(iface *net.Interface, ip net.IP) bool {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
 // Stop stops the DHCP protocol handler
 func (h *ProtocolHandler) Stop() error {
 	if h.cancel != nil {
@@ -0,0 +1,96 @@
+package dhcp
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	d4 "github.com/krolaw/dhcp4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// TestProtocolHandler_BoundToInterface serves on the loopback device with
+// SO_BINDTODEVICE and checks a DISCOVER gets an OFFER from the bound socket
+func TestProtocolHandler_BoundToInterface(t *testing.T) {
+	loopback := loopbackInterface(t)
+
+	server := &Server{
+		ID:            "lo-server",
+		IP:            net.ParseIP("127.0.0.1"),
+		Interface:     loopback,
+		IPStart:       net.ParseIP("127.0.0.100"),
+		LeaseRange:    10,
+		LeaseDuration: time.Hour,
+		Options: DHCPOptions{
+			SubnetMask: net.ParseIP("255.0.0.0"),
+			Gateway:    net.ParseIP("127.0.0.1"),
+			DNS:        net.ParseIP("127.0.0.1"),
+		},
+	}
+
+	leaseRepo := &MockLeaseRepository{}
+	leaseRepo.On("GetByMAC", mock.Anything, mock.Anything).Return(nil, errors.New("not found"))
+	leaseRepo.On("GetByServerID", mock.Anything, server.ID).Return([]*Lease{}, nil)
+
+	client, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer client.Close()
+
+	// Pick a free port rather than 67 so the test does not clash with a real server
+	probe, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	port := probe.LocalAddr().(*net.UDPAddr).Port
+	probe.Close()
+
+	handler := NewProtocolHandler(server, leaseRepo)
+	handler.port = port
+	if err := handler.Start(); err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			t.Skipf("binding to an interface needs CAP_NET_RAW: %v", err)
+		}
+		require.NoError(t, err)
+	}
+	defer handler.Stop()
+
+	mac, _ := net.ParseMAC("aa:bb:cc:dd:ee:ff")
+	discover := d4.RequestPacket(d4.Discover, mac, nil, []byte{1, 2, 3, 4}, false, nil)
+	_, err = client.WriteTo(discover, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port})
+	require.NoError(t, err)
+
+	require.NoError(t, client.SetReadDeadline(time.Now().Add(2*time.Second)))
+	buffer := make([]byte, 1500)
+	n, _, err := client.ReadFrom(buffer)
+	require.NoError(t, err)
+
+	reply := d4.Packet(buffer[:n])
+	options := reply.ParseOptions()
+	assert.Equal(t, []byte{byte(d4.Offer)}, options[d4.OptionDHCPMessageType])
+	assert.True(t, reply.YIAddr().Equal(net.ParseIP("127.0.0.100")))
+}
+
+// TestProtocolHandler_UnknownInterface fails to start on a missing device
+func TestProtocolHandler_UnknownInterface(t *testing.T) {
+	server := &Server{ID: "missing", IP: net.ParseIP("10.0.0.1"), Interface: "ignite-missing0"}
+	handler := NewProtocolHandler(server, &MockLeaseRepository{})
+
+	err := handler.Start()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ignite-missing0")
+}
+
+// loopbackInterface returns the name of the loopback device or skips the test
+func loopbackInterface(t *testing.T) string {
+	interfaces, err := net.Interfaces()
+	require.NoError(t, err)
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagLoopback != 0 && iface.Flags&net.FlagUp != 0 {
+			return iface.Name
+		}
+	}
+	t.Skip("no loopback interface available")
+	return ""
+}
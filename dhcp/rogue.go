@@ -0,0 +1,452 @@
+// dhcp/rogue.go - Rogue DHCP server detection
+package dhcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	d4 "github.com/krolaw/dhcp4"
+)
+
+// dhcpClientPort is the port DHCP clients listen on for replies
+const dhcpClientPort = 68
+
+// DHCPOffer is an OFFER received in reply to a detection probe
+type DHCPOffer struct {
+	ServerIP  net.IP `json:"server_ip"`  // Server identifier option, or the source address
+	SourceIP  net.IP `json:"source_ip"`  // Address the OFFER was sent from
+	OfferedIP net.IP `json:"offered_ip"` // Address offered to the probe
+}
+
+// RogueServer is a DHCP server answering on a managed interface that is not ignite
+type RogueServer struct {
+	Interface string    `json:"interface"`
+	ServerIP  net.IP    `json:"server_ip"`
+	SourceIP  net.IP    `json:"source_ip"`
+	MAC       string    `json:"mac,omitempty"`
+	OfferedIP net.IP    `json:"offered_ip"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Count     int       `json:"count"`
+	Active    bool      `json:"active"` // Seen in the latest scan of its interface
+}
+
+// RogueAlertHook is called when a rogue server is first seen, or seen again after going quiet
+type RogueAlertHook func(rogue RogueServer)
+
+// DiscoverProber sends a DHCPDISCOVER on an interface and returns the offers received
+type DiscoverProber interface {
+	Probe(ctx context.Context, iface string) ([]DHCPOffer, error)
+}
+
+// RogueDetector periodically probes every interface ignite serves DHCP on and
+// records offers from servers that are not ignite
+type RogueDetector struct {
+	serverRepo ServerRepository
+	prober     DiscoverProber
+	interval   time.Duration
+	resolveMAC func(ip net.IP) string
+
+	mu         sync.RWMutex
+	rogues     map[string]*RogueServer
+	scanErrors map[string]string
+	lastScan   time.Time
+	hooks      []RogueAlertHook
+}
+
+// NewRogueDetector creates a detector that scans every interval
+func NewRogueDetector(serverRepo ServerRepository, prober DiscoverProber, interval time.Duration) *RogueDetector {
+	return &RogueDetector{
+		serverRepo: serverRepo,
+		prober:     prober,
+		interval:   interval,
+		resolveMAC: neighborMAC,
+		rogues:     make(map[string]*RogueServer),
+		scanErrors: make(map[string]string),
+	}
+}
+
+// AddAlertHook registers a hook called for new rogue servers
+func (d *RogueDetector) AddAlertHook(hook RogueAlertHook) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.hooks = append(d.hooks, hook)
+}
+
+// Start scans in the background until ctx is cancelled. A zero interval disables scanning.
+func (d *RogueDetector) Start(ctx context.Context) {
+	if d.interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+
+		for {
+			if err := d.Scan(ctx); err != nil {
+				log.Printf("Rogue DHCP scan failed: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Scan probes every managed interface once
+func (d *RogueDetector) Scan(ctx context.Context) error {
+	servers, err := d.serverRepo.GetAll(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get servers: %w", err)
+	}
+
+	igniteIPs := make(map[string]bool)
+	for _, server := range servers {
+		if server.IP != nil {
+			igniteIPs[server.IP.String()] = true
+		}
+	}
+
+	var alerts []RogueServer
+	scanErrors := make(map[string]string)
+
+	for _, iface := range managedInterfaces(servers) {
+		offers, err := d.prober.Probe(ctx, iface)
+		if err != nil {
+			scanErrors[iface] = err.Error()
+			continue
+		}
+
+		now := time.Now()
+		seen := make(map[string]bool)
+		for _, offer := range offers {
+			if igniteIPs[offer.ServerIP.String()] || igniteIPs[offer.SourceIP.String()] {
+				continue
+			}
+			key := iface + "/" + offer.ServerIP.String()
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			if rogue, alert := d.record(key, iface, offer, now); alert {
+				alerts = append(alerts, rogue)
+			}
+		}
+		d.markInactive(iface, seen)
+	}
+
+	d.mu.Lock()
+	d.scanErrors = scanErrors
+	d.lastScan = time.Now()
+	hooks := append([]RogueAlertHook(nil), d.hooks...)
+	d.mu.Unlock()
+
+	for _, rogue := range alerts {
+		for _, hook := range hooks {
+			hook(rogue)
+		}
+	}
+
+	return nil
+}
+
+// record updates or adds a rogue server, returning whether it should be alerted on
+func (d *RogueDetector) record(key, iface string, offer DHCPOffer, now time.Time) (RogueServer, bool) {
+	d.mu.Lock()
+	rogue, exists := d.rogues[key]
+	alert := !exists || !rogue.Active
+	if !exists {
+		rogue = &RogueServer{
+			Interface: iface,
+			ServerIP:  offer.ServerIP,
+			FirstSeen: now,
+		}
+		d.rogues[key] = rogue
+	}
+	rogue.SourceIP = offer.SourceIP
+	rogue.OfferedIP = offer.OfferedIP
+	rogue.LastSeen = now
+	rogue.Count++
+	rogue.Active = true
+	needsMAC := rogue.MAC == ""
+	d.mu.Unlock()
+
+	// Resolve outside the lock since it may wait on ARP
+	if needsMAC && d.resolveMAC != nil {
+		if mac := d.resolveMAC(offer.SourceIP); mac != "" {
+			d.mu.Lock()
+			rogue.MAC = mac
+			d.mu.Unlock()
+		}
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return *rogue, alert
+}
+
+// markInactive flags rogues on iface that did not answer the latest probe
+func (d *RogueDetector) markInactive(iface string, seen map[string]bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for key, rogue := range d.rogues {
+		if rogue.Interface == iface && !seen[key] {
+			rogue.Active = false
+		}
+	}
+}
+
+// RogueServers returns every rogue server seen, most recent first
+func (d *RogueDetector) RogueServers() []RogueServer {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	rogues := make([]RogueServer, 0, len(d.rogues))
+	for _, rogue := range d.rogues {
+		rogues = append(rogues, *rogue)
+	}
+	sort.Slice(rogues, func(i, j int) bool {
+		return rogues[i].LastSeen.After(rogues[j].LastSeen)
+	})
+	return rogues
+}
+
+// ScanErrors returns the probe errors from the latest scan, keyed by interface
+func (d *RogueDetector) ScanErrors() map[string]string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	errs := make(map[string]string, len(d.scanErrors))
+	for iface, err := range d.scanErrors {
+		errs[iface] = err
+	}
+	return errs
+}
+
+// LastScan returns when the latest scan finished
+func (d *RogueDetector) LastScan() time.Time {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.lastScan
+}
+
+// Clear forgets every recorded rogue server
+func (d *RogueDetector) Clear() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.rogues = make(map[string]*RogueServer)
+}
+
+// managedInterfaces returns the interfaces ignite serves DHCP on, from each
+// server's bound interface or the interface holding its IP
+func managedInterfaces(servers []*Server) []string {
+	seen := make(map[string]bool)
+	var names []string
+
+	for _, server := range servers {
+		name := server.Interface
+		if name == "" {
+			name = interfaceForIP(server.IP)
+		}
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// interfaceForIP finds the local interface an address is assigned to
+func interfaceForIP(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return ""
+	}
+	for _, iface := range interfaces {
+		if interfaceHasIP(&iface, ip) {
+			return iface.Name
+		}
+	}
+	return ""
+}
+
+// UDPDiscoverProber probes with a real DHCPDISCOVER broadcast from the interface
+type UDPDiscoverProber struct {
+	timeout time.Duration
+}
+
+// NewDiscoverProber creates a prober that waits timeout for offers
+func NewDiscoverProber(timeout time.Duration) *UDPDiscoverProber {
+	return &UDPDiscoverProber{timeout: timeout}
+}
+
+// Probe broadcasts a DISCOVER with the broadcast flag set and collects offers until the timeout
+func (p *UDPDiscoverProber) Probe(ctx context.Context, ifaceName string) ([]DHCPOffer, error) {
+	iface, err := net.InterfaceByName(ifaceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find interface %s: %w", ifaceName, err)
+	}
+
+	conn, err := listenOnInterface(iface.Name, dhcpClientPort)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on interface %s port %d: %w", iface.Name, dhcpClientPort, err)
+	}
+
+	// Closing the socket ends the read loop once the timeout passes
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	xid := make([]byte, 4)
+	if _, err := rand.Read(xid); err != nil {
+		return nil, fmt.Errorf("failed to generate transaction ID: %w", err)
+	}
+	mac := iface.HardwareAddr
+	if len(mac) == 0 {
+		mac = net.HardwareAddr{0x02, xid[0], xid[1], xid[2], xid[3], 0x01} // Locally administered
+	}
+
+	discover := d4.RequestPacket(d4.Discover, mac, nil, xid, true, nil)
+	if _, err := conn.WriteTo(discover, &net.UDPAddr{IP: net.IPv4bcast, Port: dhcpServerPort}); err != nil {
+		return nil, fmt.Errorf("failed to send DHCPDISCOVER on %s: %w", iface.Name, err)
+	}
+
+	var offers []DHCPOffer
+	buffer := make([]byte, 1500)
+	for {
+		n, addr, err := conn.ReadFrom(buffer)
+		if err != nil {
+			break
+		}
+		if offer, ok := parseOffer(buffer[:n], xid, addr); ok {
+			offers = append(offers, offer)
+		}
+	}
+
+	return offers, nil
+}
+
+// parseOffer extracts an OFFER answering transaction xid
+func parseOffer(data []byte, xid []byte, addr net.Addr) (DHCPOffer, bool) {
+	if len(data) < 240 {
+		return DHCPOffer{}, false
+	}
+	packet := d4.Packet(data)
+	if packet.OpCode() != d4.BootReply || !bytes.Equal(packet.XId(), xid) {
+		return DHCPOffer{}, false
+	}
+
+	options := packet.ParseOptions()
+	if msgType := options[d4.OptionDHCPMessageType]; len(msgType) != 1 || d4.MessageType(msgType[0]) != d4.Offer {
+		return DHCPOffer{}, false
+	}
+
+	var source net.IP
+	if udpAddr, ok := addr.(*net.UDPAddr); ok {
+		source = udpAddr.IP
+	}
+
+	offer := DHCPOffer{
+		ServerIP:  source,
+		SourceIP:  source,
+		OfferedIP: append(net.IP(nil), packet.YIAddr()...),
+	}
+	if serverID := options[d4.OptionServerIdentifier]; len(serverID) == net.IPv4len {
+		offer.ServerIP = append(net.IP(nil), serverID...)
+	}
+	return offer, offer.ServerIP != nil
+}
+
+// neighborMAC looks ip up in the kernel ARP table, prompting an ARP request
+// if it is not there yet. Returns an empty string when it cannot be resolved.
+func neighborMAC(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	if mac := arpTableLookup(ip); mac != "" {
+		return mac
+	}
+
+	// Sending anything makes the kernel resolve the address
+	if conn, err := net.DialUDP("udp4", nil, &net.UDPAddr{IP: ip, Port: 9}); err == nil {
+		conn.Write([]byte{0})
+		conn.Close()
+		time.Sleep(500 * time.Millisecond)
+	}
+	return arpTableLookup(ip)
+}
+
+// arpTableLookup reads /proc/net/arp for ip
+func arpTableLookup(ip net.IP) string {
+	file, err := os.Open("/proc/net/arp")
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 4 && fields[0] == ip.String() && fields[3] != "00:00:00:00:00:00" {
+			return fields[3]
+		}
+	}
+	return ""
+}
+
+// LogAlertHook logs rogue servers
+func LogAlertHook(rogue RogueServer) {
+	log.Printf("Rogue DHCP server detected on %s: server %s (source %s, MAC %s) offered %s",
+		rogue.Interface, rogue.ServerIP, rogue.SourceIP, rogue.MAC, rogue.OfferedIP)
+}
+
+// NewWebhookAlertHook posts rogue servers as JSON to url
+func NewWebhookAlertHook(url string) RogueAlertHook {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	return func(rogue RogueServer) {
+		body, err := json.Marshal(map[string]any{
+			"event": "rogue_dhcp_server",
+			"rogue": rogue,
+		})
+		if err != nil {
+			log.Printf("Failed to encode rogue DHCP alert: %v", err)
+			return
+		}
+
+		resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			log.Printf("Failed to send rogue DHCP alert: %v", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			log.Printf("Rogue DHCP alert webhook returned %s", resp.Status)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package dhcp
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	d4 "github.com/krolaw/dhcp4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProber returns canned offers per interface
+type fakeProber struct {
+	offers map[string][]DHCPOffer
+	probed []string
+}
+
+func (p *fakeProber) Probe(ctx context.Context, iface string) ([]DHCPOffer, error) {
+	p.probed = append(p.probed, iface)
+	return p.offers[iface], nil
+}
+
+func newTestRogueDetector(prober DiscoverProber) (*RogueDetector, *MockServerRepository) {
+	repo := &MockServerRepository{}
+	repo.On("GetAll", context.Background()).Return([]*Server{
+		{ID: "a", IP: net.ParseIP("10.0.0.1"), Interface: "eth0.100"},
+		{ID: "b", IP: net.ParseIP("10.0.1.1"), Interface: "eth0.101"},
+	}, nil)
+
+	detector := NewRogueDetector(repo, prober, 0)
+	detector.resolveMAC = func(ip net.IP) string { return "de:ad:be:ef:00:01" }
+	return detector, repo
+}
+
+func TestRogueDetector_IgnoresIgniteOffers(t *testing.T) {
+	prober := &fakeProber{offers: map[string][]DHCPOffer{
+		"eth0.100": {{ServerIP: net.ParseIP("10.0.0.1"), SourceIP: net.ParseIP("10.0.0.1"), OfferedIP: net.ParseIP("10.0.0.50")}},
+	}}
+	detector, _ := newTestRogueDetector(prober)
+
+	require.NoError(t, detector.Scan(context.Background()))
+
+	assert.Equal(t, []string{"eth0.100", "eth0.101"}, prober.probed)
+	assert.Empty(t, detector.RogueServers())
+	assert.False(t, detector.LastScan().IsZero())
+}
+
+func TestRogueDetector_RecordsAndAlerts(t *testing.T) {
+	rogueOffer := DHCPOffer{ServerIP: net.ParseIP("10.0.0.254"), SourceIP: net.ParseIP("10.0.0.254"), OfferedIP: net.ParseIP("10.0.0.77")}
+	prober := &fakeProber{offers: map[string][]DHCPOffer{
+		"eth0.100": {rogueOffer, rogueOffer},
+	}}
+	detector, _ := newTestRogueDetector(prober)
+
+	var alerts []RogueServer
+	detector.AddAlertHook(func(rogue RogueServer) { alerts = append(alerts, rogue) })
+
+	ctx := context.Background()
+	require.NoError(t, detector.Scan(ctx))
+	require.NoError(t, detector.Scan(ctx))
+
+	rogues := detector.RogueServers()
+	require.Len(t, rogues, 1)
+	assert.Equal(t, "eth0.100", rogues[0].Interface)
+	assert.Equal(t, "de:ad:be:ef:00:01", rogues[0].MAC)
+	assert.Equal(t, 2, rogues[0].Count, "duplicate offers in one scan count once")
+	assert.True(t, rogues[0].Active)
+	assert.Len(t, alerts, 1, "alert only when first seen")
+
+	// The rogue goes quiet, then comes back
+	prober.offers["eth0.100"] = nil
+	require.NoError(t, detector.Scan(ctx))
+	assert.False(t, detector.RogueServers()[0].Active)
+
+	prober.offers["eth0.100"] = []DHCPOffer{rogueOffer}
+	require.NoError(t, detector.Scan(ctx))
+	assert.Len(t, alerts, 2, "alert again when it reappears")
+
+	detector.Clear()
+	assert.Empty(t, detector.RogueServers())
+}
+
+func TestParseOffer(t *testing.T) {
+	mac, _ := net.ParseMAC("aa:bb:cc:dd:ee:ff")
+	xid := []byte{1, 2, 3, 4}
+	discover := d4.RequestPacket(d4.Discover, mac, nil, xid, true, nil)
+	source := &net.UDPAddr{IP: net.ParseIP("192.168.1.5"), Port: 67}
+
+	offer := d4.ReplyPacket(discover, d4.Offer, net.ParseIP("192.168.1.1").To4(), net.ParseIP("192.168.1.60").To4(), time.Hour, nil)
+	parsed, ok := parseOffer(offer, xid, source)
+	require.True(t, ok)
+	assert.True(t, parsed.ServerIP.Equal(net.ParseIP("192.168.1.1")), "server identifier wins over source")
+	assert.True(t, parsed.SourceIP.Equal(net.ParseIP("192.168.1.5")))
+	assert.True(t, parsed.OfferedIP.Equal(net.ParseIP("192.168.1.60")))
+
+	_, ok = parseOffer(offer, []byte{9, 9, 9, 9}, source)
+	assert.False(t, ok, "other transactions are ignored")
+
+	ack := d4.ReplyPacket(discover, d4.ACK, net.ParseIP("192.168.1.1").To4(), net.ParseIP("192.168.1.60").To4(), time.Hour, nil)
+	_, ok = parseOffer(ack, xid, source)
+	assert.False(t, ok, "only offers are recorded")
+}
@@ -4,16 +4,20 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
 	"time"
 
+	"ignite/network"
+
 	"github.com/google/uuid"
 )
 
 // DHCPServerService implements the ServerService interface
 type DHCPServerService struct {
-	serverRepo ServerRepository
-	leaseRepo  LeaseRepository
-	handlers   map[string]*ProtocolHandler
+	serverRepo  ServerRepository
+	leaseRepo   LeaseRepository
+	vlanManager network.VLANManager
+	handlers    map[string]*ProtocolHandler
 }
 
 // NewDHCPServerService creates a new DHCP server service
@@ -25,22 +29,46 @@ func NewDHCPServerService(serverRepo ServerRepository, leaseRepo LeaseRepository
 	}
 }
 
+// SetVLANManager enables creating VLAN subinterfaces for servers with a VLAN parent
+func (s *DHCPServerService) SetVLANManager(manager network.VLANManager) *DHCPServerService {
+	s.vlanManager = manager
+	return s
+}
+
 // CreateServer creates a new DHCP server
 func (s *DHCPServerService) CreateServer(ctx context.Context, config ServerConfig) (*Server, error) {
-	// Validate configuration
-	if err := s.validateServerConfig(config); err != nil {
+	// Check if server with this IP already exists
+	if config.IP != nil {
+		existing, err := s.serverRepo.GetByIP(ctx, config.IP)
+		if err == nil && existing != nil {
+			return nil, fmt.Errorf("server with IP %s already exists", config.IP)
+		}
+	}
+
+	// Validate configuration against the subnet and all existing servers
+	if err := s.validateServerConfig(ctx, config, ""); err != nil {
 		return nil, fmt.Errorf("invalid server configuration: %w", err)
 	}
 
-	// Check if server with this IP already exists
-	existing, err := s.serverRepo.GetByIP(ctx, config.IP)
-	if err == nil && existing != nil {
-		return nil, fmt.Errorf("server with IP %s already exists", config.IP)
+	// Create the VLAN subinterface the server will be bound to
+	vlanCreated := false
+	if config.VLANParent != "" {
+		name, created, err := s.createVLAN(config)
+		if err != nil {
+			return nil, err
+		}
+		config.Interface = name
+		vlanCreated = created
 	}
 
 	server := &Server{
 		ID:            uuid.New().String(),
 		IP:            config.IP,
+		Interface:     config.Interface,
+		VLANID:        config.VLANID,
+		VLANParent:    config.VLANParent,
+		VLANManaged:   vlanCreated,
+		TFTPRoot:      config.TFTPRoot,
 		IPStart:       config.StartIP,
 		LeaseRange:    config.LeaseRange,
 		LeaseDuration: config.LeaseDuration,
@@ -56,28 +84,58 @@ func (s *DHCPServerService) CreateServer(ctx context.Context, config ServerConfi
 	}
 
 	if err := s.serverRepo.Save(ctx, server); err != nil {
+		if vlanCreated {
+			s.deleteVLAN(server)
+		}
 		return nil, fmt.Errorf("failed to save server: %w", err)
 	}
 
 	return server, nil
 }
 
-// UpdateServer updates an existing DHCP server configuration
-func (s *DHCPServerService) UpdateServer(ctx context.Context, serverID string, config ServerConfig) error {
-	// Validate configuration
-	if err := s.validateServerConfig(config); err != nil {
-		return fmt.Errorf("invalid server configuration: %w", err)
+// createVLAN creates and addresses the subinterface described by config
+func (s *DHCPServerService) createVLAN(config ServerConfig) (string, bool, error) {
+	if s.vlanManager == nil {
+		return "", false, fmt.Errorf("VLAN management is not enabled")
+	}
+
+	addr := &net.IPNet{IP: config.IP, Mask: net.IPMask(config.SubnetMask.To4())}
+	name, created, err := s.vlanManager.CreateVLAN(config.VLANParent, config.VLANID, addr)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to create VLAN %d on %s: %w", config.VLANID, config.VLANParent, err)
 	}
+	return name, created, nil
+}
 
+// deleteVLAN removes a subinterface that ignite created for a server
+func (s *DHCPServerService) deleteVLAN(server *Server) {
+	if s.vlanManager == nil || !server.VLANManaged || server.Interface == "" {
+		return
+	}
+	if err := s.vlanManager.DeleteVLAN(server.Interface); err != nil {
+		log.Printf("Warning: failed to remove VLAN interface %s: %v", server.Interface, err)
+	}
+}
+
+// UpdateServer updates an existing DHCP server configuration
+func (s *DHCPServerService) UpdateServer(ctx context.Context, serverID string, config ServerConfig) error {
 	// Get existing server
 	server, err := s.serverRepo.Get(ctx, serverID)
 	if err != nil {
 		return fmt.Errorf("failed to get server: %w", err)
 	}
 
-	// For updates, we don't allow changing the network IP to prevent conflicts
-	// The UI should prevent this, but we enforce it here as well
-	config.IP = server.IP
+	// Changing the server IP moves every lease, which MigrateServer handles
+	if config.IP == nil {
+		config.IP = server.IP
+	} else if !config.IP.Equal(server.IP) {
+		return fmt.Errorf("cannot change server IP from %s to %s with an update, migrate the server instead", server.IP, config.IP)
+	}
+
+	// Validate configuration against the subnet and all other servers
+	if err := s.validateServerConfig(ctx, config, serverID); err != nil {
+		return fmt.Errorf("invalid server configuration: %w", err)
+	}
 
 	// If server is running, we need to stop and restart it
 	wasRunning := server.Started
@@ -89,6 +147,11 @@ func (s *DHCPServerService) UpdateServer(ctx context.Context, serverID string, c
 
 	// Update server configuration
 	server.IP = config.IP
+	// A VLAN server stays bound to its subinterface
+	if server.VLANParent == "" {
+		server.Interface = config.Interface
+	}
+	server.TFTPRoot = config.TFTPRoot
 	server.IPStart = config.StartIP
 	server.LeaseRange = config.LeaseRange
 	server.LeaseDuration = config.LeaseDuration
@@ -181,6 +244,11 @@ func (s *DHCPServerService) StopServer(ctx context.Context, serverID string) err
 
 // DeleteServer deletes a DHCP server and all its leases
 func (s *DHCPServerService) DeleteServer(ctx context.Context, serverID string) error {
+	server, err := s.serverRepo.Get(ctx, serverID)
+	if err != nil {
+		return fmt.Errorf("failed to get server: %w", err)
+	}
+
 	// Stop server if running
 	if handler, exists := s.handlers[serverID]; exists {
 		handler.Stop()
@@ -197,6 +265,9 @@ func (s *DHCPServerService) DeleteServer(ctx context.Context, serverID string) e
 		return fmt.Errorf("failed to delete server: %w", err)
 	}
 
+	// Remove the VLAN subinterface once nothing is listening on it
+	s.deleteVLAN(server)
+
 	return nil
 }
 
@@ -210,29 +281,13 @@ func (s *DHCPServerService) GetAllServers(ctx context.Context) ([]*Server, error
 	return s.serverRepo.GetAll(ctx)
 }
 
-// validateServerConfig validates server configuration
-func (s *DHCPServerService) validateServerConfig(config ServerConfig) error {
-	if config.IP == nil {
-		return fmt.Errorf("server IP cannot be nil")
-	}
-	if config.SubnetMask == nil {
-		return fmt.Errorf("subnet mask cannot be nil")
-	}
-	if config.Gateway == nil {
-		return fmt.Errorf("gateway cannot be nil")
-	}
-	if config.DNS == nil {
-		return fmt.Errorf("DNS cannot be nil")
-	}
-	if config.StartIP == nil {
-		return fmt.Errorf("start IP cannot be nil")
-	}
-	if config.LeaseRange <= 0 {
-		return fmt.Errorf("lease range must be positive")
-	}
-	if config.LeaseDuration <= 0 {
-		return fmt.Errorf("lease duration must be positive")
+// validateServerConfig validates server configuration, including overlap
+// checks against every other configured server
+func (s *DHCPServerService) validateServerConfig(ctx context.Context, config ServerConfig, excludeID string) error {
+	servers, err := s.serverRepo.GetAll(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load existing servers: %w", err)
 	}
 
-	return nil
+	return ValidateServerConfig(config, servers, excludeID)
 }
@@ -8,6 +8,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // Additional tests for DHCP services with more edge cases
@@ -110,3 +111,54 @@ func TestServerConfigValidation(t *testing.T) {
 	assert.Greater(t, config.LeaseRange, 0)
 	assert.Greater(t, config.LeaseDuration, time.Duration(0))
 }
+
+func TestDHCPLeaseService_GetLeaseByIP(t *testing.T) {
+	ctx := context.Background()
+	mockServerRepo := &MockServerRepository{}
+	mockLeaseRepo := &MockLeaseRepository{}
+
+	service := NewDHCPLeaseService(mockLeaseRepo, mockServerRepo)
+
+	expiry := time.Now().Add(time.Hour)
+	lease := &Lease{ID: "lease-1", MAC: "00:11:22:33:44:55", IP: net.ParseIP("10.0.0.50"), ServerID: "server-2", Expiry: expiry}
+	mockServerRepo.On("GetAll", ctx).Return([]*Server{{ID: "server-1"}, {ID: "server-2"}}, nil)
+	mockLeaseRepo.On("GetByServerID", ctx, "server-1").Return([]*Lease{{ID: "lease-0", IP: net.ParseIP("192.168.1.50"), Expiry: expiry}}, nil)
+	mockLeaseRepo.On("GetByServerID", ctx, "server-2").Return([]*Lease{lease}, nil)
+
+	found, err := service.GetLeaseByIP(ctx, net.ParseIP("10.0.0.50"))
+	assert.NoError(t, err)
+	assert.Equal(t, lease, found)
+
+	_, err = service.GetLeaseByIP(ctx, net.ParseIP("10.0.0.51"))
+	assert.Error(t, err)
+}
+
+func TestDHCPLeaseService_GetLeaseByIP_SkipsExpired(t *testing.T) {
+	ctx := context.Background()
+	mockServerRepo := &MockServerRepository{}
+	mockLeaseRepo := &MockLeaseRepository{}
+	service := NewDHCPLeaseService(mockLeaseRepo, mockServerRepo)
+
+	// The address was handed to a new host after the old host's lease expired
+	ip := net.ParseIP("10.0.0.50")
+	stale := &Lease{ID: "old", MAC: "00:11:22:33:44:55", IP: ip, Expiry: time.Now().Add(-time.Hour), Token: "old-token"}
+	live := &Lease{ID: "new", MAC: "00:11:22:33:44:66", IP: ip, Expiry: time.Now().Add(time.Hour)}
+	reserved := &Lease{ID: "reserved", MAC: "00:11:22:33:44:77", IP: net.ParseIP("10.0.0.60"), Reserved: true}
+	mockServerRepo.On("GetAll", ctx).Return([]*Server{{ID: "server-1"}}, nil)
+	mockLeaseRepo.On("GetByServerID", ctx, "server-1").Return([]*Lease{stale, live, reserved}, nil)
+
+	found, err := service.GetLeaseByIP(ctx, ip)
+	require.NoError(t, err)
+	assert.Equal(t, live, found)
+
+	// Reserved leases keep their address however old they are
+	found, err = service.GetLeaseByIP(ctx, net.ParseIP("10.0.0.60"))
+	require.NoError(t, err)
+	assert.Equal(t, reserved, found)
+
+	// An expired lease alone no longer holds the address
+	mockLeaseRepo.ExpectedCalls = nil
+	mockLeaseRepo.On("GetByServerID", ctx, "server-1").Return([]*Lease{stale}, nil)
+	_, err = service.GetLeaseByIP(ctx, ip)
+	assert.Error(t, err)
+}
@@ -0,0 +1,234 @@
+// dhcp/validation.go - Server configuration validation
+package dhcp
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"strings"
+
+	"ignite/network"
+)
+
+// maxInterfaceNameLen is IFNAMSIZ, including the trailing NUL
+const maxInterfaceNameLen = 16
+
+// Field names used in ConfigError, matching the ServerConfig fields they describe
+const (
+	FieldIP            = "ip"
+	FieldInterface     = "interface"
+	FieldVLANID        = "vlan_id"
+	FieldTFTPRoot      = "tftp_root"
+	FieldSubnetMask    = "subnet_mask"
+	FieldGateway       = "gateway"
+	FieldDNS           = "dns"
+	FieldStartIP       = "start_ip"
+	FieldLeaseRange    = "lease_range"
+	FieldLeaseDuration = "lease_duration"
+)
+
+// FieldError describes a problem with a single server configuration field
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ConfigError collects every field error found while validating a server configuration
+type ConfigError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+// Add records an error for a field
+func (e *ConfigError) Add(field, format string, args ...interface{}) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// HasErrors returns true if any field errors were recorded
+func (e *ConfigError) HasErrors() bool {
+	return len(e.Fields) > 0
+}
+
+// Error implements the error interface
+func (e *ConfigError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		messages = append(messages, fmt.Sprintf("%s: %s", field.Field, field.Message))
+	}
+	return strings.Join(messages, "; ")
+}
+
+// ValidateServerConfig checks a server configuration on its own and against the
+// servers that already exist. The server with excludeID is skipped so that an
+// update is not compared against itself. A *ConfigError is returned on failure.
+func ValidateServerConfig(config ServerConfig, existing []*Server, excludeID string) error {
+	errs := &ConfigError{}
+
+	if config.IP == nil {
+		errs.Add(FieldIP, "server IP cannot be nil")
+	} else if config.IP.To4() == nil {
+		errs.Add(FieldIP, "only IPv4 addresses are supported: %s", config.IP)
+	}
+	if config.Interface != "" && !validInterfaceName(config.Interface) {
+		errs.Add(FieldInterface, "invalid interface name: %q", config.Interface)
+	}
+	if config.VLANID != 0 {
+		if err := network.ValidateVLANID(config.VLANID); err != nil {
+			errs.Add(FieldVLANID, "%v", err)
+		} else if config.VLANParent != "" {
+			if _, err := network.VLANInterfaceName(config.VLANParent, config.VLANID); err != nil {
+				errs.Add(FieldInterface, "%v", err)
+			}
+		}
+	} else if config.VLANParent != "" {
+		errs.Add(FieldVLANID, "a VLAN ID is required to create a subinterface on %s", config.VLANParent)
+	}
+	if config.TFTPRoot != "" && !validTFTPRoot(config.TFTPRoot) {
+		errs.Add(FieldTFTPRoot, "TFTP root must be a relative path inside the TFTP directory: %s", config.TFTPRoot)
+	}
+	if config.SubnetMask == nil {
+		errs.Add(FieldSubnetMask, "subnet mask cannot be nil")
+	} else if ones, bits := net.IPMask(config.SubnetMask.To4()).Size(); bits != 32 || ones == 0 {
+		errs.Add(FieldSubnetMask, "invalid subnet mask: %s", config.SubnetMask)
+	}
+	if config.Gateway == nil {
+		errs.Add(FieldGateway, "gateway cannot be nil")
+	}
+	if config.DNS == nil {
+		errs.Add(FieldDNS, "DNS cannot be nil")
+	}
+	if config.StartIP == nil {
+		errs.Add(FieldStartIP, "start IP cannot be nil")
+	} else if config.StartIP.To4() == nil {
+		errs.Add(FieldStartIP, "only IPv4 addresses are supported: %s", config.StartIP)
+	}
+	if config.LeaseRange <= 0 {
+		errs.Add(FieldLeaseRange, "lease range must be positive")
+	}
+	if config.LeaseDuration <= 0 {
+		errs.Add(FieldLeaseDuration, "lease duration must be positive")
+	}
+
+	// Subnet maths only makes sense once the basic fields are present
+	if errs.HasErrors() {
+		return errs
+	}
+
+	subnet := subnetFor(config.IP, config.SubnetMask)
+	network := subnet.IP
+	broadcast := broadcastAddress(subnet)
+	endIP := incrementIP(config.StartIP, config.LeaseRange-1)
+
+	if config.IP.Equal(network) || config.IP.Equal(broadcast) {
+		errs.Add(FieldIP, "server IP %s cannot be the network or broadcast address of %s", config.IP, subnet)
+	}
+
+	if !subnet.Contains(config.Gateway) {
+		errs.Add(FieldGateway, "gateway %s is not within subnet %s", config.Gateway, subnet)
+	} else if config.Gateway.Equal(network) || config.Gateway.Equal(broadcast) {
+		errs.Add(FieldGateway, "gateway %s cannot be the network or broadcast address of %s", config.Gateway, subnet)
+	}
+
+	switch {
+	case !subnet.Contains(config.StartIP):
+		errs.Add(FieldStartIP, "start IP %s is not within subnet %s", config.StartIP, subnet)
+	case config.StartIP.Equal(network):
+		errs.Add(FieldStartIP, "start IP %s cannot be the network address of %s", config.StartIP, subnet)
+	case ipToInt(config.StartIP)+uint32(config.LeaseRange-1) < ipToInt(config.StartIP):
+		errs.Add(FieldLeaseRange, "lease range of %d overflows the IPv4 address space", config.LeaseRange)
+	case !subnet.Contains(endIP) || ipToInt(endIP) >= ipToInt(broadcast):
+		errs.Add(FieldLeaseRange, "lease range %s-%s runs past the last usable address of %s", config.StartIP, endIP, subnet)
+	default:
+		if rangeContains(config.StartIP, config.LeaseRange, config.IP) {
+			errs.Add(FieldLeaseRange, "lease range %s-%s includes the server IP %s", config.StartIP, endIP, config.IP)
+		}
+		if rangeContains(config.StartIP, config.LeaseRange, config.Gateway) {
+			errs.Add(FieldLeaseRange, "lease range %s-%s includes the gateway %s", config.StartIP, endIP, config.Gateway)
+		}
+	}
+
+	// Compare against every other configured server
+	for _, other := range existing {
+		if other == nil || other.ID == excludeID || other.IP == nil || other.Options.SubnetMask == nil {
+			continue
+		}
+
+		if other.IP.Equal(config.IP) {
+			errs.Add(FieldIP, "server with IP %s already exists", config.IP)
+			continue
+		}
+
+		if config.VLANID != 0 && other.VLANID == config.VLANID {
+			errs.Add(FieldVLANID, "VLAN %d is already served by server %s", config.VLANID, other.IP)
+		}
+
+		otherSubnet := subnetFor(other.IP, other.Options.SubnetMask)
+		if subnetsOverlap(subnet, otherSubnet) {
+			errs.Add(FieldSubnetMask, "subnet %s overlaps subnet %s of server %s", subnet, otherSubnet, other.IP)
+		}
+
+		if other.IPStart != nil && other.LeaseRange > 0 &&
+			rangesOverlap(config.StartIP, config.LeaseRange, other.IPStart, other.LeaseRange) {
+			errs.Add(FieldLeaseRange, "lease range %s-%s overlaps range %s-%s of server %s",
+				config.StartIP, endIP, other.IPStart, other.GetRangeEnd(), other.IP)
+		}
+	}
+
+	if errs.HasErrors() {
+		return errs
+	}
+	return nil
+}
+
+// validInterfaceName checks a name against the kernel's interface naming rules
+func validInterfaceName(name string) bool {
+	if len(name) >= maxInterfaceNameLen || name == "." || name == ".." {
+		return false
+	}
+	return !strings.ContainsAny(name, "/: \t\n")
+}
+
+// validTFTPRoot checks that root is a relative path that stays inside the TFTP directory
+func validTFTPRoot(root string) bool {
+	if path.IsAbs(root) || strings.Contains(root, "\\") {
+		return false
+	}
+	clean := path.Clean(root)
+	return clean != "." && clean != ".." && !strings.HasPrefix(clean, "../")
+}
+
+// subnetFor returns the IPv4 network that ip belongs to under mask
+func subnetFor(ip, mask net.IP) *net.IPNet {
+	ipMask := net.IPMask(mask.To4())
+	return &net.IPNet{IP: ip.To4().Mask(ipMask), Mask: ipMask}
+}
+
+// broadcastAddress returns the broadcast address of an IPv4 network
+func broadcastAddress(subnet *net.IPNet) net.IP {
+	broadcast := make(net.IP, net.IPv4len)
+	for i := range broadcast {
+		broadcast[i] = subnet.IP[i] | ^subnet.Mask[i]
+	}
+	return broadcast
+}
+
+// subnetsOverlap reports whether two IPv4 networks share any addresses
+func subnetsOverlap(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// rangeContains reports whether ip falls inside the range starting at start
+func rangeContains(start net.IP, size int, ip net.IP) bool {
+	if ip == nil || ip.To4() == nil {
+		return false
+	}
+	startInt := ipToInt(start)
+	ipInt := ipToInt(ip)
+	return ipInt >= startInt && ipInt-startInt < uint32(size)
+}
+
+// rangesOverlap reports whether two address ranges share any addresses
+func rangesOverlap(startA net.IP, sizeA int, startB net.IP, sizeB int) bool {
+	a := uint64(ipToInt(startA))
+	b := uint64(ipToInt(startB))
+	return a < b+uint64(sizeB) && b < a+uint64(sizeA)
+}
@@ -0,0 +1,135 @@
+package dhcp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func validTestConfig() ServerConfig {
+	return ServerConfig{
+		IP:            net.ParseIP("192.168.1.10"),
+		SubnetMask:    net.ParseIP("255.255.255.0"),
+		Gateway:       net.ParseIP("192.168.1.1"),
+		DNS:           net.ParseIP("8.8.8.8"),
+		StartIP:       net.ParseIP("192.168.1.100"),
+		LeaseRange:    50,
+		LeaseDuration: 2 * time.Hour,
+	}
+}
+
+func fieldsOf(err error) []string {
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) {
+		return nil
+	}
+	fields := make([]string, 0, len(configErr.Fields))
+	for _, field := range configErr.Fields {
+		fields = append(fields, field.Field)
+	}
+	return fields
+}
+
+func TestValidateServerConfig_SubnetMaths(t *testing.T) {
+	tests := []struct {
+		name          string
+		modify        func(c *ServerConfig)
+		expectedField string
+	}{
+		{"valid config", func(c *ServerConfig) {}, ""},
+		{"gateway outside subnet", func(c *ServerConfig) { c.Gateway = net.ParseIP("192.168.2.1") }, FieldGateway},
+		{"gateway is broadcast", func(c *ServerConfig) { c.Gateway = net.ParseIP("192.168.1.255") }, FieldGateway},
+		{"server IP is network address", func(c *ServerConfig) { c.IP = net.ParseIP("192.168.1.0") }, FieldIP},
+		{"start IP outside subnet", func(c *ServerConfig) { c.StartIP = net.ParseIP("192.168.2.100") }, FieldStartIP},
+		{"range past broadcast", func(c *ServerConfig) { c.LeaseRange = 156 }, FieldLeaseRange},
+		{"range includes server IP", func(c *ServerConfig) { c.StartIP = net.ParseIP("192.168.1.5") }, FieldLeaseRange},
+		{"non-contiguous mask", func(c *ServerConfig) { c.SubnetMask = net.ParseIP("255.0.255.0") }, FieldSubnetMask},
+		{"missing DNS", func(c *ServerConfig) { c.DNS = nil }, FieldDNS},
+		{"VLAN interface", func(c *ServerConfig) { c.Interface = "eth0.100" }, ""},
+		{"interface name too long", func(c *ServerConfig) { c.Interface = "averylonginterface0" }, FieldInterface},
+		{"interface name with slash", func(c *ServerConfig) { c.Interface = "eth0/1" }, FieldInterface},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := validTestConfig()
+			tt.modify(&config)
+
+			err := ValidateServerConfig(config, nil, "")
+			if tt.expectedField == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, fieldsOf(err), tt.expectedField)
+		})
+	}
+}
+
+func TestValidateServerConfig_RangeEndsAtLastUsableAddress(t *testing.T) {
+	config := validTestConfig()
+	config.LeaseRange = 155 // 192.168.1.100 - 192.168.1.254
+
+	assert.NoError(t, ValidateServerConfig(config, nil, ""))
+}
+
+func TestValidateServerConfig_CrossServer(t *testing.T) {
+	existing := &Server{
+		ID:         "existing",
+		IP:         net.ParseIP("192.168.1.2"),
+		IPStart:    net.ParseIP("192.168.1.120"),
+		LeaseRange: 20,
+		Options: DHCPOptions{
+			SubnetMask: net.ParseIP("255.255.255.0"),
+		},
+	}
+
+	err := ValidateServerConfig(validTestConfig(), []*Server{existing}, "")
+	require.Error(t, err)
+	assert.Contains(t, fieldsOf(err), FieldSubnetMask)
+	assert.Contains(t, fieldsOf(err), FieldLeaseRange)
+
+	// The server being updated is not compared against itself
+	assert.NoError(t, ValidateServerConfig(validTestConfig(), []*Server{existing}, "existing"))
+
+	// A server on a separate subnet does not conflict
+	existing.IP = net.ParseIP("10.0.0.2")
+	existing.IPStart = net.ParseIP("10.0.0.100")
+	assert.NoError(t, ValidateServerConfig(validTestConfig(), []*Server{existing}, ""))
+}
+
+func TestDHCPServerService_CreateServer_OverlappingSubnet(t *testing.T) {
+	ctx := context.Background()
+	mockServerRepo := &MockServerRepository{}
+	mockLeaseRepo := &MockLeaseRepository{}
+
+	service := NewDHCPServerService(mockServerRepo, mockLeaseRepo)
+	config := validTestConfig()
+
+	existing := &Server{
+		ID:         "existing",
+		IP:         net.ParseIP("192.168.1.20"),
+		IPStart:    net.ParseIP("192.168.1.200"),
+		LeaseRange: 10,
+		Options: DHCPOptions{
+			SubnetMask: net.ParseIP("255.255.0.0"),
+		},
+	}
+
+	mockServerRepo.On("GetByIP", ctx, config.IP).Return(nil, assert.AnError)
+	mockServerRepo.On("GetAll", ctx).Return([]*Server{existing}, nil)
+
+	server, err := service.CreateServer(ctx, config)
+
+	assert.Nil(t, server)
+	require.Error(t, err)
+	var configErr *ConfigError
+	assert.True(t, errors.As(err, &configErr))
+	assert.Contains(t, fieldsOf(err), FieldSubnetMask)
+	mockServerRepo.AssertNotCalled(t, "Save")
+}
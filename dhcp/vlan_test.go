@@ -0,0 +1,152 @@
+package dhcp
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockVLANManager is a mock implementation of network.VLANManager
+type MockVLANManager struct {
+	mock.Mock
+}
+
+func (m *MockVLANManager) CreateVLAN(parent string, vlanID int, addr *net.IPNet) (string, bool, error) {
+	args := m.Called(parent, vlanID, addr)
+	return args.String(0), args.Bool(1), args.Error(2)
+}
+
+func (m *MockVLANManager) DeleteVLAN(name string) error {
+	args := m.Called(name)
+	return args.Error(0)
+}
+
+func (m *MockVLANManager) ReplaceAddress(name string, old, addr *net.IPNet) error {
+	args := m.Called(name, old, addr)
+	return args.Error(0)
+}
+
+func vlanTestConfig() ServerConfig {
+	config := validTestConfig()
+	config.VLANID = 100
+	config.VLANParent = "eth0"
+	config.TFTPRoot = "racks/r100"
+	return config
+}
+
+func TestDHCPServerService_CreateServer_CreatesVLAN(t *testing.T) {
+	ctx := context.Background()
+	mockServerRepo := &MockServerRepository{}
+	mockVLANs := &MockVLANManager{}
+	service := NewDHCPServerService(mockServerRepo, &MockLeaseRepository{}).SetVLANManager(mockVLANs)
+
+	config := vlanTestConfig()
+	mockServerRepo.On("GetByIP", ctx, config.IP).Return(nil, assert.AnError)
+	mockServerRepo.On("GetAll", ctx).Return([]*Server{}, nil)
+	mockServerRepo.On("Save", ctx, mock.AnythingOfType("*dhcp.Server")).Return(nil)
+	mockVLANs.On("CreateVLAN", "eth0", 100, mock.MatchedBy(func(addr *net.IPNet) bool {
+		return addr.String() == "192.168.1.10/24"
+	})).Return("eth0.100", true, nil)
+
+	server, err := service.CreateServer(ctx, config)
+
+	require.NoError(t, err)
+	assert.Equal(t, "eth0.100", server.Interface)
+	assert.Equal(t, 100, server.VLANID)
+	assert.True(t, server.VLANManaged)
+	assert.Equal(t, "racks/r100", server.TFTPRoot)
+	mockVLANs.AssertExpectations(t)
+}
+
+func TestDHCPServerService_CreateServer_RemovesVLANOnSaveFailure(t *testing.T) {
+	ctx := context.Background()
+	mockServerRepo := &MockServerRepository{}
+	mockVLANs := &MockVLANManager{}
+	service := NewDHCPServerService(mockServerRepo, &MockLeaseRepository{}).SetVLANManager(mockVLANs)
+
+	config := vlanTestConfig()
+	mockServerRepo.On("GetByIP", ctx, config.IP).Return(nil, assert.AnError)
+	mockServerRepo.On("GetAll", ctx).Return([]*Server{}, nil)
+	mockServerRepo.On("Save", ctx, mock.AnythingOfType("*dhcp.Server")).Return(assert.AnError)
+	mockVLANs.On("CreateVLAN", "eth0", 100, mock.Anything).Return("eth0.100", true, nil)
+	mockVLANs.On("DeleteVLAN", "eth0.100").Return(nil)
+
+	_, err := service.CreateServer(ctx, config)
+
+	assert.Error(t, err)
+	mockVLANs.AssertExpectations(t)
+}
+
+func TestDHCPServerService_CreateServer_VLANWithoutManager(t *testing.T) {
+	ctx := context.Background()
+	mockServerRepo := &MockServerRepository{}
+	service := NewDHCPServerService(mockServerRepo, &MockLeaseRepository{})
+
+	config := vlanTestConfig()
+	mockServerRepo.On("GetByIP", ctx, config.IP).Return(nil, assert.AnError)
+	mockServerRepo.On("GetAll", ctx).Return([]*Server{}, nil)
+
+	_, err := service.CreateServer(ctx, config)
+
+	assert.ErrorContains(t, err, "VLAN management is not enabled")
+	mockServerRepo.AssertNotCalled(t, "Save", mock.Anything, mock.Anything)
+}
+
+func TestDHCPServerService_DeleteServer_RemovesManagedVLAN(t *testing.T) {
+	ctx := context.Background()
+	mockServerRepo := &MockServerRepository{}
+	mockLeaseRepo := &MockLeaseRepository{}
+	mockVLANs := &MockVLANManager{}
+	service := NewDHCPServerService(mockServerRepo, mockLeaseRepo).SetVLANManager(mockVLANs)
+
+	managed := &Server{ID: "managed", Interface: "eth0.100", VLANID: 100, VLANParent: "eth0", VLANManaged: true}
+	existing := &Server{ID: "existing", Interface: "eth0.200", VLANID: 200}
+
+	for _, server := range []*Server{managed, existing} {
+		mockServerRepo.On("Get", ctx, server.ID).Return(server, nil)
+		mockServerRepo.On("Delete", ctx, server.ID).Return(nil)
+		mockLeaseRepo.On("DeleteByServerID", ctx, server.ID).Return(nil)
+	}
+	mockVLANs.On("DeleteVLAN", "eth0.100").Return(nil)
+
+	require.NoError(t, service.DeleteServer(ctx, "managed"))
+	require.NoError(t, service.DeleteServer(ctx, "existing"))
+
+	mockVLANs.AssertExpectations(t)
+	mockVLANs.AssertNotCalled(t, "DeleteVLAN", "eth0.200")
+}
+
+func TestValidateServerConfig_VLAN(t *testing.T) {
+	config := vlanTestConfig()
+	assert.NoError(t, ValidateServerConfig(config, nil, ""))
+
+	config.VLANID = 4095
+	assert.Contains(t, fieldsOf(ValidateServerConfig(config, nil, "")), FieldVLANID)
+
+	config = vlanTestConfig()
+	config.VLANID = 0
+	assert.Contains(t, fieldsOf(ValidateServerConfig(config, nil, "")), FieldVLANID)
+
+	config = vlanTestConfig()
+	config.TFTPRoot = "../etc"
+	assert.Contains(t, fieldsOf(ValidateServerConfig(config, nil, "")), FieldTFTPRoot)
+
+	config = vlanTestConfig()
+	config.TFTPRoot = "/srv/tftp"
+	assert.Contains(t, fieldsOf(ValidateServerConfig(config, nil, "")), FieldTFTPRoot)
+
+	other := &Server{
+		ID:         "other",
+		IP:         net.ParseIP("10.0.0.1"),
+		VLANID:     100,
+		IPStart:    net.ParseIP("10.0.0.100"),
+		LeaseRange: 10,
+		Options:    DHCPOptions{SubnetMask: net.ParseIP("255.255.255.0")},
+	}
+	assert.Contains(t, fieldsOf(ValidateServerConfig(vlanTestConfig(), []*Server{other}, "")), FieldVLANID)
+	assert.NoError(t, ValidateServerConfig(vlanTestConfig(), []*Server{other}, "other"))
+}
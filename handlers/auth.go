@@ -184,8 +184,8 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			"/auth/logout",
 		}
 
-		// Also allow static files
-		if strings.HasPrefix(r.URL.Path, "/public/") {
+		// Also allow static files, and boot files fetched by machines as they install
+		if strings.HasPrefix(r.URL.Path, "/public/") || strings.HasPrefix(r.URL.Path, BootPrefix) {
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -14,6 +14,8 @@ func TestAuthMiddleware_PublicPaths(t *testing.T) {
 		"/public/http/css/tailwind.css",
 		"/public/http/img/logo.png",
 		"/public/http/js/app.js",
+		"/boot/vmlinuz",
+		"/boot/configs/kickstart/aa-bb-cc-dd-ee-ff",
 	}
 
 	// Create a simple handler that returns 200 OK
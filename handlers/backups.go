@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"ignite/tftp"
+)
+
+// diffContext is how many unchanged lines are shown around each change
+const diffContext = 3
+
+// maxDiffCells bounds the work done comparing two versions line by line
+const maxDiffCells = 4_000_000
+
+// BackupDevice is a device with the files it has uploaded into an area
+type BackupDevice struct {
+	Address string
+	Files   []tftp.BackupFile
+}
+
+// BackupArea is an upload area with the devices that have used it
+type BackupArea struct {
+	Name    string
+	Dir     string
+	Devices []BackupDevice
+}
+
+// BackupsData holds information for rendering the config backups page
+type BackupsData struct {
+	Title string
+	Areas []BackupArea
+}
+
+// DiffLine is one line of a comparison between two versions
+type DiffLine struct {
+	Kind    string // "add", "remove", "same" or "skip" for elided unchanged lines
+	Text    string
+	OldLine int
+	NewLine int
+}
+
+// BackupFileData holds information for rendering one backed-up file
+type BackupFileData struct {
+	Title   string
+	File    tftp.BackupFile
+	From    string
+	To      string
+	Diff    []DiffLine
+	Changes int
+}
+
+// HandleBackupsPage lists the files each device has uploaded into the upload areas
+func (h *TFTPHandlers) HandleBackupsPage(w http.ResponseWriter, r *http.Request) {
+	store := h.container.TFTPBackups
+	data := &BackupsData{Title: "Config Backups"}
+
+	if store != nil {
+		for _, area := range store.Areas() {
+			backupArea := BackupArea{Name: area.Name, Dir: area.Dir}
+			devices, err := store.Devices(area.Name)
+			if err != nil {
+				HandleError(w, r, NewInternalError(
+					fmt.Sprintf("Failed to list devices in upload area %s: %v", area.Name, err),
+					"Unable to load config backups",
+				))
+				return
+			}
+			for _, device := range devices {
+				files, err := store.Files(area.Name, device)
+				if err != nil {
+					HandleError(w, r, NewInternalError(
+						fmt.Sprintf("Failed to list backups of %s in %s: %v", device, area.Name, err),
+						"Unable to load config backups",
+					))
+					return
+				}
+				if len(files) > 0 {
+					backupArea.Devices = append(backupArea.Devices, BackupDevice{Address: device, Files: files})
+				}
+			}
+			data.Areas = append(data.Areas, backupArea)
+		}
+	}
+
+	templates := LoadTemplates()
+	if err := templates["backups"].Execute(w, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// HandleBackupFile shows the versions of one backed-up file and the changes
+// between two of them, by default the latest and the one before it
+func (h *TFTPHandlers) HandleBackupFile(w http.ResponseWriter, r *http.Request) {
+	data, err := h.backupFileData(r)
+	if err != nil {
+		HandleError(w, r, err)
+		return
+	}
+
+	templates := LoadTemplates()
+	if err := templates["backup-file"].Execute(w, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// HandleBackupVersion returns the contents of one version of a backed-up file
+func (h *TFTPHandlers) HandleBackupVersion(w http.ResponseWriter, r *http.Request) {
+	store := h.container.TFTPBackups
+	if store == nil {
+		HandleError(w, r, NewNotFoundError("TFTP uploads are not configured", "No config backups are available"))
+		return
+	}
+
+	q := r.URL.Query()
+	content, err := store.ReadVersion(q.Get("area"), q.Get("device"), q.Get("file"), q.Get("version"))
+	if err != nil {
+		HandleError(w, r, NewNotFoundError(
+			fmt.Sprintf("Backup version not found: %v", err),
+			"The requested backup version does not exist",
+		))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(content)
+}
+
+// backupFileData loads a file's versions and compares the requested pair
+func (h *TFTPHandlers) backupFileData(r *http.Request) (*BackupFileData, *AppError) {
+	store := h.container.TFTPBackups
+	if store == nil {
+		return nil, NewNotFoundError("TFTP uploads are not configured", "No config backups are available")
+	}
+
+	q := r.URL.Query()
+	area, device, name := q.Get("area"), q.Get("device"), q.Get("file")
+	file, err := store.File(area, device, name)
+	if err != nil {
+		return nil, NewNotFoundError(
+			fmt.Sprintf("Backup not found: %v", err),
+			"The requested backup does not exist",
+		)
+	}
+
+	data := &BackupFileData{Title: "Config Backup", File: file, From: q.Get("from"), To: q.Get("to")}
+	if data.To == "" {
+		data.To = file.Versions[0].ID
+	}
+	if data.From == "" && len(file.Versions) > 1 {
+		data.From = file.Versions[1].ID
+	}
+	if data.From == "" {
+		return data, nil
+	}
+
+	from, err := store.ReadVersion(area, device, name, data.From)
+	if err != nil {
+		return nil, NewNotFoundError(fmt.Sprintf("Backup version not found: %v", err), "The requested backup version does not exist")
+	}
+	to, err := store.ReadVersion(area, device, name, data.To)
+	if err != nil {
+		return nil, NewNotFoundError(fmt.Sprintf("Backup version not found: %v", err), "The requested backup version does not exist")
+	}
+
+	data.Diff = withContext(diffLines(string(from), string(to)), diffContext)
+	for _, line := range data.Diff {
+		if line.Kind == "add" || line.Kind == "remove" {
+			data.Changes++
+		}
+	}
+	return data, nil
+}
+
+// diffLines compares two texts line by line using their longest common subsequence
+func diffLines(from, to string) []DiffLine {
+	a, b := splitLines(from), splitLines(to)
+
+	// Unchanged lines at either end need no comparison
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var lines []DiffLine
+	for i := 0; i < prefix; i++ {
+		lines = append(lines, DiffLine{Kind: "same", Text: a[i], OldLine: i + 1, NewLine: i + 1})
+	}
+	lines = append(lines, diffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix], prefix)...)
+	for i := 0; i < suffix; i++ {
+		oldIndex, newIndex := len(a)-suffix+i, len(b)-suffix+i
+		lines = append(lines, DiffLine{Kind: "same", Text: a[oldIndex], OldLine: oldIndex + 1, NewLine: newIndex + 1})
+	}
+	return lines
+}
+
+// diffMiddle compares the changed region of two texts starting at line offset
+func diffMiddle(a, b []string, offset int) []DiffLine {
+	var lines []DiffLine
+	remove := func(i int) {
+		lines = append(lines, DiffLine{Kind: "remove", Text: a[i], OldLine: offset + i + 1})
+	}
+	add := func(j int) {
+		lines = append(lines, DiffLine{Kind: "add", Text: b[j], NewLine: offset + j + 1})
+	}
+
+	// Very large rewrites are shown as a whole removal and addition
+	if len(a)*len(b) > maxDiffCells {
+		for i := range a {
+			remove(i)
+		}
+		for j := range b {
+			add(j)
+		}
+		return lines
+	}
+
+	// lcs[i][j] is the length of the common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, DiffLine{Kind: "same", Text: a[i], OldLine: offset + i + 1, NewLine: offset + j + 1})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			remove(i)
+			i++
+		default:
+			add(j)
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		remove(i)
+	}
+	for ; j < len(b); j++ {
+		add(j)
+	}
+	return lines
+}
+
+// withContext keeps changed lines and up to n unchanged lines around each,
+// replacing longer unchanged runs with a single skip marker
+func withContext(lines []DiffLine, n int) []DiffLine {
+	keep := make([]bool, len(lines))
+	for i, line := range lines {
+		if line.Kind == "same" {
+			continue
+		}
+		for k := max(0, i-n); k <= min(len(lines)-1, i+n); k++ {
+			keep[k] = true
+		}
+	}
+
+	var result []DiffLine
+	for i, line := range lines {
+		if keep[i] {
+			result = append(result, line)
+		} else if i == 0 || keep[i-1] {
+			result = append(result, DiffLine{Kind: "skip"})
+		}
+	}
+	return result
+}
+
+// splitLines splits text into lines, ignoring a trailing newline
+func splitLines(text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
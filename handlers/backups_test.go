@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ignite/tftp"
+)
+
+// newBackupHandlers creates handlers over a backup store holding two versions
+// of one switch config
+func newBackupHandlers(t *testing.T) *TFTPHandlers {
+	t.Helper()
+	serveDir := t.TempDir()
+	policy, err := tftp.NewUploadPolicy([]string{"switches=backups"}, []string{"10.0.0.0/24"})
+	if err != nil {
+		t.Fatalf("NewUploadPolicy failed: %v", err)
+	}
+
+	versionsDir := filepath.Join(serveDir, "backups", "10.0.0.5", "sw1.cfg.versions")
+	if err := os.MkdirAll(versionsDir, 0755); err != nil {
+		t.Fatalf("Failed to create version directory: %v", err)
+	}
+	versions := map[string]string{
+		"20260101T100000.000000000Z": "hostname sw1\nvlan 10\nend\n",
+		"20260102T100000.000000000Z": "hostname sw1\nvlan 20\nend\n",
+	}
+	for id, content := range versions {
+		if err := os.WriteFile(filepath.Join(versionsDir, id), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create version: %v", err)
+		}
+	}
+
+	return NewTFTPHandlers(&Container{TFTPBackups: tftp.NewBackupStore(serveDir, policy)})
+}
+
+func TestBackupFileDataDefaultsToLatestChange(t *testing.T) {
+	h := newBackupHandlers(t)
+	req := httptest.NewRequest("GET", "/tftp/backups/file?area=switches&device=10.0.0.5&file=sw1.cfg", nil)
+
+	data, appErr := h.backupFileData(req)
+	if appErr != nil {
+		t.Fatalf("backupFileData failed: %v", appErr)
+	}
+	if data.From != "20260101T100000.000000000Z" || data.To != "20260102T100000.000000000Z" {
+		t.Errorf("Compared %s to %s; expected the previous version against the latest", data.From, data.To)
+	}
+	if data.Changes != 2 {
+		t.Errorf("Changes = %d, expected 2", data.Changes)
+	}
+}
+
+func TestBackupVersion(t *testing.T) {
+	h := newBackupHandlers(t)
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+	}{
+		{"Existing version", "area=switches&device=10.0.0.5&file=sw1.cfg&version=20260101T100000.000000000Z", http.StatusOK},
+		{"Unknown version", "area=switches&device=10.0.0.5&file=sw1.cfg&version=20250101T100000.000000000Z", http.StatusNotFound},
+		{"Unknown area", "area=routers&device=10.0.0.5&file=sw1.cfg&version=20260101T100000.000000000Z", http.StatusNotFound},
+		{"Traversal", "area=switches&device=10.0.0.5&file=../../../etc/passwd&version=20260101T100000.000000000Z", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/tftp/backups/version?"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			h.HandleBackupVersion(rr, req)
+
+			if rr.Code != tt.status {
+				t.Fatalf("Status = %d, expected %d", rr.Code, tt.status)
+			}
+			if tt.status == http.StatusOK && rr.Body.String() != "hostname sw1\nvlan 10\nend\n" {
+				t.Errorf("Body = %q", rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	diff := withContext(diffLines("a\nb\nc\nd\ne\nf\ng\n", "a\nb\nc\nd\ne\nF\ng\nh\n"), 1)
+
+	expected := []DiffLine{
+		{Kind: "skip"},
+		{Kind: "same", Text: "e", OldLine: 5, NewLine: 5},
+		{Kind: "remove", Text: "f", OldLine: 6},
+		{Kind: "add", Text: "F", NewLine: 6},
+		{Kind: "same", Text: "g", OldLine: 7, NewLine: 7},
+		{Kind: "add", Text: "h", NewLine: 8},
+	}
+	if len(diff) != len(expected) {
+		t.Fatalf("Diff = %+v, expected %+v", diff, expected)
+	}
+	for i := range expected {
+		if diff[i] != expected[i] {
+			t.Errorf("Line %d = %+v, expected %+v", i, diff[i], expected[i])
+		}
+	}
+}
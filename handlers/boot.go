@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"ignite/bootmenu"
+	"ignite/tftp"
+)
+
+// BootPrefix is where the HTTP boot tree is served. It needs no session, since
+// installers and firmware fetch from it while machines boot.
+const BootPrefix = "/boot/"
+
+// bootConfigsDir holds the rendered provisioning configs inside the provision directory
+const bootConfigsDir = "configs"
+
+// BootHandlers serves boot files and provisioning configs over HTTP
+type BootHandlers struct {
+	container *Container
+}
+
+// NewBootHandlers creates a new BootHandlers instance
+func NewBootHandlers(container *Container) *BootHandlers {
+	return &BootHandlers{container: container}
+}
+
+// ServeBootFile serves /boot/configs/<type>/<mac> rendered from the template on
+// the host's lease, falling back to configs on disk, and everything else under
+// /boot/ from the TFTP directory as the requesting client sees it. Range
+// requests are supported for large kernels and images.
+func (h *BootHandlers) ServeBootFile(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+strings.TrimPrefix(r.URL.Path, BootPrefix)), "/")
+	clientIP := requestIP(r)
+
+	if err := h.container.BootAccess.Check(name, clientIP); err != nil {
+		log.Printf("HTTP boot: denied %s to %s: %v", name, clientIP, err)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	files := h.files(clientIP)
+	if dir, rest, ok := strings.Cut(name, "/"); ok && dir == bootConfigsDir {
+		if h.serveConfig(w, r, rest) {
+			return
+		}
+		files, name = h.configs(), rest
+	} else if err := h.checkTFTPRead(name, clientIP); err != nil {
+		log.Printf("HTTP boot: denied %s to %s: %v", name, clientIP, err)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if files == nil || name == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	file, err := files.Open(name)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("HTTP boot: failed to open %s for %s: %v", name, clientIP, err)
+		}
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+
+	content, ok := file.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			http.Error(w, "Error reading file", http.StatusInternalServerError)
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), content)
+}
+
+// serveConfig renders <type>/<mac> from the template selected on the host's
+// lease and records the fetch. It returns false if the host has no template of
+// that type, so configs written to disk by hand are served instead.
+func (h *BootHandlers) serveConfig(w http.ResponseWriter, r *http.Request, name string) bool {
+	templateType, mac, ok := strings.Cut(name, "/")
+	if !ok || h.container.BootConfigs == nil {
+		return false
+	}
+
+	data, lease, err := h.container.BootConfigs.Render(r.Context(), templateType, mac, requestIP(r))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false
+	}
+	if err != nil {
+		log.Printf("HTTP boot: failed to render %s config for %s: %v", templateType, mac, err)
+		http.Error(w, "Error rendering config", http.StatusInternalServerError)
+		return true
+	}
+
+	if r.Method != http.MethodHead {
+		if err := h.container.BootConfigs.RecordFetch(r.Context(), lease, requestIP(r)); err != nil {
+			log.Printf("HTTP boot: %v", err)
+		}
+	}
+
+	SetNoCacheHeaders(w)
+	w.Header().Set("Content-Type", bootmenu.ConfigContentType(templateType))
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	return true
+}
+
+// checkTFTPRead applies the TFTP read policy to a file served from the TFTP
+// directory. Device backups are never served over HTTP.
+func (h *BootHandlers) checkTFTPRead(name string, clientIP net.IP) error {
+	if h.container.TFTPBackups != nil && h.container.TFTPBackups.InArea(name) {
+		return fmt.Errorf("%s is in an upload area", name)
+	}
+	return h.container.TFTPAccess.Check(name, clientIP)
+}
+
+// files returns the TFTP layers as seen by clientIP
+func (h *BootHandlers) files(clientIP net.IP) fs.FS {
+	if h.container.BootFiles != nil {
+		return h.container.BootFiles(clientIP)
+	}
+	return tftpFiles(h.container)
+}
+
+// configs returns the rendered provisioning configs, confined like TFTP reads
+func (h *BootHandlers) configs() fs.FS {
+	if h.container.Config == nil || h.container.Config.Provision.Dir == "" {
+		return nil
+	}
+	return tftp.NewLayeredFS(tftp.DirLayer("provision", filepath.Join(h.container.Config.Provision.Dir, bootConfigsDir)))
+}
+
+// requestIP returns the address the request came from
+func requestIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
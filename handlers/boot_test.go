@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ignite/bootmenu"
+	"ignite/config"
+	"ignite/dhcp"
+	"ignite/tftp"
+
+	"github.com/stretchr/testify/mock"
+)
+
+func newBootHandlers(t *testing.T, subnets ...string) *BootHandlers {
+	t.Helper()
+	tftpDir, provisionDir := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(tftpDir, "vmlinuz"), []byte("0123456789"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(tftpDir, "images"), 0755); err != nil {
+		t.Fatalf("Failed to create test directory: %v", err)
+	}
+	configs := filepath.Join(provisionDir, "configs", "kickstart")
+	if err := os.MkdirAll(configs, 0755); err != nil {
+		t.Fatalf("Failed to create configs directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(configs, "aa-bb-cc-dd-ee-ff"), []byte("install"), 0644); err != nil {
+		t.Fatalf("Failed to create config: %v", err)
+	}
+
+	access, err := tftp.NewAccessPolicy(subnets, nil, nil)
+	if err != nil {
+		t.Fatalf("NewAccessPolicy failed: %v", err)
+	}
+	cfg := &config.Config{}
+	cfg.Provision.Dir = provisionDir
+	return NewBootHandlers(&Container{
+		TFTPFiles:  tftp.NewLayeredFS(tftp.DirLayer(tftp.LayerShared, tftpDir)),
+		BootAccess: access,
+		Config:     cfg,
+	})
+}
+
+func TestBootHandlers_ServeBootFile(t *testing.T) {
+	h := newBootHandlers(t)
+
+	tests := []struct {
+		name   string
+		target string
+		status int
+		body   string
+	}{
+		{"TFTP file", "/boot/vmlinuz", http.StatusOK, "0123456789"},
+		{"Rendered config", "/boot/configs/kickstart/aa-bb-cc-dd-ee-ff", http.StatusOK, "install"},
+		{"Missing file", "/boot/initrd.img", http.StatusNotFound, ""},
+		{"Directory", "/boot/images", http.StatusNotFound, ""},
+		{"Root", "/boot/", http.StatusNotFound, ""},
+		{"Traversal", "/boot/../../etc/passwd", http.StatusNotFound, ""},
+		{"Config traversal", "/boot/configs/../../etc/passwd", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/boot/", nil)
+			req.URL.Path = tt.target
+			rr := httptest.NewRecorder()
+			h.ServeBootFile(rr, req)
+
+			if rr.Code != tt.status {
+				t.Fatalf("Status = %d, expected %d", rr.Code, tt.status)
+			}
+			if tt.body != "" && rr.Body.String() != tt.body {
+				t.Errorf("Body = %q, expected %q", rr.Body.String(), tt.body)
+			}
+		})
+	}
+}
+
+func TestBootHandlers_Range(t *testing.T) {
+	h := newBootHandlers(t)
+
+	req := httptest.NewRequest("GET", "/boot/vmlinuz", nil)
+	req.Header.Set("Range", "bytes=4-")
+	rr := httptest.NewRecorder()
+	h.ServeBootFile(rr, req)
+
+	if rr.Code != http.StatusPartialContent {
+		t.Fatalf("Status = %d, expected 206", rr.Code)
+	}
+	body, _ := io.ReadAll(rr.Body)
+	if string(body) != "456789" {
+		t.Errorf("Body = %q, expected the remainder of the file", body)
+	}
+}
+
+func TestBootHandlers_SubnetRestriction(t *testing.T) {
+	h := newBootHandlers(t, "10.0.0.0/24")
+
+	for addr, status := range map[string]int{
+		"10.0.0.7:4011":    http.StatusOK,
+		"192.168.1.9:4011": http.StatusForbidden,
+	} {
+		req := httptest.NewRequest("GET", "/boot/vmlinuz", nil)
+		req.RemoteAddr = addr
+		rr := httptest.NewRecorder()
+		h.ServeBootFile(rr, req)
+
+		if rr.Code != status {
+			t.Errorf("Request from %s: status = %d, expected %d", addr, rr.Code, status)
+		}
+	}
+}
+
+func TestBootHandlers_TFTPReadPolicy(t *testing.T) {
+	h := newBootHandlers(t)
+	dir := t.TempDir()
+	for _, name := range []string{"vmlinuz", "installers/install.img", "backups/10.0.0.7/running.cfg"} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755); err != nil {
+			t.Fatalf("Failed to create test directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("data"), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+	access, err := tftp.NewAccessPolicy(nil, []string{"installers/*=10.0.1.0/24"}, nil)
+	if err != nil {
+		t.Fatalf("NewAccessPolicy failed: %v", err)
+	}
+	uploads, err := tftp.NewUploadPolicy([]string{"backups"}, nil)
+	if err != nil {
+		t.Fatalf("NewUploadPolicy failed: %v", err)
+	}
+	h.container.TFTPFiles = tftp.NewLayeredFS(tftp.DirLayer(tftp.LayerShared, dir))
+	h.container.TFTPAccess = access
+	h.container.TFTPBackups = tftp.NewBackupStore(dir, uploads)
+
+	tests := []struct {
+		target string
+		addr   string
+		status int
+	}{
+		{"/boot/vmlinuz", "10.0.0.7:4011", http.StatusOK},
+		{"/boot/installers/install.img", "10.0.1.5:4011", http.StatusOK},
+		{"/boot/installers/install.img", "10.0.0.7:4011", http.StatusForbidden},
+		{"/boot/backups/10.0.0.7/running.cfg", "10.0.0.7:4011", http.StatusForbidden},
+		{"/boot/backups/10.0.0.7/running.cfg", "10.0.0.8:4011", http.StatusForbidden},
+		{"/boot/configs/kickstart/aa-bb-cc-dd-ee-ff", "10.0.0.7:4011", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.target, nil)
+		req.RemoteAddr = tt.addr
+		rr := httptest.NewRecorder()
+		h.ServeBootFile(rr, req)
+
+		if rr.Code != tt.status {
+			t.Errorf("%s from %s: status = %d, expected %d", tt.target, tt.addr, rr.Code, tt.status)
+		}
+	}
+}
+
+func TestBootHandlers_RendersConfigFromLease(t *testing.T) {
+	h := newBootHandlers(t)
+	templateDir := filepath.Join(h.container.Config.Provision.Dir, "templates")
+	if err := os.MkdirAll(filepath.Join(templateDir, "kickstart"), 0755); err != nil {
+		t.Fatalf("Failed to create template directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(templateDir, "kickstart", "ks.templ"), []byte("network --hostname={{ .hostname }}"), 0644); err != nil {
+		t.Fatalf("Failed to create template: %v", err)
+	}
+
+	lease := &dhcp.Lease{
+		MAC:    "aa:bb:cc:dd:ee:ff",
+		IP:     net.ParseIP("10.0.0.5"),
+		Expiry: time.Now().Add(time.Hour),
+		State:  dhcp.StateBooting,
+		Menu:   dhcp.BootMenu{OS: "centos", TemplateType: "kickstart", TemplateName: "ks.templ", Hostname: "node1"},
+	}
+	servers := new(MockServerService)
+	servers.On("GetServer", mock.Anything, mock.Anything).Return(nil, errors.New("server not found"))
+	leases := new(MockLeaseService)
+	leases.On("GetLeaseByMAC", mock.Anything, "aa:bb:cc:dd:ee:ff").Return(lease, nil)
+	leases.On("UpdateLease", mock.Anything, lease).Return(nil)
+	h.container.BootConfigs = bootmenu.NewConfigRenderer(templateDir, servers, leases)
+
+	// Another host fetching the config is recorded without moving the lease
+	req := httptest.NewRequest("GET", "/boot/configs/kickstart/aa-bb-cc-dd-ee-ff", nil)
+	req.RemoteAddr = "10.0.0.9:1234"
+	rr := httptest.NewRecorder()
+	h.ServeBootFile(rr, req)
+
+	if rr.Code != http.StatusOK || rr.Body.String() != "network --hostname=node1" {
+		t.Fatalf("Response = %d %q, expected the config rendered from the lease", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if lease.State != dhcp.StateBooting || lease.ConfigFetchedAt.IsZero() {
+		t.Errorf("Lease state = %s, fetched at %v, expected only the fetch time from a foreign IP", lease.State, lease.ConfigFetchedAt)
+	}
+
+	req = httptest.NewRequest("GET", "/boot/configs/kickstart/aa-bb-cc-dd-ee-ff", nil)
+	req.RemoteAddr = "10.0.0.5:1234"
+	rr = httptest.NewRecorder()
+	h.ServeBootFile(rr, req)
+	if lease.State != dhcp.StateImaging {
+		t.Errorf("Lease state = %s, expected the fetch to be recorded", lease.State)
+	}
+
+	// Hosts whose lease selects another template type get the config on disk
+	lease.Menu.TemplateType = "preseed"
+	rr = httptest.NewRecorder()
+	h.ServeBootFile(rr, httptest.NewRequest("GET", "/boot/configs/kickstart/aa-bb-cc-dd-ee-ff", nil))
+	if rr.Body.String() != "install" {
+		t.Errorf("Body = %q, expected the config on disk", rr.Body.String())
+	}
+}
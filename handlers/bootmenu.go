@@ -3,11 +3,13 @@ package handlers
 import (
 	"context"
 	"fmt"
-	"html/template"
+	"ignite/autoinstall"
+	"ignite/bootmenu"
 	"ignite/dhcp"
 	"log"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -25,14 +27,6 @@ func NewBootMenuHandlers(container *Container) *BootMenuHandlers {
 	return &BootMenuHandlers{container: container}
 }
 
-// BootMenuData holds the data used for generating a PXE boot menu configuration.
-type BootMenuData struct {
-	Name    string
-	Kernel  string
-	Initrd  string
-	Options string
-}
-
 // SubmitBootMenu handles boot menu submission
 func (h *BootMenuHandlers) SubmitBootMenu(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseForm(); err != nil {
@@ -53,9 +47,10 @@ func (h *BootMenuHandlers) SubmitBootMenu(w http.ResponseWriter, r *http.Request
 		"gateway":        r.Form.Get("gateway"),
 		"dns":            r.Form.Get("dns"),
 		"kernel_options": r.Form.Get("kernel_options"),
+		"install_device": strings.TrimSpace(r.Form.Get("install_device")),
 	}
 
-	// Check required fields (kernel_options is optional)
+	// Check required fields (kernel_options and install_device are optional)
 	requiredFields := []string{"tftpip", "mac", "os", "version", "typeSelect", "template_name", "hostname", "ip", "subnet", "gateway", "dns"}
 	for _, field := range requiredFields {
 		if formData[field] == "" {
@@ -63,6 +58,10 @@ func (h *BootMenuHandlers) SubmitBootMenu(w http.ResponseWriter, r *http.Request
 			return
 		}
 	}
+	if dev := formData["install_device"]; dev != "" && (!strings.HasPrefix(dev, "/dev/") || strings.ContainsAny(dev, " \t\n")) {
+		http.Error(w, fmt.Sprintf("Invalid install device: %s", dev), http.StatusBadRequest)
+		return
+	}
 
 	// Load configuration to get provision directory
 	cfg, err := config.LoadDefault()
@@ -71,14 +70,12 @@ func (h *BootMenuHandlers) SubmitBootMenu(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Build PXE file paths
-	buildpxe := fmt.Sprintf("pxelinux.cfg/01-%s", strings.ReplaceAll(formData["mac"], ":", "-"))
-	pxefile := filepath.Join(TFTPDir, buildpxe)
-	pxetempl := filepath.Join(cfg.Provision.Dir, "templates/bootmenu/default.templ")
+	// The PXE menu is rendered from the lease by the TFTP server when requested
+	buildpxe := "pxelinux.cfg/01-" + bootmenu.MACFileName(formData["mac"])
 
 	// Create BootMenu struct
 	bootMenu := dhcp.BootMenu{
-		Filename:      pxefile,
+		Filename:      buildpxe,
 		OS:            formData["os"],
 		Version:       formData["version"],
 		TemplateType:  formData["typeSelect"],
@@ -89,38 +86,36 @@ func (h *BootMenuHandlers) SubmitBootMenu(w http.ResponseWriter, r *http.Request
 		Gateway:       net.ParseIP(formData["gateway"]),
 		DNS:           net.ParseIP(formData["dns"]),
 		KernelOptions: formData["kernel_options"],
+		InstallDevice: formData["install_device"],
 	}
 
-	// Build config file paths
-	buildconfig := fmt.Sprintf("configs/%s/%s", formData["typeSelect"], strings.ReplaceAll(formData["mac"], ":", "-"))
-	configFile := filepath.Join(cfg.Provision.Dir, buildconfig)
-	templBuild := fmt.Sprintf("templates/%s/%s", formData["typeSelect"], formData["template_name"])
-	configTempl := filepath.Join(cfg.Provision.Dir, templBuild)
-
-	// Generate boot data (use buildconfig for HTTP URL, configFile for filesystem path)
-	pxedata := h.generateBootData(formData, buildconfig)
-
-	// Ensure directories exist
-	if err := os.MkdirAll(filepath.Dir(pxefile), 0755); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to create PXE directory: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	if err := os.MkdirAll(filepath.Dir(configFile), 0755); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to create config directory: %v", err), http.StatusInternalServerError)
-		return
+	// Autoinstall templates take structured settings from the form
+	if bootMenu.TemplateType == "autoinstall" {
+		inputs := autoinstallInputs(r.Form)
+		if err := autoinstall.Check(inputs); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid autoinstall settings: %v", err), http.StatusBadRequest)
+			return
+		}
+		if !inputs.IsZero() {
+			bootMenu.Autoinstall = inputs
+		}
 	}
 
-	// Write PXE template to disk
-	if err := h.writeTemplateToDisk(pxetempl, pxefile, pxedata); err != nil {
-		http.Error(w, fmt.Sprintf("Error writing PXE menu: %v", err), http.StatusInternalServerError)
+	// The provisioning config is rendered from the lease when the installer fetches it
+	configTempl := filepath.Join(cfg.Provision.Dir, "templates", formData["typeSelect"], formData["template_name"])
+	if _, err := os.Stat(configTempl); err != nil {
+		http.Error(w, fmt.Sprintf("Template not found: %s/%s", formData["typeSelect"], formData["template_name"]), http.StatusBadRequest)
 		return
 	}
 
-	// Write config template to disk
-	if err := h.writeTemplateToDisk(configTempl, configFile, formData); err != nil {
-		http.Error(w, fmt.Sprintf("Error writing config file: %v", err), http.StatusInternalServerError)
-		return
+	// Remove files written by earlier versions so they can't go stale
+	for _, old := range []string{
+		filepath.Join(TFTPDir, buildpxe),
+		filepath.Join(cfg.Provision.Dir, bootmenu.ConfigPath(formData["typeSelect"], formData["mac"])),
+	} {
+		if err := os.Remove(old); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove %s: %v", old, err)
+		}
 	}
 
 	// Update DHCP lease
@@ -132,161 +127,29 @@ func (h *BootMenuHandlers) SubmitBootMenu(w http.ResponseWriter, r *http.Request
 	http.Redirect(w, r, "/dhcp", http.StatusSeeOther)
 }
 
-// generateBootData constructs the boot configuration data based on provided OS and network details.
-func (h *BootMenuHandlers) generateBootData(formData map[string]string, configFile string) BootMenuData {
-	options := h.getBootOptions(formData["os"], formData["typeSelect"], formData["dns"], formData["tftpip"], configFile, formData["kernel_options"])
-
-	return BootMenuData{
-		Name:    h.osToName(formData["os"]),
-		Kernel:  h.osToKernel(formData["os"], formData["version"]),
-		Initrd:  h.osToInitrd(formData["os"], formData["version"]),
-		Options: options,
-	}
-}
-
-// getBootOptions returns the appropriate boot options string based on the operating system and template type.
-func (h *BootMenuHandlers) getBootOptions(os, templateType, dns, tftpip, configFile, kernelOptions string) string {
-	var baseOptions string
-
-	// Determine boot parameters based on template type and OS
-	switch templateType {
-	case "cloud-init":
-		baseOptions = fmt.Sprintf(`url=http://%s/%s autoinstall ds=nocloud-net;s=http://%s/ nameserver=%s`,
-			tftpip, configFile, tftpip, dns)
-	case "kickstart":
-		baseOptions = fmt.Sprintf(`ks=http://%s/%s nameserver=%s`,
-			tftpip, configFile, dns)
-	case "preseed":
-		baseOptions = fmt.Sprintf(`url=http://%s/%s auto=true priority=critical nameserver=%s`,
-			tftpip, configFile, dns)
-	case "autoyast":
-		baseOptions = fmt.Sprintf(`autoyast=http://%s/%s nameserver=%s`,
-			tftpip, configFile, dns)
-	case "ipxe":
-		baseOptions = fmt.Sprintf(`initrd=http://%s/%s nameserver=%s`,
-			tftpip, configFile, dns)
-	default:
-		// Fallback to OS-based detection for backward compatibility
-		switch os {
-		case "ubuntu", "Ubuntu", "nixos", "NixOS":
-			baseOptions = fmt.Sprintf(`url=http://%s/%s autoinstall ds=nocloud-net;s=http://%s/ nameserver=%s`,
-				tftpip, configFile, tftpip, dns)
-		case "debian", "Debian":
-			baseOptions = fmt.Sprintf(`url=http://%s/%s auto=true priority=critical nameserver=%s`,
-				tftpip, configFile, dns)
-		case "redhat", "Redhat", "centos", "CentOS", "fedora", "Fedora":
-			baseOptions = fmt.Sprintf(`ks=http://%s/%s nameserver=%s`,
-				tftpip, configFile, dns)
-		case "opensuse", "openSUSE", "suse", "SUSE":
-			baseOptions = fmt.Sprintf(`autoyast=http://%s/%s nameserver=%s`,
-				tftpip, configFile, dns)
-		default:
-			baseOptions = ""
-		}
-	}
-
-	// Add additional kernel options if provided
-	if kernelOptions != "" && baseOptions != "" {
-		return baseOptions + " " + kernelOptions
-	} else if kernelOptions != "" {
-		return kernelOptions
-	}
-
-	return baseOptions
-}
-
-// osToName maps the OS name to a standardized name used in file paths.
-func (h *BootMenuHandlers) osToName(os string) string {
-	switch os {
-	case "ubuntu", "Ubuntu":
-		return "ubuntu"
-	case "debian", "Debian":
-		return "debian"
-	case "fedora", "Fedora":
-		return "fedora"
-	case "centos", "CentOS":
-		return "centos"
-	case "opensuse", "openSUSE":
-		return "opensuse"
-	case "nixos", "NixOS":
-		return "nixos"
-	case "redhat", "Redhat":
-		return "redhat"
+// autoinstallInputs reads the autoinstall settings from the boot menu form.
+// Keys, packages and late-commands are entered one per line.
+func autoinstallInputs(form url.Values) *dhcp.AutoinstallSettings {
+	return &dhcp.AutoinstallSettings{
+		StorageLayout:  strings.TrimSpace(form.Get("autoinstall_storage_layout")),
+		Username:       strings.TrimSpace(form.Get("autoinstall_username")),
+		RealName:       strings.TrimSpace(form.Get("autoinstall_realname")),
+		PasswordHash:   strings.TrimSpace(form.Get("autoinstall_password_hash")),
+		AuthorizedKeys: formLines(form.Get("autoinstall_authorized_keys")),
+		Packages:       formLines(form.Get("autoinstall_packages")),
+		LateCommands:   formLines(form.Get("autoinstall_late_commands")),
 	}
-	return strings.ToLower(os)
 }
 
-// osToKernel constructs the kernel file path for the given OS and version.
-// If a specific version is provided, it tries to find that version, otherwise uses the default version.
-func (h *BootMenuHandlers) osToKernel(os, version string) string {
-	ctx := context.Background()
-
-	if h.container.OSImageService != nil {
-		// If a specific version is requested, try to find that exact version
-		if version != "" {
-			if allImages, err := h.container.OSImageService.GetAllOSImages(ctx); err == nil {
-				for _, image := range allImages {
-					if image.OS == os && image.Version == version {
-						return image.KernelPath
-					}
-				}
-			}
-		}
-
-		// Fallback to default version
-		if image, err := h.container.OSImageService.GetDefaultVersion(ctx, os); err == nil {
-			return image.KernelPath
-		}
-	}
-
-	// Final fallback to legacy path structure
-	return fmt.Sprintf("%s/vmlinuz", h.osToName(os))
-}
-
-// osToInitrd constructs the initrd file path for the given OS and version.
-// If a specific version is provided, it tries to find that version, otherwise uses the default version.
-func (h *BootMenuHandlers) osToInitrd(os, version string) string {
-	ctx := context.Background()
-
-	if h.container.OSImageService != nil {
-		// If a specific version is requested, try to find that exact version
-		if version != "" {
-			if allImages, err := h.container.OSImageService.GetAllOSImages(ctx); err == nil {
-				for _, image := range allImages {
-					if image.OS == os && image.Version == version {
-						return image.InitrdPath
-					}
-				}
-			}
-		}
-
-		// Fallback to default version
-		if image, err := h.container.OSImageService.GetDefaultVersion(ctx, os); err == nil {
-			return image.InitrdPath
+// formLines splits a textarea into its non-blank lines
+func formLines(value string) []string {
+	var lines []string
+	for _, line := range strings.Split(value, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
 		}
 	}
-
-	// Final fallback to legacy path structure
-	return fmt.Sprintf("%s/initrd.img", h.osToName(os))
-}
-
-// writeTemplateToDisk writes the template to disk.
-func (h *BootMenuHandlers) writeTemplateToDisk(templpath string, filepath string, data interface{}) error {
-	templates := map[string]*template.Template{
-		"templ": template.Must(template.ParseFiles(templpath)),
-	}
-
-	file, err := os.Create(filepath)
-	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
-	}
-	defer file.Close()
-
-	if err := templates["templ"].Execute(file, data); err != nil {
-		return fmt.Errorf("failed to execute template: %w", err)
-	}
-
-	return nil
+	return lines
 }
 
 // updateDHCPLease updates the DHCP lease with new boot menu data.
@@ -322,8 +185,11 @@ func (h *BootMenuHandlers) updateDHCPLease(tftpip, mac string, menu dhcp.BootMen
 		return fmt.Errorf("lease not found for MAC %s: %w", mac, err)
 	}
 
-	// Update lease with boot menu
+	// Update lease with boot menu, and a new token so earlier installs can't report on this one
 	lease.Menu = menu
+	if lease.Token, err = dhcp.NewToken(); err != nil {
+		return err
+	}
 
 	// Save the updated lease using the lease service
 	if err := h.container.LeaseService.UpdateLease(ctx, lease); err != nil {
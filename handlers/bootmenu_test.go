@@ -2,9 +2,12 @@ package handlers
 
 import (
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
 
+	"ignite/autoinstall"
+
 	"github.com/stretchr/testify/assert"
 )
 
@@ -42,3 +45,22 @@ func TestBootMenuFormProcessing(t *testing.T) {
 
 	// Note: Full integration test would require proper service mocks
 }
+
+func TestAutoinstallInputs(t *testing.T) {
+	form := url.Values{
+		"autoinstall_storage_layout":  {"zfs"},
+		"autoinstall_username":        {" admin "},
+		"autoinstall_authorized_keys": {"ssh-ed25519 AAAA one\r\n\r\nssh-ed25519 AAAA two\n"},
+		"autoinstall_packages":        {"vim\ncurl"},
+	}
+
+	inputs := autoinstallInputs(form)
+	assert.Equal(t, "zfs", inputs.StorageLayout)
+	assert.Equal(t, "admin", inputs.Username)
+	assert.Equal(t, []string{"ssh-ed25519 AAAA one", "ssh-ed25519 AAAA two"}, inputs.AuthorizedKeys)
+	assert.Equal(t, []string{"vim", "curl"}, inputs.Packages)
+	assert.Empty(t, inputs.LateCommands)
+	assert.NoError(t, autoinstall.Check(inputs))
+
+	assert.True(t, autoinstallInputs(url.Values{}).IsZero())
+}
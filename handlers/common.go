@@ -1,14 +1,16 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"html/template"
+	"io/fs"
 	"log"
 	"net"
 	"net/http"
-	"os"
-	"path/filepath"
+	"strings"
 
+	"ignite/autoinstall"
 	"ignite/config"
 )
 
@@ -35,6 +37,8 @@ func LoadTemplates() map[string]*template.Template {
 		"login":              template.Must(template.ParseFiles("templates/base-login.templ", "templates/pages/login.templ")),
 		"dhcp":               template.Must(template.ParseFiles(baseTemplate, "templates/pages/dhcp.templ")),
 		"tftp":               template.Must(template.ParseFiles(baseTemplate, "templates/pages/tftp.templ", "templates/modals/uploadmodal.templ")),
+		"backups":            template.Must(template.ParseFiles(baseTemplate, "templates/pages/backups.templ")),
+		"backup-file":        template.Must(template.ParseFiles(baseTemplate, "templates/pages/backup-file.templ")),
 		"status":             template.Must(template.ParseFiles(baseTemplate, "templates/pages/status.templ")),
 		"status-content":     template.Must(template.ParseFiles("templates/partials/status-content.templ")),
 		"provision":          template.Must(template.ParseFiles(baseTemplate, "templates/pages/provision.templ")),
@@ -48,6 +52,8 @@ func LoadTemplates() map[string]*template.Template {
 		"viewmodal":          template.Must(template.ParseFiles("templates/modals/viewmodal.templ")),
 		"provision-new-file": template.Must(template.ParseFiles("templates/modals/provision-new-file.templ")),
 		"manualleasemodal":   template.Must(template.ParseFiles("templates/modals/manualleasemodal.templ")),
+		"migratemodal":       template.Must(template.ParseFiles("templates/modals/migratemodal.templ")),
+		"rackmodal":          template.Must(template.ParseFiles("templates/modals/rackmodal.templ")),
 	}
 }
 
@@ -133,7 +139,7 @@ func (h *ModalHandlers) OpenModalHandler(w http.ResponseWriter, r *http.Request)
 		case "upload":
 			data = NewUploadModal(w, r)
 		case "viewmodal":
-			data, err = NewViewModal(w, r)
+			data, err = NewViewModal(w, r, h.container)
 			if err != nil {
 				log.Printf("Error creating view modal data: %v", err)
 				http.Error(w, "Failed to prepare view data: "+err.Error(), http.StatusInternalServerError)
@@ -148,6 +154,15 @@ func (h *ModalHandlers) OpenModalHandler(w http.ResponseWriter, r *http.Request)
 				http.Error(w, "Failed to prepare manual lease data: "+err.Error(), http.StatusInternalServerError)
 				return
 			}
+		case "rackmodal":
+			data = NewRackModal()
+		case "migratemodal":
+			data, err = NewMigrateModal(w, r, h.container)
+			if err != nil {
+				log.Printf("Error creating migrate modal data: %v", err)
+				http.Error(w, "Failed to prepare migration data: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
 		default:
 			log.Printf("Unhandled template type: %s", template)
 			http.Error(w, "Unhandled template type", http.StatusInternalServerError)
@@ -170,6 +185,10 @@ func NewDHCPModal(w http.ResponseWriter, r *http.Request, container *Container)
 	data := map[string]any{
 		"title":      "DHCP Configuration",
 		"Networks":   networks,
+		"Interfaces": getLocalInterfaces(),
+		"interface":  "",
+		"vlan_id":    0,
+		"tftp_root":  "",
 		"tftpip":     "",
 		"startip":    "",
 		"endip":      "",
@@ -193,6 +212,9 @@ func NewDHCPModal(w http.ResponseWriter, r *http.Request, container *Container)
 
 		// Populate with existing server data
 		data["tftpip"] = server.IP.String()
+		data["interface"] = server.Interface
+		data["vlan_id"] = server.VLANID
+		data["tftp_root"] = server.TFTPRoot
 		data["startip"] = server.IPStart.String()
 
 		// Calculate end IP from start IP and lease range
@@ -256,6 +278,26 @@ func getLocalIPAddresses() []string {
 	return ips
 }
 
+// getLocalInterfaces returns the names of all non-loopback interfaces that are up
+func getLocalInterfaces() []string {
+	var names []string
+
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		log.Printf("Error getting network interfaces: %v", err)
+		return names
+	}
+
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagLoopback != 0 || iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		names = append(names, iface.Name)
+	}
+
+	return names
+}
+
 // NewReserveModal creates data for reservation modal
 func NewReserveModal(w http.ResponseWriter, r *http.Request, container *Container) (map[string]any, error) {
 	// Get query parameters
@@ -358,7 +400,17 @@ func NewBootModal(w http.ResponseWriter, r *http.Request, container *Container)
 		"gateway":        "",
 		"dns":            "",
 		"kernel_options": "",
+		"install_device": "",
 		"osImages":       osImages,
+
+		"autoinstall_storage_layout":  "",
+		"autoinstall_username":        "",
+		"autoinstall_realname":        "",
+		"autoinstall_password_hash":   "",
+		"autoinstall_authorized_keys": "",
+		"autoinstall_packages":        "",
+		"autoinstall_late_commands":   "",
+		"storageLayouts":              autoinstall.StorageLayouts,
 	}
 
 	// Try to load existing boot menu data from the lease
@@ -396,6 +448,16 @@ func NewBootModal(w http.ResponseWriter, r *http.Request, container *Container)
 			if lease.Menu.KernelOptions != "" {
 				data["kernel_options"] = lease.Menu.KernelOptions
 			}
+			data["install_device"] = lease.Menu.InstallDevice
+			if in := lease.Menu.Autoinstall; in != nil {
+				data["autoinstall_storage_layout"] = in.StorageLayout
+				data["autoinstall_username"] = in.Username
+				data["autoinstall_realname"] = in.RealName
+				data["autoinstall_password_hash"] = in.PasswordHash
+				data["autoinstall_authorized_keys"] = strings.Join(in.AuthorizedKeys, "\n")
+				data["autoinstall_packages"] = strings.Join(in.Packages, "\n")
+				data["autoinstall_late_commands"] = strings.Join(in.LateCommands, "\n")
+			}
 		}
 	}
 
@@ -451,24 +513,28 @@ func NewUploadModal(w http.ResponseWriter, r *http.Request) map[string]any {
 }
 
 // NewViewModal creates data for view modal
-func NewViewModal(w http.ResponseWriter, r *http.Request) (map[string]any, error) {
+func NewViewModal(w http.ResponseWriter, r *http.Request, container *Container) (map[string]any, error) {
 	fileName := r.URL.Query().Get("file")
 	if fileName == "" {
 		return nil, fmt.Errorf("file parameter is required")
 	}
 
-	filePath := filepath.Join(TFTPDir, fileName)
-	content, err := os.ReadFile(filePath)
+	layer, err := tftpFiles(container).Locate(tftpName(fileName))
 	if err != nil {
-		if os.IsNotExist(err) {
+		if errors.Is(err, fs.ErrNotExist) {
 			return nil, fmt.Errorf("file not found: %s", fileName)
 		}
 		return nil, fmt.Errorf("error reading file: %v", err)
 	}
+	content, err := fs.ReadFile(layer.FS, tftpName(fileName))
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %v", err)
+	}
 
 	return map[string]any{
 		"FileName":    fileName,
 		"FileContent": string(content),
+		"Layer":       layer.Name,
 	}, nil
 }
 
@@ -497,3 +563,43 @@ func NewManualLeaseModal(w http.ResponseWriter, r *http.Request, container *Cont
 
 	return data, nil
 }
+
+// NewRackModal creates data for the add rack modal
+func NewRackModal() map[string]any {
+	return map[string]any{
+		"title":      "Add Rack",
+		"Interfaces": getLocalInterfaces(),
+	}
+}
+
+// NewMigrateModal creates data for the server migration modal
+func NewMigrateModal(w http.ResponseWriter, r *http.Request, container *Container) (map[string]any, error) {
+	serverID := r.URL.Query().Get("server_id")
+	if serverID == "" {
+		return nil, fmt.Errorf("server_id parameter is required")
+	}
+
+	ctx := r.Context()
+	server, err := container.ServerService.GetServer(ctx, serverID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get server: %w", err)
+	}
+
+	leases, err := container.LeaseService.GetLeasesByServer(ctx, serverID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get leases: %w", err)
+	}
+
+	return map[string]any{
+		"title":       "Migrate DHCP Server",
+		"Networks":    getLocalIPAddresses(),
+		"Interfaces":  getLocalInterfaces(),
+		"interface":   server.Interface,
+		"server_id":   serverID,
+		"tftpip":      server.IP.String(),
+		"subnet":      server.Options.SubnetMask.String(),
+		"dns":         server.Options.DNS.String(),
+		"lease_count": len(leases),
+		"leases":      leases,
+	}, nil
+}
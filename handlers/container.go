@@ -1,11 +1,16 @@
 package handlers
 
 import (
+	"net"
+
+	"ignite/bootmenu"
 	"ignite/config"
 	"ignite/dhcp"
 	"ignite/ipxe"
 	"ignite/osimage"
 	"ignite/syslinux"
+	"ignite/tftp"
+	"ignite/upload"
 )
 
 // Container holds dependencies for handlers
@@ -13,7 +18,20 @@ type Container struct {
 	ServerService   dhcp.ServerService
 	LeaseService    dhcp.LeaseService
 	OSImageService  osimage.OSImageService
+	OSCatalog       *osimage.Catalog // OS definitions images are downloaded from
 	SyslinuxService syslinux.Service
 	IPXEService     *ipxe.Service
+	RogueDetector   *dhcp.RogueDetector
+	TransferLog     *tftp.TransferLog
+	TFTPCache       *tftp.FileCache
+	TFTPFiles       *tftp.LayeredFS
+	TFTPBackups     *tftp.BackupStore
+	Uploads         *upload.Store
+	TFTPManager     *tftp.FileManager
+	BootFiles       func(clientIP net.IP) *tftp.LayeredFS // TFTP files as seen by a client, for the HTTP boot tree
+	TFTPAccess      tftp.AccessPolicy                     // Clients allowed to read which TFTP files, over TFTP and HTTP alike
+	BootAccess      tftp.AccessPolicy                     // Clients allowed to use the HTTP boot tree
+	BootMenus       *bootmenu.Renderer
+	BootConfigs     *bootmenu.ConfigRenderer // Renders provisioning configs when installers fetch them
 	Config          *config.Config
 }
@@ -2,20 +2,28 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net"
 	"net/http"
+	"os"
+	"path/filepath"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"ignite/config"
 	"ignite/dhcp"
+	"ignite/tftp"
 )
 
 // DHCPHandlers contains DHCP-related HTTP handlers
 type DHCPHandlers struct {
 	serverService dhcp.ServerService
 	leaseService  dhcp.LeaseService
+	transferLog   *tftp.TransferLog
 	config        *config.Config
 }
 
@@ -24,6 +32,7 @@ func NewDHCPHandlers(container *Container) *DHCPHandlers {
 	return &DHCPHandlers{
 		serverService: container.ServerService,
 		leaseService:  container.LeaseService,
+		transferLog:   container.TransferLog,
 		config:        container.Config,
 	}
 }
@@ -56,10 +65,12 @@ func (h *DHCPHandlers) HandleDHCPPage(w http.ResponseWriter, r *http.Request) {
 		}
 
 		serverView := DHCPServerView{
-			ID:     server.ID,
-			TFTPIP: server.IP.String(),
-			Status: h.getServerStatusBadge(server.Started),
-			Leases: h.convertLeasesToViews(leases),
+			ID:        server.ID,
+			TFTPIP:    server.IP.String(),
+			Interface: server.Interface,
+			VLANID:    server.VLANID,
+			Status:    h.getServerStatusBadge(server.Started),
+			Leases:    h.convertLeasesToViews(leases),
 		}
 		serverViews = append(serverViews, serverView)
 	}
@@ -101,10 +112,12 @@ func (h *DHCPHandlers) GetDHCPServers(w http.ResponseWriter, r *http.Request) {
 		}
 
 		serverView := DHCPServerView{
-			ID:     server.ID,
-			TFTPIP: server.IP.String(),
-			Status: h.getServerStatusBadge(server.Started),
-			Leases: h.convertLeasesToViews(leases),
+			ID:        server.ID,
+			TFTPIP:    server.IP.String(),
+			Interface: server.Interface,
+			VLANID:    server.VLANID,
+			Status:    h.getServerStatusBadge(server.Started),
+			Leases:    h.convertLeasesToViews(leases),
 		}
 		serverViews = append(serverViews, serverView)
 	}
@@ -199,13 +212,225 @@ func (h *DHCPHandlers) SubmitDHCPServer(w http.ResponseWriter, r *http.Request)
 	serverID := r.FormValue("server_id")
 	isEdit := serverID != ""
 
-	// Parse form data
+	// Parse and validate the server form
+	config, validationErrors, err := h.parseServerConfigForm(r, serverID)
+	if err != nil {
+		appErr := NewInternalError(
+			fmt.Sprintf("Failed to get DHCP servers: %v", err),
+			"Unable to validate DHCP server. Please try again later.",
+		)
+		HandleError(w, r, appErr)
+		return
+	}
+	if validationErrors.HasErrors() {
+		SendValidationError(w, r, validationErrors)
+		return
+	}
+
+	if isEdit {
+		// Update existing server
+		err := h.serverService.UpdateServer(ctx, serverID, config)
+		var configErr *dhcp.ConfigError
+		if errors.As(err, &configErr) {
+			SendValidationError(w, r, ConfigErrorToValidationErrors(configErr))
+			return
+		}
+		if err != nil {
+			appErr := NewInternalError(
+				fmt.Sprintf("Failed to update DHCP server %s: %v", serverID, err),
+				"Unable to update DHCP server. Please try again later.",
+			)
+			HandleError(w, r, appErr)
+			return
+		}
+
+		// Redirect back to DHCP page to show the updated server list
+		w.Header().Set("HX-Redirect", "/dhcp")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("DHCP server updated successfully"))
+	} else {
+		// Create new server
+		server, err := h.serverService.CreateServer(ctx, config)
+		var configErr *dhcp.ConfigError
+		if errors.As(err, &configErr) {
+			SendValidationError(w, r, ConfigErrorToValidationErrors(configErr))
+			return
+		}
+		if err != nil {
+			appErr := NewInternalError(
+				fmt.Sprintf("Failed to create DHCP server: %v", err),
+				"Unable to create DHCP server. Please check your configuration and try again.",
+			)
+			HandleError(w, r, appErr)
+			return
+		}
+
+		// Redirect back to DHCP page to show the updated server list
+		w.Header().Set("HX-Redirect", "/dhcp")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(fmt.Sprintf("DHCP server created with ID: %s", server.ID)))
+	}
+}
+
+// AddRack handles POST /dhcp/rack, creating a VLAN subinterface and a DHCP
+// server bound to it from a single form
+func (h *DHCPHandlers) AddRack(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	rackErrors := make(ValidationErrors)
+	parent := strings.TrimSpace(r.FormValue("parent"))
+	if parent == "" {
+		rackErrors.Add("interface", "Parent interface is required")
+	}
+	vlanID, err := strconv.Atoi(strings.TrimSpace(r.FormValue("vlan_id")))
+	if err != nil {
+		rackErrors.Add("vlan_id", "VLAN ID must be a number")
+	}
+	if rackErrors.HasErrors() {
+		SendValidationError(w, r, rackErrors)
+		return
+	}
+
+	config, validationErrors, err := h.parseServerConfigForm(r, "")
+	if err != nil {
+		appErr := NewInternalError(
+			fmt.Sprintf("Failed to get DHCP servers: %v", err),
+			"Unable to validate DHCP server. Please try again later.",
+		)
+		HandleError(w, r, appErr)
+		return
+	}
+	if validationErrors.HasErrors() {
+		SendValidationError(w, r, validationErrors)
+		return
+	}
+	config.VLANID = vlanID
+	config.VLANParent = parent
+
+	server, err := h.serverService.CreateServer(ctx, config)
+	var configErr *dhcp.ConfigError
+	if errors.As(err, &configErr) {
+		SendValidationError(w, r, ConfigErrorToValidationErrors(configErr))
+		return
+	}
+	if err != nil {
+		appErr := NewInternalError(
+			fmt.Sprintf("Failed to add rack on VLAN %d: %v", vlanID, err),
+			"Unable to add rack. Check that the parent interface exists and ignite can manage network interfaces.",
+		)
+		HandleError(w, r, appErr)
+		return
+	}
+
+	if server.TFTPRoot != "" {
+		if err := os.MkdirAll(filepath.Join(h.config.TFTP.Dir, server.TFTPRoot), 0755); err != nil {
+			log.Printf("Warning: failed to create TFTP root %s: %v", server.TFTPRoot, err)
+		}
+	}
+
+	message := fmt.Sprintf("Rack added on %s with DHCP server %s", server.Interface, server.IP)
+	if r.FormValue("start") == "on" {
+		if err := h.serverService.StartServer(ctx, server.ID); err != nil {
+			message = fmt.Sprintf("%s, but the server failed to start: %v", message, err)
+		}
+	}
+
+	// Redirect back to DHCP page to show the new rack
+	w.Header().Set("HX-Redirect", "/dhcp")
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte(message))
+}
+
+// MigrateDHCPServer handles POST /dhcp/migrate
+func (h *DHCPHandlers) MigrateDHCPServer(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	serverID := r.FormValue("server_id")
+	if serverID == "" {
+		http.Error(w, "Server ID is required", http.StatusBadRequest)
+		return
+	}
+
+	config, validationErrors, err := h.parseServerConfigForm(r, serverID)
+	if err != nil {
+		appErr := NewInternalError(
+			fmt.Sprintf("Failed to get DHCP servers: %v", err),
+			"Unable to validate DHCP server. Please try again later.",
+		)
+		HandleError(w, r, appErr)
+		return
+	}
+
+	mapping, err := parseLeaseMapping(r.FormValue("mapping"))
+	if err != nil {
+		validationErrors.Add("mapping", err.Error())
+	}
+	if validationErrors.HasErrors() {
+		SendValidationError(w, r, validationErrors)
+		return
+	}
+
+	req := dhcp.MigrationRequest{
+		Config:  config,
+		Mode:    r.FormValue("mode"),
+		Mapping: mapping,
+		DryRun:  r.FormValue("dry_run") == "true",
+	}
+
+	result, err := h.serverService.MigrateServer(ctx, serverID, req)
+	var configErr *dhcp.ConfigError
+	if errors.As(err, &configErr) {
+		SendValidationError(w, r, ConfigErrorToValidationErrors(configErr))
+		return
+	}
+	if err != nil && result == nil {
+		appErr := NewInternalError(
+			fmt.Sprintf("Failed to migrate DHCP server %s: %v", serverID, err),
+			"Unable to migrate DHCP server. Please try again later.",
+		)
+		HandleError(w, r, appErr)
+		return
+	}
+
+	// Dry runs and conflicting migrations return the plan so the UI can show it
+	if req.DryRun || err != nil {
+		status := http.StatusOK
+		if err != nil {
+			status = http.StatusConflict
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+
+	// Redirect back to DHCP page to show the migrated server
+	w.Header().Set("HX-Redirect", "/dhcp")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf("DHCP server migrated from %s to %s", result.OldIP, result.Server.IP)))
+}
+
+// parseServerConfigForm builds a server configuration from the DHCP server form,
+// validating it on its own and against every server other than excludeID
+func (h *DHCPHandlers) parseServerConfigForm(r *http.Request, excludeID string) (dhcp.ServerConfig, ValidationErrors, error) {
 	networkStr := r.FormValue("network")
 	subnetStr := r.FormValue("subnet")
 	gatewayStr := r.FormValue("gateway")
 	dnsStr := r.FormValue("dns")
 	startIPStr := r.FormValue("startIP")
 	endIPStr := r.FormValue("endIP")
+	iface := strings.TrimSpace(r.FormValue("interface"))
+	tftpRoot := strings.TrimRight(strings.TrimSpace(r.FormValue("tftp_root")), "/")
 
 	// Create DHCP configuration validator
 	validator := NewDHCPConfigValidator()
@@ -220,69 +445,66 @@ func (h *DHCPHandlers) SubmitDHCPServer(w http.ResponseWriter, r *http.Request)
 
 	// Validate configuration
 	if validationErrors := validator.ValidateDHCPConfig(validationConfig); validationErrors.HasErrors() {
-		SendValidationError(w, r, validationErrors)
-		return
+		return dhcp.ServerConfig{}, validationErrors, nil
+	}
+
+	// Check the configuration against every other configured server
+	existingServers, err := h.serverService.GetAllServers(r.Context())
+	if err != nil {
+		return dhcp.ServerConfig{}, nil, err
+	}
+	if validationErrors := validator.ValidateAgainstServers(validationConfig, existingServers, excludeID); validationErrors.HasErrors() {
+		return dhcp.ServerConfig{}, validationErrors, nil
 	}
 
 	// Parse validated IPs
 	startIP := net.ParseIP(startIPStr)
 	endIP := net.ParseIP(endIPStr)
-	network := net.ParseIP(networkStr)
-	subnet := net.ParseIP(subnetStr)
-	gateway := net.ParseIP(gatewayStr)
 
 	// Calculate numLeases from start and end IP
-	startInt := ipToInt(startIP)
-	endInt := ipToInt(endIP)
-	numLeases := int(endInt - startInt + 1)
+	numLeases := int(ipToInt(endIP) - ipToInt(startIP) + 1)
 
-	// Parse DNS (already validated above)
-	dns := net.ParseIP(dnsStr)
-
-	// Create server configuration
 	config := dhcp.ServerConfig{
-		IP:            network,
-		SubnetMask:    subnet,
-		Gateway:       gateway,
-		DNS:           dns,
+		IP:            net.ParseIP(networkStr),
+		Interface:     iface,
+		TFTPRoot:      tftpRoot,
+		SubnetMask:    net.ParseIP(subnetStr),
+		Gateway:       net.ParseIP(gatewayStr),
+		DNS:           net.ParseIP(dnsStr),
 		StartIP:       startIP,
 		LeaseRange:    numLeases,
 		LeaseDuration: 2 * time.Hour, // Default lease duration
 	}
 
-	if isEdit {
-		// Update existing server
-		err := h.serverService.UpdateServer(ctx, serverID, config)
-		if err != nil {
-			appErr := NewInternalError(
-				fmt.Sprintf("Failed to update DHCP server %s: %v", serverID, err),
-				"Unable to update DHCP server. Please try again later.",
-			)
-			HandleError(w, r, appErr)
-			return
+	return config, make(ValidationErrors), nil
+}
+
+// parseLeaseMapping parses "MAC IP" or "MAC=IP" lines into a lease mapping
+func parseLeaseMapping(text string) (map[string]net.IP, error) {
+	mapping := make(map[string]net.IP)
+	validator := NewIPValidator()
+
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
 		}
 
-		// Redirect back to DHCP page to show the updated server list
-		w.Header().Set("HX-Redirect", "/dhcp")
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("DHCP server updated successfully"))
-	} else {
-		// Create new server
-		server, err := h.serverService.CreateServer(ctx, config)
-		if err != nil {
-			appErr := NewInternalError(
-				fmt.Sprintf("Failed to create DHCP server: %v", err),
-				"Unable to create DHCP server. Please check your configuration and try again.",
-			)
-			HandleError(w, r, appErr)
-			return
+		fields := strings.Fields(strings.ReplaceAll(line, "=", " "))
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected 'MAC IP', got %q", i+1, line)
+		}
+		if err := validator.ValidateMACAddress(fields[0]); err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		if err := validator.ValidateIPAddress(fields[1]); err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
 		}
 
-		// Redirect back to DHCP page to show the updated server list
-		w.Header().Set("HX-Redirect", "/dhcp")
-		w.WriteHeader(http.StatusCreated)
-		w.Write([]byte(fmt.Sprintf("DHCP server created with ID: %s", server.ID)))
+		mapping[fields[0]] = net.ParseIP(fields[1])
 	}
+
+	return mapping, nil
 }
 
 // ReserveLease handles POST /dhcp/submit_reserve
@@ -499,6 +721,36 @@ func (h *DHCPHandlers) GetLeaseStateHistory(w http.ResponseWriter, r *http.Reque
 	json.NewEncoder(w).Encode(response)
 }
 
+// GetLeaseTransfers handles GET /dhcp/lease/transfers, returning the TFTP
+// transfers made by the host holding a lease
+func (h *DHCPHandlers) GetLeaseTransfers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	mac := r.URL.Query().Get("mac")
+	if mac == "" {
+		http.Error(w, "MAC address is required", http.StatusBadRequest)
+		return
+	}
+
+	lease, err := h.leaseService.GetLeaseByMAC(ctx, mac)
+	if err != nil || lease == nil {
+		http.Error(w, fmt.Sprintf("Lease not found for MAC %s", mac), http.StatusNotFound)
+		return
+	}
+
+	transfers := []tftp.Transfer{}
+	if h.transferLog != nil {
+		transfers = h.transferLog.History(lease.IP)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"mac":       mac,
+		"ip":        lease.IP,
+		"transfers": transfers,
+	})
+}
+
 // Helper methods
 func (h *DHCPHandlers) getServerStatusBadge(started bool) string {
 	if started {
@@ -578,10 +830,12 @@ func (h *DHCPHandlers) convertLeasesToViews(leases []*dhcp.Lease) []LeaseView {
 
 // View models for templates
 type DHCPServerView struct {
-	ID     string      `json:"id"`
-	TFTPIP string      `json:"tftpip"`
-	Status string      `json:"status"`
-	Leases []LeaseView `json:"leases"`
+	ID        string      `json:"id"`
+	TFTPIP    string      `json:"tftpip"`
+	Interface string      `json:"interface,omitempty"`
+	VLANID    int         `json:"vlan_id,omitempty"`
+	Status    string      `json:"status"`
+	Leases    []LeaseView `json:"leases"`
 }
 
 type LeaseView struct {
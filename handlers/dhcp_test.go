@@ -2,15 +2,19 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"ignite/config"
 	"ignite/dhcp"
+	"ignite/tftp"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -50,6 +54,14 @@ func (m *MockServerService) UpdateServer(ctx context.Context, serverID string, c
 	return args.Error(0)
 }
 
+func (m *MockServerService) MigrateServer(ctx context.Context, serverID string, req dhcp.MigrationRequest) (*dhcp.MigrationResult, error) {
+	args := m.Called(ctx, serverID, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*dhcp.MigrationResult), args.Error(1)
+}
+
 func (m *MockServerService) DeleteServer(ctx context.Context, id string) error {
 	args := m.Called(ctx, id)
 	return args.Error(0)
@@ -91,6 +103,14 @@ func (m *MockLeaseService) GetLease(ctx context.Context, id string) (*dhcp.Lease
 	return args.Get(0).(*dhcp.Lease), args.Error(1)
 }
 
+func (m *MockLeaseService) GetLeaseByIP(ctx context.Context, ip net.IP) (*dhcp.Lease, error) {
+	args := m.Called(ctx, ip)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*dhcp.Lease), args.Error(1)
+}
+
 func (m *MockLeaseService) GetLeasesByServer(ctx context.Context, serverID string) ([]*dhcp.Lease, error) {
 	args := m.Called(ctx, serverID)
 	if args.Get(0) == nil {
@@ -302,6 +322,107 @@ func TestDHCPHandlers_StartDHCPServer_Success(t *testing.T) {
 	mockServerService.AssertExpectations(t)
 }
 
+// Test MigrateDHCPServer dry run returns the plan without redirecting
+func TestDHCPHandlers_MigrateDHCPServer_DryRun(t *testing.T) {
+	mockServerService := &MockServerService{}
+	mockLeaseService := &MockLeaseService{}
+
+	handlers := &DHCPHandlers{
+		serverService: mockServerService,
+		leaseService:  mockLeaseService,
+		config:        createTestContainer().Config,
+	}
+
+	mockServerService.On("GetAllServers", mock.Anything).Return([]*dhcp.Server{}, nil)
+	result := &dhcp.MigrationResult{DryRun: true, OldIP: net.ParseIP("192.168.1.1")}
+	mockServerService.On("MigrateServer", mock.Anything, "test-server", mock.MatchedBy(func(req dhcp.MigrationRequest) bool {
+		return req.DryRun && req.Mode == dhcp.RemapByOffset && req.Config.IP.Equal(net.ParseIP("10.0.0.1"))
+	})).Return(result, nil)
+
+	form := "server_id=test-server&network=10.0.0.1&subnet=255.255.255.0&gateway=10.0.0.254" +
+		"&dns=8.8.8.8&startIP=10.0.0.100&endIP=10.0.0.150&mode=offset&dry_run=true"
+	req := httptest.NewRequest("POST", "/dhcp/migrate", strings.NewReader(form))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	handlers.MigrateDHCPServer(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("HX-Redirect"))
+	assert.Contains(t, w.Body.String(), `"dry_run":true`)
+	mockServerService.AssertExpectations(t)
+}
+
+// Test AddRack creates a VLAN scoped server and starts it
+func TestDHCPHandlers_AddRack_Success(t *testing.T) {
+	mockServerService := &MockServerService{}
+	mockLeaseService := &MockLeaseService{}
+
+	container := createTestContainer()
+	container.Config.TFTP.Dir = t.TempDir()
+	handlers := &DHCPHandlers{
+		serverService: mockServerService,
+		leaseService:  mockLeaseService,
+		config:        container.Config,
+	}
+
+	created := &dhcp.Server{ID: "rack-100", IP: net.ParseIP("10.100.0.1"), Interface: "eth0.100", VLANID: 100, TFTPRoot: "racks/r100"}
+	mockServerService.On("GetAllServers", mock.Anything).Return([]*dhcp.Server{}, nil)
+	mockServerService.On("CreateServer", mock.Anything, mock.MatchedBy(func(config dhcp.ServerConfig) bool {
+		return config.VLANID == 100 && config.VLANParent == "eth0" && config.TFTPRoot == "racks/r100"
+	})).Return(created, nil)
+	mockServerService.On("StartServer", mock.Anything, "rack-100").Return(nil)
+
+	form := "parent=eth0&vlan_id=100&network=10.100.0.1&subnet=255.255.255.0&gateway=10.100.0.254" +
+		"&dns=8.8.8.8&startIP=10.100.0.100&endIP=10.100.0.200&tftp_root=racks/r100&start=on"
+	req := httptest.NewRequest("POST", "/dhcp/rack", strings.NewReader(form))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	handlers.AddRack(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "/dhcp", w.Header().Get("HX-Redirect"))
+	assert.DirExists(t, filepath.Join(container.Config.TFTP.Dir, "racks", "r100"))
+	mockServerService.AssertExpectations(t)
+}
+
+// Test AddRack rejects a missing VLAN ID before touching the network
+func TestDHCPHandlers_AddRack_InvalidVLAN(t *testing.T) {
+	mockServerService := &MockServerService{}
+
+	handlers := &DHCPHandlers{
+		serverService: mockServerService,
+		leaseService:  &MockLeaseService{},
+		config:        createTestContainer().Config,
+	}
+
+	req := httptest.NewRequest("POST", "/dhcp/rack", strings.NewReader("parent=eth0&vlan_id=abc"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	handlers.AddRack(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "vlan_id")
+	mockServerService.AssertNotCalled(t, "CreateServer", mock.Anything, mock.Anything)
+}
+
+// Test parseLeaseMapping accepts both separators and rejects bad lines
+func TestParseLeaseMapping(t *testing.T) {
+	mapping, err := parseLeaseMapping("# comment\naa:bb:cc:dd:ee:ff 10.0.0.10\n\n11:22:33:44:55:66=10.0.0.11\n")
+	assert.NoError(t, err)
+	assert.Len(t, mapping, 2)
+	assert.True(t, mapping["aa:bb:cc:dd:ee:ff"].Equal(net.ParseIP("10.0.0.10")))
+	assert.True(t, mapping["11:22:33:44:55:66"].Equal(net.ParseIP("10.0.0.11")))
+
+	_, err = parseLeaseMapping("aa:bb:cc:dd:ee:ff")
+	assert.Error(t, err)
+
+	_, err = parseLeaseMapping("aa:bb:cc:dd:ee:ff 10.0.0.300")
+	assert.Error(t, err)
+}
+
 // Test StartDHCPServer missing server_id
 func TestDHCPHandlers_StartDHCPServer_MissingID(t *testing.T) {
 	mockServerService := &MockServerService{}
@@ -501,6 +622,42 @@ func TestDHCPHandlers_GetLeaseStateHistory_Success(t *testing.T) {
 	mockLeaseService.AssertExpectations(t)
 }
 
+// Test GetLeaseTransfers returns the TFTP history of the lease's IP
+func TestDHCPHandlers_GetLeaseTransfers(t *testing.T) {
+	mockLeaseService := &MockLeaseService{}
+	transferLog := tftp.NewTransferLog(10)
+
+	handlers := &DHCPHandlers{
+		leaseService: mockLeaseService,
+		transferLog:  transferLog,
+		config:       createTestContainer().Config,
+	}
+
+	mac := "aa:bb:cc:dd:ee:ff"
+	ip := net.ParseIP("192.168.1.100")
+	transferLog.Record(tftp.Transfer{ClientIP: ip, Filename: "pxelinux.0", Direction: tftp.DirectionRead, Outcome: tftp.OutcomeSuccess, Bytes: 42})
+	transferLog.Record(tftp.Transfer{ClientIP: net.ParseIP("192.168.1.101"), Filename: "other.0"})
+
+	mockLeaseService.On("GetLeaseByMAC", mock.Anything, mac).Return(&dhcp.Lease{MAC: mac, IP: ip}, nil)
+
+	req := httptest.NewRequest("GET", "/dhcp/lease/transfers?mac="+mac, nil)
+	w := httptest.NewRecorder()
+
+	handlers.GetLeaseTransfers(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Transfers []tftp.Transfer `json:"transfers"`
+	}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.Len(t, response.Transfers, 1)
+	assert.Equal(t, "pxelinux.0", response.Transfers[0].Filename)
+	assert.Equal(t, int64(42), response.Transfers[0].Bytes)
+
+	mockLeaseService.AssertExpectations(t)
+}
+
 // Test utility functions
 func TestDHCPHandlers_getServerStatusBadge(t *testing.T) {
 	handlers := &DHCPHandlers{}
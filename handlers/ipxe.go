@@ -1,7 +1,13 @@
 package handlers
 
 import (
+	"log"
+	"net"
 	"net/http"
+
+	"ignite/bootmenu"
+	"ignite/dhcp"
+	"ignite/ipxe"
 )
 
 // IPXEHandlers handles iPXE-related HTTP requests
@@ -43,3 +49,60 @@ func (h *IPXEHandlers) UpdateConfigFile(w http.ResponseWriter, r *http.Request)
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("iPXE configuration updated successfully"))
 }
+
+// HostScript serves the iPXE script for one host, as chained with
+// /boot/ipxe?mac=${net0/mac}&uuid=${uuid}. Hosts armed for provisioning boot
+// straight into the installer on their lease, other known hosts boot from
+// local disk and unknown hosts get the global menu.
+func (h *IPXEHandlers) HostScript(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	clientIP := requestIP(r)
+
+	if err := h.container.BootAccess.Check("ipxe", clientIP); err != nil {
+		log.Printf("iPXE: denied host script to %s: %v", clientIP, err)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	mac, uuid := r.URL.Query().Get("mac"), r.URL.Query().Get("uuid")
+	lease := h.leaseForMAC(r, mac)
+
+	var script []byte
+	switch {
+	case lease == nil || h.container.BootMenus == nil:
+		log.Printf("iPXE: unknown host %s (uuid %s), serving the boot menu", mac, uuid)
+		config, err := h.container.IPXEService.GenerateConfig(ctx)
+		if err != nil {
+			http.Error(w, "Failed to generate iPXE config: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		script = []byte(config)
+	case !lease.IsArmed():
+		log.Printf("iPXE: %s (uuid %s) is not armed, booting from local disk", lease.MAC, uuid)
+		script = []byte(ipxe.LocalBootScript)
+	default:
+		log.Printf("iPXE: booting %s (uuid %s) into %s %s", lease.MAC, uuid, lease.Menu.OS, lease.Menu.Version)
+		var err error
+		if script, err = h.container.BootMenus.RenderLease(ctx, lease, bootmenu.IPXETemplate); err != nil {
+			http.Error(w, "Failed to render iPXE script: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	SetNoCacheHeaders(w)
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write(script)
+}
+
+// leaseForMAC returns the lease for mac, or nil if the MAC is malformed or unknown
+func (h *IPXEHandlers) leaseForMAC(r *http.Request, mac string) *dhcp.Lease {
+	hw, err := net.ParseMAC(mac)
+	if err != nil || h.container.LeaseService == nil {
+		return nil
+	}
+	lease, err := h.container.LeaseService.GetLeaseByMAC(r.Context(), hw.String())
+	if err != nil {
+		return nil
+	}
+	return lease
+}
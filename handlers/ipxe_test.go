@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ignite/bootmenu"
+	"ignite/config"
+	"ignite/dhcp"
+	"ignite/ipxe"
+	"ignite/osimage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// noOSImages is an OS image service without any images
+type noOSImages struct {
+	osimage.OSImageService
+}
+
+func (noOSImages) GetAllOSImages(ctx context.Context) ([]*osimage.OSImage, error) {
+	return nil, nil
+}
+
+func newHostScriptHandlers(t *testing.T, lease *dhcp.Lease) *IPXEHandlers {
+	t.Helper()
+	templateDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(templateDir, bootmenu.IPXETemplate),
+		[]byte("#!ipxe\necho Installing {{.Name}} on {{.Hostname}}\n"), 0644))
+
+	servers := new(MockServerService)
+	servers.On("GetServer", mock.Anything, mock.Anything).Return(&dhcp.Server{IP: net.ParseIP("10.0.0.1")}, nil)
+	leases := new(MockLeaseService)
+	leases.On("GetLeaseByMAC", mock.Anything, "aa:bb:cc:dd:ee:ff").Return(lease, nil)
+	leases.On("GetLeaseByMAC", mock.Anything, mock.Anything).Return(nil, errors.New("lease not found"))
+
+	cfg := &config.Config{}
+	cfg.HTTP.Port = "8080"
+	return NewIPXEHandlers(&Container{
+		LeaseService: leases,
+		IPXEService:  ipxe.NewService(cfg, noOSImages{}),
+		BootMenus:    bootmenu.NewRenderer(templateDir, servers, leases, nil),
+		Config:       cfg,
+	})
+}
+
+func TestIPXEHandlers_HostScript(t *testing.T) {
+	armed := &dhcp.Lease{
+		MAC:   "aa:bb:cc:dd:ee:ff",
+		State: dhcp.StateAssigned,
+		Menu:  dhcp.BootMenu{OS: "ubuntu", Hostname: "node1"},
+	}
+	installed := *armed
+	installed.State = dhcp.StateComplete
+
+	tests := []struct {
+		name     string
+		lease    *dhcp.Lease
+		mac      string
+		contains string
+	}{
+		{"Armed host boots its installer", armed, "AA:BB:CC:DD:EE:FF", "Installing ubuntu on node1"},
+		{"Installed host boots locally", &installed, "aa:bb:cc:dd:ee:ff", "sanboot"},
+		{"Unknown host gets the menu", armed, "11:22:33:44:55:66", "menu Ignite PXE Boot Menu"},
+		{"Malformed MAC gets the menu", armed, "not-a-mac", "menu Ignite PXE Boot Menu"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHostScriptHandlers(t, tt.lease)
+			req := httptest.NewRequest("GET", "/boot/ipxe?mac="+tt.mac+"&uuid=4c4c4544-0000", nil)
+			rr := httptest.NewRecorder()
+			h.HostScript(rr, req)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Contains(t, rr.Body.String(), tt.contains)
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+
+	"ignite/bootmenu"
+	"ignite/dhcp"
+
+	"github.com/gorilla/mux"
+)
+
+// ServeNoCloud serves the cloud-init NoCloud datasource files for the host
+// with the "mac" query parameter or, without one, the host leased the
+// request's source IP. user-data is rendered from the host's cloud-init or
+// autoinstall template; meta-data and network-config come from its boot menu.
+func (h *BootHandlers) ServeNoCloud(w http.ResponseWriter, r *http.Request) {
+	file := mux.Vars(r)["file"]
+	clientIP := requestIP(r)
+
+	if err := h.container.BootAccess.Check(bootmenu.NoCloudPath+"/"+file, clientIP); err != nil {
+		log.Printf("NoCloud: denied %s to %s: %v", file, clientIP, err)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	lease := h.noCloudLease(r, clientIP)
+	if lease == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	var data []byte
+	contentType := "text/plain; charset=utf-8"
+	switch file {
+	case bootmenu.NoCloudUserData:
+		var err error
+		if data, err = h.userData(r, lease); err != nil {
+			log.Printf("NoCloud: failed to render user-data for %s: %v", lease.MAC, err)
+			http.Error(w, "Error rendering user-data", http.StatusInternalServerError)
+			return
+		}
+		contentType = bootmenu.ConfigContentType("cloud-init")
+	case bootmenu.NoCloudMetaData:
+		data = bootmenu.MetaData(lease)
+	case bootmenu.NoCloudNetworkConfig:
+		data = bootmenu.NetworkConfig(lease)
+	case bootmenu.NoCloudVendorData:
+		// Nothing beyond what user-data configures
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	SetNoCacheHeaders(w)
+	w.Header().Set("Content-Type", contentType)
+	w.Write(data)
+}
+
+// userData renders the host's cloud-init or autoinstall template, recording the fetch, or
+// returns minimal user-data for hosts without one
+func (h *BootHandlers) userData(r *http.Request, lease *dhcp.Lease) ([]byte, error) {
+	if h.container.BootConfigs == nil || (lease.Menu.TemplateType != "cloud-init" && lease.Menu.TemplateType != "autoinstall") {
+		return bootmenu.DefaultUserData(lease), nil
+	}
+
+	data, err := h.container.BootConfigs.RenderLease(r.Context(), lease, requestIP(r))
+	if errors.Is(err, fs.ErrNotExist) {
+		return bootmenu.DefaultUserData(lease), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := h.container.BootConfigs.RecordFetch(r.Context(), lease, requestIP(r)); err != nil {
+		log.Printf("NoCloud: %v", err)
+	}
+	return data, nil
+}
+
+// noCloudLease returns the lease of the host a NoCloud request is for, or nil
+func (h *BootHandlers) noCloudLease(r *http.Request, clientIP net.IP) *dhcp.Lease {
+	if h.container.LeaseService == nil {
+		return nil
+	}
+
+	var lease *dhcp.Lease
+	var err error
+	if mac := r.URL.Query().Get("mac"); mac != "" {
+		hw, parseErr := net.ParseMAC(mac)
+		if parseErr != nil {
+			return nil
+		}
+		lease, err = h.container.LeaseService.GetLeaseByMAC(r.Context(), hw.String())
+	} else if clientIP != nil {
+		lease, err = h.container.LeaseService.GetLeaseByIP(r.Context(), clientIP)
+	}
+	if err != nil {
+		return nil
+	}
+	return lease
+}
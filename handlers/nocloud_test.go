@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ignite/bootmenu"
+	"ignite/dhcp"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newNoCloudRouter(t *testing.T, lease *dhcp.Lease) *mux.Router {
+	t.Helper()
+	templateDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(templateDir, "cloud-init"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(templateDir, "cloud-init", "default.templ"),
+		[]byte("#cloud-config\nhostname: {{ .hostname }}\ntoken: \"{{ .token }}\"\n"), 0644))
+
+	servers := new(MockServerService)
+	servers.On("GetServer", mock.Anything, mock.Anything).Return(nil, errors.New("server not found"))
+	leases := new(MockLeaseService)
+	leases.On("GetLeaseByMAC", mock.Anything, lease.MAC).Return(lease, nil)
+	leases.On("GetLeaseByMAC", mock.Anything, mock.Anything).Return(nil, errors.New("lease not found"))
+	leases.On("GetLeaseByIP", mock.Anything, lease.IP).Return(lease, nil)
+	leases.On("GetLeaseByIP", mock.Anything, mock.Anything).Return(nil, errors.New("lease not found"))
+	leases.On("UpdateLease", mock.Anything, lease).Return(nil)
+
+	h := NewBootHandlers(&Container{
+		LeaseService: leases,
+		BootConfigs:  bootmenu.NewConfigRenderer(templateDir, servers, leases),
+	})
+	router := mux.NewRouter()
+	router.HandleFunc("/boot/nocloud/{file}", h.ServeNoCloud)
+	return router
+}
+
+func TestBootHandlers_ServeNoCloud(t *testing.T) {
+	lease := &dhcp.Lease{
+		MAC:    "aa:bb:cc:dd:ee:ff",
+		IP:     net.ParseIP("10.0.0.5"),
+		Expiry: time.Now().Add(time.Hour),
+		State:  dhcp.StateBooting,
+		Token:  "0123456789abcdef",
+		Menu: dhcp.BootMenu{
+			OS:           "ubuntu",
+			TemplateType: "cloud-init",
+			TemplateName: "default.templ",
+			Hostname:     "node1",
+			IP:           net.ParseIP("10.0.0.50"),
+			Subnet:       net.ParseIP("255.255.255.0"),
+		},
+	}
+	router := newNoCloudRouter(t, lease)
+
+	tests := []struct {
+		name       string
+		target     string
+		remoteAddr string
+		status     int
+		contains   string
+	}{
+		{"user-data by MAC", "/boot/nocloud/user-data?mac=AA:BB:CC:DD:EE:FF", "10.0.0.5:1234", http.StatusOK, "hostname: node1"},
+		{"meta-data by source IP", "/boot/nocloud/meta-data", "10.0.0.5:1234", http.StatusOK, "instance-id: \"ignite-aa-bb-cc-dd-ee-ff-9f9f5111\""},
+		{"network-config", "/boot/nocloud/network-config", "10.0.0.5:1234", http.StatusOK, "addresses: [\"10.0.0.50/24\"]"},
+		{"vendor-data", "/boot/nocloud/vendor-data", "10.0.0.5:1234", http.StatusOK, ""},
+		{"Unknown file", "/boot/nocloud/user-data.bak", "10.0.0.5:1234", http.StatusNotFound, ""},
+		{"Unknown host", "/boot/nocloud/meta-data", "192.0.2.1:1234", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.target, nil)
+			req.RemoteAddr = tt.remoteAddr
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.status, rr.Code)
+			assert.Contains(t, rr.Body.String(), tt.contains)
+		})
+	}
+	assert.Equal(t, dhcp.StateImaging, lease.State, "user-data fetch should be recorded")
+}
+
+func TestBootHandlers_NoCloudTokenOnlyForLeasedIP(t *testing.T) {
+	lease := &dhcp.Lease{
+		MAC:    "aa:bb:cc:dd:ee:ff",
+		IP:     net.ParseIP("10.0.0.5"),
+		Expiry: time.Now().Add(time.Hour),
+		Token:  "0123456789abcdef",
+		Menu:   dhcp.BootMenu{OS: "ubuntu", TemplateType: "cloud-init", TemplateName: "default.templ", Hostname: "node1"},
+	}
+	router := newNoCloudRouter(t, lease)
+
+	for remoteAddr, token := range map[string]string{
+		"10.0.0.5:1234":  "token: \"0123456789abcdef\"",
+		"192.0.2.1:1234": "token: \"\"",
+	} {
+		req := httptest.NewRequest("GET", "/boot/nocloud/user-data?mac=aa:bb:cc:dd:ee:ff", nil)
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), token, "user-data fetched from %s", remoteAddr)
+	}
+}
+
+func TestBootHandlers_NoCloudFetchFromForeignIP(t *testing.T) {
+	lease := &dhcp.Lease{
+		MAC:    "aa:bb:cc:dd:ee:ff",
+		IP:     net.ParseIP("10.0.0.5"),
+		Expiry: time.Now().Add(time.Hour),
+		State:  dhcp.StateBooting,
+		Menu:   dhcp.BootMenu{OS: "ubuntu", TemplateType: "cloud-init", TemplateName: "default.templ", Hostname: "node1"},
+	}
+	router := newNoCloudRouter(t, lease)
+
+	req := httptest.NewRequest("GET", "/boot/nocloud/user-data?mac=aa:bb:cc:dd:ee:ff", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, dhcp.StateBooting, lease.State, "another host's fetch must not move the lease to imaging")
+	assert.False(t, lease.ConfigFetchedAt.IsZero())
+}
+
+func TestBootHandlers_NoCloudDefaultUserData(t *testing.T) {
+	lease := &dhcp.Lease{
+		MAC:  "aa:bb:cc:dd:ee:ff",
+		IP:   net.ParseIP("10.0.0.5"),
+		Menu: dhcp.BootMenu{OS: "debian", TemplateType: "preseed", TemplateName: "default.templ", Hostname: "node2"},
+	}
+	router := newNoCloudRouter(t, lease)
+
+	req := httptest.NewRequest("GET", "/boot/nocloud/user-data", nil)
+	req.RemoteAddr = "10.0.0.5:1234"
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "#cloud-config\nhostname: \"node2\"\n", rr.Body.String())
+}
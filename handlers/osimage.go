@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"ignite/osimage"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -36,9 +37,9 @@ func (h *OSImageHandlers) OSImagesPage(w http.ResponseWriter, r *http.Request) {
 		downloads = []*osimage.DownloadStatus{} // Continue with empty downloads
 	}
 
-	// Get supported architectures from config (collect unique architectures from all versions)
+	// Get supported architectures from the catalog (collect unique architectures from all versions)
 	archMap := make(map[string]bool)
-	for _, osSource := range h.container.Config.OSImages.Sources {
+	for _, osSource := range h.container.OSCatalog.Sources() {
 		for _, version := range osSource.Versions {
 			for _, arch := range version.Architectures {
 				archMap[arch] = true
@@ -56,16 +57,26 @@ func (h *OSImageHandlers) OSImagesPage(w http.ResponseWriter, r *http.Request) {
 		supportedArchs = []string{"x86_64"}
 	}
 
+	catalogSources, mirrors, catalogLoaded := h.container.OSCatalog.Status()
+
 	data := struct {
-		Title         string
-		OSImages      []*osimage.OSImage
-		Downloads     []*osimage.DownloadStatus
-		Architectures []string
+		Title          string
+		OSImages       []*osimage.OSImage
+		Downloads      []*osimage.DownloadStatus
+		Architectures  []string
+		Catalog        []osimage.CatalogEntry
+		CatalogSources []osimage.CatalogSource
+		Mirrors        map[string]string
+		CatalogLoaded  time.Time
 	}{
-		Title:         "OS Images",
-		OSImages:      images,
-		Downloads:     downloads,
-		Architectures: supportedArchs,
+		Title:          "OS Images",
+		OSImages:       images,
+		Downloads:      downloads,
+		Architectures:  supportedArchs,
+		Catalog:        h.container.OSCatalog.Entries(),
+		CatalogSources: catalogSources,
+		Mirrors:        mirrors,
+		CatalogLoaded:  catalogLoaded,
 	}
 
 	templates := LoadTemplates()
@@ -203,8 +214,8 @@ func (h *OSImageHandlers) GetAvailableVersions(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	// Create a more detailed response with display names from config
-	osDef, exists := h.container.Config.OSImages.Sources[os]
+	// Create a more detailed response with display names from the catalog
+	osDef, exists := h.container.OSCatalog.Definition(os)
 	if !exists {
 		http.Error(w, fmt.Sprintf("OS configuration not found: %s", os), http.StatusInternalServerError)
 		return
@@ -275,3 +286,33 @@ func (h *OSImageHandlers) CancelDownload(w http.ResponseWriter, r *http.Request)
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Download cancelled successfully"))
 }
+
+// GetCatalog returns the merged OS catalog and where its entries came from
+func (h *OSImageHandlers) GetCatalog(w http.ResponseWriter, r *http.Request) {
+	sources, mirrors, loaded := h.container.OSCatalog.Status()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sources":   h.container.OSCatalog.Sources(),
+		"entries":   h.container.OSCatalog.Entries(),
+		"catalogs":  sources,
+		"mirrors":   mirrors,
+		"loaded_at": loaded,
+	})
+}
+
+// RefreshCatalog reloads catalog files and remote catalogs
+func (h *OSImageHandlers) RefreshCatalog(w http.ResponseWriter, r *http.Request) {
+	response := map[string]interface{}{
+		"status":  "success",
+		"message": "OS catalog refreshed",
+	}
+	if err := h.container.OSCatalog.Refresh(r.Context()); err != nil {
+		// The rest of the catalog was still loaded
+		response["status"] = "partial"
+		response["message"] = fmt.Sprintf("OS catalog refreshed, some sources were skipped: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+
+	"ignite/dhcp"
+)
+
+// phoneHomeSource is recorded on lease state transitions reported by installers
+const phoneHomeSource = "installer"
+
+// maxPhoneHomeBody limits the size of a phone-home report
+const maxPhoneHomeBody = 64 << 10
+
+// phoneHomeStates are the states installers may report
+var phoneHomeStates = map[string]bool{
+	dhcp.StateImaging:     true,
+	dhcp.StateImaged:      true,
+	dhcp.StateConfiguring: true,
+	dhcp.StateComplete:    true,
+	dhcp.StateFailed:      true,
+}
+
+// PhoneHomeReport is a progress report from a host's installer
+type PhoneHomeReport struct {
+	State   string `json:"state"`
+	Message string `json:"message"`
+	Token   string `json:"token"`
+}
+
+// HandlePhoneHome records a progress report from the installer on the host
+// with the "mac" query parameter. Reports are authenticated with the token in
+// the host's rendered config, sent as a bearer token or a "token" field, and
+// carry a state and an optional message. A report without a state is a
+// heartbeat, and only its latest message is kept.
+func (h *BootHandlers) HandlePhoneHome(w http.ResponseWriter, r *http.Request) {
+	clientIP := requestIP(r)
+	if err := h.container.BootAccess.Check("phone-home", clientIP); err != nil {
+		log.Printf("Phone home: denied %s: %v", clientIP, err)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	report, err := parsePhoneHomeReport(w, r)
+	if err != nil {
+		http.Error(w, "Invalid report", http.StatusBadRequest)
+		return
+	}
+	if report.State != "" && !phoneHomeStates[report.State] {
+		http.Error(w, "Unknown state: "+report.State, http.StatusBadRequest)
+		return
+	}
+
+	lease := h.leaseForReport(r)
+	if lease == nil || !lease.CheckToken(report.Token) {
+		log.Printf("Phone home: rejected report for %s from %s", r.URL.Query().Get("mac"), clientIP)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if report.State != "" {
+		lease.Report(report.State, phoneHomeSource, report.Message)
+	} else {
+		lease.Heartbeat(report.Message)
+	}
+	if err := h.container.LeaseService.UpdateLease(r.Context(), lease); err != nil {
+		log.Printf("Phone home: failed to save report for %s: %v", lease.MAC, err)
+		http.Error(w, "Failed to record report", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+		"state":  lease.State,
+	})
+}
+
+// leaseForReport returns the lease of the host a report is for, or nil
+func (h *BootHandlers) leaseForReport(r *http.Request) *dhcp.Lease {
+	mac, err := net.ParseMAC(r.URL.Query().Get("mac"))
+	if err != nil || h.container.LeaseService == nil {
+		return nil
+	}
+	lease, err := h.container.LeaseService.GetLeaseByMAC(r.Context(), mac.String())
+	if err != nil {
+		return nil
+	}
+	return lease
+}
+
+// parsePhoneHomeReport reads a report sent as JSON or as form fields, taking
+// the token from the Authorization header if present
+func parsePhoneHomeReport(w http.ResponseWriter, r *http.Request) (PhoneHomeReport, error) {
+	var report PhoneHomeReport
+	r.Body = http.MaxBytesReader(w, r.Body, maxPhoneHomeBody)
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/json" {
+		if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+			return report, err
+		}
+	} else {
+		if err := r.ParseForm(); err != nil {
+			return report, err
+		}
+		report = PhoneHomeReport{
+			State:   r.PostForm.Get("state"),
+			Message: r.PostForm.Get("message"),
+			Token:   r.PostForm.Get("token"),
+		}
+	}
+
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		report.Token = token
+	}
+	report.State = strings.ToLower(strings.TrimSpace(report.State))
+	return report, nil
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"ignite/dhcp"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newPhoneHomeHandlers(lease *dhcp.Lease) (*BootHandlers, *MockLeaseService) {
+	leases := new(MockLeaseService)
+	leases.On("GetLeaseByMAC", mock.Anything, "aa:bb:cc:dd:ee:ff").Return(lease, nil)
+	leases.On("GetLeaseByMAC", mock.Anything, mock.Anything).Return(nil, errors.New("lease not found"))
+	leases.On("UpdateLease", mock.Anything, lease).Return(nil)
+	return NewBootHandlers(&Container{LeaseService: leases}), leases
+}
+
+func phoneHome(h *BootHandlers, mac string, form url.Values, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/boot/phone-home?mac="+url.QueryEscape(mac), strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	rr := httptest.NewRecorder()
+	h.HandlePhoneHome(rr, req)
+	return rr
+}
+
+func TestBootHandlers_PhoneHomeReportsState(t *testing.T) {
+	lease := &dhcp.Lease{MAC: "aa:bb:cc:dd:ee:ff", State: dhcp.StateBooting, Token: "secret"}
+	h, leases := newPhoneHomeHandlers(lease)
+
+	rr := phoneHome(h, "aa:bb:cc:dd:ee:ff", url.Values{"state": {"imaged"}, "message": {"packages installed"}, "token": {"secret"}}, nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, dhcp.StateImaged, lease.State)
+
+	// Reports of the current state keep their message, authenticated with a bearer token
+	rr = phoneHome(h, "aa:bb:cc:dd:ee:ff", url.Values{"state": {"imaged"}, "message": {"bootloader installed"}},
+		http.Header{"Authorization": {"Bearer secret"}})
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	if assert.Len(t, lease.StateHistory, 2) {
+		assert.Equal(t, "installer", lease.StateHistory[0].Source)
+		assert.Equal(t, "packages installed", lease.StateHistory[0].Message)
+		assert.Equal(t, "bootloader installed", lease.StateHistory[1].Message)
+	}
+	leases.AssertNumberOfCalls(t, "UpdateLease", 2)
+}
+
+func TestBootHandlers_PhoneHomeHeartbeat(t *testing.T) {
+	lease := &dhcp.Lease{MAC: "aa:bb:cc:dd:ee:ff", State: dhcp.StateConfiguring, Token: "secret"}
+	h, _ := newPhoneHomeHandlers(lease)
+
+	req := httptest.NewRequest("POST", "/boot/phone-home?mac=aa:bb:cc:dd:ee:ff", strings.NewReader(`{"token":"secret"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	h.HandlePhoneHome(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, dhcp.StateConfiguring, lease.State)
+	assert.False(t, lease.LastSeen.IsZero())
+	assert.Empty(t, lease.StateHistory)
+
+	// Heartbeat messages replace each other instead of growing the history
+	for _, message := range []string{"50% done", "75% done", "90% done"} {
+		rr = phoneHome(h, "aa:bb:cc:dd:ee:ff", url.Values{"message": {message}, "token": {"secret"}}, nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	}
+	if assert.Len(t, lease.StateHistory, 1) {
+		assert.Equal(t, "heartbeat", lease.StateHistory[0].Source)
+		assert.Equal(t, "90% done", lease.StateHistory[0].Message)
+	}
+
+	// A state report starts a new entry, after which heartbeats are kept again
+	rr = phoneHome(h, "aa:bb:cc:dd:ee:ff", url.Values{"state": {"configuring"}, "message": {"running hooks"}, "token": {"secret"}}, nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = phoneHome(h, "aa:bb:cc:dd:ee:ff", url.Values{"message": {"hooks done"}, "token": {"secret"}}, nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Len(t, lease.StateHistory, 3)
+}
+
+func TestBootHandlers_PhoneHomeRejected(t *testing.T) {
+	lease := &dhcp.Lease{MAC: "aa:bb:cc:dd:ee:ff", State: dhcp.StateBooting, Token: "secret"}
+	h, leases := newPhoneHomeHandlers(lease)
+
+	tests := []struct {
+		name   string
+		mac    string
+		form   url.Values
+		status int
+	}{
+		{"Wrong token", "aa:bb:cc:dd:ee:ff", url.Values{"state": {"complete"}, "token": {"guess"}}, http.StatusUnauthorized},
+		{"Missing token", "aa:bb:cc:dd:ee:ff", url.Values{"state": {"complete"}}, http.StatusUnauthorized},
+		{"Unknown host", "11:22:33:44:55:66", url.Values{"state": {"complete"}, "token": {"secret"}}, http.StatusUnauthorized},
+		{"Unknown state", "aa:bb:cc:dd:ee:ff", url.Values{"state": {"assigned"}, "token": {"secret"}}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := phoneHome(h, tt.mac, tt.form, nil)
+			assert.Equal(t, tt.status, rr.Code)
+		})
+	}
+	assert.Equal(t, dhcp.StateBooting, lease.State)
+	leases.AssertNotCalled(t, "UpdateLease", mock.Anything, mock.Anything)
+}
@@ -71,7 +71,7 @@ func (h *ProvisionHandlers) getProvisionData() *ProvisionData {
 	data := &ProvisionData{
 		Title:      "Provisioning Scripts",
 		Files:      []*ProvisionFileInfo{},
-		Categories: []string{"autoyast", "bootmenu", "cloud-init", "ipxe", "kickstart", "preseed"},
+		Categories: []string{"autoinstall", "autoyast", "bootmenu", "cloud-init", "ignition", "ipxe", "kickstart", "preseed"},
 		Types:      []string{"templates", "configs"},
 	}
 
@@ -139,7 +139,7 @@ func (h *ProvisionHandlers) detectLanguage(path string) string {
 	ext := strings.ToLower(filepath.Ext(path))
 
 	switch ext {
-	case ".yaml", ".yml":
+	case ".yaml", ".yml", ".bu":
 		return "yaml"
 	case ".cfg", ".conf":
 		return "ini"
@@ -151,7 +151,7 @@ func (h *ProvisionHandlers) detectLanguage(path string) string {
 		return "ipxe"
 	default:
 		// Check directory or filename for hints
-		if strings.Contains(path, "cloud-init") {
+		if strings.Contains(path, "cloud-init") || strings.Contains(path, "autoinstall") || strings.Contains(path, "ignition") {
 			return "yaml"
 		}
 		if strings.Contains(path, "kickstart") {
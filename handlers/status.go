@@ -5,7 +5,11 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"strconv"
 	"time"
+
+	"ignite/dhcp"
+	"ignite/tftp"
 )
 
 // StatusHandlers handles status-related requests
@@ -41,10 +45,40 @@ type SystemStatus struct {
 	HTTPServer    ServiceStatus      `json:"http_server"`
 	APIServer     ServiceStatus      `json:"api_server"`
 	TFTPServer    ServiceStatus      `json:"tftp_server"`
+	TFTPListener  TFTPListenerStatus `json:"tftp_listener"`
+	TFTPCache     *TFTPCacheStatus   `json:"tftp_cache,omitempty"`
 	DHCPServers   []DHCPServerStatus `json:"dhcp_servers"`
+	RogueDHCP     RogueDHCPStatus    `json:"rogue_dhcp"`
 	OverallStatus string             `json:"overall_status"`
 }
 
+// TFTPListenerStatus shows the configured TFTP listener and transfer tuning
+type TFTPListenerStatus struct {
+	Address      string        `json:"address"`
+	Port         int           `json:"port"`
+	MaxBlockSize int           `json:"max_block_size"`
+	Timeout      time.Duration `json:"timeout"`
+	Retries      int           `json:"retries"`
+	SinglePort   bool          `json:"single_port"`
+}
+
+// TFTPCacheStatus shows TFTP file cache usage and hit rate
+type TFTPCacheStatus struct {
+	tftp.CacheStats
+	HitPercent float64 `json:"hit_percent"`
+	UsedMB     float64 `json:"used_mb"`
+	MaxMB      float64 `json:"max_mb"`
+}
+
+// RogueDHCPStatus summarises rogue DHCP server detection
+type RogueDHCPStatus struct {
+	Enabled    bool               `json:"enabled"`
+	LastScan   time.Time          `json:"last_scan"`
+	Servers    []dhcp.RogueServer `json:"servers"`
+	ScanErrors map[string]string  `json:"scan_errors,omitempty"`
+	Active     int                `json:"active"`
+}
+
 // NewStatusHandlers creates a new StatusHandlers instance
 func NewStatusHandlers(container *Container) *StatusHandlers {
 	return &StatusHandlers{container: container}
@@ -85,16 +119,72 @@ func (h *StatusHandlers) getSystemStatus() *SystemStatus {
 
 	// Check TFTP Server status
 	status.TFTPServer = h.checkTFTPServerStatus()
+	status.TFTPListener = h.tftpListenerStatus()
+	if h.container.TFTPCache != nil {
+		stats := h.container.TFTPCache.Stats()
+		status.TFTPCache = &TFTPCacheStatus{
+			CacheStats: stats,
+			HitPercent: stats.HitRate * 100,
+			UsedMB:     float64(stats.Bytes) / (1 << 20),
+			MaxMB:      float64(stats.MaxBytes) / (1 << 20),
+		}
+	}
 
 	// Check DHCP Server statuses
 	status.DHCPServers = h.checkDHCPServersStatus()
 
+	// Report any rogue DHCP servers seen on managed interfaces
+	status.RogueDHCP = h.getRogueDHCPStatus()
+
 	// Determine overall status
 	status.OverallStatus = h.calculateOverallStatus(status)
 
 	return status
 }
 
+// ScanRogueDHCP handles POST /status/rogue/scan, probing for rogue DHCP servers immediately
+func (h *StatusHandlers) ScanRogueDHCP(w http.ResponseWriter, r *http.Request) {
+	if h.container.RogueDetector == nil {
+		http.Error(w, "Rogue DHCP detection is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Minute)
+	defer cancel()
+
+	if err := h.container.RogueDetector.Scan(ctx); err != nil {
+		appErr := NewInternalError(
+			fmt.Sprintf("Rogue DHCP scan failed: %v", err),
+			"Unable to scan for rogue DHCP servers. Please try again later.",
+		)
+		HandleError(w, r, appErr)
+		return
+	}
+
+	h.HandleStatusContent(w, r)
+}
+
+// getRogueDHCPStatus collects the detector's latest findings
+func (h *StatusHandlers) getRogueDHCPStatus() RogueDHCPStatus {
+	detector := h.container.RogueDetector
+	if detector == nil {
+		return RogueDHCPStatus{}
+	}
+
+	status := RogueDHCPStatus{
+		Enabled:    h.container.Config.DHCP.RogueScanInterval > 0,
+		LastScan:   detector.LastScan(),
+		Servers:    detector.RogueServers(),
+		ScanErrors: detector.ScanErrors(),
+	}
+	for _, rogue := range status.Servers {
+		if rogue.Active {
+			status.Active++
+		}
+	}
+	return status
+}
+
 // checkHTTPServerStatus checks if the HTTP/API server is running
 func (h *StatusHandlers) checkHTTPServerStatus() ServiceStatus {
 	now := time.Now()
@@ -126,16 +216,23 @@ func (h *StatusHandlers) checkHTTPServerStatus() ServiceStatus {
 // checkTFTPServerStatus checks if the TFTP server is running
 func (h *StatusHandlers) checkTFTPServerStatus() ServiceStatus {
 	now := time.Now()
+	cfg := h.container.Config.TFTP
+
+	address := cfg.Address
+	if address == "" {
+		address = "localhost"
+	}
+	port := strconv.Itoa(cfg.Port)
 
 	status := ServiceStatus{
 		Name:      "TFTP Server",
 		LastCheck: now,
-		Address:   "localhost",
-		Port:      "69",
+		Address:   address,
+		Port:      port,
 	}
 
-	// Try to connect to the TFTP server on UDP port 69
-	conn, err := net.DialTimeout("udp", "localhost:69", 2*time.Second)
+	// Try to connect to the TFTP server on its configured UDP port
+	conn, err := net.DialTimeout("udp", net.JoinHostPort(address, port), 2*time.Second)
 	if err != nil {
 		status.Status = "stopped"
 		status.Description = "TFTP Server is not responding"
@@ -150,6 +247,25 @@ func (h *StatusHandlers) checkTFTPServerStatus() ServiceStatus {
 	return status
 }
 
+// tftpListenerStatus reports the TFTP listener settings from the configuration
+func (h *StatusHandlers) tftpListenerStatus() TFTPListenerStatus {
+	cfg := h.container.Config.TFTP
+
+	address := cfg.Address
+	if address == "" {
+		address = "0.0.0.0"
+	}
+
+	return TFTPListenerStatus{
+		Address:      address,
+		Port:         cfg.Port,
+		MaxBlockSize: cfg.MaxBlockSize,
+		Timeout:      cfg.Timeout,
+		Retries:      cfg.Retries,
+		SinglePort:   cfg.SinglePort,
+	}
+}
+
 // checkDHCPServersStatus checks the status of all configured DHCP servers
 func (h *StatusHandlers) checkDHCPServersStatus() []DHCPServerStatus {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -225,7 +341,7 @@ func (h *StatusHandlers) calculateOverallStatus(status *SystemStatus) string {
 		runningCount += runningDHCP
 	}
 
-	if runningCount == totalServices {
+	if runningCount == totalServices && status.RogueDHCP.Active == 0 {
 		return "healthy"
 	} else if runningCount > 0 {
 		return "partial"
@@ -1,12 +1,18 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+
+	"ignite/security"
+	"ignite/tftp"
 )
 
 // TFTPHandlers handles TFTP-related requests
@@ -53,7 +59,7 @@ func (h *TFTPHandlers) HandleDownload(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create security validator
-	validator := NewTFTPSecurityValidator(TFTPDir)
+	validator := security.NewTFTPSecurityValidator(TFTPDir)
 
 	// Validate the file path
 	if err := validator.ValidateTFTPPath(fileName); err != nil {
@@ -65,30 +71,9 @@ func (h *TFTPHandlers) HandleDownload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get safe file path
-	filePath, err := validator.GetSafePath(TFTPDir, fileName)
-	if err != nil {
-		appErr := NewValidationError(
-			fmt.Sprintf("Cannot resolve safe path: %v", err),
-			"The requested file path is not allowed",
-		)
-		HandleError(w, r, appErr)
-		return
-	}
-
-	// Validate file size
-	if err := validator.pathValidator.ValidateFileSize(filePath); err != nil {
-		appErr := NewValidationError(
-			fmt.Sprintf("File validation failed: %v", err),
-			"The requested file is too large or invalid",
-		)
-		HandleError(w, r, appErr)
-		return
-	}
-
-	file, err := os.Open(filePath)
+	file, info, err := h.openFile(fileName)
 	if err != nil {
-		if os.IsNotExist(err) {
+		if errors.Is(err, fs.ErrNotExist) {
 			appErr := NewNotFoundError(
 				fmt.Sprintf("File not found: %s", fileName),
 				"The requested file does not exist",
@@ -105,15 +90,19 @@ func (h *TFTPHandlers) HandleDownload(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	fileInfo, err := file.Stat()
-	if err != nil {
-		http.Error(w, "Error getting file info", http.StatusInternalServerError)
+	// Validate file size
+	if info.Size() > security.GetDefaultSecurityConfig().MaxFileSize {
+		appErr := NewValidationError(
+			fmt.Sprintf("File validation failed: %s is %d bytes", fileName, info.Size()),
+			"The requested file is too large or invalid",
+		)
+		HandleError(w, r, appErr)
 		return
 	}
 
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filepath.Base(fileName)))
 	w.Header().Set("Content-Type", "application/octet-stream")
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", fileInfo.Size()))
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", info.Size()))
 
 	if _, err := io.Copy(w, file); err != nil {
 		http.Error(w, "Error serving file", http.StatusInternalServerError)
@@ -128,10 +117,9 @@ func (h *TFTPHandlers) ViewFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	filePath := filepath.Join(TFTPDir, fileName)
-	file, err := os.Open(filePath)
+	file, info, err := h.openFile(fileName)
 	if err != nil {
-		if os.IsNotExist(err) {
+		if errors.Is(err, fs.ErrNotExist) {
 			http.Error(w, "File not found", http.StatusNotFound)
 		} else {
 			http.Error(w, "Error opening file", http.StatusInternalServerError)
@@ -140,13 +128,7 @@ func (h *TFTPHandlers) ViewFile(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	fileInfo, err := file.Stat()
-	if err != nil {
-		http.Error(w, "Error getting file info", http.StatusInternalServerError)
-		return
-	}
-
-	if fileInfo.IsDir() {
+	if info.IsDir() {
 		http.Error(w, "Cannot view directory", http.StatusBadRequest)
 		return
 	}
@@ -172,7 +154,17 @@ func (h *TFTPHandlers) HandleDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	filePath := filepath.Join(TFTPDir, fileName)
+	layer, err := h.files().Locate(tftpName(fileName))
+	if err != nil {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+	// Built-in defaults can only be replaced by uploading a file of the same name
+	filePath, err := layer.Path(tftpName(fileName))
+	if err != nil {
+		http.Error(w, "Built-in default files cannot be deleted", http.StatusBadRequest)
+		return
+	}
 	if err := os.Remove(filePath); err != nil {
 		if os.IsNotExist(err) {
 			http.Error(w, "File not found", http.StatusNotFound)
@@ -191,7 +183,8 @@ func (h *TFTPHandlers) HandleDelete(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// HandleUpload handles file uploads
+// HandleUpload handles small file uploads in a single request. Large files
+// should use the resumable upload endpoints instead.
 func (h *TFTPHandlers) HandleUpload(w http.ResponseWriter, r *http.Request) {
 	// Parse multipart form with 32MB max memory
 	err := r.ParseMultipartForm(32 << 20)
@@ -207,19 +200,25 @@ func (h *TFTPHandlers) HandleUpload(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	// Create the uploads directory if it doesn't exist
 	tftpDir := h.container.Config.TFTP.Dir
 	if tftpDir == "" {
 		tftpDir = "./public/tftp"
 	}
 
-	if err := os.MkdirAll(tftpDir, 0755); err != nil {
+	// Place the file in the chosen directory, refusing unsafe names
+	target, err := security.NewTFTPSecurityValidator(tftpDir).ResolveUploadTarget(tftpDir, r.FormValue("dir"), handler.Filename)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid upload: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
 		http.Error(w, "Failed to create upload directory", http.StatusInternalServerError)
 		return
 	}
 
 	// Create the destination file
-	dst, err := os.Create(filepath.Join(tftpDir, handler.Filename))
+	dst, err := os.Create(target)
 	if err != nil {
 		http.Error(w, "Failed to create destination file", http.StatusInternalServerError)
 		return
@@ -244,6 +243,8 @@ type FileInfo struct {
 	Size         string
 	LastModified string
 	IsDir        bool
+	Layer        string // TFTP layer the file is served from
+	Archive      bool   // Whether the file can be extracted
 }
 
 // TFTPData holds information for rendering the TFTP management page
@@ -267,7 +268,7 @@ func (h *TFTPHandlers) getTFTPDir(dir string) (*TFTPData, error) {
 
 // getFileInfo reads the directory and returns file information for display.
 func (h *TFTPHandlers) getFileInfo(dir string) (*TFTPData, error) {
-	entries, err := os.ReadDir(filepath.Join(TFTPDir, dir))
+	entries, err := h.files().Entries(tftpName(dir))
 	if err != nil {
 		return nil, err
 	}
@@ -291,6 +292,8 @@ func (h *TFTPHandlers) getFileInfo(dir string) (*TFTPData, error) {
 			Size:         humanReadableSize(fileInfo.Size()),
 			LastModified: fileInfo.ModTime().Format("2006-01-02 15:04:05"),
 			IsDir:        fileInfo.IsDir(),
+			Layer:        entry.Layer,
+			Archive:      !fileInfo.IsDir() && tftp.IsArchive(entry.Name()),
 		})
 	}
 
@@ -305,6 +308,49 @@ func (h *TFTPHandlers) getFileInfo(dir string) (*TFTPData, error) {
 	}, nil
 }
 
+// files returns the layered TFTP filesystem
+func (h *TFTPHandlers) files() *tftp.LayeredFS {
+	return tftpFiles(h.container)
+}
+
+// openFile opens a file from whichever TFTP layer serves it
+func (h *TFTPHandlers) openFile(fileName string) (fs.File, fs.FileInfo, error) {
+	return openTFTPFile(h.container, fileName)
+}
+
+// tftpFiles returns the container's layered TFTP filesystem, or just the TFTP
+// directory if it does not provide one
+func tftpFiles(container *Container) *tftp.LayeredFS {
+	if container != nil && container.TFTPFiles != nil {
+		return container.TFTPFiles
+	}
+	return tftp.NewLayeredFS(tftp.DirLayer(tftp.LayerShared, TFTPDir))
+}
+
+// openTFTPFile opens a file from whichever TFTP layer serves it
+func openTFTPFile(container *Container, fileName string) (fs.File, fs.FileInfo, error) {
+	file, err := tftpFiles(container).Open(tftpName(fileName))
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return file, info, nil
+}
+
+// tftpName converts a path from the browser into a name within the TFTP layers
+func tftpName(p string) string {
+	p = strings.TrimPrefix(filepath.ToSlash(p), filepath.ToSlash(TFTPDir))
+	name := strings.TrimPrefix(path.Clean("/"+p), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
 // humanReadableSize converts bytes to a human-readable format.
 func humanReadableSize(bytes int64) string {
 	const unit = 1024
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"ignite/tftp"
+)
+
+// newLayeredTFTPHandlers serves a TFTP directory on top of built-in defaults
+func newLayeredTFTPHandlers(t *testing.T) (*TFTPHandlers, string) {
+	t.Helper()
+	sharedDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(sharedDir, "boot.ipxe"), []byte("#!ipxe\nshared"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	defaults := fstest.MapFS{
+		"boot.ipxe": {Data: []byte("#!ipxe\ndefault")},
+		"grub.cfg":  {Data: []byte("set timeout=10")},
+	}
+	container := &Container{
+		TFTPFiles: tftp.NewLayeredFS(
+			tftp.DirLayer(tftp.LayerShared, sharedDir),
+			tftp.Layer{Name: tftp.LayerDefault, FS: defaults},
+		),
+	}
+	return NewTFTPHandlers(container), sharedDir
+}
+
+func TestTFTPHandlers_FileInfoShowsLayers(t *testing.T) {
+	handlers, _ := newLayeredTFTPHandlers(t)
+
+	data, err := handlers.getTFTP()
+	if err != nil {
+		t.Fatalf("getTFTP failed: %v", err)
+	}
+
+	layers := make(map[string]string)
+	for _, file := range data.Files {
+		layers[file.Name] = file.Layer
+	}
+	if layers["boot.ipxe"] != tftp.LayerShared {
+		t.Errorf("Expected boot.ipxe from the shared layer, got %q", layers["boot.ipxe"])
+	}
+	if layers["grub.cfg"] != tftp.LayerDefault {
+		t.Errorf("Expected grub.cfg from the default layer, got %q", layers["grub.cfg"])
+	}
+}
+
+func TestTFTPHandlers_ViewDefaultFile(t *testing.T) {
+	handlers, _ := newLayeredTFTPHandlers(t)
+
+	req := httptest.NewRequest("GET", "/tftp/view?file=grub.cfg", nil)
+	w := httptest.NewRecorder()
+	handlers.ViewFile(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if w.Body.String() != "set timeout=10" {
+		t.Errorf("Unexpected content %q", w.Body.String())
+	}
+}
+
+func TestTFTPHandlers_Delete(t *testing.T) {
+	handlers, sharedDir := newLayeredTFTPHandlers(t)
+
+	// Built-in defaults cannot be deleted
+	req := httptest.NewRequest("POST", "/tftp/delete_file?file=grub.cfg", nil)
+	w := httptest.NewRecorder()
+	handlers.HandleDelete(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 deleting a default file, got %d", w.Code)
+	}
+
+	// Deleting a file from disk uncovers the default beneath it
+	req = httptest.NewRequest("POST", "/tftp/delete_file?file=boot.ipxe", nil)
+	w = httptest.NewRecorder()
+	handlers.HandleDelete(w, req)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected redirect after delete, got %d", w.Code)
+	}
+	if _, err := os.Stat(filepath.Join(sharedDir, "boot.ipxe")); !os.IsNotExist(err) {
+		t.Error("Expected boot.ipxe to be removed from disk")
+	}
+	layer, err := handlers.files().Locate("boot.ipxe")
+	if err != nil || layer.Name != tftp.LayerDefault {
+		t.Errorf("Expected boot.ipxe to fall back to the default layer, got %q, %v", layer.Name, err)
+	}
+
+	// Traversal is refused
+	req = httptest.NewRequest("POST", "/tftp/delete_file?file=../../etc/passwd", nil)
+	w = httptest.NewRecorder()
+	handlers.HandleDelete(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a path outside the TFTP directory, got %d", w.Code)
+	}
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+
+	"ignite/tftp"
+)
+
+// DirectorySize is the recursive size of a directory in the TFTP tree
+type DirectorySize struct {
+	Dir   string `json:"dir"`
+	Bytes int64  `json:"bytes"`
+	Size  string `json:"size"`
+}
+
+// HandleCreateDirectory creates a directory named "name" inside "dir"
+func (h *TFTPHandlers) HandleCreateDirectory(w http.ResponseWriter, r *http.Request) {
+	name := formOrPrompt(r, "name")
+	if name == "" {
+		HandleError(w, r, NewValidationError("Missing directory name", "A directory name is required"))
+		return
+	}
+
+	dir := path.Join(tftpName(r.FormValue("dir")), name)
+	if err := h.manager().CreateDirectory(dir); err != nil {
+		HandleError(w, r, fileManagerError(err, "Unable to create directory"))
+		return
+	}
+	sendFileManagerResult(w, fmt.Sprintf("Created %s", dir))
+}
+
+// HandleDeleteDirectory removes a directory and everything in it
+func (h *TFTPHandlers) HandleDeleteDirectory(w http.ResponseWriter, r *http.Request) {
+	dir := r.FormValue("dir")
+	if dir == "" {
+		HandleError(w, r, NewValidationError("Missing dir parameter", "Directory parameter is required"))
+		return
+	}
+
+	if err := h.manager().DeleteDirectory(tftpName(dir)); err != nil {
+		HandleError(w, r, fileManagerError(err, "Unable to delete directory"))
+		return
+	}
+	sendFileManagerResult(w, fmt.Sprintf("Deleted %s", tftpName(dir)))
+}
+
+// HandleDirectorySize reports the total size of the files below a directory
+func (h *TFTPHandlers) HandleDirectorySize(w http.ResponseWriter, r *http.Request) {
+	dir := tftpName(r.URL.Query().Get("dir"))
+	size, err := h.manager().GetDirectorySize(dir)
+	if err != nil {
+		HandleError(w, r, fileManagerError(err, "Unable to measure directory"))
+		return
+	}
+
+	// htmx swaps the size straight into the page
+	if r.Header.Get("HX-Request") != "" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(humanReadableSize(size)))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DirectorySize{Dir: dir, Bytes: size, Size: humanReadableSize(size)})
+}
+
+// HandleMove renames or moves "from" to "to". Moving onto an existing
+// directory places the file inside it.
+func (h *TFTPHandlers) HandleMove(w http.ResponseWriter, r *http.Request) {
+	from, to := r.FormValue("from"), formOrPrompt(r, "to")
+	if from == "" || to == "" {
+		HandleError(w, r, NewValidationError("Missing from or to parameter", "Both a source and a destination are required"))
+		return
+	}
+
+	// A bare name renames within the same directory
+	if !strings.Contains(to, "/") {
+		to = path.Join(path.Dir(tftpName(from)), to)
+	}
+	if err := h.manager().Move(tftpName(from), tftpName(to)); err != nil {
+		HandleError(w, r, fileManagerError(err, "Unable to move file"))
+		return
+	}
+	sendFileManagerResult(w, fmt.Sprintf("Moved %s to %s", tftpName(from), tftpName(to)))
+}
+
+// HandleExtract unpacks a tar, tar.gz or zip archive into "dest", by default
+// the directory holding the archive
+func (h *TFTPHandlers) HandleExtract(w http.ResponseWriter, r *http.Request) {
+	file := r.FormValue("file")
+	if file == "" {
+		HandleError(w, r, NewValidationError("Missing file parameter", "File parameter is required"))
+		return
+	}
+	if !tftp.IsArchive(file) {
+		HandleError(w, r, NewValidationError(fmt.Sprintf("%s is not an archive", file), "Only tar, tar.gz and zip archives can be extracted"))
+		return
+	}
+
+	dest := formOrPrompt(r, "dest")
+	if dest == "" {
+		dest = path.Dir(tftpName(file))
+	}
+	count, err := h.manager().Extract(tftpName(file), tftpName(dest))
+	if err != nil {
+		HandleError(w, r, fileManagerError(err, "Unable to extract archive"))
+		return
+	}
+	sendFileManagerResult(w, fmt.Sprintf("Extracted %d files into %s", count, tftpName(dest)))
+}
+
+// manager returns the container's file manager, or one for the TFTP directory
+// if it does not provide one
+func (h *TFTPHandlers) manager() *tftp.FileManager {
+	if h.container.TFTPManager != nil {
+		return h.container.TFTPManager
+	}
+	return tftp.NewFileManager(TFTPDir, 0)
+}
+
+// formOrPrompt reads a form value, falling back to the answer of an hx-prompt
+func formOrPrompt(r *http.Request, key string) string {
+	if value := strings.TrimSpace(r.FormValue(key)); value != "" {
+		return value
+	}
+	return strings.TrimSpace(r.Header.Get("HX-Prompt"))
+}
+
+// fileManagerError maps file manager errors to responses
+func fileManagerError(err error, userMessage string) *AppError {
+	if errors.Is(err, fs.ErrNotExist) {
+		return NewNotFoundError(err.Error(), "The file or directory does not exist")
+	}
+	return NewValidationError(err.Error(), fmt.Sprintf("%s: %v", userMessage, err))
+}
+
+// sendFileManagerResult reports a successful file operation
+func sendFileManagerResult(w http.ResponseWriter, message string) {
+	SetNoCacheHeaders(w)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": message,
+	})
+}
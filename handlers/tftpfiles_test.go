@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ignite/tftp"
+)
+
+func newFileManagerHandlers(t *testing.T) (*TFTPHandlers, string) {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "grub.cfg"), []byte("set timeout=5"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	return NewTFTPHandlers(&Container{TFTPManager: tftp.NewFileManager(root, 0)}), root
+}
+
+func TestTFTPHandlers_MoveWithPrompt(t *testing.T) {
+	h, root := newFileManagerHandlers(t)
+
+	req := httptest.NewRequest("POST", "/tftp/move?from=grub.cfg", nil)
+	req.Header.Set("HX-Request", "true")
+	req.Header.Set("HX-Prompt", "grub-old.cfg")
+	rr := httptest.NewRecorder()
+	h.HandleMove(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Status = %d: %s", rr.Code, rr.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(root, "grub-old.cfg")); err != nil {
+		t.Errorf("File not renamed: %v", err)
+	}
+}
+
+func TestTFTPHandlers_DirectoryOperations(t *testing.T) {
+	h, root := newFileManagerHandlers(t)
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		target  string
+		status  int
+	}{
+		{"Create", h.HandleCreateDirectory, "/tftp/create_dir?dir=images&name=ubuntu", http.StatusOK},
+		{"Create without name", h.HandleCreateDirectory, "/tftp/create_dir?dir=images", http.StatusBadRequest},
+		{"Create hidden", h.HandleCreateDirectory, "/tftp/create_dir?name=.uploads", http.StatusBadRequest},
+		{"Delete", h.HandleDeleteDirectory, "/tftp/delete_dir?dir=images", http.StatusOK},
+		{"Delete missing", h.HandleDeleteDirectory, "/tftp/delete_dir?dir=images", http.StatusNotFound},
+		{"Delete root", h.HandleDeleteDirectory, "/tftp/delete_dir?dir=/", http.StatusBadRequest},
+		{"Extract non-archive", h.HandleExtract, "/tftp/extract?file=grub.cfg", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.target, nil)
+			req.Header.Set("HX-Request", "true")
+			rr := httptest.NewRecorder()
+			tt.handler(rr, req)
+			if rr.Code != tt.status {
+				t.Errorf("Status = %d, expected %d: %s", rr.Code, tt.status, rr.Body.String())
+			}
+		})
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "grub.cfg")); err != nil {
+		t.Errorf("Deleting directories removed other files: %v", err)
+	}
+}
+
+func TestTFTPHandlers_DirectorySize(t *testing.T) {
+	h, _ := newFileManagerHandlers(t)
+
+	req := httptest.NewRequest("GET", "/tftp/size?dir=", nil)
+	req.Header.Set("HX-Request", "true")
+	rr := httptest.NewRecorder()
+	h.HandleDirectorySize(rr, req)
+
+	if rr.Code != http.StatusOK || rr.Body.String() != humanReadableSize(13) {
+		t.Errorf("Size response = %d %q, expected %q", rr.Code, rr.Body.String(), humanReadableSize(13))
+	}
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"ignite/upload"
+)
+
+// tusVersion is the version of the tus resumable upload protocol spoken by
+// the upload endpoints
+const tusVersion = "1.0.0"
+
+// statusChecksumMismatch is the tus checksum extension's status for a chunk
+// or file whose digest does not match
+const statusChecksumMismatch = 460
+
+// UploadStatus reports the progress of a resumable upload
+type UploadStatus struct {
+	upload.Upload
+	Percent float64 `json:"percent"`
+	URL     string  `json:"url"`
+}
+
+// HandleCreateUpload starts a resumable upload. The size is taken from the
+// Upload-Length header, and the target from Upload-Metadata pairs "filename",
+// "dir" and optionally "checksum" ("sha256:<hex>"), with base64 values.
+func (h *TFTPHandlers) HandleCreateUpload(w http.ResponseWriter, r *http.Request) {
+	store := h.uploads(w, r)
+	if store == nil {
+		return
+	}
+
+	size, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || size < 0 {
+		HandleError(w, r, NewValidationError("Invalid Upload-Length header", "The upload size is missing or invalid"))
+		return
+	}
+	metadata, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		HandleError(w, r, NewValidationError(err.Error(), "The upload metadata is invalid"))
+		return
+	}
+
+	u, err := store.Create(metadata["dir"], metadata["filename"], size, metadata["checksum"])
+	if err != nil {
+		HandleError(w, r, NewValidationError(fmt.Sprintf("Failed to create upload: %v", err), err.Error()))
+		return
+	}
+
+	setUploadHeaders(w, u)
+	w.Header().Set("Location", uploadURL(u))
+	writeUploadStatus(w, u, http.StatusCreated)
+}
+
+// HandleUploadOffset reports how much of an upload has been received, so a
+// client can resume it
+func (h *TFTPHandlers) HandleUploadOffset(w http.ResponseWriter, r *http.Request) {
+	store := h.uploads(w, r)
+	if store == nil {
+		return
+	}
+
+	u, err := store.Get(mux.Vars(r)["id"])
+	if err != nil {
+		HandleError(w, r, uploadError(err))
+		return
+	}
+
+	setUploadHeaders(w, u)
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	writeUploadStatus(w, u, http.StatusOK)
+}
+
+// HandleUploadChunk appends the request body to an upload at the offset in the
+// Upload-Offset header. An Upload-Checksum header ("sha256 <base64>") is
+// checked before the chunk is kept.
+func (h *TFTPHandlers) HandleUploadChunk(w http.ResponseWriter, r *http.Request) {
+	store := h.uploads(w, r)
+	if store == nil {
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		HandleError(w, r, NewAppError(ErrorTypeValidation, "Unsupported chunk content type",
+			"Chunks must be sent as application/offset+octet-stream", http.StatusUnsupportedMediaType))
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		HandleError(w, r, NewValidationError("Invalid Upload-Offset header", "The upload offset is missing or invalid"))
+		return
+	}
+
+	u, err := store.Write(mux.Vars(r)["id"], offset, r.Body, r.Header.Get("Upload-Checksum"))
+	if err != nil {
+		setUploadHeaders(w, u)
+		HandleError(w, r, uploadError(err))
+		return
+	}
+
+	setUploadHeaders(w, u)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleDeleteUpload abandons an upload
+func (h *TFTPHandlers) HandleDeleteUpload(w http.ResponseWriter, r *http.Request) {
+	store := h.uploads(w, r)
+	if store == nil {
+		return
+	}
+
+	if err := store.Delete(mux.Vars(r)["id"]); err != nil {
+		HandleError(w, r, uploadError(err))
+		return
+	}
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleListUploads returns the progress of every unfinished upload
+func (h *TFTPHandlers) HandleListUploads(w http.ResponseWriter, r *http.Request) {
+	store := h.uploads(w, r)
+	if store == nil {
+		return
+	}
+
+	uploads, err := store.List()
+	if err != nil {
+		HandleError(w, r, NewInternalError(fmt.Sprintf("Failed to list uploads: %v", err), "Unable to list uploads"))
+		return
+	}
+
+	statuses := make([]UploadStatus, 0, len(uploads))
+	for _, u := range uploads {
+		statuses = append(statuses, UploadStatus{Upload: u, Percent: u.Percent(), URL: uploadURL(u)})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
+
+// uploads returns the upload store, reporting an error if there is none
+func (h *TFTPHandlers) uploads(w http.ResponseWriter, r *http.Request) *upload.Store {
+	if h.container.Uploads == nil {
+		HandleError(w, r, NewAppError(ErrorTypeServiceUnavail, "Upload store not configured",
+			"Uploads are not available", http.StatusServiceUnavailable))
+	}
+	return h.container.Uploads
+}
+
+// uploadError maps upload store errors to responses
+func uploadError(err error) *AppError {
+	switch {
+	case errors.Is(err, upload.ErrNotFound):
+		return NewNotFoundError(err.Error(), "The upload does not exist or has expired")
+	case errors.Is(err, upload.ErrOffsetMismatch):
+		return NewAppError(ErrorTypeConflict, err.Error(), "The upload offset is out of date; check it and resume", http.StatusConflict)
+	case errors.Is(err, upload.ErrBusy):
+		return NewAppError(ErrorTypeConflict, err.Error(), "The upload is already in progress", http.StatusLocked)
+	case errors.Is(err, upload.ErrTooLarge):
+		return NewAppError(ErrorTypeValidation, err.Error(), "More data was sent than the declared size", http.StatusRequestEntityTooLarge)
+	case errors.Is(err, upload.ErrChecksumMismatch):
+		return NewAppError(ErrorTypeValidation, err.Error(), "The uploaded data failed checksum verification", statusChecksumMismatch)
+	default:
+		return NewInternalError(err.Error(), "The upload failed")
+	}
+}
+
+// parseUploadMetadata decodes a tus Upload-Metadata header of comma-separated
+// "key base64value" pairs
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid upload metadata %q: %w", key, err)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+// setUploadHeaders reports an upload's progress in tus headers
+func setUploadHeaders(w http.ResponseWriter, u upload.Upload) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if u.ID == "" {
+		return
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(u.Size, 10))
+}
+
+// writeUploadStatus sends an upload's progress as JSON
+func writeUploadStatus(w http.ResponseWriter, u upload.Upload, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(UploadStatus{Upload: u, Percent: u.Percent(), URL: uploadURL(u)})
+}
+
+// uploadURL is where a client sends the chunks of an upload
+func uploadURL(u upload.Upload) string {
+	return "/tftp/uploads/" + u.ID
+}
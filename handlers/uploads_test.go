@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"ignite/config"
+	"ignite/upload"
+)
+
+// newUploadRouter routes the resumable upload endpoints over a temporary TFTP directory
+func newUploadRouter(t *testing.T) (*mux.Router, string) {
+	t.Helper()
+	root := t.TempDir()
+	h := NewTFTPHandlers(&Container{Uploads: upload.NewStore(root, 0, time.Hour)})
+
+	router := mux.NewRouter()
+	router.HandleFunc("/tftp/uploads", h.HandleListUploads).Methods("GET")
+	router.HandleFunc("/tftp/uploads", h.HandleCreateUpload).Methods("POST")
+	router.HandleFunc("/tftp/uploads/{id}", h.HandleUploadOffset).Methods("GET", "HEAD")
+	router.HandleFunc("/tftp/uploads/{id}", h.HandleUploadChunk).Methods("PATCH")
+	router.HandleFunc("/tftp/uploads/{id}", h.HandleDeleteUpload).Methods("DELETE")
+	return router, root
+}
+
+func sendChunk(router *mux.Router, url string, offset, data string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("PATCH", url, strings.NewReader(data))
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	req.Header.Set("Upload-Offset", offset)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestResumableUpload(t *testing.T) {
+	router, root := newUploadRouter(t)
+	b64 := base64.StdEncoding.EncodeToString
+
+	req := httptest.NewRequest("POST", "/tftp/uploads", nil)
+	req.Header.Set("Upload-Length", "10")
+	req.Header.Set("Upload-Metadata", "filename "+b64([]byte("boot.cfg"))+",dir "+b64([]byte("menus")))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Create status = %d: %s", rr.Code, rr.Body.String())
+	}
+	url := rr.Header().Get("Location")
+
+	if rr := sendChunk(router, url, "0", "hello"); rr.Code != http.StatusNoContent || rr.Header().Get("Upload-Offset") != "5" {
+		t.Fatalf("First chunk: status %d, offset %q", rr.Code, rr.Header().Get("Upload-Offset"))
+	}
+
+	// Progress is reported for resuming clients and the upload list
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("HEAD", url, nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Upload-Offset") != "5" || rr.Header().Get("Upload-Length") != "10" {
+		t.Errorf("HEAD: status %d, headers %v", rr.Code, rr.Header())
+	}
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/tftp/uploads", nil))
+	var statuses []UploadStatus
+	if err := json.Unmarshal(rr.Body.Bytes(), &statuses); err != nil || len(statuses) != 1 || statuses[0].Percent != 50 {
+		t.Errorf("Upload list = %s, %v; expected one upload at 50%%", rr.Body.String(), err)
+	}
+
+	if rr := sendChunk(router, url, "0", "hello"); rr.Code != http.StatusConflict {
+		t.Errorf("Stale offset status = %d, expected %d", rr.Code, http.StatusConflict)
+	}
+	if rr := sendChunk(router, url, "5", "world"); rr.Code != http.StatusNoContent {
+		t.Fatalf("Last chunk status = %d: %s", rr.Code, rr.Body.String())
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, "menus", "boot.cfg"))
+	if err != nil || string(data) != "helloworld" {
+		t.Errorf("Uploaded file = %q, %v", data, err)
+	}
+}
+
+func TestHandleUpload_Bootloaders(t *testing.T) {
+	root := t.TempDir()
+	h := NewTFTPHandlers(&Container{Config: &config.Config{TFTP: config.TFTPConfig{Dir: root}}})
+
+	for _, name := range []string{"pxelinux.0", "ldlinux.c32", "undionly.kpxe"} {
+		t.Run(name, func(t *testing.T) {
+			var body bytes.Buffer
+			form := multipart.NewWriter(&body)
+			part, err := form.CreateFormFile("file", name)
+			require.NoError(t, err)
+			part.Write([]byte("bootloader"))
+			form.WriteField("dir", "bios")
+			require.NoError(t, form.Close())
+
+			req := httptest.NewRequest("POST", "/tftp/upload_file", &body)
+			req.Header.Set("Content-Type", form.FormDataContentType())
+			rr := httptest.NewRecorder()
+			h.HandleUpload(rr, req)
+
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+			data, err := os.ReadFile(filepath.Join(root, "bios", name))
+			require.NoError(t, err)
+			assert.Equal(t, "bootloader", string(data))
+		})
+	}
+}
+
+func TestCreateUploadValidation(t *testing.T) {
+	router, _ := newUploadRouter(t)
+	b64 := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name     string
+		length   string
+		metadata string
+	}{
+		{"Missing length", "", "filename " + b64("boot.cfg")},
+		{"Negative length", "-1", "filename " + b64("boot.cfg")},
+		{"Bad metadata", "10", "filename !!!"},
+		{"Traversal", "10", "filename " + b64("boot.cfg") + ",dir " + b64("../../etc")},
+		{"Unsafe filename", "10", "filename " + b64("../boot.cfg")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/tftp/uploads", nil)
+			req.Header.Set("Upload-Length", tt.length)
+			req.Header.Set("Upload-Metadata", tt.metadata)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("Status = %d, expected %d", rr.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
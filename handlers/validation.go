@@ -6,6 +6,8 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+
+	"ignite/dhcp"
 )
 
 // IPValidator provides IP address validation functionality
@@ -220,6 +222,8 @@ func (v *DHCPConfigValidator) ValidateDHCPConfig(config map[string]string) Valid
 			// Validate range is within subnet
 			if err := v.ipValidator.ValidateRangeInSubnet(rangeStr, subnet); err != nil {
 				errors.Add("range", err.Error())
+			} else if err := v.validateRangeUsable(rangeStr, subnet); err != nil {
+				errors.Add("range", err.Error())
 			}
 		}
 	} else {
@@ -234,6 +238,8 @@ func (v *DHCPConfigValidator) ValidateDHCPConfig(config map[string]string) Valid
 			// Validate router is within subnet
 			if err := v.ipValidator.ValidateIPInSubnet(router, subnet); err != nil {
 				errors.Add("router", err.Error())
+			} else if isNetworkOrBroadcast(net.ParseIP(router), subnet) {
+				errors.Add("router", fmt.Sprintf("router %s cannot be the network or broadcast address of %s", router, subnet))
 			}
 		}
 	}
@@ -259,6 +265,97 @@ func (v *DHCPConfigValidator) ValidateDHCPConfig(config map[string]string) Valid
 	return errors
 }
 
+// ValidateAgainstServers checks a DHCP configuration for conflicts with already
+// configured servers. The server with excludeID is skipped so edits are not
+// compared against themselves. The config must already pass ValidateDHCPConfig.
+func (v *DHCPConfigValidator) ValidateAgainstServers(config map[string]string, servers []*dhcp.Server, excludeID string) ValidationErrors {
+	errors := make(ValidationErrors)
+
+	serverIP, subnet, err := net.ParseCIDR(config["subnet"])
+	if err != nil {
+		errors.Add("subnet", fmt.Sprintf("invalid subnet format: %s", config["subnet"]))
+		return errors
+	}
+
+	parts := strings.Split(config["range"], "-")
+	if len(parts) != 2 {
+		errors.Add("range", fmt.Sprintf("IP range must be in format 'start-end': %s", config["range"]))
+		return errors
+	}
+	start := net.ParseIP(strings.TrimSpace(parts[0])).To4()
+	end := net.ParseIP(strings.TrimSpace(parts[1])).To4()
+	if start == nil || end == nil {
+		errors.Add("range", fmt.Sprintf("invalid IP range: %s", config["range"]))
+		return errors
+	}
+
+	for _, server := range servers {
+		if server == nil || server.ID == excludeID || server.IP == nil || server.Options.SubnetMask == nil {
+			continue
+		}
+
+		if server.IP.Equal(serverIP) {
+			errors.Add("network", fmt.Sprintf("a DHCP server already exists on %s", serverIP))
+			continue
+		}
+
+		otherSubnet := server.GetSubnet()
+		if subnet.Contains(otherSubnet.IP) || otherSubnet.Contains(subnet.IP) {
+			errors.Add("subnet", fmt.Sprintf("subnet %s overlaps subnet %s of server %s", subnet, otherSubnet, server.IP))
+		}
+
+		if server.IPStart != nil && server.LeaseRange > 0 {
+			otherStart := server.IPStart.To4()
+			otherEnd := server.GetRangeEnd().To4()
+			if compareIPs(start, otherEnd) <= 0 && compareIPs(otherStart, end) <= 0 {
+				errors.Add("range", fmt.Sprintf("range %s overlaps range %s-%s of server %s", config["range"], otherStart, otherEnd, server.IP))
+			}
+		}
+	}
+
+	return errors
+}
+
+// validateRangeUsable ensures a range does not include the network or broadcast address
+func (v *DHCPConfigValidator) validateRangeUsable(rangeStr, subnet string) error {
+	parts := strings.Split(rangeStr, "-")
+	start := net.ParseIP(strings.TrimSpace(parts[0]))
+	end := net.ParseIP(strings.TrimSpace(parts[1]))
+
+	if isNetworkOrBroadcast(start, subnet) || isNetworkOrBroadcast(end, subnet) {
+		return fmt.Errorf("IP range %s cannot include the network or broadcast address of %s", rangeStr, subnet)
+	}
+
+	return nil
+}
+
+// configErrorFields maps dhcp.ConfigError field names to DHCP form validation keys
+var configErrorFields = map[string]string{
+	dhcp.FieldIP:            "network",
+	dhcp.FieldInterface:     "interface",
+	dhcp.FieldVLANID:        "vlan_id",
+	dhcp.FieldTFTPRoot:      "tftp_root",
+	dhcp.FieldSubnetMask:    "subnet",
+	dhcp.FieldGateway:       "router",
+	dhcp.FieldDNS:           "dns",
+	dhcp.FieldStartIP:       "range",
+	dhcp.FieldLeaseRange:    "range",
+	dhcp.FieldLeaseDuration: "lease_time",
+}
+
+// ConfigErrorToValidationErrors converts service-level field errors into form validation errors
+func ConfigErrorToValidationErrors(configErr *dhcp.ConfigError) ValidationErrors {
+	errors := make(ValidationErrors)
+	for _, field := range configErr.Fields {
+		key, ok := configErrorFields[field.Field]
+		if !ok {
+			key = field.Field
+		}
+		errors.Add(key, field.Message)
+	}
+	return errors
+}
+
 // ValidateReservation validates a DHCP reservation
 func (v *DHCPConfigValidator) ValidateReservation(ip, mac string) ValidationErrors {
 	errors := make(ValidationErrors)
@@ -274,6 +371,27 @@ func (v *DHCPConfigValidator) ValidateReservation(ip, mac string) ValidationErro
 	return errors
 }
 
+// isNetworkOrBroadcast reports whether ip is the network or broadcast address of a CIDR subnet
+func isNetworkOrBroadcast(ip net.IP, subnet string) bool {
+	_, network, err := net.ParseCIDR(subnet)
+	if err != nil || ip == nil || ip.To4() == nil {
+		return false
+	}
+
+	ones, bits := network.Mask.Size()
+	if bits-ones < 2 {
+		return false // /31 and /32 networks have no network or broadcast address
+	}
+
+	base := network.IP.To4()
+	broadcast := make(net.IP, net.IPv4len)
+	for i := range broadcast {
+		broadcast[i] = base[i] | ^network.Mask[i]
+	}
+
+	return ip.To4().Equal(base) || ip.To4().Equal(broadcast)
+}
+
 // Helper function to compare IPv4 addresses
 func compareIPs(ip1, ip2 net.IP) int {
 	ip1 = ip1.To4()
@@ -1,7 +1,10 @@
 package handlers
 
 import (
+	"net"
 	"testing"
+
+	"ignite/dhcp"
 )
 
 func TestIPValidator_ValidateIPAddress(t *testing.T) {
@@ -218,3 +221,98 @@ func TestValidationErrors(t *testing.T) {
 		t.Errorf("Expected validation error type, got %s", appErr.Type)
 	}
 }
+
+func TestDHCPConfigValidator_NetworkAndBroadcast(t *testing.T) {
+	validator := NewDHCPConfigValidator()
+
+	tests := []struct {
+		name          string
+		config        map[string]string
+		expectedField string
+	}{
+		{
+			name: "Range includes broadcast",
+			config: map[string]string{
+				"subnet": "192.168.1.10/24",
+				"range":  "192.168.1.100-192.168.1.255",
+			},
+			expectedField: "range",
+		},
+		{
+			name: "Range includes network address",
+			config: map[string]string{
+				"subnet": "192.168.1.10/24",
+				"range":  "192.168.1.0-192.168.1.20",
+			},
+			expectedField: "range",
+		},
+		{
+			name: "Router is broadcast",
+			config: map[string]string{
+				"subnet": "192.168.1.10/24",
+				"range":  "192.168.1.100-192.168.1.200",
+				"router": "192.168.1.255",
+			},
+			expectedField: "router",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errors := validator.ValidateDHCPConfig(tt.config)
+			if len(errors[tt.expectedField]) == 0 {
+				t.Errorf("Expected error for field %s, got %+v", tt.expectedField, errors)
+			}
+		})
+	}
+}
+
+func TestDHCPConfigValidator_ValidateAgainstServers(t *testing.T) {
+	validator := NewDHCPConfigValidator()
+
+	existing := &dhcp.Server{
+		ID:         "existing",
+		IP:         net.ParseIP("192.168.1.2"),
+		IPStart:    net.ParseIP("192.168.1.150"),
+		LeaseRange: 20,
+		Options: dhcp.DHCPOptions{
+			SubnetMask: net.ParseIP("255.255.255.0"),
+		},
+	}
+
+	config := map[string]string{
+		"subnet": "192.168.1.10/24",
+		"range":  "192.168.1.100-192.168.1.160",
+	}
+
+	errors := validator.ValidateAgainstServers(config, []*dhcp.Server{existing}, "")
+	if len(errors["subnet"]) == 0 {
+		t.Errorf("Expected subnet overlap error, got %+v", errors)
+	}
+	if len(errors["range"]) == 0 {
+		t.Errorf("Expected range overlap error, got %+v", errors)
+	}
+
+	if errors := validator.ValidateAgainstServers(config, []*dhcp.Server{existing}, "existing"); errors.HasErrors() {
+		t.Errorf("Expected no errors when excluding the edited server, got %+v", errors)
+	}
+
+	config = map[string]string{
+		"subnet": "10.0.0.10/24",
+		"range":  "10.0.0.100-10.0.0.160",
+	}
+	if errors := validator.ValidateAgainstServers(config, []*dhcp.Server{existing}, ""); errors.HasErrors() {
+		t.Errorf("Expected no errors for a separate subnet, got %+v", errors)
+	}
+}
+
+func TestConfigErrorToValidationErrors(t *testing.T) {
+	configErr := &dhcp.ConfigError{}
+	configErr.Add(dhcp.FieldGateway, "gateway outside subnet")
+	configErr.Add(dhcp.FieldLeaseRange, "range overlaps")
+
+	errors := ConfigErrorToValidationErrors(configErr)
+	if len(errors["router"]) != 1 || len(errors["range"]) != 1 {
+		t.Errorf("Unexpected field mapping: %+v", errors)
+	}
+}
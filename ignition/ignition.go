@@ -0,0 +1,149 @@
+package ignition
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ContentType is the media type Ignition configs are served with
+const ContentType = "application/vnd.coreos.ignition+json"
+
+// butaneSpecs maps each supported Butane variant and version to the Ignition
+// spec version it translates to
+var butaneSpecs = map[string]map[string]string{
+	"fcos": {
+		"1.0.0": "3.0.0",
+		"1.1.0": "3.1.0",
+		"1.2.0": "3.2.0",
+		"1.3.0": "3.2.0",
+		"1.4.0": "3.3.0",
+		"1.5.0": "3.4.0",
+		"1.6.0": "3.5.0",
+	},
+	"flatcar": {
+		"1.0.0": "3.3.0",
+		"1.1.0": "3.4.0",
+	},
+}
+
+// Render returns the Ignition config for a rendered template, which is either
+// an Ignition config already or a Butane config to translate. The result is
+// validated either way.
+func Render(content []byte) ([]byte, error) {
+	config := content
+	if !bytes.HasPrefix(bytes.TrimSpace(content), []byte("{")) {
+		var err error
+		if config, err = Translate(content); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := Validate(config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Translate converts a Butane config to Ignition JSON. It supports the fcos
+// and flatcar variants; Butane sugar that needs local files or disk layout
+// knowledge, such as contents.local or boot_device, is rejected.
+func Translate(butane []byte) ([]byte, error) {
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(butane, &doc); err != nil {
+		return nil, fmt.Errorf("invalid Butane YAML: %w", err)
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("empty Butane config")
+	}
+
+	variant, _ := doc["variant"].(string)
+	version, _ := doc["version"].(string)
+	versions, ok := butaneSpecs[variant]
+	if !ok {
+		return nil, fmt.Errorf("unsupported Butane variant %q", variant)
+	}
+	spec, ok := versions[version]
+	if !ok {
+		return nil, fmt.Errorf("unsupported Butane version %q for variant %s", version, variant)
+	}
+	delete(doc, "variant")
+	delete(doc, "version")
+
+	converted, err := convert(doc, "")
+	if err != nil {
+		return nil, err
+	}
+	config := converted.(map[string]interface{})
+
+	ign, _ := config["ignition"].(map[string]interface{})
+	if ign == nil {
+		ign = map[string]interface{}{}
+		config["ignition"] = ign
+	}
+	ign["version"] = spec
+
+	return json.Marshal(config)
+}
+
+// convert renames Butane's snake_case keys to Ignition's camelCase and turns
+// inline contents into data URLs. path locates value in error messages.
+func convert(value interface{}, path string) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			childPath := strings.TrimPrefix(path+"."+key, ".")
+			switch {
+			case strings.HasSuffix(key, "_local") || key == "local":
+				return nil, fmt.Errorf("%s: local files are not supported", childPath)
+			case key == "inline":
+				text, ok := child.(string)
+				if !ok {
+					return nil, fmt.Errorf("%s: must be a string", childPath)
+				}
+				out["source"] = "data:;base64," + base64.StdEncoding.EncodeToString([]byte(text))
+				continue
+			}
+
+			converted, err := convert(child, childPath)
+			if err != nil {
+				return nil, err
+			}
+			out[camelCase(key)] = converted
+		}
+		return out, nil
+
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, child := range v {
+			converted, err := convert(child, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			out[i] = converted
+		}
+		return out, nil
+	}
+	return value, nil
+}
+
+// camelCase converts a Butane key such as ssh_authorized_keys or size_mib to
+// its Ignition spelling
+func camelCase(key string) string {
+	parts := strings.Split(key, "_")
+	for i := 1; i < len(parts); i++ {
+		switch parts[i] {
+		case "mib":
+			parts[i] = "MiB"
+		case "":
+		default:
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
@@ -0,0 +1,147 @@
+package ignition
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const butaneConfig = `variant: fcos
+version: 1.5.0
+passwd:
+  users:
+    - name: core
+      ssh_authorized_keys:
+        - ssh-ed25519 AAAA test
+storage:
+  files:
+    - path: /etc/hostname
+      mode: 0644
+      overwrite: true
+      contents:
+        inline: node1
+systemd:
+  units:
+    - name: phone-home.service
+      enabled: true
+      contents: |
+        [Service]
+        Type=oneshot
+`
+
+func TestTranslate(t *testing.T) {
+	out, err := Translate([]byte(butaneConfig))
+	if err != nil {
+		t.Fatalf("Translate() error = %v", err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(out, &cfg); err != nil {
+		t.Fatalf("Translate() produced invalid JSON: %v", err)
+	}
+	if cfg.Ignition.Version != "3.4.0" {
+		t.Errorf("ignition.version = %q, want 3.4.0", cfg.Ignition.Version)
+	}
+	if len(cfg.Passwd.Users) != 1 || len(cfg.Passwd.Users[0].SSHAuthorizedKeys) != 1 {
+		t.Errorf("ssh_authorized_keys not translated: %s", out)
+	}
+	if strings.Contains(string(out), "variant") {
+		t.Errorf("Butane variant left in output: %s", out)
+	}
+
+	if len(cfg.Storage.Files) != 1 {
+		t.Fatalf("expected one file, got %s", out)
+	}
+	file := cfg.Storage.Files[0]
+	if file.Mode == nil || *file.Mode != 0644 {
+		t.Errorf("mode = %v, want 0644", file.Mode)
+	}
+	source := *file.Contents.Source
+	encoded, ok := strings.CutPrefix(source, "data:;base64,")
+	if !ok {
+		t.Fatalf("contents.source = %q, want a base64 data URL", source)
+	}
+	if decoded, _ := base64.StdEncoding.DecodeString(encoded); string(decoded) != "node1" {
+		t.Errorf("contents.source decodes to %q, want node1", decoded)
+	}
+
+	if err := Validate(out); err != nil {
+		t.Errorf("Validate() of translated config error = %v", err)
+	}
+}
+
+func TestTranslate_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		butane string
+	}{
+		{"Unknown variant", "variant: rhcos\nversion: 1.0.0\n"},
+		{"Unknown version", "variant: flatcar\nversion: 1.5.0\n"},
+		{"Local file", "variant: fcos\nversion: 1.4.0\nstorage:\n  files:\n    - path: /etc/motd\n      contents:\n        local: motd\n"},
+		{"Invalid YAML", "variant: [fcos\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Translate([]byte(tt.butane)); err == nil {
+				t.Error("Translate() expected an error")
+			}
+		})
+	}
+}
+
+func TestCamelCase(t *testing.T) {
+	tests := map[string]string{
+		"path":                "path",
+		"ssh_authorized_keys": "sshAuthorizedKeys",
+		"size_mib":            "sizeMiB",
+		"http_headers":        "httpHeaders",
+	}
+	for in, want := range tests {
+		if got := camelCase(in); got != want {
+			t.Errorf("camelCase(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr bool
+	}{
+		{"Minimal", `{"ignition":{"version":"3.3.0"}}`, false},
+		{"Disks are passed through", `{"ignition":{"version":"3.4.0"},"storage":{"disks":[{"device":"/dev/sda","wipeTable":true}]}}`, false},
+		{"Missing version", `{"ignition":{}}`, true},
+		{"Spec 2", `{"ignition":{"version":"2.3.0"}}`, true},
+		{"Unknown field", `{"ignition":{"version":"3.3.0"},"storage":{"files":[{"path":"/etc/motd","contnets":{}}]}}`, true},
+		{"Relative path", `{"ignition":{"version":"3.3.0"},"storage":{"files":[{"path":"etc/motd"}]}}`, true},
+		{"Duplicate path", `{"ignition":{"version":"3.3.0"},"storage":{"files":[{"path":"/etc/motd"}],"directories":[{"path":"/etc/motd"}]}}`, true},
+		{"Bad source scheme", `{"ignition":{"version":"3.3.0"},"storage":{"files":[{"path":"/etc/motd","contents":{"source":"file:///motd"}}]}}`, true},
+		{"Bad hash", `{"ignition":{"version":"3.3.0"},"storage":{"files":[{"path":"/etc/motd","contents":{"source":"https://example.com/motd","verification":{"hash":"md5-abc"}}}]}}`, true},
+		{"Bad unit name", `{"ignition":{"version":"3.3.0"},"systemd":{"units":[{"name":"phone-home"}]}}`, true},
+		{"Link without target", `{"ignition":{"version":"3.3.0"},"storage":{"links":[{"path":"/etc/localtime"}]}}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate([]byte(tt.config))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	native := `{"ignition":{"version":"3.3.0"}}`
+	out, err := Render([]byte("\n" + native))
+	if err != nil || strings.TrimSpace(string(out)) != native {
+		t.Errorf("Render() of Ignition JSON = %q, %v; want it unchanged", out, err)
+	}
+
+	if _, err := Render([]byte(butaneConfig)); err != nil {
+		t.Errorf("Render() of Butane error = %v", err)
+	}
+}
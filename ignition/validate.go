@@ -0,0 +1,363 @@
+package ignition
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// specVersions are the Ignition spec versions accepted by Validate
+var specVersions = map[string]bool{
+	"3.0.0": true,
+	"3.1.0": true,
+	"3.2.0": true,
+	"3.3.0": true,
+	"3.4.0": true,
+	"3.5.0": true,
+}
+
+// unitSuffixes are the systemd unit types Ignition can write
+var unitSuffixes = []string{
+	".service", ".socket", ".target", ".timer", ".mount", ".automount",
+	".swap", ".path", ".slice", ".scope", ".device",
+}
+
+// sourceSchemes are the URL schemes Ignition fetches resources from
+var sourceSchemes = map[string]bool{
+	"http": true, "https": true, "tftp": true, "s3": true, "gs": true, "arn": true, "data": true,
+}
+
+// Config is the subset of an Ignition 3.x config checked by Validate. Sections
+// that need knowledge of the target disks are accepted without inspection.
+type Config struct {
+	Ignition        Ignition        `json:"ignition"`
+	KernelArguments json.RawMessage `json:"kernelArguments,omitempty"`
+	Passwd          Passwd          `json:"passwd,omitempty"`
+	Storage         Storage         `json:"storage,omitempty"`
+	Systemd         Systemd         `json:"systemd,omitempty"`
+}
+
+// Ignition holds the config's version and references to other configs
+type Ignition struct {
+	Version  string          `json:"version"`
+	Config   ConfigRefs      `json:"config,omitempty"`
+	Proxy    json.RawMessage `json:"proxy,omitempty"`
+	Security json.RawMessage `json:"security,omitempty"`
+	Timeouts json.RawMessage `json:"timeouts,omitempty"`
+}
+
+// ConfigRefs references configs merged into or replacing this one
+type ConfigRefs struct {
+	Merge   []Resource `json:"merge,omitempty"`
+	Replace *Resource  `json:"replace,omitempty"`
+}
+
+// Resource is a remote or inline piece of content
+type Resource struct {
+	Source       *string      `json:"source,omitempty"`
+	Compression  *string      `json:"compression,omitempty"`
+	HTTPHeaders  []HTTPHeader `json:"httpHeaders,omitempty"`
+	Verification Verification `json:"verification,omitempty"`
+}
+
+// HTTPHeader is a header sent when fetching a resource
+type HTTPHeader struct {
+	Name  string  `json:"name"`
+	Value *string `json:"value,omitempty"`
+}
+
+// Verification holds the expected hash of a resource
+type Verification struct {
+	Hash *string `json:"hash,omitempty"`
+}
+
+// Passwd holds the users and groups to create
+type Passwd struct {
+	Users  []User  `json:"users,omitempty"`
+	Groups []Group `json:"groups,omitempty"`
+}
+
+// User is a user account to create or modify
+type User struct {
+	Name              string   `json:"name"`
+	PasswordHash      *string  `json:"passwordHash,omitempty"`
+	SSHAuthorizedKeys []string `json:"sshAuthorizedKeys,omitempty"`
+	UID               *int     `json:"uid,omitempty"`
+	Gecos             *string  `json:"gecos,omitempty"`
+	HomeDir           *string  `json:"homeDir,omitempty"`
+	NoCreateHome      *bool    `json:"noCreateHome,omitempty"`
+	PrimaryGroup      *string  `json:"primaryGroup,omitempty"`
+	Groups            []string `json:"groups,omitempty"`
+	NoUserGroup       *bool    `json:"noUserGroup,omitempty"`
+	NoLogInit         *bool    `json:"noLogInit,omitempty"`
+	Shell             *string  `json:"shell,omitempty"`
+	ShouldExist       *bool    `json:"shouldExist,omitempty"`
+	System            *bool    `json:"system,omitempty"`
+}
+
+// Group is a group to create or modify
+type Group struct {
+	Name         string  `json:"name"`
+	Gid          *int    `json:"gid,omitempty"`
+	PasswordHash *string `json:"passwordHash,omitempty"`
+	ShouldExist  *bool   `json:"shouldExist,omitempty"`
+	System       *bool   `json:"system,omitempty"`
+}
+
+// Storage holds the filesystem entries to write
+type Storage struct {
+	Directories []Directory     `json:"directories,omitempty"`
+	Files       []File          `json:"files,omitempty"`
+	Links       []Link          `json:"links,omitempty"`
+	Disks       json.RawMessage `json:"disks,omitempty"`
+	Filesystems json.RawMessage `json:"filesystems,omitempty"`
+	Luks        json.RawMessage `json:"luks,omitempty"`
+	Raid        json.RawMessage `json:"raid,omitempty"`
+}
+
+// Node holds the fields shared by files, directories and links
+type Node struct {
+	Path      string    `json:"path"`
+	Overwrite *bool     `json:"overwrite,omitempty"`
+	User      NodeOwner `json:"user,omitempty"`
+	Group     NodeOwner `json:"group,omitempty"`
+}
+
+// NodeOwner identifies the owner of a node by ID or name
+type NodeOwner struct {
+	ID   *int    `json:"id,omitempty"`
+	Name *string `json:"name,omitempty"`
+}
+
+// Directory is a directory to create
+type Directory struct {
+	Node
+	Mode *int `json:"mode,omitempty"`
+}
+
+// File is a file to write
+type File struct {
+	Node
+	Contents Resource   `json:"contents,omitempty"`
+	Append   []Resource `json:"append,omitempty"`
+	Mode     *int       `json:"mode,omitempty"`
+}
+
+// Link is a symbolic or hard link to create
+type Link struct {
+	Node
+	Target *string `json:"target,omitempty"`
+	Hard   *bool   `json:"hard,omitempty"`
+}
+
+// Systemd holds the units to write and enable
+type Systemd struct {
+	Units []Unit `json:"units,omitempty"`
+}
+
+// Unit is a systemd unit
+type Unit struct {
+	Name     string   `json:"name"`
+	Enabled  *bool    `json:"enabled,omitempty"`
+	Mask     *bool    `json:"mask,omitempty"`
+	Contents *string  `json:"contents,omitempty"`
+	Dropins  []Dropin `json:"dropins,omitempty"`
+}
+
+// Dropin is a drop-in config for a systemd unit
+type Dropin struct {
+	Name     string  `json:"name"`
+	Contents *string `json:"contents,omitempty"`
+}
+
+// Validate checks that config is an Ignition 3.x config: a known spec version,
+// no unknown fields, absolute and unique paths, valid unit names and fetchable
+// resource URLs.
+func Validate(config []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(config))
+	decoder.DisallowUnknownFields()
+
+	var cfg Config
+	if err := decoder.Decode(&cfg); err != nil {
+		return fmt.Errorf("invalid Ignition config: %w", err)
+	}
+	if decoder.More() {
+		return fmt.Errorf("invalid Ignition config: trailing data after config")
+	}
+
+	if cfg.Ignition.Version == "" {
+		return fmt.Errorf("invalid Ignition config: ignition.version is required")
+	}
+	if !specVersions[cfg.Ignition.Version] {
+		return fmt.Errorf("invalid Ignition config: unsupported spec version %q", cfg.Ignition.Version)
+	}
+
+	for i, ref := range cfg.Ignition.Config.Merge {
+		if err := validateResource(ref, fmt.Sprintf("ignition.config.merge[%d]", i)); err != nil {
+			return err
+		}
+	}
+	if ref := cfg.Ignition.Config.Replace; ref != nil {
+		if err := validateResource(*ref, "ignition.config.replace"); err != nil {
+			return err
+		}
+	}
+
+	for i, user := range cfg.Passwd.Users {
+		if user.Name == "" {
+			return fmt.Errorf("invalid Ignition config: passwd.users[%d]: name is required", i)
+		}
+	}
+	for i, group := range cfg.Passwd.Groups {
+		if group.Name == "" {
+			return fmt.Errorf("invalid Ignition config: passwd.groups[%d]: name is required", i)
+		}
+	}
+
+	if err := validateStorage(cfg.Storage); err != nil {
+		return err
+	}
+
+	for i, unit := range cfg.Systemd.Units {
+		if err := validateUnit(unit, fmt.Sprintf("systemd.units[%d]", i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateStorage checks the paths, modes and contents of storage entries
+func validateStorage(storage Storage) error {
+	seen := make(map[string]string)
+	checkNode := func(node Node, field string, mode *int) error {
+		if node.Path == "" || !path.IsAbs(node.Path) {
+			return fmt.Errorf("invalid Ignition config: %s: path %q must be absolute", field, node.Path)
+		}
+		if path.Clean(node.Path) != node.Path {
+			return fmt.Errorf("invalid Ignition config: %s: path %q is not clean", field, node.Path)
+		}
+		if other, ok := seen[node.Path]; ok {
+			return fmt.Errorf("invalid Ignition config: %s: path %q is also set by %s", field, node.Path, other)
+		}
+		seen[node.Path] = field
+		if mode != nil && (*mode < 0 || *mode > 07777) {
+			return fmt.Errorf("invalid Ignition config: %s: invalid mode %#o", field, *mode)
+		}
+		return nil
+	}
+
+	for i, dir := range storage.Directories {
+		if err := checkNode(dir.Node, fmt.Sprintf("storage.directories[%d]", i), dir.Mode); err != nil {
+			return err
+		}
+	}
+	for i, file := range storage.Files {
+		field := fmt.Sprintf("storage.files[%d]", i)
+		if err := checkNode(file.Node, field, file.Mode); err != nil {
+			return err
+		}
+		if err := validateResource(file.Contents, field+".contents"); err != nil {
+			return err
+		}
+		for j, appended := range file.Append {
+			if err := validateResource(appended, fmt.Sprintf("%s.append[%d]", field, j)); err != nil {
+				return err
+			}
+		}
+	}
+	for i, link := range storage.Links {
+		field := fmt.Sprintf("storage.links[%d]", i)
+		if err := checkNode(link.Node, field, nil); err != nil {
+			return err
+		}
+		if link.Target == nil || *link.Target == "" {
+			return fmt.Errorf("invalid Ignition config: %s: target is required", field)
+		}
+	}
+	return nil
+}
+
+// validateResource checks a resource's source URL and verification hash
+func validateResource(res Resource, field string) error {
+	if res.Source != nil && *res.Source != "" {
+		u, err := url.Parse(*res.Source)
+		if err != nil {
+			return fmt.Errorf("invalid Ignition config: %s: invalid source: %w", field, err)
+		}
+		if !sourceSchemes[u.Scheme] {
+			return fmt.Errorf("invalid Ignition config: %s: unsupported source scheme %q", field, u.Scheme)
+		}
+	}
+
+	if res.Compression != nil && *res.Compression != "" && *res.Compression != "gzip" {
+		return fmt.Errorf("invalid Ignition config: %s: unsupported compression %q", field, *res.Compression)
+	}
+
+	for _, header := range res.HTTPHeaders {
+		if header.Name == "" {
+			return fmt.Errorf("invalid Ignition config: %s: HTTP header name is required", field)
+		}
+	}
+
+	if res.Verification.Hash != nil {
+		if err := validateHash(*res.Verification.Hash); err != nil {
+			return fmt.Errorf("invalid Ignition config: %s: %w", field, err)
+		}
+	}
+	return nil
+}
+
+// validateHash checks a verification hash of the form sha256-<hex> or sha512-<hex>
+func validateHash(hash string) error {
+	function, sum, ok := strings.Cut(hash, "-")
+	if !ok {
+		return fmt.Errorf("invalid hash %q", hash)
+	}
+
+	var size int
+	switch function {
+	case "sha256":
+		size = 32
+	case "sha512":
+		size = 64
+	default:
+		return fmt.Errorf("unsupported hash function %q", function)
+	}
+
+	decoded, err := hex.DecodeString(sum)
+	if err != nil || len(decoded) != size {
+		return fmt.Errorf("invalid %s hash %q", function, sum)
+	}
+	return nil
+}
+
+// validateUnit checks the names of a unit and its drop-ins
+func validateUnit(unit Unit, field string) error {
+	if unit.Name == "" {
+		return fmt.Errorf("invalid Ignition config: %s: name is required", field)
+	}
+	if strings.Contains(unit.Name, "/") || !hasUnitSuffix(unit.Name) {
+		return fmt.Errorf("invalid Ignition config: %s: invalid unit name %q", field, unit.Name)
+	}
+
+	for i, dropin := range unit.Dropins {
+		if strings.Contains(dropin.Name, "/") || !strings.HasSuffix(dropin.Name, ".conf") {
+			return fmt.Errorf("invalid Ignition config: %s.dropins[%d]: invalid drop-in name %q", field, i, dropin.Name)
+		}
+	}
+	return nil
+}
+
+// hasUnitSuffix reports whether name ends in a systemd unit type
+func hasUnitSuffix(name string) bool {
+	for _, suffix := range unitSuffixes {
+		if strings.HasSuffix(name, suffix) && len(name) > len(suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -258,11 +258,13 @@ type ImageInfo struct {
 
 // Template type constants
 const (
-	TemplateTypeKickstart = "kickstart"  // Red Hat/CentOS/Fedora
-	TemplateTypePreseed   = "preseed"    // Debian/Ubuntu
-	TemplateTypeAutoYaST  = "autoyast"   // SUSE/openSUSE
-	TemplateTypeCloudInit = "cloud-init" // Modern cloud images
-	TemplateTypeIPXE      = "ipxe"       // Custom boot scripts
+	TemplateTypeKickstart   = "kickstart"   // Red Hat/CentOS/Fedora
+	TemplateTypePreseed     = "preseed"     // Debian/Ubuntu
+	TemplateTypeAutoYaST    = "autoyast"    // SUSE/openSUSE
+	TemplateTypeCloudInit   = "cloud-init"  // Modern cloud images
+	TemplateTypeIPXE        = "ipxe"        // Custom boot scripts
+	TemplateTypeIgnition    = "ignition"    // Fedora CoreOS/Flatcar
+	TemplateTypeAutoinstall = "autoinstall" // Ubuntu Server (subiquity)
 )
 
 // TemplateInfo represents template information
@@ -583,11 +583,13 @@ func TestServiceManager_Events(t *testing.T) {
 // Test template type constants
 func TestTemplateType_Constants(t *testing.T) {
 	expectedTypes := map[string]string{
-		TemplateTypeKickstart: "kickstart",
-		TemplateTypePreseed:   "preseed",
-		TemplateTypeAutoYaST:  "autoyast",
-		TemplateTypeCloudInit: "cloud-init",
-		TemplateTypeIPXE:      "ipxe",
+		TemplateTypeKickstart:   "kickstart",
+		TemplateTypePreseed:     "preseed",
+		TemplateTypeAutoYaST:    "autoyast",
+		TemplateTypeCloudInit:   "cloud-init",
+		TemplateTypeIPXE:        "ipxe",
+		TemplateTypeIgnition:    "ignition",
+		TemplateTypeAutoinstall: "autoinstall",
 	}
 
 	for constant, expected := range expectedTypes {
@@ -135,16 +135,27 @@ func createTestOSImages() []*osimage.OSImage {
 			ID:      "ubuntu-22.04",
 			OS:      "ubuntu",
 			Version: "22.04",
+			Artifacts: []osimage.ImageArtifact{
+				{Role: config.RoleKernel, Path: "ubuntu/22.04/vmlinuz"},
+				{Role: config.RoleInitrd, Path: "ubuntu/22.04/initrd"},
+				{Role: config.RoleSquashfs, Path: "ubuntu/22.04/filesystem.squashfs"},
+			},
 		},
 		{
-			ID:      "centos-stream-9",
-			OS:      "centos",
-			Version: "stream-9",
+			ID:         "centos-stream-9",
+			OS:         "centos",
+			Version:    "stream-9",
+			KernelPath: "centos/stream-9/vmlinuz",
+			InitrdPath: "centos/stream-9/initrd.img",
 		},
 		{
 			ID:      "nixos-23.11",
 			OS:      "nixos",
 			Version: "23.11",
+			Artifacts: []osimage.ImageArtifact{
+				{Role: config.RoleKernel, Path: "nixos/23.11/bzImage-x86_64-linux"},
+				{Role: config.RoleInitrd, Path: "nixos/23.11/initrd-x86_64-linux"},
+			},
 		},
 	}
 }
@@ -269,48 +280,6 @@ func TestGetDisplayName(t *testing.T) {
 	}
 }
 
-// Test getKernelFilename
-func TestGetKernelFilename(t *testing.T) {
-	cfg := createTestConfig()
-	service := NewService(cfg, nil)
-
-	tests := []struct {
-		os       string
-		expected string
-	}{
-		{"ubuntu", "vmlinuz"},
-		{"centos", "vmlinuz"},
-		{"nixos", "bzImage-x86_64-linux"},
-		{"unknown", "vmlinuz"}, // fallback
-	}
-
-	for _, test := range tests {
-		result := service.getKernelFilename(test.os)
-		assert.Equal(t, test.expected, result, "OS: %s", test.os)
-	}
-}
-
-// Test getInitrdFilename
-func TestGetInitrdFilename(t *testing.T) {
-	cfg := createTestConfig()
-	service := NewService(cfg, nil)
-
-	tests := []struct {
-		os       string
-		expected string
-	}{
-		{"ubuntu", "initrd"},
-		{"centos", "initrd.img"},
-		{"nixos", "initrd-x86_64-linux"},
-		{"unknown", "initrd.img"}, // fallback
-	}
-
-	for _, test := range tests {
-		result := service.getInitrdFilename(test.os)
-		assert.Equal(t, test.expected, result, "OS: %s", test.os)
-	}
-}
-
 // Test getKernelArgs
 func TestGetKernelArgs(t *testing.T) {
 	cfg := createTestConfig()
@@ -318,19 +287,25 @@ func TestGetKernelArgs(t *testing.T) {
 	serverIP := "192.168.1.100"
 
 	tests := []struct {
-		os       string
+		image    *osimage.OSImage
 		contains []string
 	}{
-		{"ubuntu", []string{"boot=casper", "netboot=url", "fetch=http://192.168.1.100:8080/ubuntu/"}},
-		{"centos", []string{"inst.repo=http://192.168.1.100:8080/centos/", "quiet"}},
-		{"nixos", []string{"init=/nix/store", "boot.shell_on_fail", "console=ttyS0"}},
-		{"unknown", []string{"quiet"}},
+		{&osimage.OSImage{OS: "ubuntu"}, []string{"boot=casper", "netboot=url", "fetch=http://192.168.1.100:8080/boot/ubuntu/"}},
+		{&osimage.OSImage{OS: "centos"}, []string{"inst.repo=http://192.168.1.100:8080/boot/centos/", "quiet"}},
+		{&osimage.OSImage{OS: "nixos"}, []string{"init=/nix/store", "boot.shell_on_fail", "console=ttyS0"}},
+		{&osimage.OSImage{OS: "unknown"}, []string{"quiet"}},
+		// Artifacts with boot roles are fetched from the boot tree
+		{createTestOSImages()[0], []string{"boot=casper", "fetch=http://192.168.1.100:8080/boot/ubuntu/22.04/filesystem.squashfs"}},
+		{&osimage.OSImage{OS: "fedora", Artifacts: []osimage.ImageArtifact{
+			{Role: config.RoleKernel, Path: "fedora/41/vmlinuz"},
+			{Role: config.RoleStage2, Path: "fedora/41/install.img"},
+		}}, []string{"inst.stage2=http://192.168.1.100:8080/boot/fedora/41/install.img"}},
 	}
 
 	for _, test := range tests {
-		result := service.getKernelArgs(test.os, serverIP)
+		result := service.getKernelArgs(test.image, serverIP)
 		for _, expected := range test.contains {
-			assert.Contains(t, result, expected, "OS: %s should contain: %s", test.os, expected)
+			assert.Contains(t, result, expected, "OS: %s should contain: %s", test.image.OS, expected)
 		}
 	}
 }
@@ -371,7 +346,7 @@ func TestRenderTemplate(t *testing.T) {
 				Name:        "ubuntu",
 				DisplayName: "Ubuntu 22.04",
 				KernelPath:  "ubuntu/22.04/vmlinuz",
-				InitrdPath:  "ubuntu/22.04/initrd",
+				InitrdPaths: []string{"ubuntu/22.04/initrd"},
 				KernelArgs:  "boot=casper netboot=url",
 			},
 		},
@@ -478,7 +453,7 @@ func TestOSImageEntry(t *testing.T) {
 		Name:        "test-name",
 		DisplayName: "Test Display Name",
 		KernelPath:  "test/kernel/path",
-		InitrdPath:  "test/initrd/path",
+		InitrdPaths: []string{"test/initrd/path"},
 		KernelArgs:  "test=args quiet",
 	}
 
@@ -486,7 +461,7 @@ func TestOSImageEntry(t *testing.T) {
 	assert.Equal(t, "test-name", entry.Name)
 	assert.Equal(t, "Test Display Name", entry.DisplayName)
 	assert.Equal(t, "test/kernel/path", entry.KernelPath)
-	assert.Equal(t, "test/initrd/path", entry.InitrdPath)
+	assert.Equal(t, []string{"test/initrd/path"}, entry.InitrdPaths)
 	assert.Equal(t, "test=args quiet", entry.KernelArgs)
 }
 
@@ -525,7 +500,7 @@ func TestTemplateStructure(t *testing.T) {
 				Name:        "ubuntu",
 				DisplayName: "Ubuntu 22.04",
 				KernelPath:  "ubuntu/22.04/vmlinuz",
-				InitrdPath:  "ubuntu/22.04/initrd",
+				InitrdPaths: []string{"ubuntu/22.04/initrd"},
 				KernelArgs:  "boot=casper netboot=url",
 			},
 		},
@@ -27,6 +27,15 @@ func NewService(cfg *config.Config, osImageService osimage.OSImageService) *Serv
 	}
 }
 
+// LocalBootScript is served to known hosts that are not armed for
+// provisioning. It boots the first disk, or returns to the firmware to try
+// the next boot device where sanboot is unavailable.
+const LocalBootScript = `#!ipxe
+
+echo Booting from local disk...
+sanboot --no-describe --drive 0x80 || exit
+`
+
 // iPXEConfig represents the data for iPXE template
 type iPXEConfig struct {
 	ServerIP string
@@ -41,7 +50,7 @@ type OSImageEntry struct {
 	Name        string
 	DisplayName string
 	KernelPath  string
-	InitrdPath  string
+	InitrdPaths []string
 	KernelArgs  string
 }
 
@@ -63,13 +72,18 @@ func (s *Service) GenerateConfig(ctx context.Context) (string, error) {
 	// Convert to iPXE menu entries
 	var entries []OSImageEntry
 	for _, img := range osImages {
+		kernel := img.Path(config.RoleKernel)
+		if kernel == "" {
+			continue // Nothing to boot
+		}
+
 		entry := OSImageEntry{
 			ID:          strings.ToLower(img.OS),
 			Name:        strings.ToLower(img.OS),
 			DisplayName: s.getDisplayName(img.OS, img.Version),
-			KernelPath:  fmt.Sprintf("%s/%s/%s", img.OS, img.Version, s.getKernelFilename(img.OS)),
-			InitrdPath:  fmt.Sprintf("%s/%s/%s", img.OS, img.Version, s.getInitrdFilename(img.OS)),
-			KernelArgs:  s.getKernelArgs(img.OS, serverIP),
+			KernelPath:  kernel,
+			InitrdPaths: img.Paths(config.RoleInitrd),
+			KernelArgs:  s.getKernelArgs(img, serverIP),
 		}
 		entries = append(entries, entry)
 	}
@@ -78,7 +92,7 @@ func (s *Service) GenerateConfig(ctx context.Context) (string, error) {
 	data := iPXEConfig{
 		ServerIP: serverIP,
 		HTTPPort: s.config.HTTP.Port,
-		BaseURL:  fmt.Sprintf("http://%s:%s", serverIP, s.config.HTTP.Port),
+		BaseURL:  s.bootURL(serverIP),
 		OSImages: entries,
 	}
 
@@ -129,34 +143,39 @@ func (s *Service) getDisplayName(os, version string) string {
 	}
 }
 
-// getKernelFilename returns the kernel filename for an OS
-func (s *Service) getKernelFilename(os string) string {
-	if osDef, exists := s.config.OSImages.Sources[os]; exists {
-		return osDef.KernelFile
-	}
-	return "vmlinuz" // fallback
-}
-
-// getInitrdFilename returns the initrd filename for an OS
-func (s *Service) getInitrdFilename(os string) string {
-	if osDef, exists := s.config.OSImages.Sources[os]; exists {
-		return osDef.InitrdFile
-	}
-	return "initrd.img" // fallback
+// bootURL returns the URL of the HTTP boot tree, which serves the TFTP directory
+func (s *Service) bootURL(serverIP string) string {
+	return fmt.Sprintf("http://%s:%s/boot", serverIP, s.config.HTTP.Port)
 }
 
 // getKernelArgs returns appropriate kernel arguments for an OS
-func (s *Service) getKernelArgs(os, serverIP string) string {
-	switch os {
+func (s *Service) getKernelArgs(img *osimage.OSImage, serverIP string) string {
+	// Artifacts such as a squashfs or stage2 image are fetched from the boot tree
+	artifactArgs := img.BootArgs(s.bootURL(serverIP))
+
+	var args string
+	switch img.OS {
 	case "ubuntu":
-		return "boot=casper netboot=url fetch=http://" + serverIP + ":8080/ubuntu/ quiet splash"
+		args = "boot=casper netboot=url"
+		if artifactArgs == "" {
+			args += " fetch=" + s.bootURL(serverIP) + "/ubuntu/"
+		}
+		args += " quiet splash"
 	case "centos":
-		return "inst.repo=http://" + serverIP + ":8080/centos/ quiet"
+		args = "quiet"
+		if artifactArgs == "" {
+			args = "inst.repo=" + s.bootURL(serverIP) + "/centos/ quiet"
+		}
 	case "nixos":
-		return "init=/nix/store/.../init boot.shell_on_fail console=ttyS0"
+		args = "init=/nix/store/.../init boot.shell_on_fail console=ttyS0"
 	default:
-		return "quiet"
+		args = "quiet"
+	}
+
+	if artifactArgs != "" {
+		return artifactArgs + " " + args
 	}
+	return args
 }
 
 // renderTemplate renders the iPXE configuration template
@@ -191,9 +210,9 @@ goto ${selected}
 {{range .OSImages}}
 :{{.ID}}
 echo Booting {{.DisplayName}}...
-kernel ${base-url}/{{.KernelPath}} initrd={{.InitrdPath}} {{.KernelArgs}}
-initrd ${base-url}/{{.InitrdPath}}
-boot
+kernel ${base-url}/{{.KernelPath}}{{range .InitrdPaths}} initrd={{.}}{{end}} {{.KernelArgs}}
+{{range .InitrdPaths}}initrd ${base-url}/{{.}}
+{{end}}boot
 
 {{end}}
 :memtest
@@ -0,0 +1,354 @@
+//go:build linux
+
+// network/netlink_linux.go - VLAN subinterfaces via rtnetlink
+package network
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// NetlinkVLANManager manages VLAN subinterfaces through rtnetlink. It needs
+// CAP_NET_ADMIN.
+type NetlinkVLANManager struct{}
+
+// NewVLANManager creates a VLAN manager for this platform
+func NewVLANManager() VLANManager {
+	return &NetlinkVLANManager{}
+}
+
+// CreateVLAN creates, addresses and brings up a VLAN subinterface
+func (m *NetlinkVLANManager) CreateVLAN(parent string, vlanID int, addr *net.IPNet) (string, bool, error) {
+	name, err := VLANInterfaceName(parent, vlanID)
+	if err != nil {
+		return "", false, err
+	}
+
+	parentLink, err := net.InterfaceByName(parent)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to find parent interface %s: %w", parent, err)
+	}
+
+	created := false
+	link, err := net.InterfaceByName(name)
+	if err != nil {
+		if err := addVLANLink(name, parentLink.Index, vlanID); err != nil {
+			return "", false, fmt.Errorf("failed to create VLAN interface %s: %w", name, err)
+		}
+		created = true
+
+		if link, err = net.InterfaceByName(name); err != nil {
+			return "", false, fmt.Errorf("failed to find created interface %s: %w", name, err)
+		}
+	} else if err := checkVLANLink(link.Index, parentLink.Index, vlanID); err != nil {
+		return "", false, fmt.Errorf("cannot reuse existing interface %s: %w", name, err)
+	}
+
+	// Undo the link on failure so a retry starts clean
+	fail := func(err error) (string, bool, error) {
+		if created {
+			deleteLink(link.Index)
+		}
+		return "", false, err
+	}
+
+	if addr != nil {
+		if err := addAddress(link.Index, addr); err != nil && !errors.Is(err, unix.EEXIST) {
+			return fail(fmt.Errorf("failed to assign %s to %s: %w", addr, name, err))
+		}
+	}
+	if err := setLinkUp(link.Index); err != nil {
+		return fail(fmt.Errorf("failed to bring up %s: %w", name, err))
+	}
+
+	return name, created, nil
+}
+
+// DeleteVLAN removes a VLAN subinterface
+func (m *NetlinkVLANManager) DeleteVLAN(name string) error {
+	link, err := net.InterfaceByName(name)
+	if err != nil {
+		return fmt.Errorf("failed to find interface %s: %w", name, err)
+	}
+	if err := deleteLink(link.Index); err != nil {
+		return fmt.Errorf("failed to delete interface %s: %w", name, err)
+	}
+	return nil
+}
+
+// ReplaceAddress assigns addr to a subinterface and then removes old from it
+func (m *NetlinkVLANManager) ReplaceAddress(name string, old, addr *net.IPNet) error {
+	link, err := net.InterfaceByName(name)
+	if err != nil {
+		return fmt.Errorf("failed to find interface %s: %w", name, err)
+	}
+	if err := addAddress(link.Index, addr); err != nil && !errors.Is(err, unix.EEXIST) {
+		return fmt.Errorf("failed to assign %s to %s: %w", addr, name, err)
+	}
+	if old == nil || old.String() == addr.String() {
+		return nil
+	}
+	if err := deleteAddress(link.Index, old); err != nil && !errors.Is(err, unix.EADDRNOTAVAIL) {
+		return fmt.Errorf("failed to remove %s from %s: %w", old, name, err)
+	}
+	return nil
+}
+
+// checkVLANLink verifies that an existing link is the 802.1Q subinterface for
+// vlanID on parentIndex
+func checkVLANLink(index, parentIndex, vlanID int) error {
+	info, err := getLink(index)
+	if err != nil {
+		return fmt.Errorf("failed to read link: %w", err)
+	}
+	if info.kind != "vlan" {
+		return fmt.Errorf("it is not a VLAN interface")
+	}
+	if info.vlanID != vlanID {
+		return fmt.Errorf("it has VLAN ID %d, not %d", info.vlanID, vlanID)
+	}
+	if info.parentIndex != parentIndex {
+		return fmt.Errorf("it is on another parent interface (index %d, not %d)", info.parentIndex, parentIndex)
+	}
+	return nil
+}
+
+// linkInfo is the part of a link's description CreateVLAN checks
+type linkInfo struct {
+	kind        string // IFLA_INFO_KIND, e.g. "vlan"
+	parentIndex int    // IFLA_LINK, 0 if the link has no parent
+	vlanID      int    // IFLA_VLAN_ID for VLAN links
+}
+
+// getLink sends RTM_GETLINK for a link and decodes the reply
+func getLink(index int) (linkInfo, error) {
+	reply, err := exchange(unix.RTM_GETLINK, 0, ifInfomsg(index, 0, 0))
+	if err != nil {
+		return linkInfo{}, err
+	}
+	if reply == nil || reply.Header.Type != unix.RTM_NEWLINK {
+		return linkInfo{}, fmt.Errorf("unexpected reply to RTM_GETLINK")
+	}
+	attrs, err := syscall.ParseNetlinkRouteAttr(reply)
+	if err != nil {
+		return linkInfo{}, fmt.Errorf("failed to parse link attributes: %w", err)
+	}
+
+	var info linkInfo
+	for _, attr := range attrs {
+		switch attr.Attr.Type {
+		case unix.IFLA_LINK:
+			if len(attr.Value) >= 4 {
+				info.parentIndex = int(binary.NativeEndian.Uint32(attr.Value))
+			}
+		case unix.IFLA_LINKINFO:
+			nested := parseAttrs(attr.Value)
+			info.kind = strings.TrimRight(string(nested[unix.IFLA_INFO_KIND]), "\x00")
+			if data := parseAttrs(nested[unix.IFLA_INFO_DATA]); len(data[unix.IFLA_VLAN_ID]) >= 2 {
+				info.vlanID = int(binary.NativeEndian.Uint16(data[unix.IFLA_VLAN_ID]))
+			}
+		}
+	}
+	return info, nil
+}
+
+// parseAttrs decodes a run of netlink attributes, keyed by type
+func parseAttrs(b []byte) map[uint16][]byte {
+	attrs := make(map[uint16][]byte)
+	for len(b) >= unix.SizeofNlAttr {
+		length := int(binary.NativeEndian.Uint16(b[0:]))
+		if length < unix.SizeofNlAttr || length > len(b) {
+			break
+		}
+		attrType := binary.NativeEndian.Uint16(b[2:]) &^ (unix.NLA_F_NESTED | unix.NLA_F_NET_BYTEORDER)
+		attrs[attrType] = b[unix.SizeofNlAttr:length]
+		if nlAlign(length) >= len(b) {
+			break
+		}
+		b = b[nlAlign(length):]
+	}
+	return attrs
+}
+
+// addVLANLink sends RTM_NEWLINK for an 802.1Q subinterface of parentIndex
+func addVLANLink(name string, parentIndex, vlanID int) error {
+	vlanData := newAttr(unix.IFLA_VLAN_ID, uint16Bytes(uint16(vlanID)))
+	linkInfo := newAttr(unix.IFLA_LINKINFO, concat(
+		newAttr(unix.IFLA_INFO_KIND, []byte("vlan")),
+		newAttr(unix.IFLA_INFO_DATA, vlanData),
+	))
+
+	return addLink(name, parentIndex, linkInfo)
+}
+
+// addLink sends RTM_NEWLINK with the given IFLA_LINKINFO attribute
+func addLink(name string, parentIndex int, linkInfo []byte) error {
+	attrs := [][]byte{newAttr(unix.IFLA_IFNAME, nullTerminated(name))}
+	if parentIndex > 0 {
+		attrs = append(attrs, newAttr(unix.IFLA_LINK, uint32Bytes(uint32(parentIndex))))
+	}
+	attrs = append(attrs, linkInfo)
+
+	body := concat(append([][]byte{ifInfomsg(0, 0, 0)}, attrs...)...)
+	return request(unix.RTM_NEWLINK, unix.NLM_F_CREATE|unix.NLM_F_EXCL, body)
+}
+
+// setLinkUp sets IFF_UP on a link
+func setLinkUp(index int) error {
+	return request(unix.RTM_NEWLINK, 0, ifInfomsg(index, unix.IFF_UP, unix.IFF_UP))
+}
+
+// deleteLink sends RTM_DELLINK for a link
+func deleteLink(index int) error {
+	return request(unix.RTM_DELLINK, 0, ifInfomsg(index, 0, 0))
+}
+
+// addAddress assigns an IPv4 address to a link
+func addAddress(index int, addr *net.IPNet) error {
+	body, err := ifAddrmsg(index, addr)
+	if err != nil {
+		return err
+	}
+	return request(unix.RTM_NEWADDR, unix.NLM_F_CREATE|unix.NLM_F_EXCL, body)
+}
+
+// deleteAddress removes an IPv4 address from a link
+func deleteAddress(index int, addr *net.IPNet) error {
+	body, err := ifAddrmsg(index, addr)
+	if err != nil {
+		return err
+	}
+	return request(unix.RTM_DELADDR, 0, body)
+}
+
+// ifAddrmsg encodes a struct ifaddrmsg with the attributes for addr
+func ifAddrmsg(index int, addr *net.IPNet) ([]byte, error) {
+	ip := addr.IP.To4()
+	if ip == nil {
+		return nil, fmt.Errorf("only IPv4 addresses are supported: %s", addr.IP)
+	}
+	ones, _ := addr.Mask.Size()
+
+	msg := make([]byte, unix.SizeofIfAddrmsg)
+	msg[0] = unix.AF_INET
+	msg[1] = byte(ones)
+	binary.NativeEndian.PutUint32(msg[4:], uint32(index))
+
+	return concat(msg, newAttr(unix.IFA_LOCAL, ip), newAttr(unix.IFA_ADDRESS, ip)), nil
+}
+
+// ifInfomsg encodes a struct ifinfomsg
+func ifInfomsg(index int, flags, change uint32) []byte {
+	msg := make([]byte, unix.SizeofIfInfomsg)
+	msg[0] = unix.AF_UNSPEC
+	binary.NativeEndian.PutUint32(msg[4:], uint32(int32(index)))
+	binary.NativeEndian.PutUint32(msg[8:], flags)
+	binary.NativeEndian.PutUint32(msg[12:], change)
+	return msg
+}
+
+// newAttr encodes a netlink attribute, padded to 4 bytes
+func newAttr(attrType uint16, value []byte) []byte {
+	length := unix.SizeofNlAttr + len(value)
+	attr := make([]byte, nlAlign(length))
+	binary.NativeEndian.PutUint16(attr[0:], uint16(length))
+	binary.NativeEndian.PutUint16(attr[2:], attrType)
+	copy(attr[unix.SizeofNlAttr:], value)
+	return attr
+}
+
+var sequence atomic.Uint32
+
+// request sends a single rtnetlink request and waits for its acknowledgement
+func request(msgType uint16, flags uint16, body []byte) error {
+	_, err := exchange(msgType, flags|unix.NLM_F_ACK, body)
+	return err
+}
+
+// exchange sends a single rtnetlink request and returns the first reply to
+// it, or nil for an acknowledgement. Error replies are returned as errors.
+func exchange(msgType uint16, flags uint16, body []byte) (*syscall.NetlinkMessage, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open netlink socket: %w", err)
+	}
+	defer unix.Close(fd)
+
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return nil, fmt.Errorf("failed to bind netlink socket: %w", err)
+	}
+
+	seq := sequence.Add(1)
+	header := make([]byte, unix.SizeofNlMsghdr)
+	binary.NativeEndian.PutUint32(header[0:], uint32(unix.SizeofNlMsghdr+len(body)))
+	binary.NativeEndian.PutUint16(header[4:], msgType)
+	binary.NativeEndian.PutUint16(header[6:], flags|unix.NLM_F_REQUEST)
+	binary.NativeEndian.PutUint32(header[8:], seq)
+
+	if err := unix.Sendto(fd, concat(header, body), 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return nil, fmt.Errorf("failed to send netlink request: %w", err)
+	}
+
+	buffer := make([]byte, 32<<10)
+	for {
+		n, _, err := unix.Recvfrom(fd, buffer, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read netlink response: %w", err)
+		}
+
+		messages, err := syscall.ParseNetlinkMessage(buffer[:n])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse netlink response: %w", err)
+		}
+		for _, msg := range messages {
+			if msg.Header.Seq != seq {
+				continue
+			}
+			if msg.Header.Type != unix.NLMSG_ERROR {
+				return &msg, nil
+			}
+			if len(msg.Data) < 4 {
+				return nil, fmt.Errorf("short netlink error message")
+			}
+			if errno := int32(binary.NativeEndian.Uint32(msg.Data[0:4])); errno != 0 {
+				return nil, unix.Errno(-errno)
+			}
+			return nil, nil
+		}
+	}
+}
+
+func nlAlign(length int) int {
+	return (length + unix.NLA_ALIGNTO - 1) & ^(unix.NLA_ALIGNTO - 1)
+}
+
+func nullTerminated(s string) []byte {
+	return append([]byte(s), 0)
+}
+
+func uint16Bytes(v uint16) []byte {
+	b := make([]byte, 2)
+	binary.NativeEndian.PutUint16(b, v)
+	return b
+}
+
+func uint32Bytes(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.NativeEndian.PutUint32(b, v)
+	return b
+}
+
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, part := range parts {
+		out = append(out, part...)
+	}
+	return out
+}
@@ -0,0 +1,255 @@
+//go:build linux
+
+package network
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// inNetworkNamespace runs fn on a locked thread moved into a fresh network
+// namespace, so links created by the test never touch the host. The thread
+// is left locked and is discarded when the goroutine exits. fn must not call
+// t.FailNow or anything that does; it returns an error instead, which is
+// returned to the test goroutine.
+func inNetworkNamespace(t *testing.T, fn func() error) error {
+	done := make(chan struct{})
+	var unshareErr, fnErr error
+
+	go func() {
+		defer close(done)
+		runtime.LockOSThread()
+
+		if err := unix.Unshare(unix.CLONE_NEWNET); err != nil {
+			unshareErr = err
+			return
+		}
+		fnErr = fn()
+	}()
+	<-done
+
+	if unshareErr != nil {
+		if errors.Is(unshareErr, os.ErrPermission) {
+			t.Skipf("creating a network namespace needs CAP_SYS_ADMIN: %v", unshareErr)
+		}
+		t.Fatalf("failed to create network namespace: %v", unshareErr)
+	}
+	return fnErr
+}
+
+// addParent creates a veth pair standing in for the physical NIC and brings
+// up its first end
+func addParent(name, peer string) (*net.Interface, error) {
+	if err := addVethPair(name, peer); err != nil {
+		return nil, fmt.Errorf("failed to create veth pair: %w", err)
+	}
+	parent, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+	return parent, setLinkUp(parent.Index)
+}
+
+func TestNetlinkVLANManager_CreateAndDelete(t *testing.T) {
+	var (
+		name               string
+		created, recreated bool
+		addrs              []net.Addr
+		deleteErr          error
+		linkErr            error
+	)
+	manager := NewVLANManager()
+	_, subnet, _ := net.ParseCIDR("10.42.0.0/24")
+	addr := &net.IPNet{IP: net.ParseIP("10.42.0.1"), Mask: subnet.Mask}
+
+	err := inNetworkNamespace(t, func() error {
+		if _, err := addParent("ignite0", "ignite1"); err != nil {
+			return err
+		}
+
+		var err error
+		name, created, err = manager.CreateVLAN("ignite0", 42, addr)
+		if err != nil {
+			return err
+		}
+		link, err := net.InterfaceByName(name)
+		if err != nil {
+			return err
+		}
+		if addrs, err = link.Addrs(); err != nil {
+			return err
+		}
+
+		// A second call reuses the existing subinterface
+		if _, recreated, err = manager.CreateVLAN("ignite0", 42, addr); err != nil {
+			return err
+		}
+
+		deleteErr = manager.DeleteVLAN(name)
+		_, linkErr = net.InterfaceByName(name)
+		return nil
+	})
+	if errors.Is(err, unix.EOPNOTSUPP) {
+		t.Skip("kernel has no 802.1Q support")
+	}
+	require.NoError(t, err)
+
+	assert.Equal(t, "ignite0.42", name)
+	assert.True(t, created)
+	require.Len(t, addrs, 1)
+	assert.Equal(t, "10.42.0.1/24", addrs[0].String())
+	assert.False(t, recreated)
+	assert.NoError(t, deleteErr)
+	assert.Error(t, linkErr, "the subinterface is gone after DeleteVLAN")
+}
+
+func TestNetlinkVLANManager_RejectsMismatchedLink(t *testing.T) {
+	var wrongID, wrongParent, notVLAN error
+	manager := NewVLANManager()
+
+	err := inNetworkNamespace(t, func() error {
+		parent, err := addParent("ignite0", "ignite1")
+		if err != nil {
+			return err
+		}
+		other, err := addParent("ignite2", "ignite3")
+		if err != nil {
+			return err
+		}
+
+		// Links named for one VLAN but set up for another
+		if err := addVLANLink("ignite0.43", parent.Index, 44); err != nil {
+			return err
+		}
+		if err := addVLANLink("ignite0.45", other.Index, 45); err != nil {
+			return err
+		}
+		if err := addVethPair("ignite0.46", "ignite4"); err != nil {
+			return err
+		}
+
+		_, _, wrongID = manager.CreateVLAN("ignite0", 43, nil)
+		_, _, wrongParent = manager.CreateVLAN("ignite0", 45, nil)
+		_, _, notVLAN = manager.CreateVLAN("ignite0", 46, nil)
+		return nil
+	})
+	if errors.Is(err, unix.EOPNOTSUPP) {
+		t.Skip("kernel has no 802.1Q support")
+	}
+	require.NoError(t, err)
+
+	assert.ErrorContains(t, wrongID, "VLAN ID 44")
+	assert.ErrorContains(t, wrongParent, "another parent")
+	assert.ErrorContains(t, notVLAN, "not a VLAN interface")
+}
+
+func TestNetlinkGetLink(t *testing.T) {
+	var info linkInfo
+	var peerIndex int
+
+	err := inNetworkNamespace(t, func() error {
+		if err := addVethPair("ignite0", "ignite1"); err != nil {
+			return err
+		}
+		link, err := net.InterfaceByName("ignite0")
+		if err != nil {
+			return err
+		}
+		peer, err := net.InterfaceByName("ignite1")
+		if err != nil {
+			return err
+		}
+		peerIndex = peer.Index
+		info, err = getLink(link.Index)
+		return err
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "veth", info.kind)
+	assert.Equal(t, peerIndex, info.parentIndex)
+	assert.Zero(t, info.vlanID)
+}
+
+// addVethPair creates a veth pair, with the peer described by a nested ifinfomsg
+func addVethPair(name, peer string) error {
+	const vethInfoPeer = 1
+	peerInfo := concat(ifInfomsg(0, 0, 0), newAttr(unix.IFLA_IFNAME, nullTerminated(peer)))
+	linkInfo := newAttr(unix.IFLA_LINKINFO, concat(
+		newAttr(unix.IFLA_INFO_KIND, []byte("veth")),
+		newAttr(unix.IFLA_INFO_DATA, newAttr(vethInfoPeer, peerInfo)),
+	))
+	return addLink(name, 0, linkInfo)
+}
+
+func TestNetlinkVLANManager_MissingParent(t *testing.T) {
+	_, _, err := NewVLANManager().CreateVLAN("ignite-none0", 10, nil)
+	assert.Error(t, err)
+}
+
+func TestNetlinkAddAddress(t *testing.T) {
+	var firstErr, secondErr, deleteErr, linkErr error
+	var addrs []net.Addr
+
+	err := inNetworkNamespace(t, func() error {
+		if err := addVethPair("ignite0", "ignite1"); err != nil {
+			return err
+		}
+		link, err := net.InterfaceByName("ignite0")
+		if err != nil {
+			return err
+		}
+
+		addr := &net.IPNet{IP: net.ParseIP("10.42.0.1"), Mask: net.CIDRMask(24, 32)}
+		firstErr = addAddress(link.Index, addr)
+		secondErr = addAddress(link.Index, addr)
+		if addrs, err = link.Addrs(); err != nil {
+			return err
+		}
+
+		deleteErr = deleteLink(link.Index)
+		_, linkErr = net.InterfaceByName("ignite0")
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.NoError(t, firstErr)
+	assert.ErrorIs(t, secondErr, unix.EEXIST)
+	require.Len(t, addrs, 1)
+	assert.Equal(t, "10.42.0.1/24", addrs[0].String())
+	assert.NoError(t, deleteErr)
+	assert.Error(t, linkErr)
+}
+
+func TestNetlinkVLANManager_ReplaceAddress(t *testing.T) {
+	var replaceErr error
+	var addrs []net.Addr
+
+	err := inNetworkNamespace(t, func() error {
+		link, err := addParent("ignite0", "ignite1")
+		if err != nil {
+			return err
+		}
+		old := &net.IPNet{IP: net.ParseIP("192.168.1.10"), Mask: net.CIDRMask(24, 32)}
+		if err := addAddress(link.Index, old); err != nil {
+			return err
+		}
+
+		addr := &net.IPNet{IP: net.ParseIP("10.20.0.10"), Mask: net.CIDRMask(24, 32)}
+		replaceErr = NewVLANManager().ReplaceAddress("ignite0", old, addr)
+		addrs, err = link.Addrs()
+		return err
+	})
+	require.NoError(t, err)
+
+	assert.NoError(t, replaceErr)
+	require.Len(t, addrs, 1)
+	assert.Equal(t, "10.20.0.10/24", addrs[0].String())
+}
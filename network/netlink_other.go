@@ -0,0 +1,29 @@
+//go:build !linux
+
+// network/netlink_other.go - VLAN management stub for other platforms
+package network
+
+import "net"
+
+// unsupportedVLANManager reports ErrNotSupported for every operation
+type unsupportedVLANManager struct{}
+
+// NewVLANManager creates a VLAN manager for this platform
+func NewVLANManager() VLANManager {
+	return unsupportedVLANManager{}
+}
+
+// CreateVLAN is not supported outside Linux
+func (unsupportedVLANManager) CreateVLAN(parent string, vlanID int, addr *net.IPNet) (string, bool, error) {
+	return "", false, ErrNotSupported
+}
+
+// DeleteVLAN is not supported outside Linux
+func (unsupportedVLANManager) DeleteVLAN(name string) error {
+	return ErrNotSupported
+}
+
+// ReplaceAddress is not supported outside Linux
+func (unsupportedVLANManager) ReplaceAddress(name string, old, addr *net.IPNet) error {
+	return ErrNotSupported
+}
@@ -0,0 +1,57 @@
+// network/vlan.go - VLAN subinterface management
+package network
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// VLAN ID limits from IEEE 802.1Q; 0 and 4095 are reserved
+const (
+	MinVLANID = 1
+	MaxVLANID = 4094
+)
+
+// maxInterfaceNameLen is IFNAMSIZ without the trailing NUL
+const maxInterfaceNameLen = 15
+
+// ErrNotSupported is returned when VLAN management is unavailable on this platform
+var ErrNotSupported = errors.New("VLAN management is not supported on this platform")
+
+// VLANManager creates and removes VLAN subinterfaces
+type VLANManager interface {
+	// CreateVLAN creates the subinterface for vlanID on parent, assigns addr
+	// and brings it up. An existing subinterface is reused, in which case
+	// created is false; a link with its name but another VLAN ID or parent is
+	// an error.
+	CreateVLAN(parent string, vlanID int, addr *net.IPNet) (name string, created bool, err error)
+	// DeleteVLAN removes a subinterface by name
+	DeleteVLAN(name string) error
+	// ReplaceAddress moves a subinterface from address old to addr
+	ReplaceAddress(name string, old, addr *net.IPNet) error
+}
+
+// VLANInterfaceName returns the conventional name for a VLAN subinterface, e.g. eth0.100
+func VLANInterfaceName(parent string, vlanID int) (string, error) {
+	if err := ValidateVLANID(vlanID); err != nil {
+		return "", err
+	}
+	if parent == "" {
+		return "", fmt.Errorf("parent interface is required")
+	}
+
+	name := fmt.Sprintf("%s.%d", parent, vlanID)
+	if len(name) > maxInterfaceNameLen {
+		return "", fmt.Errorf("interface name %s is longer than %d characters", name, maxInterfaceNameLen)
+	}
+	return name, nil
+}
+
+// ValidateVLANID checks that id is a usable 802.1Q VLAN ID
+func ValidateVLANID(id int) error {
+	if id < MinVLANID || id > MaxVLANID {
+		return fmt.Errorf("VLAN ID must be between %d and %d, got %d", MinVLANID, MaxVLANID, id)
+	}
+	return nil
+}
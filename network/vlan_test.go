@@ -0,0 +1,25 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVLANInterfaceName(t *testing.T) {
+	name, err := VLANInterfaceName("eth0", 100)
+	assert.NoError(t, err)
+	assert.Equal(t, "eth0.100", name)
+
+	_, err = VLANInterfaceName("eth0", 0)
+	assert.Error(t, err)
+
+	_, err = VLANInterfaceName("eth0", 4095)
+	assert.Error(t, err)
+
+	_, err = VLANInterfaceName("", 100)
+	assert.Error(t, err)
+
+	_, err = VLANInterfaceName("enp129s0f1np1", 4000)
+	assert.Error(t, err, "name longer than IFNAMSIZ")
+}
@@ -0,0 +1,508 @@
+package osimage
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ignite/config"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// BuiltInCatalog is the location reported for the compiled-in catalog
+const BuiltInCatalog = "built-in"
+
+// maxCatalogSize limits the size of a remote catalog or signature
+const maxCatalogSize = 1 << 20
+
+var (
+	osNamePattern  = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+	versionPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+)
+
+// catalogFile is a catalog file or remote catalog. Mirrors, which replace URL
+// prefixes, are only read from local files.
+type catalogFile struct {
+	Sources map[string]config.OSDefinition `json:"sources"`
+	Mirrors map[string]string              `json:"mirrors,omitempty"`
+}
+
+// CatalogSource reports what was loaded from one place in the catalog
+type CatalogSource struct {
+	Location string   `json:"location"`
+	OSes     []string `json:"oses,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// CatalogEntry summarises one OS in the merged catalog
+type CatalogEntry struct {
+	OS          string   `json:"os"`
+	DisplayName string   `json:"display_name"`
+	Versions    []string `json:"versions"`
+	Origin      string   `json:"origin"` // The last source that set the entry
+}
+
+// Catalog is the set of OS definitions images can be downloaded from. It
+// merges the built-in catalog with signed remote catalogs and then local
+// catalog files, so local files win.
+type Catalog struct {
+	builtIn map[string]config.OSDefinition
+	dir     string
+	urls    []string
+	keys    []ed25519.PublicKey
+	client  *http.Client
+
+	mu       sync.RWMutex
+	sources  map[string]config.OSDefinition
+	origins  map[string]string
+	mirrors  map[string]string
+	report   []CatalogSource
+	loadedAt time.Time
+}
+
+// NewCatalog creates a catalog holding the built-in definitions. Call Refresh
+// to load catalog files and remote catalogs.
+func NewCatalog(cfg config.OSImageConfig) *Catalog {
+	c := &Catalog{
+		builtIn: cfg.Sources,
+		dir:     cfg.CatalogDir,
+		urls:    cfg.CatalogURLs,
+		client:  &http.Client{Timeout: 30 * time.Second},
+		origins: make(map[string]string),
+	}
+	for _, key := range cfg.CatalogKeys {
+		// Keys are checked when the configuration is built
+		if decoded, err := base64.StdEncoding.DecodeString(key); err == nil && len(decoded) == ed25519.PublicKeySize {
+			c.keys = append(c.keys, ed25519.PublicKey(decoded))
+		}
+	}
+
+	c.sources = cfg.Sources
+	for name := range cfg.Sources {
+		c.origins[name] = BuiltInCatalog
+	}
+	c.report = []CatalogSource{{Location: BuiltInCatalog, OSes: sortedKeys(cfg.Sources)}}
+	c.loadedAt = time.Now()
+	return c
+}
+
+// Definition returns the definition of an OS
+func (c *Catalog) Definition(name string) (config.OSDefinition, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	def, ok := c.sources[name]
+	return def, ok
+}
+
+// Sources returns every OS definition. The map must not be modified.
+func (c *Catalog) Sources() map[string]config.OSDefinition {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.sources
+}
+
+// Entries summarises the catalog, sorted by OS
+func (c *Catalog) Entries() []CatalogEntry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entries := make([]CatalogEntry, 0, len(c.sources))
+	for _, name := range sortedKeys(c.sources) {
+		def := c.sources[name]
+		entry := CatalogEntry{OS: name, DisplayName: def.DisplayName, Origin: c.origins[name]}
+		if entry.DisplayName == "" {
+			entry.DisplayName = name
+		}
+		for version := range def.Versions {
+			entry.Versions = append(entry.Versions, version)
+		}
+		sort.Strings(entry.Versions)
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// Status returns what each source contributed at the last refresh, the mirror
+// overrides in use and when the catalog was loaded
+func (c *Catalog) Status() ([]CatalogSource, map[string]string, time.Time) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.report, c.mirrors, c.loadedAt
+}
+
+// Refresh reloads remote catalogs and catalog files and merges them over the
+// built-in catalog. Sources and entries that fail to load or validate are
+// skipped and reported; the rest of the catalog is still updated.
+func (c *Catalog) Refresh(ctx context.Context) error {
+	sources := make(map[string]config.OSDefinition, len(c.builtIn))
+	origins := make(map[string]string, len(c.builtIn))
+	for name, def := range c.builtIn {
+		sources[name] = def
+		origins[name] = BuiltInCatalog
+	}
+	mirrors := make(map[string]string)
+	report := []CatalogSource{{Location: BuiltInCatalog, OSes: sortedKeys(c.builtIn)}}
+	var errs []error
+
+	load := func(location string, file *catalogFile, err error) {
+		source := CatalogSource{Location: location}
+		var problems []string
+		if err != nil {
+			problems = append(problems, err.Error())
+		} else {
+			for _, name := range sortedKeys(file.Sources) {
+				merged := mergeDefinition(sources[name], file.Sources[name])
+				if err := validateDefinition(name, merged); err != nil {
+					problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+					continue
+				}
+				sources[name] = merged
+				origins[name] = location
+				source.OSes = append(source.OSes, name)
+			}
+		}
+		if len(problems) > 0 {
+			source.Error = strings.Join(problems, "; ")
+			errs = append(errs, fmt.Errorf("%s: %s", location, source.Error))
+		}
+		report = append(report, source)
+	}
+
+	for _, location := range c.urls {
+		file, err := c.fetchRemote(ctx, location)
+		if err == nil && len(file.Mirrors) > 0 {
+			err = fmt.Errorf("mirrors can only be set in local catalog files")
+		}
+		load(location, file, err)
+	}
+
+	files, err := catalogFiles(c.dir)
+	if err != nil {
+		report = append(report, CatalogSource{Location: c.dir, Error: err.Error()})
+		errs = append(errs, err)
+	}
+	for _, path := range files {
+		file, err := readCatalogFile(path)
+		if err == nil {
+			err = validateMirrors(file.Mirrors)
+		}
+		load(path, file, err)
+		if err == nil {
+			for prefix, replacement := range file.Mirrors {
+				mirrors[prefix] = replacement
+			}
+		}
+	}
+
+	for name, def := range sources {
+		sources[name] = applyMirrors(def, mirrors)
+	}
+
+	c.mu.Lock()
+	c.sources = sources
+	c.origins = origins
+	c.mirrors = mirrors
+	c.report = report
+	c.loadedAt = time.Now()
+	c.mu.Unlock()
+
+	return errors.Join(errs...)
+}
+
+// fetchRemote downloads a remote catalog and checks its detached signature
+func (c *Catalog) fetchRemote(ctx context.Context, location string) (*catalogFile, error) {
+	data, err := c.get(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+
+	sigURL, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid catalog URL: %w", err)
+	}
+	sigURL.Path += ".sig"
+	sig, err := c.get(ctx, sigURL.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch signature: %w", err)
+	}
+	if !c.verify(data, sig) {
+		return nil, fmt.Errorf("signature does not match any trusted catalog key")
+	}
+
+	return parseCatalog(data)
+}
+
+// get fetches a URL, refusing bodies larger than maxCatalogSize
+func (c *Catalog) get(ctx context.Context, location string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: HTTP %d", location, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCatalogSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxCatalogSize {
+		return nil, fmt.Errorf("%s: larger than %d bytes", location, maxCatalogSize)
+	}
+	return data, nil
+}
+
+// verify checks an ed25519 signature, raw or base64 encoded, against the
+// trusted keys
+func (c *Catalog) verify(data, sig []byte) bool {
+	if decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(sig))); err == nil {
+		sig = decoded
+	}
+	if len(sig) != ed25519.SignatureSize {
+		return false
+	}
+	for _, key := range c.keys {
+		if ed25519.Verify(key, data, sig) {
+			return true
+		}
+	}
+	return false
+}
+
+// catalogFiles lists the YAML and JSON files in dir in name order. A missing
+// directory holds no files.
+func catalogFiles(dir string) ([]string, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read catalog directory: %w", err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".yaml", ".yml", ".json":
+			if !entry.IsDir() {
+				files = append(files, filepath.Join(dir, entry.Name()))
+			}
+		}
+	}
+	return files, nil
+}
+
+// readCatalogFile reads and parses a local catalog file
+func readCatalogFile(path string) (*catalogFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseCatalog(data)
+}
+
+// parseCatalog parses a catalog written in YAML or JSON, rejecting unknown
+// fields so typos are reported instead of ignored
+func parseCatalog(data []byte) (*catalogFile, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid catalog: %w", err)
+	}
+	value, err := nodeValue(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid catalog: %w", err)
+	}
+
+	// The config types carry JSON tags, so YAML is decoded through JSON
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid catalog: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.DisallowUnknownFields()
+	var file catalogFile
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("invalid catalog: %w", err)
+	}
+	return &file, nil
+}
+
+// nodeValue converts a YAML node to values encoding/json can marshal. Mapping
+// keys are kept as written, so versions such as 10.0 are not read as numbers.
+func nodeValue(node *yaml.Node) (interface{}, error) {
+	switch node.Kind {
+	case 0:
+		return nil, nil
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+		return nodeValue(node.Content[0])
+	case yaml.AliasNode:
+		return nodeValue(node.Alias)
+	case yaml.MappingNode:
+		m := make(map[string]interface{}, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			value, err := nodeValue(node.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			m[node.Content[i].Value] = value
+		}
+		return m, nil
+	case yaml.SequenceNode:
+		list := make([]interface{}, 0, len(node.Content))
+		for _, item := range node.Content {
+			value, err := nodeValue(item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return list, nil
+	}
+
+	var value interface{}
+	if err := node.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// mergeDefinition lays over on top of base: fields set in over replace those
+// in base, and its versions are added to or replace base's
+func mergeDefinition(base, over config.OSDefinition) config.OSDefinition {
+	merged := base
+	if over.DisplayName != "" {
+		merged.DisplayName = over.DisplayName
+	}
+	if over.KernelFile != "" {
+		merged.KernelFile = over.KernelFile
+	}
+	if over.InitrdFile != "" {
+		merged.InitrdFile = over.InitrdFile
+	}
+	if len(over.Artifacts) > 0 {
+		merged.Artifacts = over.Artifacts
+	}
+
+	merged.Versions = make(map[string]config.OSVersion, len(base.Versions)+len(over.Versions))
+	for version, v := range base.Versions {
+		merged.Versions[version] = v
+	}
+	for version, v := range over.Versions {
+		merged.Versions[version] = v
+	}
+	return merged
+}
+
+// validateDefinition checks that an OS can be downloaded: its name and
+// versions are usable as directory names and every version has a valid
+// set of artifacts
+func validateDefinition(name string, def config.OSDefinition) error {
+	if !osNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid OS name, use lowercase letters, digits, '.', '_' and '-'")
+	}
+	if len(def.Versions) == 0 {
+		return fmt.Errorf("no versions")
+	}
+	for _, version := range sortedKeys(def.Versions) {
+		if !versionPattern.MatchString(version) {
+			return fmt.Errorf("invalid version %q", version)
+		}
+		if _, err := def.VersionArtifacts(version); err != nil {
+			return fmt.Errorf("version %s: %w", version, err)
+		}
+	}
+	return nil
+}
+
+// validateMirrors checks that mirror overrides replace URL prefixes with
+// HTTP or HTTPS URLs
+func validateMirrors(mirrors map[string]string) error {
+	for prefix, replacement := range mirrors {
+		if prefix == "" {
+			return fmt.Errorf("mirror prefix cannot be empty")
+		}
+		u, err := url.Parse(replacement)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid mirror URL %q for %s", replacement, prefix)
+		}
+	}
+	return nil
+}
+
+// applyMirrors rewrites a definition's base and artifact URLs using the
+// longest matching mirror prefix
+func applyMirrors(def config.OSDefinition, mirrors map[string]string) config.OSDefinition {
+	if len(mirrors) == 0 {
+		return def
+	}
+	rewrite := func(location string) string {
+		best := ""
+		for prefix := range mirrors {
+			if strings.HasPrefix(location, prefix) && len(prefix) > len(best) {
+				best = prefix
+			}
+		}
+		if best == "" {
+			return location
+		}
+		return mirrors[best] + strings.TrimPrefix(location, best)
+	}
+	rewriteArtifacts := func(artifacts []config.Artifact) []config.Artifact {
+		if artifacts == nil {
+			return nil
+		}
+		rewritten := make([]config.Artifact, len(artifacts))
+		for i, a := range artifacts {
+			if a.URL != "" {
+				a.URL = rewrite(a.URL)
+			}
+			rewritten[i] = a
+		}
+		return rewritten
+	}
+
+	def.Artifacts = rewriteArtifacts(def.Artifacts)
+	versions := make(map[string]config.OSVersion, len(def.Versions))
+	for version, v := range def.Versions {
+		v.BaseURL = rewrite(v.BaseURL)
+		v.Artifacts = rewriteArtifacts(v.Artifacts)
+		versions[version] = v
+	}
+	def.Versions = versions
+	return def
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,183 @@
+package osimage
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ignite/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const rockyCatalog = `sources:
+  rocky:
+    display_name: Rocky Linux
+    artifacts:
+      - {name: vmlinuz, role: kernel}
+      - {name: initrd.img, role: initrd}
+      - {name: ../install.img, role: stage2}
+    versions:
+      10.0:
+        display_name: "10.0"
+        base_url: https://dl.rockylinux.org/pub/rocky/10.0/BaseOS/x86_64/os/images/pxeboot/
+        architectures: [x86_64]
+`
+
+func builtInCatalog() config.OSImageConfig {
+	return config.OSImageConfig{
+		Sources: map[string]config.OSDefinition{
+			"ubuntu": {
+				DisplayName: "Ubuntu",
+				Artifacts: []config.Artifact{
+					{Name: "vmlinuz", Role: config.RoleKernel},
+					{Name: "initrd", Dest: "initrd.img", Role: config.RoleInitrd},
+				},
+				Versions: map[string]config.OSVersion{
+					"24.04": {BaseURL: "https://releases.ubuntu.com/24.04/netboot/", Architectures: []string{"x86_64"}},
+				},
+			},
+		},
+	}
+}
+
+func writeCatalogFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+}
+
+func TestCatalog_LocalFiles(t *testing.T) {
+	cfg := builtInCatalog()
+	cfg.CatalogDir = t.TempDir()
+	writeCatalogFile(t, cfg.CatalogDir, "10-rocky.yaml", rockyCatalog)
+	writeCatalogFile(t, cfg.CatalogDir, "20-ubuntu.json",
+		`{"sources":{"ubuntu":{"versions":{"22.04":{"base_url":"https://releases.ubuntu.com/22.04/netboot/"}}}}}`)
+	writeCatalogFile(t, cfg.CatalogDir, "notes.txt", "not a catalog")
+
+	catalog := NewCatalog(cfg)
+	require.NoError(t, catalog.Refresh(context.Background()))
+
+	rocky, ok := catalog.Definition("rocky")
+	require.True(t, ok)
+	artifacts, err := rocky.VersionArtifacts("10.0")
+	require.NoError(t, err, "version keys are kept as written")
+	assert.Equal(t, "https://dl.rockylinux.org/pub/rocky/10.0/BaseOS/x86_64/os/images/install.img", artifacts[2].URL)
+
+	// Files add versions to built-in OSes without repeating their artifacts
+	ubuntu, _ := catalog.Definition("ubuntu")
+	assert.Len(t, ubuntu.Versions, 2)
+	assert.Equal(t, "Ubuntu", ubuntu.DisplayName)
+	_, err = ubuntu.VersionArtifacts("22.04")
+	assert.NoError(t, err)
+
+	entries := catalog.Entries()
+	require.Len(t, entries, 2)
+	assert.Equal(t, "rocky", entries[0].OS)
+	assert.Equal(t, filepath.Join(cfg.CatalogDir, "10-rocky.yaml"), entries[0].Origin)
+	assert.Equal(t, []string{"22.04", "24.04"}, entries[1].Versions)
+}
+
+func TestCatalog_InvalidEntriesAreSkipped(t *testing.T) {
+	cfg := builtInCatalog()
+	cfg.CatalogDir = t.TempDir()
+	writeCatalogFile(t, cfg.CatalogDir, "bad.yaml", `sources:
+  Rocky Linux:
+    versions: {"9": {base_url: "https://example.com/"}}
+  alma:
+    artifacts: [{name: initrd.img, role: initrd}]
+    versions: {"9": {base_url: "https://example.com/"}}
+  ubuntu:
+    versions: {"../etc": {base_url: "https://example.com/"}}
+`)
+	writeCatalogFile(t, cfg.CatalogDir, "typo.yaml", "sources:\n  rocky:\n    versoins: {}\n")
+
+	catalog := NewCatalog(cfg)
+	err := catalog.Refresh(context.Background())
+	require.Error(t, err)
+
+	assert.Len(t, catalog.Sources(), 1, "only the built-in OS remains")
+	ubuntu, _ := catalog.Definition("ubuntu")
+	assert.Len(t, ubuntu.Versions, 1)
+
+	sources, _, _ := catalog.Status()
+	require.Len(t, sources, 3)
+	assert.Contains(t, sources[1].Error, "alma")
+	assert.Contains(t, sources[1].Error, "kernel")
+	assert.Contains(t, sources[2].Error, "versoins")
+}
+
+func TestCatalog_Mirrors(t *testing.T) {
+	cfg := builtInCatalog()
+	cfg.CatalogDir = t.TempDir()
+	writeCatalogFile(t, cfg.CatalogDir, "mirrors.yaml", `mirrors:
+  https://releases.ubuntu.com/: http://mirror.lan/ubuntu/
+  https://releases.ubuntu.com/24.04/: http://mirror.lan/noble/
+`)
+
+	catalog := NewCatalog(cfg)
+	require.NoError(t, catalog.Refresh(context.Background()))
+
+	ubuntu, _ := catalog.Definition("ubuntu")
+	assert.Equal(t, "http://mirror.lan/noble/netboot/", ubuntu.Versions["24.04"].BaseURL, "the longest prefix wins")
+
+	_, mirrors, _ := catalog.Status()
+	assert.Len(t, mirrors, 2)
+
+	writeCatalogFile(t, cfg.CatalogDir, "mirrors.yaml", "mirrors:\n  https://releases.ubuntu.com/: ftp://mirror.lan/\n")
+	assert.Error(t, catalog.Refresh(context.Background()))
+	ubuntu, _ = catalog.Definition("ubuntu")
+	assert.Equal(t, "https://releases.ubuntu.com/24.04/netboot/", ubuntu.Versions["24.04"].BaseURL)
+}
+
+func TestCatalog_RemoteSignature(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	_, otherKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	files := map[string][]byte{
+		"/signed.yaml":       []byte(rockyCatalog),
+		"/forged.yaml":       []byte(rockyCatalog),
+		"/mirrors.yaml":      []byte("mirrors:\n  https://dl.rockylinux.org/: http://evil.example/\n"),
+		"/unsigned.yaml":     []byte(rockyCatalog),
+		"/signed.yaml.sig":   []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(private, []byte(rockyCatalog)))),
+		"/forged.yaml.sig":   ed25519.Sign(otherKey, []byte(rockyCatalog)),
+		"/mirrors.yaml.sig":  ed25519.Sign(private, []byte("mirrors:\n  https://dl.rockylinux.org/: http://evil.example/\n")),
+		"/unsigned.yaml.sig": nil,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Path]
+		if !ok || content == nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(content)
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := builtInCatalog()
+	cfg.CatalogKeys = []string{base64.StdEncoding.EncodeToString(public)}
+	cfg.CatalogURLs = []string{server.URL + "/signed.yaml"}
+	catalog := NewCatalog(cfg)
+	require.NoError(t, catalog.Refresh(context.Background()))
+	_, ok := catalog.Definition("rocky")
+	assert.True(t, ok)
+
+	for _, name := range []string{"forged.yaml", "mirrors.yaml", "unsigned.yaml"} {
+		t.Run(name, func(t *testing.T) {
+			cfg.CatalogURLs = []string{server.URL + "/" + name}
+			catalog := NewCatalog(cfg)
+			assert.Error(t, catalog.Refresh(context.Background()))
+			_, ok := catalog.Definition("rocky")
+			assert.False(t, ok)
+			_, mirrors, _ := catalog.Status()
+			assert.Empty(t, mirrors)
+		})
+	}
+}
@@ -0,0 +1,371 @@
+package osimage
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxBackoff caps the delay between retries of a failed transfer
+const maxBackoff = time.Minute
+
+// partSuffix is added to files while they are downloaded, so a transfer
+// interrupted by a failure or restart can be resumed
+const partSuffix = ".part"
+
+// validatorSuffix is added to a partial file's name for the ETag or
+// Last-Modified time of the file it holds the start of, so it is only resumed
+// while the server still has that file
+const validatorSuffix = ".validator"
+
+// permanentError is a download failure that retrying will not fix
+type permanentError struct {
+	error
+}
+
+// downloader fetches artifacts over HTTP, resuming partial files with Range
+// requests and retrying failed transfers with exponential backoff
+type downloader struct {
+	client  *http.Client
+	retries int
+	backoff time.Duration // Delay before the first retry, doubled for each further retry
+	stall   time.Duration // A transfer that receives nothing for this long is retried
+}
+
+// newDownloader creates a downloader retrying each transfer up to retries times
+func newDownloader(retries int) *downloader {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = 30 * time.Second
+	return &downloader{
+		client:  &http.Client{Transport: transport},
+		retries: retries,
+		backoff: time.Second,
+		stall:   time.Minute,
+	}
+}
+
+// size returns the size of the file at url, or -1 if the server does not say
+func (d *downloader) size(ctx context.Context, url string) int64 {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return -1
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return -1
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return -1
+	}
+	return resp.ContentLength
+}
+
+// fetch downloads url to dest, through dest.part, and returns the file's size
+// and SHA-256 checksum. progress is called with the bytes held so far and the
+// file's size, or -1 while it is unknown.
+func (d *downloader) fetch(ctx context.Context, url, dest string, progress func(done, total int64)) (int64, string, error) {
+	part := dest + partSuffix
+	for attempt := 0; ; attempt++ {
+		err := d.fetchOnce(ctx, url, part, progress)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return 0, "", ctx.Err()
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) || attempt >= d.retries {
+			return 0, "", err
+		}
+
+		delay := d.backoff << attempt
+		if delay > maxBackoff || delay <= 0 {
+			delay = maxBackoff
+		}
+		log.Printf("Download of %s failed, retrying in %s: %v", url, delay, err)
+		select {
+		case <-ctx.Done():
+			return 0, "", ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+
+	size, checksum, err := hashFile(part)
+	if err != nil {
+		return 0, "", err
+	}
+	if err := os.Rename(part, dest); err != nil {
+		return 0, "", err
+	}
+	os.Remove(part + validatorSuffix)
+	return size, checksum, nil
+}
+
+// fetchOnce makes one attempt at completing part, resuming from its current
+// size if the server's file is unchanged since part was started
+func (d *downloader) fetchOnce(ctx context.Context, url, part string, progress func(done, total int64)) error {
+	file, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return &permanentError{err}
+	}
+	defer file.Close()
+
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	reqCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, url, nil)
+	if err != nil {
+		return &permanentError{err}
+	}
+	validatorPath := part + validatorSuffix
+	validator, _ := os.ReadFile(validatorPath)
+	if offset > 0 && len(validator) == 0 {
+		// Without a validator the file may have been replaced since, so
+		// start over rather than splice two files together
+		if err := restart(file); err != nil {
+			return err
+		}
+		offset = 0
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", string(validator))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	total := int64(-1)
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, size, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			// Start over rather than guess where the data belongs
+			file.Truncate(0)
+			return fmt.Errorf("unexpected Content-Range %q resuming at byte %d", resp.Header.Get("Content-Range"), offset)
+		}
+		if current := rangeValidator(resp); current != string(validator) {
+			// The server ignored If-Range for a file that has changed
+			file.Truncate(0)
+			return fmt.Errorf("%s changed while resuming at byte %d", url, offset)
+		}
+		total = size
+	case http.StatusOK:
+		// The server ignored the range or the file has changed, so it is
+		// sent from the start
+		if offset > 0 {
+			if err := restart(file); err != nil {
+				return err
+			}
+			offset = 0
+		}
+		if current := rangeValidator(resp); current != "" {
+			if err := os.WriteFile(validatorPath, []byte(current), 0644); err != nil {
+				return &permanentError{err}
+			}
+		} else {
+			os.Remove(validatorPath)
+		}
+		total = resp.ContentLength
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The partial file may already be complete
+		if _, size, ok := parseContentRange(resp.Header.Get("Content-Range")); ok && size == offset {
+			progress(offset, offset)
+			return nil
+		}
+		file.Truncate(0)
+		return fmt.Errorf("server refused to resume at byte %d", offset)
+	default:
+		err := fmt.Errorf("download failed: %s", resp.Status)
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+			resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+			return &permanentError{err}
+		}
+		return err
+	}
+	progress(offset, total)
+
+	// Abort the request if the transfer stalls; it is then retried
+	timer := time.AfterFunc(d.stall, cancel)
+	defer timer.Stop()
+
+	buf := make([]byte, 64<<10)
+	for {
+		n, readErr := resp.Body.Read(buf)
+		if n > 0 {
+			timer.Reset(d.stall)
+			if _, err := file.Write(buf[:n]); err != nil {
+				return &permanentError{err}
+			}
+			offset += int64(n)
+			progress(offset, total)
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			if ctx.Err() == nil && reqCtx.Err() != nil {
+				return fmt.Errorf("transfer stalled for %s", d.stall)
+			}
+			return readErr
+		}
+	}
+
+	if total >= 0 && offset != total {
+		return fmt.Errorf("transfer ended at byte %d of %d", offset, total)
+	}
+	return nil
+}
+
+// restart empties a partial file so it is written from the start
+func restart(file *os.File) error {
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	_, err := file.Seek(0, io.SeekStart)
+	return err
+}
+
+// rangeValidator returns the value a request resuming the response's file
+// sends as If-Range: its strong ETag, or else its Last-Modified time. It is
+// empty if the server gives neither.
+func rangeValidator(resp *http.Response) string {
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return resp.Header.Get("Last-Modified")
+}
+
+// parseContentRange parses a Content-Range header such as "bytes 0-99/200"
+// or "bytes */200". start is -1 for an unsatisfied range and size is -1 when
+// the server does not give it.
+func parseContentRange(header string) (start, size int64, ok bool) {
+	spec, found := strings.CutPrefix(header, "bytes ")
+	if !found {
+		return 0, 0, false
+	}
+	byteRange, sizeText, found := strings.Cut(spec, "/")
+	if !found {
+		return 0, 0, false
+	}
+
+	size = -1
+	if sizeText != "*" {
+		parsed, err := strconv.ParseInt(sizeText, 10, 64)
+		if err != nil {
+			return 0, 0, false
+		}
+		size = parsed
+	}
+
+	if byteRange == "*" {
+		return -1, size, true
+	}
+	startText, _, found := strings.Cut(byteRange, "-")
+	if !found {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(startText, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return start, size, true
+}
+
+// hashFile returns the size and SHA-256 checksum of a file
+func hashFile(path string) (int64, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// downloadProgress tracks the bytes transferred for each artifact of a
+// download
+type downloadProgress struct {
+	done  []int64
+	sizes []int64 // -1 while unknown
+}
+
+// newDownloadProgress creates a tracker for n artifacts of unknown size
+func newDownloadProgress(n int) *downloadProgress {
+	p := &downloadProgress{done: make([]int64, n), sizes: make([]int64, n)}
+	for i := range p.sizes {
+		p.sizes[i] = -1
+	}
+	return p
+}
+
+// setSize records the size of artifact i, if known
+func (p *downloadProgress) setSize(i int, size int64) {
+	if size >= 0 {
+		p.sizes[i] = size
+	}
+}
+
+// update records the bytes held of artifact i and, if known, its size
+func (p *downloadProgress) update(i int, done, size int64) {
+	p.done[i] = done
+	p.setSize(i, size)
+}
+
+// report returns the percentage complete and the bytes transferred. The total
+// is 0 while any artifact's size is unknown; the percentage then counts
+// artifacts of unknown size only once they are complete. It stays below 100
+// until the download is recorded as complete.
+func (p *downloadProgress) report() (percent int, done, total int64) {
+	known := true
+	var fraction float64
+	for i := range p.done {
+		done += p.done[i]
+		if p.sizes[i] < 0 {
+			known = false
+			continue
+		}
+		total += p.sizes[i]
+		if p.sizes[i] == 0 {
+			fraction += 1
+		} else {
+			fraction += float64(p.done[i]) / float64(p.sizes[i])
+		}
+	}
+
+	switch {
+	case known && total > 0:
+		percent = int(done * 100 / total)
+	case len(p.done) > 0:
+		percent = int(fraction * 100 / float64(len(p.done)))
+	}
+	if !known {
+		total = 0
+	}
+	if percent > 99 {
+		percent = 99
+	}
+	return percent, done, total
+}
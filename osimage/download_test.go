@@ -0,0 +1,299 @@
+package osimage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ignite/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var testContent = bytes.Repeat([]byte("0123456789"), 1000)
+
+// testDownloader returns a downloader that retries without waiting
+func testDownloader(retries int) *downloader {
+	d := newDownloader(retries)
+	d.backoff = time.Millisecond
+	return d
+}
+
+// testETag identifies testContent to If-Range
+const testETag = `"v1"`
+
+// serveContent serves testContent with Range support
+func serveContent(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("ETag", testETag)
+	http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(testContent))
+}
+
+func TestDownloader_ResumesPartialFile(t *testing.T) {
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		assert.Equal(t, testETag, r.Header.Get("If-Range"))
+		serveContent(w, r)
+	}))
+	defer server.Close()
+
+	dest := filepath.Join(t.TempDir(), "vmlinuz")
+	require.NoError(t, os.WriteFile(dest+partSuffix, testContent[:4000], 0644))
+	require.NoError(t, os.WriteFile(dest+partSuffix+validatorSuffix, []byte(testETag), 0644))
+
+	var lastDone, lastTotal int64
+	size, checksum, err := testDownloader(0).fetch(context.Background(), server.URL, dest, func(done, total int64) {
+		lastDone, lastTotal = done, total
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"bytes=4000-"}, ranges)
+	assert.Equal(t, int64(len(testContent)), size)
+	assert.Equal(t, fmt.Sprintf("%x", sha256.Sum256(testContent)), checksum)
+	assert.Equal(t, int64(len(testContent)), lastDone)
+	assert.Equal(t, int64(len(testContent)), lastTotal)
+
+	content, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	assert.Equal(t, testContent, content)
+	assert.NoFileExists(t, dest+partSuffix)
+	assert.NoFileExists(t, dest+partSuffix+validatorSuffix)
+}
+
+func TestDownloader_RestartsWhenFileChanged(t *testing.T) {
+	for name, validator := range map[string]string{
+		"Changed ETag": `"v0"`,
+		"No validator": "",
+	} {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(serveContent))
+			defer server.Close()
+
+			// The start of an older file that has since been replaced
+			dest := filepath.Join(t.TempDir(), "ubuntu.iso")
+			require.NoError(t, os.WriteFile(dest+partSuffix, bytes.Repeat([]byte("x"), 4000), 0644))
+			if validator != "" {
+				require.NoError(t, os.WriteFile(dest+partSuffix+validatorSuffix, []byte(validator), 0644))
+			}
+
+			_, _, err := testDownloader(0).fetch(context.Background(), server.URL, dest, func(done, total int64) {})
+			require.NoError(t, err)
+			content, err := os.ReadFile(dest)
+			require.NoError(t, err)
+			assert.Equal(t, testContent, content)
+		})
+	}
+}
+
+func TestDownloader_RecordsValidator(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", testETag)
+		w.Header().Set("Content-Length", fmt.Sprint(len(testContent)))
+		w.Write(testContent[:1000])
+	}))
+	defer server.Close()
+
+	// The transfer ends early, leaving a partial file to resume
+	dest := filepath.Join(t.TempDir(), "vmlinuz")
+	_, _, err := testDownloader(0).fetch(context.Background(), server.URL, dest, func(done, total int64) {})
+	require.Error(t, err)
+	validator, err := os.ReadFile(dest + partSuffix + validatorSuffix)
+	require.NoError(t, err)
+	assert.Equal(t, testETag, string(validator))
+}
+
+func TestDownloader_RestartsWhenRangeIgnored(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(testContent)
+	}))
+	defer server.Close()
+
+	dest := filepath.Join(t.TempDir(), "initrd.img")
+	require.NoError(t, os.WriteFile(dest+partSuffix, []byte("stale data"), 0644))
+
+	_, _, err := testDownloader(0).fetch(context.Background(), server.URL, dest, func(done, total int64) {})
+	require.NoError(t, err)
+	content, _ := os.ReadFile(dest)
+	assert.Equal(t, testContent, content)
+}
+
+func TestDownloader_Retries(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= 2 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		serveContent(w, r)
+	}))
+	defer server.Close()
+
+	dest := filepath.Join(t.TempDir(), "vmlinuz")
+	_, _, err := testDownloader(1).fetch(context.Background(), server.URL, dest, func(done, total int64) {})
+	assert.Error(t, err, "two failures exceed one retry")
+
+	requests.Store(0)
+	_, _, err = testDownloader(2).fetch(context.Background(), server.URL, dest, func(done, total int64) {})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), requests.Load())
+}
+
+func TestDownloader_DoesNotRetryClientErrors(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	_, _, err := testDownloader(5).fetch(context.Background(), server.URL, filepath.Join(t.TempDir(), "vmlinuz"), func(done, total int64) {})
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+func TestDownloader_RetriesStalledTransfer(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			// Send part of the file, then go quiet
+			w.Header().Set("ETag", testETag)
+			w.Header().Set("Content-Length", fmt.Sprint(len(testContent)))
+			w.Write(testContent[:1000])
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		assert.Equal(t, "bytes=1000-", r.Header.Get("Range"))
+		serveContent(w, r)
+	}))
+	defer server.Close()
+
+	d := testDownloader(1)
+	d.stall = 50 * time.Millisecond
+	dest := filepath.Join(t.TempDir(), "vmlinuz")
+	_, _, err := d.fetch(context.Background(), server.URL, dest, func(done, total int64) {})
+	require.NoError(t, err)
+	content, _ := os.ReadFile(dest)
+	assert.Equal(t, testContent, content)
+}
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		header      string
+		start, size int64
+		ok          bool
+	}{
+		{"bytes 100-199/200", 100, 200, true},
+		{"bytes 0-99/*", 0, -1, true},
+		{"bytes */200", -1, 200, true},
+		{"items 0-1/2", 0, 0, false},
+		{"bytes 0-99", 0, 0, false},
+	}
+	for _, tt := range tests {
+		start, size, ok := parseContentRange(tt.header)
+		if ok != tt.ok || (ok && (start != tt.start || size != tt.size)) {
+			t.Errorf("parseContentRange(%q) = %d, %d, %v", tt.header, start, size, ok)
+		}
+	}
+}
+
+func TestDownloadProgress(t *testing.T) {
+	p := newDownloadProgress(2)
+	p.setSize(0, 100)
+	p.setSize(1, 300)
+	p.update(0, 100, 100)
+	p.update(1, 100, 300)
+	percent, done, total := p.report()
+	assert.Equal(t, 50, percent)
+	assert.Equal(t, int64(200), done)
+	assert.Equal(t, int64(400), total)
+
+	p.update(1, 300, 300)
+	percent, _, _ = p.report()
+	assert.Equal(t, 99, percent, "100% is reported once the image is saved")
+
+	// Artifacts of unknown size count once complete
+	p = newDownloadProgress(2)
+	p.update(0, 50, 50)
+	p.update(1, 10, -1)
+	percent, done, total = p.report()
+	assert.Equal(t, 50, percent)
+	assert.Equal(t, int64(60), done)
+	assert.Zero(t, total)
+}
+
+func TestCancelDownload_AbortsTransfer(t *testing.T) {
+	started := make(chan struct{})
+	aborted := make(chan struct{})
+	var once sync.Once
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.Header().Set("Content-Length", fmt.Sprint(len(testContent)))
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(testContent)))
+		w.Write(testContent[:1000])
+		w.(http.Flusher).Flush()
+		once.Do(func() { close(started) })
+		<-r.Context().Done()
+		close(aborted)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		TFTP: config.TFTPConfig{Dir: t.TempDir()},
+		OSImages: config.OSImageConfig{
+			DownloadRetries: 3,
+			Sources: map[string]config.OSDefinition{
+				"testos": {
+					Artifacts: []config.Artifact{{Name: "vmlinuz", Role: config.RoleKernel}},
+					Versions:  map[string]config.OSVersion{"1": {BaseURL: server.URL + "/"}},
+				},
+			},
+		},
+	}
+	status := &DownloadStatus{ID: "download-1", OS: "testos", Version: "1", Status: "queued"}
+	mockRepo := &MockOSImageRepository{}
+	mockDownloadRepo := &MockDownloadStatusRepository{}
+	mockDownloadRepo.On("Get", mock.Anything, "download-1").Return(status, nil)
+	mockDownloadRepo.On("Save", mock.Anything, mock.Anything).Return(nil)
+	service := createTestService(mockRepo, mockDownloadRepo, cfg)
+
+	require.NoError(t, service.enqueue(status))
+	done := make(chan struct{})
+	go func() {
+		service.processDownload(<-service.queue)
+		close(done)
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("transfer did not start")
+	}
+	require.NoError(t, service.CancelDownload(context.Background(), status.ID))
+
+	for name, ch := range map[string]chan struct{}{"transfer": aborted, "download": done} {
+		select {
+		case <-ch:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s was not aborted", name)
+		}
+	}
+
+	assert.Equal(t, "cancelled", status.Status)
+	assert.NoFileExists(t, filepath.Join(cfg.TFTP.Dir, "testos", "1", "vmlinuz"+partSuffix))
+	mockRepo.AssertNotCalled(t, "Save", mock.Anything, mock.Anything)
+	assert.Empty(t, service.cancels)
+}
@@ -1,24 +1,93 @@
 package osimage
 
 import (
+	"ignite/config"
+	"strings"
 	"time"
 )
 
-// OSImage represents a bootable OS kernel and initrd combination
+// OSImage represents a bootable OS: a kernel, its initrds and any other
+// artifacts it needs at boot
 type OSImage struct {
-	ID           string    `json:"id"`
-	OS           string    `json:"os"`           // ubuntu, centos, nixos
-	Version      string    `json:"version"`      // 22.04, 8, 23.11
-	Architecture string    `json:"architecture"` // x86_64, arm64
-	KernelPath   string    `json:"kernel_path"`  // ubuntu/22.04/vmlinuz
-	InitrdPath   string    `json:"initrd_path"`  // ubuntu/22.04/initrd.img
-	KernelSize   int64     `json:"kernel_size"`  // Size in bytes
-	InitrdSize   int64     `json:"initrd_size"`  // Size in bytes
-	Checksum     string    `json:"checksum"`     // SHA256 verification
-	Active       bool      `json:"active"`       // Default version for OS
-	DownloadURL  string    `json:"download_url"` // Original download URL
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID           string          `json:"id"`
+	OS           string          `json:"os"`                  // ubuntu, centos, nixos
+	Version      string          `json:"version"`             // 22.04, 8, 23.11
+	Architecture string          `json:"architecture"`        // x86_64, arm64
+	KernelPath   string          `json:"kernel_path"`         // ubuntu/22.04/vmlinuz
+	InitrdPath   string          `json:"initrd_path"`         // ubuntu/22.04/initrd.img, the first initrd
+	KernelSize   int64           `json:"kernel_size"`         // Size in bytes
+	InitrdSize   int64           `json:"initrd_size"`         // Size in bytes
+	Artifacts    []ImageArtifact `json:"artifacts,omitempty"` // Every downloaded file, by role
+	Checksum     string          `json:"checksum"`            // SHA256 verification
+	Active       bool            `json:"active"`              // Default version for OS
+	DownloadURL  string          `json:"download_url"`        // Original download URL
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+}
+
+// ImageArtifact is a downloaded file of an OS image
+type ImageArtifact struct {
+	Role     string `json:"role"`     // kernel, initrd, squashfs, rootfs, stage2
+	Path     string `json:"path"`     // Relative to the TFTP directory
+	Size     int64  `json:"size"`     // Size in bytes
+	Checksum string `json:"checksum"` // SHA256 of the file
+	URL      string `json:"url"`      // Where it was downloaded from
+}
+
+// bootArgs maps artifact roles to the kernel argument that points the
+// installer at them over HTTP
+var bootArgs = map[string]string{
+	config.RoleSquashfs: "fetch",
+	config.RoleRootfs:   "coreos.live.rootfs_url",
+	config.RoleStage2:   "inst.stage2",
+}
+
+// ImageArtifacts returns the image's artifacts. Images downloaded before
+// artifacts were recorded report their kernel and initrd.
+func (i *OSImage) ImageArtifacts() []ImageArtifact {
+	if len(i.Artifacts) > 0 {
+		return i.Artifacts
+	}
+
+	var artifacts []ImageArtifact
+	if i.KernelPath != "" {
+		artifacts = append(artifacts, ImageArtifact{Role: config.RoleKernel, Path: i.KernelPath, Size: i.KernelSize})
+	}
+	if i.InitrdPath != "" {
+		artifacts = append(artifacts, ImageArtifact{Role: config.RoleInitrd, Path: i.InitrdPath, Size: i.InitrdSize})
+	}
+	return artifacts
+}
+
+// Paths returns the paths of the image's artifacts with role, in order
+func (i *OSImage) Paths(role string) []string {
+	var paths []string
+	for _, a := range i.ImageArtifacts() {
+		if a.Role == role {
+			paths = append(paths, a.Path)
+		}
+	}
+	return paths
+}
+
+// Path returns the path of the image's first artifact with role, or an empty string
+func (i *OSImage) Path(role string) string {
+	if paths := i.Paths(role); len(paths) > 0 {
+		return paths[0]
+	}
+	return ""
+}
+
+// BootArgs returns the kernel arguments that load the image's squashfs,
+// rootfs and stage2 artifacts from bootURL, as returned by bootmenu.BootURL
+func (i *OSImage) BootArgs(bootURL string) string {
+	var args []string
+	for _, a := range i.ImageArtifacts() {
+		if arg, ok := bootArgs[a.Role]; ok {
+			args = append(args, arg+"="+bootURL+"/"+a.Path)
+		}
+	}
+	return strings.Join(args, " ")
 }
 
 // OSImageConfig holds configuration for downloading OS images
@@ -34,8 +103,10 @@ type DownloadStatus struct {
 	ID           string     `json:"id"`
 	OS           string     `json:"os"`
 	Version      string     `json:"version"`
-	Status       string     `json:"status"`   // downloading, completed, failed
+	Status       string     `json:"status"`   // queued, downloading, completed, failed, cancelled
 	Progress     int        `json:"progress"` // Percentage 0-100
+	BytesDone    int64      `json:"bytes_done"`
+	BytesTotal   int64      `json:"bytes_total,omitempty"` // 0 while the size of an artifact is unknown
 	ErrorMessage string     `json:"error_message,omitempty"`
 	StartedAt    time.Time  `json:"started_at"`
 	CompletedAt  *time.Time `json:"completed_at,omitempty"`
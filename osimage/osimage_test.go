@@ -2,7 +2,13 @@ package osimage
 
 import (
 	"context"
+	"crypto/sha256"
 	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -10,6 +16,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // MockOSImageRepository is a mock implementation of OSImageRepository
@@ -141,17 +148,16 @@ func createTestConfig() *config.Config {
 	}
 }
 
-// Helper function to create a service without starting the background worker
+// Helper function to create a service without starting the background workers
 func createTestService(mockRepo *MockOSImageRepository, mockDownloadRepo *MockDownloadStatusRepository, config *config.Config) *OSImageServiceImpl {
-	service := &OSImageServiceImpl{
-		repo:            mockRepo,
-		downloadRepo:    mockDownloadRepo,
-		config:          config,
-		downloadChan:    make(chan OSImageConfig, 10),
-		activeDownloads: make(map[string]*DownloadStatus),
-	}
-	// Don't start the background worker for tests
-	return service
+	return newOSImageService(mockRepo, mockDownloadRepo, config, NewCatalog(config.OSImages))
+}
+
+// runDownload queues a download and processes it as a worker would
+func runDownload(t *testing.T, service *OSImageServiceImpl, status *DownloadStatus) {
+	t.Helper()
+	require.NoError(t, service.enqueue(status))
+	service.processDownload(<-service.queue)
 }
 
 // Test OSImageServiceImpl creation
@@ -164,7 +170,7 @@ func TestNewOSImageService(t *testing.T) {
 	// but we need to mock the calls it will make
 	mockDownloadRepo.On("GetActive", mock.Anything).Return([]*DownloadStatus{}, nil).Maybe()
 
-	service := NewOSImageService(mockRepo, mockDownloadRepo, config)
+	service := NewOSImageService(mockRepo, mockDownloadRepo, config, NewCatalog(config.OSImages))
 
 	assert.NotNil(t, service)
 
@@ -174,8 +180,8 @@ func TestNewOSImageService(t *testing.T) {
 	assert.Equal(t, mockRepo, impl.repo)
 	assert.Equal(t, mockDownloadRepo, impl.downloadRepo)
 	assert.Equal(t, config, impl.config)
-	assert.NotNil(t, impl.downloadChan)
-	assert.NotNil(t, impl.activeDownloads)
+	assert.NotNil(t, impl.queue)
+	assert.NotNil(t, impl.pending)
 }
 
 // Test GetAllOSImages
@@ -350,8 +356,8 @@ func TestDownloadOSImage_Valid(t *testing.T) {
 	// Mock that the OS/version doesn't exist yet
 	mockRepo.On("GetByOSAndVersion", ctx, osConfig.OS, osConfig.Version).Return(nil, errors.New("not found"))
 
-	// Mock saving the download status twice (queued, then downloading)
-	mockDownloadRepo.On("Save", ctx, mock.AnythingOfType("*osimage.DownloadStatus")).Return(nil).Twice()
+	// Mock saving the queued download status
+	mockDownloadRepo.On("Save", ctx, mock.AnythingOfType("*osimage.DownloadStatus")).Return(nil).Once()
 
 	status, err := service.DownloadOSImage(ctx, osConfig)
 
@@ -359,8 +365,13 @@ func TestDownloadOSImage_Valid(t *testing.T) {
 	assert.NotNil(t, status)
 	assert.Equal(t, osConfig.OS, status.OS)
 	assert.Equal(t, osConfig.Version, status.Version)
-	assert.Equal(t, "downloading", status.Status)
+	assert.Equal(t, "queued", status.Status)
 	assert.False(t, status.StartedAt.IsZero())
+	assert.Equal(t, status.ID, <-service.queue)
+
+	// A second download of the same version is refused while the first is queued
+	_, err = service.DownloadOSImage(ctx, osConfig)
+	assert.Error(t, err)
 
 	mockRepo.AssertExpectations(t)
 	mockDownloadRepo.AssertExpectations(t)
@@ -638,3 +649,160 @@ func TestDownloadStatus(t *testing.T) {
 	assert.NotNil(t, status.CompletedAt)
 	assert.True(t, status.CompletedAt.After(status.StartedAt))
 }
+
+// newArtifactDownload sets up a download of an OS whose artifacts are served
+// by a test server, returning the service, the download's status and the
+// number of times each file was fetched
+func newArtifactDownload(t *testing.T, kernelChecksum string) (*OSImageServiceImpl, *MockOSImageRepository, *DownloadStatus, map[string]int) {
+	t.Helper()
+
+	files := map[string]string{
+		"/os/vmlinuz":      "kernel",
+		"/os/initrd.img":   "initrd",
+		"/os/firmware.img": "firmware",
+		"/live/fs.img":     "squashfs",
+	}
+	fetches := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method == http.MethodGet {
+			fetches[r.URL.Path]++
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+		w.Write([]byte(content))
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := &config.Config{
+		TFTP: config.TFTPConfig{Dir: t.TempDir()},
+		OSImages: config.OSImageConfig{
+			Sources: map[string]config.OSDefinition{
+				"testos": {
+					Versions: map[string]config.OSVersion{
+						"1": {
+							BaseURL: server.URL + "/os/",
+							Artifacts: []config.Artifact{
+								{Name: "vmlinuz", Checksum: kernelChecksum, Role: config.RoleKernel},
+								{Name: "initrd.img", Role: config.RoleInitrd},
+								{Name: "firmware.img", Role: config.RoleInitrd},
+								{URL: server.URL + "/live/fs.img", Dest: "filesystem.squashfs", Role: config.RoleSquashfs},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	status := &DownloadStatus{ID: "download-1", OS: "testos", Version: "1", Status: "downloading"}
+	mockRepo := &MockOSImageRepository{}
+	mockDownloadRepo := &MockDownloadStatusRepository{}
+	mockDownloadRepo.On("GetActive", mock.Anything).Return([]*DownloadStatus{status}, nil)
+	mockDownloadRepo.On("Get", mock.Anything, "download-1").Return(status, nil)
+	mockDownloadRepo.On("Save", mock.Anything, mock.Anything).Return(nil)
+	return createTestService(mockRepo, mockDownloadRepo, cfg), mockRepo, status, fetches
+}
+
+func TestProcessDownload_Artifacts(t *testing.T) {
+	service, mockRepo, status, _ := newArtifactDownload(t, fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("kernel"))))
+
+	var saved *OSImage
+	mockRepo.On("Save", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		saved = args.Get(1).(*OSImage)
+	}).Return(nil)
+
+	runDownload(t, service, status)
+
+	assert.Equal(t, "completed", status.Status, status.ErrorMessage)
+	if assert.NotNil(t, saved) {
+		assert.Equal(t, "testos/1/vmlinuz", saved.KernelPath)
+		assert.Equal(t, "testos/1/initrd.img", saved.InitrdPath)
+		assert.Equal(t, []string{"testos/1/initrd.img", "testos/1/firmware.img"}, saved.Paths(config.RoleInitrd))
+		assert.Equal(t, "fetch=http://server/boot/testos/1/filesystem.squashfs", saved.BootArgs("http://server/boot"))
+		assert.Len(t, saved.Artifacts, 4)
+	}
+
+	content, err := os.ReadFile(filepath.Join(service.config.TFTP.Dir, "testos", "1", "filesystem.squashfs"))
+	assert.NoError(t, err)
+	assert.Equal(t, "squashfs", string(content))
+}
+
+func TestProcessDownload_ChecksumMismatch(t *testing.T) {
+	service, mockRepo, status, _ := newArtifactDownload(t, fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("other"))))
+
+	runDownload(t, service, status)
+
+	assert.Equal(t, "failed", status.Status)
+	assert.Contains(t, status.ErrorMessage, "checksum mismatch")
+	assert.NoFileExists(t, filepath.Join(service.config.TFTP.Dir, "testos", "1", "vmlinuz"))
+	mockRepo.AssertNotCalled(t, "Save", mock.Anything, mock.Anything)
+}
+
+func TestProcessDownload_SkipsCompletedArtifacts(t *testing.T) {
+	service, mockRepo, status, fetches := newArtifactDownload(t, fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("kernel"))))
+	mockRepo.On("Save", mock.Anything, mock.Anything).Return(nil)
+
+	// Left by an attempt that failed on a later artifact
+	osDir := filepath.Join(service.config.TFTP.Dir, "testos", "1")
+	require.NoError(t, os.MkdirAll(osDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(osDir, "vmlinuz"), []byte("kernel"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(osDir, "initrd.img"), []byte("initrd"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(osDir, "firmware.img"), []byte("old"), 0644))
+
+	runDownload(t, service, status)
+
+	assert.Equal(t, "completed", status.Status, status.ErrorMessage)
+	assert.Equal(t, map[string]int{"/os/firmware.img": 1, "/live/fs.img": 1}, fetches)
+	content, err := os.ReadFile(filepath.Join(osDir, "firmware.img"))
+	require.NoError(t, err)
+	assert.Equal(t, "firmware", string(content))
+}
+
+func TestEnqueue_RejectsPendingDownload(t *testing.T) {
+	service, _, status, _ := newArtifactDownload(t, "")
+
+	// Resumed downloads are pending once resumeDownloads returns
+	service.resumeDownloads(context.Background())
+	assert.Equal(t, status.ID, service.pending["testos/1"])
+
+	err := service.enqueue(&DownloadStatus{ID: "download-2", OS: "testos", Version: "1"})
+	assert.ErrorContains(t, err, "already being downloaded")
+	assert.Equal(t, status.ID, service.pending["testos/1"])
+	assert.Len(t, service.queue, 1)
+}
+
+func TestProcessDownload_CancelledWhileStarting(t *testing.T) {
+	cfg := createTestConfig()
+	status := &DownloadStatus{ID: "download-1", OS: "ubuntu", Version: "22.04", Status: "queued"}
+	stale := *status
+
+	mockDownloadRepo := &MockDownloadStatusRepository{}
+	service := createTestService(&MockOSImageRepository{}, mockDownloadRepo, cfg)
+	require.NoError(t, service.enqueue(status))
+
+	// The download is cancelled after the worker has read its queued status
+	mockDownloadRepo.On("Get", mock.Anything, "download-1").Return(&stale, nil).Once().Run(func(mock.Arguments) {
+		require.NoError(t, service.CancelDownload(context.Background(), "download-1"))
+	})
+	mockDownloadRepo.On("Get", mock.Anything, "download-1").Return(status, nil)
+	mockDownloadRepo.On("Save", mock.Anything, mock.Anything).Return(nil)
+
+	service.processDownload(<-service.queue)
+
+	assert.Equal(t, "cancelled", status.Status)
+	assert.Equal(t, "queued", stale.Status, "the worker must not start a cancelled download")
+	mockDownloadRepo.AssertNumberOfCalls(t, "Save", 1)
+	assert.Empty(t, service.cancels)
+}
+
+func TestOSImage_LegacyArtifacts(t *testing.T) {
+	image := &OSImage{KernelPath: "ubuntu/22.04/vmlinuz", InitrdPath: "ubuntu/22.04/initrd.img"}
+
+	assert.Equal(t, "ubuntu/22.04/vmlinuz", image.Path(config.RoleKernel))
+	assert.Equal(t, []string{"ubuntu/22.04/initrd.img"}, image.Paths(config.RoleInitrd))
+	assert.Empty(t, image.BootArgs("http://server/boot"))
+}
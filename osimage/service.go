@@ -2,46 +2,70 @@ package osimage
 
 import (
 	"context"
-	"crypto/sha256"
 	"fmt"
 	"ignite/config"
-	"io"
 	"log"
-	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// queueSize is how many downloads can wait for a worker
+const queueSize = 100
+
 // OSImageServiceImpl provides business logic for OS image management
 type OSImageServiceImpl struct {
-	repo            OSImageRepository
-	downloadRepo    DownloadStatusRepository
-	config          *config.Config
-	downloadChan    chan OSImageConfig
-	activeDownloads map[string]*DownloadStatus
+	repo         OSImageRepository
+	downloadRepo DownloadStatusRepository
+	config       *config.Config
+	catalog      *Catalog
+	downloader   *downloader
+	queue        chan string // IDs of downloads waiting for a worker
+
+	mu      sync.Mutex                    // Guards the maps below and saves of running downloads' status
+	pending map[string]string             // Queued and running download IDs by OS/version
+	cancels map[string]context.CancelFunc // Cancels running downloads by ID
 }
 
-// NewOSImageService creates a new OS image service
-func NewOSImageService(repo OSImageRepository, downloadRepo DownloadStatusRepository, cfg *config.Config) OSImageService {
-	service := &OSImageServiceImpl{
-		repo:            repo,
-		downloadRepo:    downloadRepo,
-		config:          cfg,
-		downloadChan:    make(chan OSImageConfig, 10),
-		activeDownloads: make(map[string]*DownloadStatus),
-	}
+// NewOSImageService creates a new OS image service downloading the OSes in
+// catalog. Downloads left unfinished by a restart are resumed.
+func NewOSImageService(repo OSImageRepository, downloadRepo DownloadStatusRepository, cfg *config.Config, catalog *Catalog) OSImageService {
+	service := newOSImageService(repo, downloadRepo, cfg, catalog)
 
-	// Start background download worker
-	go service.downloadWorker()
+	// Start background download workers
+	workers := cfg.OSImages.DownloadWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go service.downloadWorker()
+	}
+	// Resumed downloads are pending before the service is used, so they
+	// cannot be started a second time
+	service.resumeDownloads(context.Background())
 
 	return service
 }
 
+// newOSImageService creates the service without starting its workers
+func newOSImageService(repo OSImageRepository, downloadRepo DownloadStatusRepository, cfg *config.Config, catalog *Catalog) *OSImageServiceImpl {
+	return &OSImageServiceImpl{
+		repo:         repo,
+		downloadRepo: downloadRepo,
+		config:       cfg,
+		catalog:      catalog,
+		downloader:   newDownloader(cfg.OSImages.DownloadRetries),
+		queue:        make(chan string, queueSize),
+		pending:      make(map[string]string),
+		cancels:      make(map[string]context.CancelFunc),
+	}
+}
+
 // GetAllOSImages retrieves all OS images
 func (s *OSImageServiceImpl) GetAllOSImages(ctx context.Context) ([]*OSImage, error) {
 	return s.repo.GetAll(ctx)
@@ -76,15 +100,11 @@ func (s *OSImageServiceImpl) DeleteOSImage(ctx context.Context, id string) error
 	}
 
 	// Remove files from filesystem
-	kernelPath := filepath.Join(s.config.TFTP.Dir, image.KernelPath)
-	initrdPath := filepath.Join(s.config.TFTP.Dir, image.InitrdPath)
-
-	if err := os.Remove(kernelPath); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to remove kernel file: %w", err)
-	}
-
-	if err := os.Remove(initrdPath); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to remove initrd file: %w", err)
+	for _, artifact := range image.ImageArtifacts() {
+		path := filepath.Join(s.config.TFTP.Dir, artifact.Path)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s file: %w", artifact.Role, err)
+		}
 	}
 
 	// Remove from database
@@ -104,7 +124,15 @@ func (s *OSImageServiceImpl) DownloadOSImage(ctx context.Context, osConfig OSIma
 		return nil, fmt.Errorf("OS image already exists: %s %s", osConfig.OS, osConfig.Version)
 	}
 
-	// Create download status
+	key := osConfig.OS + "/" + osConfig.Version
+	s.mu.Lock()
+	_, inProgress := s.pending[key]
+	s.mu.Unlock()
+	if inProgress {
+		return nil, fmt.Errorf("OS image is already being downloaded: %s %s", osConfig.OS, osConfig.Version)
+	}
+
+	// Create download status; it stays queued until a worker picks it up
 	status := &DownloadStatus{
 		ID:        uuid.New().String(),
 		OS:        osConfig.OS,
@@ -118,24 +146,48 @@ func (s *OSImageServiceImpl) DownloadOSImage(ctx context.Context, osConfig OSIma
 		return nil, err
 	}
 
-	// Update status to downloading BEFORE queuing to prevent race condition
-	status.Status = "downloading"
-	if err := s.downloadRepo.Save(ctx, status); err != nil {
-		return nil, err
+	if err := s.enqueue(status); err != nil {
+		s.markDownloadFailed(ctx, status, err.Error())
+		return status, err
 	}
 
-	// Queue for download
+	return status, nil
+}
+
+// enqueue queues a download for the workers, unless the same OS version is
+// already queued or running
+func (s *OSImageServiceImpl) enqueue(status *DownloadStatus) error {
+	key := status.OS + "/" + status.Version
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, inProgress := s.pending[key]; inProgress {
+		return fmt.Errorf("OS image is already being downloaded: %s %s", status.OS, status.Version)
+	}
 	select {
-	case s.downloadChan <- osConfig:
-		// Successfully queued
+	case s.queue <- status.ID:
+		s.pending[key] = status.ID
+		return nil
 	default:
-		status.Status = "failed"
-		status.ErrorMessage = "download queue is full"
-		s.downloadRepo.Save(ctx, status)
-		return status, fmt.Errorf("download queue is full")
+		return fmt.Errorf("download queue is full")
 	}
+}
 
-	return status, nil
+// resumeDownloads queues the downloads that were queued or running when the
+// service last stopped. Their partial files are resumed.
+func (s *OSImageServiceImpl) resumeDownloads(ctx context.Context) {
+	downloads, err := s.downloadRepo.GetActive(ctx)
+	if err != nil {
+		log.Printf("Failed to resume OS image downloads: %v", err)
+		return
+	}
+	for _, status := range downloads {
+		if err := s.enqueue(status); err != nil {
+			s.markDownloadFailed(ctx, status, err.Error())
+			continue
+		}
+		log.Printf("Resuming download of %s %s", status.OS, status.Version)
+	}
 }
 
 // GetDownloadStatus retrieves the status of a download
@@ -148,7 +200,8 @@ func (s *OSImageServiceImpl) GetActiveDownloads(ctx context.Context) ([]*Downloa
 	return s.downloadRepo.GetActive(ctx)
 }
 
-// CancelDownload cancels an active download and cleans up partial files
+// CancelDownload cancels a queued or running download, aborting its transfer,
+// and cleans up partial files
 func (s *OSImageServiceImpl) CancelDownload(ctx context.Context, id string) error {
 	// Get the download status
 	status, err := s.downloadRepo.Get(ctx, id)
@@ -161,25 +214,44 @@ func (s *OSImageServiceImpl) CancelDownload(ctx context.Context, id string) erro
 		return fmt.Errorf("cannot cancel download with status: %s", status.Status)
 	}
 
-	// Mark as cancelled
+	// Abort the transfer and mark as cancelled while holding the lock, so the
+	// worker cannot save its progress over the cancelled status
+	s.mu.Lock()
+	if cancel, running := s.cancels[id]; running {
+		cancel()
+	}
+	if key := status.OS + "/" + status.Version; s.pending[key] == id {
+		delete(s.pending, key)
+	}
+
 	now := time.Now()
 	status.Status = "cancelled"
 	status.Progress = 0
 	status.ErrorMessage = "Download cancelled by user"
 	status.CompletedAt = &now
-
-	if err := s.downloadRepo.Save(ctx, status); err != nil {
+	err = s.downloadRepo.Save(ctx, status)
+	s.mu.Unlock()
+	if err != nil {
 		return fmt.Errorf("failed to save cancelled status: %w", err)
 	}
 
 	// Clean up any partially downloaded files
 	osDir := filepath.Join(s.config.TFTP.Dir, status.OS, status.Version)
-	kernelPath := filepath.Join(osDir, "vmlinuz")
-	initrdPath := filepath.Join(osDir, "initrd.img")
+	dests := []string{"vmlinuz", "initrd.img"}
+	osDef, _ := s.catalog.Definition(status.OS)
+	if artifacts, err := osDef.VersionArtifacts(status.Version); err == nil {
+		dests = dests[:0]
+		for _, artifact := range artifacts {
+			dests = append(dests, artifact.Dest)
+		}
+	}
 
 	// Remove partial files (ignore errors as files might not exist)
-	os.Remove(kernelPath)
-	os.Remove(initrdPath)
+	for _, dest := range dests {
+		os.Remove(filepath.Join(osDir, dest))
+		os.Remove(filepath.Join(osDir, dest+partSuffix))
+		os.Remove(filepath.Join(osDir, dest+partSuffix+validatorSuffix))
+	}
 
 	// Try to remove the directory if it's empty
 	os.Remove(osDir)
@@ -189,7 +261,7 @@ func (s *OSImageServiceImpl) CancelDownload(ctx context.Context, id string) erro
 
 // isValidOSVersion checks if the OS and version combination is supported
 func (s *OSImageServiceImpl) isValidOSVersion(os, version string) bool {
-	osDef, exists := s.config.OSImages.Sources[os]
+	osDef, exists := s.catalog.Definition(os)
 	if !exists {
 		return false
 	}
@@ -198,121 +270,144 @@ func (s *OSImageServiceImpl) isValidOSVersion(os, version string) bool {
 	return versionExists
 }
 
-// downloadWorker processes download requests in the background
+// downloadWorker processes queued downloads in the background
 func (s *OSImageServiceImpl) downloadWorker() {
-	for osConfig := range s.downloadChan {
-		s.processDownload(osConfig)
+	for id := range s.queue {
+		s.processDownload(id)
 	}
 }
 
-// processDownload handles the actual download process
-func (s *OSImageServiceImpl) processDownload(osConfig OSImageConfig) {
-	ctx := context.Background()
+// processDownload downloads the artifacts of a queued download
+func (s *OSImageServiceImpl) processDownload(id string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	// Find download status
-	var status *DownloadStatus
-	downloads, err := s.downloadRepo.GetActive(ctx)
+	status, err := s.downloadRepo.Get(ctx, id)
 	if err != nil {
-		return
+		return // Status not found
 	}
-
-	for _, d := range downloads {
-		if d.OS == osConfig.OS && d.Version == osConfig.Version {
-			status = d
-			break
+	key := status.OS + "/" + status.Version
+	defer func() {
+		s.mu.Lock()
+		delete(s.cancels, id)
+		if s.pending[key] == id {
+			delete(s.pending, key)
 		}
+		s.mu.Unlock()
+	}()
+
+	// Register for cancellation, unless cancelled while queued. The status
+	// read above may predate the cancellation, so check that the download is
+	// still pending instead.
+	s.mu.Lock()
+	if s.pending[key] != id {
+		s.mu.Unlock()
+		return
 	}
+	s.cancels[id] = cancel
+	s.mu.Unlock()
+	s.updateStatus(ctx, status, func() { status.Status = "downloading" })
 
-	if status == nil {
-		return // Status not found
-	}
-
-	// Get OS definition from config
-	osDef, exists := s.config.OSImages.Sources[osConfig.OS]
+	// Get OS definition from the catalog
+	osDef, exists := s.catalog.Definition(status.OS)
 	if !exists {
 		s.markDownloadFailed(ctx, status, "unsupported OS")
 		return
 	}
 
-	// Get version info from config
-	versionInfo, versionExists := osDef.Versions[osConfig.Version]
-	if !versionExists {
-		s.markDownloadFailed(ctx, status, "unsupported version for this OS")
-		return
-	}
-
-	baseURL := versionInfo.BaseURL
-	if baseURL == "" {
-		s.markDownloadFailed(ctx, status, "no download URL found for this version")
+	artifacts, err := osDef.VersionArtifacts(status.Version)
+	if err != nil {
+		s.markDownloadFailed(ctx, status, fmt.Sprintf("invalid OS definition: %v", err))
 		return
 	}
 
 	// Create directory structure
-	osDir := filepath.Join(s.config.TFTP.Dir, osConfig.OS, osConfig.Version)
+	osDir := filepath.Join(s.config.TFTP.Dir, status.OS, status.Version)
 	if err := os.MkdirAll(osDir, 0755); err != nil {
 		s.markDownloadFailed(ctx, status, fmt.Sprintf("failed to create directory: %v", err))
 		return
 	}
 
-	// Get filenames from config
-	kernelFile := osDef.KernelFile
-	initrdFile := osDef.InitrdFile
-
-	kernelURL := strings.TrimSuffix(baseURL, "/") + "/" + kernelFile
-	initrdURL := strings.TrimSuffix(baseURL, "/") + "/" + initrdFile
-
-	kernelPath := filepath.Join(osDir, "vmlinuz")
-	initrdPath := filepath.Join(osDir, "initrd.img")
-
-	// Download kernel
-	status.Progress = 10
-	s.downloadRepo.Save(ctx, status)
-
-	// Check if cancelled before starting kernel download
-	if status, err := s.downloadRepo.Get(ctx, status.ID); err != nil || status.Status == "cancelled" {
-		return
+	osImage := &OSImage{
+		OS:           status.OS,
+		Version:      status.Version,
+		Architecture: "x86_64", // Default to x86_64
+		Active:       false,    // Don't automatically set as default
+		DownloadURL:  osDef.Versions[status.Version].BaseURL,
 	}
 
-	kernelSize, kernelChecksum, err := s.downloadFile(kernelURL, kernelPath)
-	if err != nil {
-		s.markDownloadFailed(ctx, status, fmt.Sprintf("failed to download kernel: %v", err))
-		return
+	// Progress is reported in bytes across all artifacts, using the sizes the
+	// servers give up front
+	progress := newDownloadProgress(len(artifacts))
+	for i, artifact := range artifacts {
+		progress.setSize(i, s.downloader.size(ctx, artifact.URL))
 	}
-
-	// Download initrd
-	status.Progress = 60
-	s.downloadRepo.Save(ctx, status)
-
-	// Check if cancelled before starting initrd download
-	if status, err := s.downloadRepo.Get(ctx, status.ID); err != nil || status.Status == "cancelled" {
-		return
+	var lastSave time.Time
+	report := func(force bool) {
+		if !force && time.Since(lastSave) < time.Second {
+			return
+		}
+		lastSave = time.Now()
+		s.updateStatus(ctx, status, func() {
+			status.Progress, status.BytesDone, status.BytesTotal = progress.report()
+		})
+	}
+	report(true)
+
+	var checksums []string
+	for i, artifact := range artifacts {
+		dest := filepath.Join(osDir, artifact.Dest)
+		size, checksum, done := completedArtifact(dest, progress.sizes[i], artifact.Checksum)
+		if !done {
+			size, checksum, err = s.downloader.fetch(ctx, artifact.URL, dest, func(done, total int64) {
+				progress.update(i, done, total)
+				report(false)
+			})
+		}
+		if ctx.Err() != nil {
+			return // Cancelled; CancelDownload has saved the status
+		}
+		if err != nil {
+			s.markDownloadFailed(ctx, status, fmt.Sprintf("failed to download %s: %v", artifact.Role, err))
+			return
+		}
+		if artifact.Checksum != "" && artifact.Checksum != "sha256:"+checksum {
+			// Remove the file so the next attempt starts from scratch
+			os.Remove(dest)
+			s.markDownloadFailed(ctx, status, fmt.Sprintf("checksum mismatch for %s: got sha256:%s, want %s", artifact.Dest, checksum, artifact.Checksum))
+			return
+		}
+		progress.update(i, size, size)
+		report(true)
+
+		imageArtifact := ImageArtifact{
+			Role:     artifact.Role,
+			Path:     fmt.Sprintf("%s/%s/%s", status.OS, status.Version, artifact.Dest),
+			Size:     size,
+			Checksum: checksum,
+			URL:      artifact.URL,
+		}
+		osImage.Artifacts = append(osImage.Artifacts, imageArtifact)
+		checksums = append(checksums, checksum)
+
+		// The kernel and first initrd are also recorded for older clients
+		switch {
+		case artifact.Role == config.RoleKernel:
+			osImage.KernelPath, osImage.KernelSize = imageArtifact.Path, size
+		case artifact.Role == config.RoleInitrd && osImage.InitrdPath == "":
+			osImage.InitrdPath, osImage.InitrdSize = imageArtifact.Path, size
+		}
 	}
+	osImage.Checksum = strings.Join(checksums, ":")
 
-	initrdSize, initrdChecksum, err := s.downloadFile(initrdURL, initrdPath)
-	if err != nil {
-		s.markDownloadFailed(ctx, status, fmt.Sprintf("failed to download initrd: %v", err))
+	// Create the OS image record, unless cancelled after the last transfer
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ctx.Err() != nil {
 		return
 	}
-
-	// Create OS image record
-	status.Progress = 90
-	s.downloadRepo.Save(ctx, status)
-
-	osImage := &OSImage{
-		OS:           osConfig.OS,
-		Version:      osConfig.Version,
-		Architecture: "x86_64", // Default to x86_64
-		KernelPath:   fmt.Sprintf("%s/%s/vmlinuz", osConfig.OS, osConfig.Version),
-		InitrdPath:   fmt.Sprintf("%s/%s/initrd.img", osConfig.OS, osConfig.Version),
-		KernelSize:   kernelSize,
-		InitrdSize:   initrdSize,
-		Checksum:     kernelChecksum + ":" + initrdChecksum,
-		Active:       false,   // Don't automatically set as default
-		DownloadURL:  baseURL, // Store the base URL where files were downloaded from
-	}
-
 	if err := s.repo.Save(ctx, osImage); err != nil {
-		s.markDownloadFailed(ctx, status, fmt.Sprintf("failed to save OS image: %v", err))
+		s.saveFailed(ctx, status, fmt.Sprintf("failed to save OS image: %v", err))
 		return
 	}
 
@@ -324,41 +419,49 @@ func (s *OSImageServiceImpl) processDownload(osConfig OSImageConfig) {
 	s.downloadRepo.Save(ctx, status)
 }
 
-// downloadFile downloads a file and returns its size and checksum
-func (s *OSImageServiceImpl) downloadFile(url, filepath string) (int64, string, error) {
-	resp, err := http.Get(url)
-	if err != nil {
-		log.Printf("HTTP GET failed for %s: %v", url, err)
-		return 0, "", err
+// completedArtifact returns the size and checksum of dest if an earlier
+// attempt finished downloading it, judged by the artifact's checksum or, for
+// artifacts without one, by the size the server gives
+func completedArtifact(dest string, size int64, checksum string) (int64, string, bool) {
+	if checksum == "" && size < 0 {
+		return 0, "", false
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("Download failed with status %s for %s", resp.Status, url)
-		return 0, "", fmt.Errorf("download failed: %s", resp.Status)
+	info, err := os.Stat(dest)
+	if err != nil || !info.Mode().IsRegular() || (size >= 0 && info.Size() != size) {
+		return 0, "", false
 	}
-
-	file, err := os.Create(filepath)
-	if err != nil {
-		return 0, "", err
+	fileSize, fileChecksum, err := hashFile(dest)
+	if err != nil || (checksum != "" && checksum != "sha256:"+fileChecksum) {
+		return 0, "", false
 	}
-	defer file.Close()
-
-	// Create hash writer
-	hash := sha256.New()
+	return fileSize, fileChecksum, true
+}
 
-	// Copy with hash calculation
-	size, err := io.Copy(io.MultiWriter(file, hash), resp.Body)
-	if err != nil {
-		return 0, "", err
+// updateStatus applies change to a running download's status and saves it,
+// unless the download has been cancelled
+func (s *OSImageServiceImpl) updateStatus(ctx context.Context, status *DownloadStatus, change func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ctx.Err() != nil {
+		return
 	}
-
-	checksum := fmt.Sprintf("%x", hash.Sum(nil))
-	return size, checksum, nil
+	change()
+	s.downloadRepo.Save(ctx, status)
 }
 
-// markDownloadFailed marks a download as failed with an error message
+// markDownloadFailed marks a download as failed with an error message. Partial
+// files are kept, so downloading the image again resumes them.
 func (s *OSImageServiceImpl) markDownloadFailed(ctx context.Context, status *DownloadStatus, errorMsg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ctx.Err() != nil {
+		return
+	}
+	s.saveFailed(ctx, status, errorMsg)
+}
+
+// saveFailed saves a download as failed; the caller holds s.mu
+func (s *OSImageServiceImpl) saveFailed(ctx context.Context, status *DownloadStatus, errorMsg string) {
 	status.Status = "failed"
 	status.ErrorMessage = errorMsg
 	now := time.Now()
@@ -368,7 +471,7 @@ func (s *OSImageServiceImpl) markDownloadFailed(ctx context.Context, status *Dow
 
 // GetAvailableVersions returns available versions for a given OS
 func (s *OSImageServiceImpl) GetAvailableVersions(ctx context.Context, os string) ([]string, error) {
-	osDef, exists := s.config.OSImages.Sources[os]
+	osDef, exists := s.catalog.Definition(os)
 	if !exists {
 		return nil, fmt.Errorf("unsupported OS: %s", os)
 	}
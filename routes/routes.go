@@ -27,6 +27,7 @@ func SetupWithContainerAndStatic(container *handlers.Container, staticHandler *h
 	osImageHandlers := handlers.NewOSImageHandlers(container)
 	syslinuxHandlers := handlers.NewSyslinuxHandler(container)
 	ipxeHandlers := handlers.NewIPXEHandlers(container)
+	bootHandlers := handlers.NewBootHandlers(container)
 
 	// Apply authentication middleware to the entire router
 	router.Use(handlers.AuthMiddleware)
@@ -43,6 +44,7 @@ func SetupWithContainerAndStatic(container *handlers.Container, staticHandler *h
 	setupOSImageRoutes(router, osImageHandlers)
 	setupSyslinuxRoutes(router, syslinuxHandlers)
 	setupIPXERoutes(router, ipxeHandlers)
+	setupBootRoutes(router, bootHandlers, ipxeHandlers)
 	setupStatusRoutes(router, statusHandlers)
 
 	return router
@@ -78,6 +80,8 @@ func setupDHCPRoutes(router *mux.Router, handlers *handlers.DHCPHandlers) {
 	router.HandleFunc("/dhcp/stop", handlers.StopDHCPServer).Methods("POST").Name("StopDHCP")
 	router.HandleFunc("/dhcp/delete", handlers.DeleteDHCPServer).Methods("POST").Name("DeleteDHCP")
 	router.HandleFunc("/dhcp/submit_dhcp", handlers.SubmitDHCPServer).Methods("POST").Name("SubmitDHCP")
+	router.HandleFunc("/dhcp/migrate", handlers.MigrateDHCPServer).Methods("POST").Name("MigrateDHCP")
+	router.HandleFunc("/dhcp/rack", handlers.AddRack).Methods("POST").Name("AddRack")
 	router.HandleFunc("/dhcp/submit_reserve", handlers.ReserveLease).Methods("POST").Name("ReserveLease")
 	router.HandleFunc("/dhcp/remove_reserve", handlers.UnreserveLease).Methods("POST").Name("UnreserveLease")
 	router.HandleFunc("/dhcp/delete_lease", handlers.DeleteLease).Methods("POST").Name("DeleteLease")
@@ -85,7 +89,9 @@ func setupDHCPRoutes(router *mux.Router, handlers *handlers.DHCPHandlers) {
 
 	// State management API routes
 	router.HandleFunc("/dhcp/lease/state", handlers.UpdateLeaseState).Methods("POST").Name("UpdateLeaseState")
+	router.HandleFunc("/dhcp/lease/heartbeat", handlers.RecordHeartbeat).Methods("POST").Name("RecordHeartbeat")
 	router.HandleFunc("/dhcp/lease/history", handlers.GetLeaseStateHistory).Methods("GET").Name("GetLeaseStateHistory")
+	router.HandleFunc("/dhcp/lease/transfers", handlers.GetLeaseTransfers).Methods("GET").Name("GetLeaseTransfers")
 }
 
 // setupTFTPRoutes configures TFTP file management routes
@@ -96,10 +102,25 @@ func setupTFTPRoutes(router *mux.Router, handlers *handlers.TFTPHandlers) {
 	router.HandleFunc("/tftp/download", handlers.HandleDownload).Methods("GET").Name("DownloadFile")
 	router.HandleFunc("/tftp/view", handlers.ViewFile).Methods("GET").Name("ViewFile")
 	router.HandleFunc("/tftp/serve", handlers.ServeFile).Methods("GET").Name("ServeFile")
+	router.HandleFunc("/tftp/backups", handlers.HandleBackupsPage).Methods("GET").Name("BackupsPage")
+	router.HandleFunc("/tftp/backups/file", handlers.HandleBackupFile).Methods("GET").Name("BackupFile")
+	router.HandleFunc("/tftp/backups/version", handlers.HandleBackupVersion).Methods("GET").Name("BackupVersion")
+	router.HandleFunc("/tftp/size", handlers.HandleDirectorySize).Methods("GET").Name("DirectorySize")
 
 	// POST routes
 	router.HandleFunc("/tftp/delete_file", handlers.HandleDelete).Methods("POST").Name("DeleteFile")
 	router.HandleFunc("/tftp/upload_file", handlers.HandleUpload).Methods("POST").Name("UploadFile")
+	router.HandleFunc("/tftp/create_dir", handlers.HandleCreateDirectory).Methods("POST").Name("CreateDirectory")
+	router.HandleFunc("/tftp/delete_dir", handlers.HandleDeleteDirectory).Methods("POST").Name("DeleteDirectory")
+	router.HandleFunc("/tftp/move", handlers.HandleMove).Methods("POST").Name("MoveFile")
+	router.HandleFunc("/tftp/extract", handlers.HandleExtract).Methods("POST").Name("ExtractArchive")
+
+	// Resumable uploads
+	router.HandleFunc("/tftp/uploads", handlers.HandleListUploads).Methods("GET").Name("ListUploads")
+	router.HandleFunc("/tftp/uploads", handlers.HandleCreateUpload).Methods("POST").Name("CreateUpload")
+	router.HandleFunc("/tftp/uploads/{id}", handlers.HandleUploadOffset).Methods("GET", "HEAD").Name("UploadOffset")
+	router.HandleFunc("/tftp/uploads/{id}", handlers.HandleUploadChunk).Methods("PATCH").Name("UploadChunk")
+	router.HandleFunc("/tftp/uploads/{id}", handlers.HandleDeleteUpload).Methods("DELETE").Name("DeleteUpload")
 }
 
 // setupProvisionRoutes configures provisioning template management routes
@@ -140,6 +161,7 @@ func setupStatusRoutes(router *mux.Router, handlers *handlers.StatusHandlers) {
 	// GET routes
 	router.HandleFunc("/status", handlers.HandleStatusPage).Methods("GET").Name("Status")
 	router.HandleFunc("/status/content", handlers.HandleStatusContent).Methods("GET").Name("StatusContent")
+	router.HandleFunc("/status/rogue/scan", handlers.ScanRogueDHCP).Methods("POST").Name("ScanRogueDHCP")
 }
 
 // setupOSImageRoutes configures OS image management routes
@@ -149,11 +171,13 @@ func setupOSImageRoutes(router *mux.Router, handlers *handlers.OSImageHandlers)
 	router.HandleFunc("/osimages/download/status/{id}", handlers.GetDownloadStatus).Methods("GET").Name("GetDownloadStatus")
 	router.HandleFunc("/osimages/info/{id}", handlers.GetOSImageInfo).Methods("GET").Name("GetOSImageInfo")
 	router.HandleFunc("/osimages/available-versions", handlers.GetAvailableVersions).Methods("GET").Name("GetAvailableVersions")
+	router.HandleFunc("/osimages/catalog", handlers.GetCatalog).Methods("GET").Name("GetOSCatalog")
 
 	// POST routes
 	router.HandleFunc("/osimages/download", handlers.DownloadOSImage).Methods("POST").Name("DownloadOSImage")
 	router.HandleFunc("/osimages/set-default/{id}", handlers.SetDefaultVersion).Methods("POST").Name("SetDefaultVersion")
 	router.HandleFunc("/osimages/cancel/{id}", handlers.CancelDownload).Methods("POST").Name("CancelDownload")
+	router.HandleFunc("/osimages/catalog/refresh", handlers.RefreshCatalog).Methods("POST").Name("RefreshOSCatalog")
 
 	// DELETE routes
 	router.HandleFunc("/osimages/delete/{id}", handlers.DeleteOSImage).Methods("DELETE").Name("DeleteOSImage")
@@ -173,6 +197,14 @@ func setupIPXERoutes(router *mux.Router, handlers *handlers.IPXEHandlers) {
 	router.HandleFunc("/ipxe/update", handlers.UpdateConfigFile).Methods("POST").Name("UpdateIPXEConfig")
 }
 
+// setupBootRoutes configures the unauthenticated HTTP boot tree
+func setupBootRoutes(router *mux.Router, handlers *handlers.BootHandlers, ipxeHandlers *handlers.IPXEHandlers) {
+	router.HandleFunc("/boot/ipxe", ipxeHandlers.HostScript).Methods("GET").Name("GetIPXEHostScript")
+	router.HandleFunc("/boot/phone-home", handlers.HandlePhoneHome).Methods("POST").Name("PhoneHome")
+	router.HandleFunc("/boot/nocloud/{file}", handlers.ServeNoCloud).Methods("GET").Name("NoCloud")
+	router.PathPrefix("/boot/").HandlerFunc(handlers.ServeBootFile).Methods("GET", "HEAD").Name("BootFiles")
+}
+
 // setupAuthRoutes configures authentication routes
 func setupAuthRoutes(router *mux.Router, handlers *handlers.AuthHandlers) {
 	// GET routes
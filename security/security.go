@@ -1,4 +1,4 @@
-package handlers
+package security
 
 import (
 	"fmt"
@@ -288,6 +288,65 @@ func (v *TFTPSecurityValidator) GetSafePath(basePath, relativePath string) (stri
 	return fullPath, nil
 }
 
+// ValidateFileSize validates that a file is within the maximum allowed size
+func (v *TFTPSecurityValidator) ValidateFileSize(filePath string) error {
+	return v.pathValidator.ValidateFileSize(filePath)
+}
+
+// NormalizeTFTPFilename converts a filename from a TFTP request into a relative
+// path. Clients commonly send a leading slash or Windows separators.
+func NormalizeTFTPFilename(filename string) string {
+	return strings.TrimLeft(strings.ReplaceAll(filename, "\\", "/"), "/")
+}
+
+// ResolveTFTPPath maps a requested TFTP filename to a path inside basePath,
+// rejecting traversal, unsafe names and symlinks that lead outside it
+func (v *TFTPSecurityValidator) ResolveTFTPPath(basePath, filename string) (string, error) {
+	fullPath, err := v.GetSafePath(basePath, NormalizeTFTPFilename(filename))
+	if err != nil {
+		return "", err
+	}
+
+	// A symlink inside the root must not point outside it
+	if resolved, err := filepath.EvalSymlinks(fullPath); err == nil {
+		resolvedBase, err := filepath.EvalSymlinks(basePath)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve base path: %v", err)
+		}
+		if !isWithin(resolvedBase, resolved) {
+			return "", fmt.Errorf("path '%s' resolves outside the TFTP directory", filename)
+		}
+	}
+
+	return fullPath, nil
+}
+
+// ResolveUploadTarget maps a file uploaded through the web interface into dir,
+// a directory relative to basePath. Unlike ValidateTFTPUpload it places no
+// limit on size, which callers enforce themselves, and accepts any file type:
+// web uploads are authenticated, and bootloaders such as pxelinux.0,
+// undionly.kpxe and *.c32 modules have no common extension.
+func (v *TFTPSecurityValidator) ResolveUploadTarget(basePath, dir, filename string) (string, error) {
+	if err := v.pathValidator.ValidateFileName(filename); err != nil {
+		return "", err
+	}
+
+	dir = strings.Trim(NormalizeTFTPFilename(dir), "/")
+	for _, part := range strings.Split(dir, "/") {
+		if strings.HasPrefix(part, ".") && part != "." {
+			return "", fmt.Errorf("hidden or parent directories not allowed: %s", dir)
+		}
+	}
+
+	return v.ResolveTFTPPath(basePath, filepath.Join(dir, filename))
+}
+
+// isWithin reports whether path is base or below it
+func isWithin(base, path string) bool {
+	rel, err := filepath.Rel(base, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
 // SecurityConfig holds security configuration
 type SecurityConfig struct {
 	MaxFileSize      int64    `json:"max_file_size"`
@@ -1,4 +1,4 @@
-package handlers
+package security
 
 import (
 	"os"
@@ -278,3 +278,82 @@ func TestGetDefaultSecurityConfig(t *testing.T) {
 		}
 	}
 }
+
+func TestTFTPSecurityValidator_ResolveTFTPPath(t *testing.T) {
+	tmpDir := t.TempDir()
+	outside := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmpDir, "pxelinux.cfg"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret.cfg"), []byte("secret"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret.cfg"), filepath.Join(tmpDir, "escape.cfg")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	validator := NewTFTPSecurityValidator(tmpDir)
+
+	tests := []struct {
+		name      string
+		filename  string
+		expected  string
+		expectErr bool
+	}{
+		{"Plain file", "pxelinux.0", "pxelinux.0", false},
+		{"Nested file", "pxelinux.cfg/default", "pxelinux.cfg/default", false},
+		{"Leading slash", "/pxelinux.cfg/default", "pxelinux.cfg/default", false},
+		{"Backslash separators", "pxelinux.cfg\\default", "pxelinux.cfg/default", false},
+		{"Traversal", "../etc/passwd", "", true},
+		{"Backslash traversal", "..\\..\\etc\\passwd", "", true},
+		{"Nested traversal", "pxelinux.cfg/../../etc/passwd", "", true},
+		{"Symlink escape", "escape.cfg", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := validator.ResolveTFTPPath(tmpDir, tt.filename)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("ResolveTFTPPath(%s) error = %v, expectErr %v", tt.filename, err, tt.expectErr)
+			}
+			if err == nil && path != filepath.Join(tmpDir, tt.expected) {
+				t.Errorf("ResolveTFTPPath(%s) = %s, expected %s", tt.filename, path, filepath.Join(tmpDir, tt.expected))
+			}
+		})
+	}
+}
+
+func TestTFTPSecurityValidator_ResolveUploadTarget(t *testing.T) {
+	tmpDir := t.TempDir()
+	validator := NewTFTPSecurityValidator(tmpDir)
+
+	tests := []struct {
+		name      string
+		dir       string
+		filename  string
+		expected  string
+		expectErr bool
+	}{
+		{"Root directory", "", "ubuntu.iso", "ubuntu.iso", false},
+		{"Subdirectory", "images/ubuntu", "ubuntu.iso", "images/ubuntu/ubuntu.iso", false},
+		{"Leading slash", "/images/", "ubuntu.iso", "images/ubuntu.iso", false},
+		{"Path in filename", "", "images/ubuntu.iso", "", true},
+		{"Hidden filename", "", ".ubuntu.iso", "", true},
+		{"PXELINUX bootloader", "", "pxelinux.0", "pxelinux.0", false},
+		{"SYSLINUX module", "syslinux", "ldlinux.c32", "syslinux/ldlinux.c32", false},
+		{"iPXE bootloader", "", "undionly.kpxe", "undionly.kpxe", false},
+		{"Traversal in directory", "../etc", "ubuntu.iso", "", true},
+		{"Hidden directory", ".uploads", "ubuntu.iso", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := validator.ResolveUploadTarget(tmpDir, tt.dir, tt.filename)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("ResolveUploadTarget(%s, %s) error = %v, expectErr %v", tt.dir, tt.filename, err, tt.expectErr)
+			}
+			if err == nil && path != filepath.Join(tmpDir, tt.expected) {
+				t.Errorf("ResolveUploadTarget(%s, %s) = %s, expected %s", tt.dir, tt.filename, path, filepath.Join(tmpDir, tt.expected))
+			}
+		})
+	}
+}
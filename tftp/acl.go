@@ -0,0 +1,172 @@
+package tftp
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"path"
+	"strings"
+	"time"
+
+	"ignite/dhcp"
+)
+
+// errReadDenied is sent to clients whose read requests are refused
+var errReadDenied = errors.New("access violation: access denied")
+
+// leaseLookupTimeout bounds the lease lookup made for per-host files
+const leaseLookupTimeout = 2 * time.Second
+
+// AccessRule limits which clients may read files matching a pattern
+type AccessRule struct {
+	Pattern string       // path.Match pattern for the requested name, such as "pxelinux.cfg/*"
+	Subnets []*net.IPNet // Client networks allowed to read matching files
+}
+
+// AccessPolicy controls which clients may read which files. The zero value
+// allows every read.
+type AccessPolicy struct {
+	Subnets []*net.IPNet      // Client networks allowed to read at all, empty for any client
+	Rules   []AccessRule      // Further restrictions for files matching a rule
+	Leases  dhcp.LeaseService // If set, per-host files are only served to the IP leased to that host
+}
+
+// NewAccessPolicy builds an access policy from client CIDRs and rules written
+// as "pattern=cidr cidr ...". Per-host files are bound to leases when leases is non-nil.
+func NewAccessPolicy(subnets []string, rules []string, leases dhcp.LeaseService) (AccessPolicy, error) {
+	policy := AccessPolicy{Leases: leases}
+
+	var err error
+	if policy.Subnets, err = parseSubnets(subnets); err != nil {
+		return AccessPolicy{}, err
+	}
+
+	for _, rule := range rules {
+		pattern, cidrs, ok := strings.Cut(rule, "=")
+		pattern = strings.TrimSpace(pattern)
+		if !ok || pattern == "" {
+			return AccessPolicy{}, fmt.Errorf("invalid access rule %q: expected pattern=cidr", rule)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return AccessPolicy{}, fmt.Errorf("invalid access rule pattern %q: %w", pattern, err)
+		}
+		ruleSubnets, err := parseSubnets(strings.Fields(cidrs))
+		if err != nil {
+			return AccessPolicy{}, err
+		}
+		if len(ruleSubnets) == 0 {
+			return AccessPolicy{}, fmt.Errorf("access rule %q has no subnets", pattern)
+		}
+		policy.Rules = append(policy.Rules, AccessRule{Pattern: pattern, Subnets: ruleSubnets})
+	}
+
+	return policy, nil
+}
+
+// parseSubnets parses a list of CIDRs
+func parseSubnets(cidrs []string) ([]*net.IPNet, error) {
+	var subnets []*net.IPNet
+	for _, cidr := range cidrs {
+		_, subnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid access subnet %q: %w", cidr, err)
+		}
+		subnets = append(subnets, subnet)
+	}
+	return subnets, nil
+}
+
+// Check returns why ip may not read name, or nil if it may
+func (p AccessPolicy) Check(name string, ip net.IP) error {
+	if len(p.Subnets) > 0 && !containsIP(p.Subnets, ip) {
+		return fmt.Errorf("client is not in an allowed subnet")
+	}
+
+	for _, rule := range p.Rules {
+		if matched, _ := path.Match(rule.Pattern, name); matched && !containsIP(rule.Subnets, ip) {
+			return fmt.Errorf("client may not read files matching %q", rule.Pattern)
+		}
+	}
+
+	if p.Leases != nil {
+		return p.checkOwner(name, ip)
+	}
+	return nil
+}
+
+// checkOwner ties per-host files to the host they were generated for
+func (p AccessPolicy) checkOwner(name string, ip net.IP) error {
+	mac, ownerIP, ok := HostFileOwner(name)
+	if !ok {
+		return nil
+	}
+	if ip == nil {
+		return fmt.Errorf("client address unknown for a per-host file")
+	}
+
+	if ownerIP != nil {
+		if !ownerIP.Equal(ip) {
+			return fmt.Errorf("file belongs to %s", ownerIP)
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), leaseLookupTimeout)
+	defer cancel()
+
+	lease, err := p.Leases.GetLeaseByMAC(ctx, mac)
+	if err != nil || lease == nil {
+		return fmt.Errorf("no lease for %s", mac)
+	}
+	if !lease.Holds(ip) {
+		return fmt.Errorf("file belongs to %s, leased %s", mac, lease.IP)
+	}
+	return nil
+}
+
+// HostFileOwner reports which host a per-host boot file is for: a MAC for
+// pxelinux.cfg/01-<mac> and grub.cfg-01-<mac>, or an IP for the eight hex
+// digit forms pxelinux.cfg/C0A8010A and grub.cfg-C0A8010A.
+func HostFileOwner(name string) (mac string, ip net.IP, ok bool) {
+	dir, base := path.Split(name)
+
+	var suffix string
+	switch {
+	case path.Base(dir) == "pxelinux.cfg":
+		suffix = base
+	case strings.HasPrefix(base, "grub.cfg-"):
+		suffix = strings.TrimPrefix(base, "grub.cfg-")
+	default:
+		return "", nil, false
+	}
+
+	if strings.HasPrefix(suffix, "01-") {
+		hw, err := net.ParseMAC(strings.ReplaceAll(strings.TrimPrefix(suffix, "01-"), "-", ":"))
+		if err != nil || len(hw) != 6 {
+			return "", nil, false
+		}
+		return hw.String(), nil, true
+	}
+
+	if len(suffix) == 8 {
+		if b, err := hex.DecodeString(suffix); err == nil {
+			return "", net.IPv4(b[0], b[1], b[2], b[3]), true
+		}
+	}
+	return "", nil, false
+}
+
+// containsIP reports whether any subnet contains ip
+func containsIP(subnets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, subnet := range subnets {
+		if subnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package tftp
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ignite/dhcp"
+)
+
+func TestHostFileOwner(t *testing.T) {
+	tests := []struct {
+		name string
+		mac  string
+		ip   string
+		ok   bool
+	}{
+		{"pxelinux.cfg/01-aa-bb-cc-dd-ee-ff", "aa:bb:cc:dd:ee:ff", "", true},
+		{"boot-bios/pxelinux.cfg/01-AA-BB-CC-DD-EE-FF", "aa:bb:cc:dd:ee:ff", "", true},
+		{"grub.cfg-01-aa-bb-cc-dd-ee-ff", "aa:bb:cc:dd:ee:ff", "", true},
+		{"pxelinux.cfg/C0A8010A", "", "192.168.1.10", true},
+		{"grub/grub.cfg-0A000005", "", "10.0.0.5", true},
+		{"pxelinux.cfg/default", "", "", false},
+		{"pxelinux.cfg/C0A801", "", "", false},
+		{"pxelinux.cfg/01-not-a-mac", "", "", false},
+		{"pxelinux.0", "", "", false},
+	}
+
+	for _, tt := range tests {
+		mac, ip, ok := HostFileOwner(tt.name)
+		if ok != tt.ok || mac != tt.mac || (tt.ip != "" && !ip.Equal(net.ParseIP(tt.ip))) {
+			t.Errorf("HostFileOwner(%s) = %q, %v, %v; expected %q, %s, %v", tt.name, mac, ip, ok, tt.mac, tt.ip, tt.ok)
+		}
+	}
+}
+
+func TestNewAccessPolicyInvalid(t *testing.T) {
+	tests := []struct {
+		subnets []string
+		rules   []string
+	}{
+		{[]string{"not-a-cidr"}, nil},
+		{nil, []string{"pxelinux.cfg/*"}},
+		{nil, []string{"pxelinux.cfg/*="}},
+		{nil, []string{"[=10.0.0.0/8"}},
+		{nil, []string{"*.efi=10.0.0.0/8 bogus"}},
+	}
+
+	for _, tt := range tests {
+		if _, err := NewAccessPolicy(tt.subnets, tt.rules, nil); err == nil {
+			t.Errorf("Expected an error for subnets %v and rules %v", tt.subnets, tt.rules)
+		}
+	}
+}
+
+func TestAccessPolicyCheck(t *testing.T) {
+	leases := &fakeLeaseService{lease: &dhcp.Lease{MAC: "aa:bb:cc:dd:ee:ff", IP: net.ParseIP("10.0.0.5"), Expiry: time.Now().Add(time.Hour)}}
+	policy, err := NewAccessPolicy(
+		[]string{"10.0.0.0/16", "192.168.0.0/24"},
+		[]string{"installers/* = 10.0.1.0/24"},
+		leases,
+	)
+	if err != nil {
+		t.Fatalf("NewAccessPolicy failed: %v", err)
+	}
+
+	tests := []struct {
+		client  string
+		name    string
+		allowed bool
+	}{
+		{"10.0.0.5", "pxelinux.0", true},
+		{"172.16.0.5", "pxelinux.0", false},
+		{"10.0.1.20", "installers/ubuntu.iso", true},
+		{"10.0.0.5", "installers/ubuntu.iso", false},
+		{"10.0.0.5", "pxelinux.cfg/01-aa-bb-cc-dd-ee-ff", true},
+		{"10.0.0.6", "pxelinux.cfg/01-aa-bb-cc-dd-ee-ff", false},
+		{"10.0.0.5", "pxelinux.cfg/01-11-22-33-44-55-66", false},
+		{"10.0.0.5", "grub.cfg-0A000005", true},
+		{"10.0.0.6", "grub.cfg-0A000005", false},
+	}
+
+	for _, tt := range tests {
+		err := policy.Check(tt.name, net.ParseIP(tt.client))
+		if (err == nil) != tt.allowed {
+			t.Errorf("Check(%s) for %s = %v, expected allowed=%v", tt.name, tt.client, err, tt.allowed)
+		}
+	}
+
+	// Once the lease expires its address may belong to another host
+	leases.lease.Expiry = time.Now().Add(-time.Hour)
+	if err := policy.Check("pxelinux.cfg/01-aa-bb-cc-dd-ee-ff", net.ParseIP("10.0.0.5")); err == nil {
+		t.Error("Expected an expired lease not to own its files")
+	}
+
+	if err := (AccessPolicy{}).Check("pxelinux.cfg/01-aa-bb-cc-dd-ee-ff", nil); err != nil {
+		t.Errorf("Expected the zero policy to allow everything, got %v", err)
+	}
+}
+
+func TestReadHandlerAccessPolicy(t *testing.T) {
+	serveDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(serveDir, "pxelinux.cfg"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	writeTestFile(t, serveDir, "pxelinux.cfg/01-aa-bb-cc-dd-ee-ff", "host config")
+
+	leases := &fakeLeaseService{lease: &dhcp.Lease{MAC: "aa:bb:cc:dd:ee:ff", IP: net.ParseIP("10.0.0.5"), Expiry: time.Now().Add(time.Hour)}}
+	policy, err := NewAccessPolicy(nil, nil, leases)
+	if err != nil {
+		t.Fatalf("NewAccessPolicy failed: %v", err)
+	}
+
+	server := NewServer(serveDir)
+	server.SetAccessPolicy(policy)
+	var transfers []Transfer
+	server.AddTransferObserver(func(transfer Transfer) { transfers = append(transfers, transfer) })
+
+	owner := &fakeTransfer{addr: net.UDPAddr{IP: net.ParseIP("10.0.0.5"), Port: 2000}}
+	if err := server.readHandler("/pxelinux.cfg/01-aa-bb-cc-dd-ee-ff", owner); err != nil {
+		t.Fatalf("Expected the lease owner to read its config: %v", err)
+	}
+	if string(owner.data) != "host config" {
+		t.Errorf("Unexpected content %q", owner.data)
+	}
+
+	other := &fakeTransfer{addr: net.UDPAddr{IP: net.ParseIP("10.0.0.6"), Port: 2000}}
+	if err := server.readHandler("pxelinux.cfg/01-aa-bb-cc-dd-ee-ff", other); err != errReadDenied {
+		t.Errorf("Expected errReadDenied for another host, got %v", err)
+	}
+	if len(other.data) != 0 {
+		t.Error("Expected no data to be sent to another host")
+	}
+	if len(transfers) != 2 || transfers[1].Outcome != OutcomeDenied {
+		t.Errorf("Expected the denied read to be recorded, got %+v", transfers)
+	}
+}
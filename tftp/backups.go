@@ -0,0 +1,352 @@
+package tftp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"ignite/security"
+)
+
+// versionsSuffix names the directory holding the versions of an uploaded file
+const versionsSuffix = ".versions"
+
+// versionLayout names each stored version after its upload time
+const versionLayout = "20060102T150405.000000000Z"
+
+// UploadArea is a named directory that accepts uploads. Each device's uploads
+// are kept in a subdirectory named after its IP address.
+type UploadArea struct {
+	Name string // First path element clients write to, such as "switches"
+	Dir  string // Directory relative to the serve directory
+}
+
+// ParseUploadArea parses "name=dir", or a bare directory used as its own name
+func ParseUploadArea(s string) (UploadArea, error) {
+	name, dir, ok := strings.Cut(s, "=")
+	if !ok {
+		dir = name
+	}
+	name, dir = strings.Trim(strings.TrimSpace(name), "/"), strings.Trim(strings.TrimSpace(dir), "/")
+
+	if name == "" || strings.Contains(name, "/") {
+		return UploadArea{}, fmt.Errorf("invalid upload area name %q", name)
+	}
+	if dir == "" || filepath.IsAbs(dir) || !filepath.IsLocal(dir) {
+		return UploadArea{}, fmt.Errorf("upload area %q must be a directory inside the TFTP directory", name)
+	}
+	return UploadArea{Name: name, Dir: filepath.Clean(dir)}, nil
+}
+
+// BackupVersion is one stored copy of an uploaded file
+type BackupVersion struct {
+	ID         string    `json:"id"`
+	UploadedAt time.Time `json:"uploaded_at"`
+	Size       int64     `json:"size"`
+}
+
+// BackupFile is a file a device has uploaded, with its versions newest first
+type BackupFile struct {
+	Area     string          `json:"area"`
+	Device   string          `json:"device"`
+	Name     string          `json:"name"`
+	Versions []BackupVersion `json:"versions"`
+}
+
+// Latest returns the newest version of the file
+func (f BackupFile) Latest() BackupVersion {
+	if len(f.Versions) == 0 {
+		return BackupVersion{}
+	}
+	return f.Versions[0]
+}
+
+// BackupStore keeps every upload into an upload area as a timestamped version,
+// alongside a copy of the latest version that devices can read back over TFTP.
+type BackupStore struct {
+	serveDir  string
+	policy    UploadPolicy
+	validator *security.TFTPSecurityValidator
+}
+
+// NewBackupStore creates a BackupStore for the areas and retention of policy
+func NewBackupStore(serveDir string, policy UploadPolicy) *BackupStore {
+	return &BackupStore{
+		serveDir:  serveDir,
+		policy:    policy,
+		validator: security.NewTFTPSecurityValidator(serveDir),
+	}
+}
+
+// Areas returns the configured upload areas
+func (b *BackupStore) Areas() []UploadArea {
+	return b.policy.Areas
+}
+
+// area finds an upload area by name
+func (b *BackupStore) area(name string) (UploadArea, error) {
+	for _, area := range b.policy.Areas {
+		if area.Name == name {
+			return area, nil
+		}
+	}
+	return UploadArea{}, fmt.Errorf("unknown upload area %q", name)
+}
+
+// CheckRead returns why ip may not read name, a slash-separated path relative
+// to the serve directory, or nil if it may. A device may read back the latest
+// copies of its own uploads; no one reads other devices' backups or any
+// version history over TFTP.
+func (b *BackupStore) CheckRead(name string, ip net.IP) error {
+	for _, area := range b.policy.Areas {
+		rel, ok := strings.CutPrefix(name, filepath.ToSlash(area.Dir)+"/")
+		if !ok {
+			if name == filepath.ToSlash(area.Dir) {
+				return fmt.Errorf("%s is upload area %q", name, area.Name)
+			}
+			continue
+		}
+
+		device, file, _ := strings.Cut(rel, "/")
+		if ip == nil || device != ip.String() {
+			return fmt.Errorf("%s is a backup of another device", name)
+		}
+		for _, part := range strings.Split(file, "/") {
+			if strings.HasSuffix(part, versionsSuffix) {
+				return fmt.Errorf("%s is version history", name)
+			}
+		}
+	}
+	return nil
+}
+
+// InArea reports whether name, a slash-separated path relative to the serve
+// directory, is an upload area or lies inside one
+func (b *BackupStore) InArea(name string) bool {
+	for _, area := range b.policy.Areas {
+		dir := filepath.ToSlash(area.Dir)
+		if name == dir || strings.HasPrefix(name, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve maps a TFTP write request to its upload area and the path of the
+// latest copy inside the device's directory
+func (b *BackupStore) resolve(filename string, device net.IP) (UploadArea, string, error) {
+	areaName, rel, _ := strings.Cut(security.NormalizeTFTPFilename(filename), "/")
+	area, err := b.area(areaName)
+	if err != nil {
+		return UploadArea{}, "", err
+	}
+	path, err := b.filePath(area, device.String(), rel)
+	return area, path, err
+}
+
+// filePath returns where the latest copy of a device's file is stored
+func (b *BackupStore) filePath(area UploadArea, device, name string) (string, error) {
+	if net.ParseIP(device) == nil {
+		return "", fmt.Errorf("invalid device address %q", device)
+	}
+	if name == "" {
+		return "", fmt.Errorf("missing file name in upload area %q", area.Name)
+	}
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasSuffix(part, versionsSuffix) {
+			return "", fmt.Errorf("file name %q is reserved for version history", name)
+		}
+	}
+	return b.validator.ResolveTFTPPath(filepath.Join(b.serveDir, area.Dir, device), name)
+}
+
+// save stores the contents of tmpPath, uploaded at the given time, as a new
+// version and as the latest copy, then applies the retention limits.
+func (b *BackupStore) save(latestPath, tmpPath string, uploadedAt time.Time) error {
+	versionsDir := latestPath + versionsSuffix
+	if err := os.MkdirAll(versionsDir, 0755); err != nil {
+		return fmt.Errorf("failed to create version directory: %w", err)
+	}
+	versionPath := filepath.Join(versionsDir, uploadedAt.UTC().Format(versionLayout))
+	if err := copyFile(tmpPath, versionPath); err != nil {
+		return fmt.Errorf("failed to store version: %w", err)
+	}
+	if err := os.Rename(tmpPath, latestPath); err != nil {
+		return fmt.Errorf("failed to store upload: %w", err)
+	}
+	return b.prune(versionsDir, uploadedAt)
+}
+
+// prune removes versions beyond the retention limits, always keeping the newest
+func (b *BackupStore) prune(versionsDir string, now time.Time) error {
+	versions, err := readVersions(versionsDir)
+	if err != nil {
+		return err
+	}
+	for i, version := range versions {
+		if i == 0 {
+			continue
+		}
+		tooMany := b.policy.Versions > 0 && i >= b.policy.Versions
+		tooOld := b.policy.MaxAge > 0 && now.Sub(version.UploadedAt) > b.policy.MaxAge
+		if tooMany || tooOld {
+			if err := os.Remove(filepath.Join(versionsDir, version.ID)); err != nil {
+				return fmt.Errorf("failed to remove old version: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Devices lists the addresses of devices that have uploaded into an area
+func (b *BackupStore) Devices(areaName string) ([]string, error) {
+	area, err := b.area(areaName)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(filepath.Join(b.serveDir, area.Dir))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var devices []string
+	for _, entry := range entries {
+		if entry.IsDir() && net.ParseIP(entry.Name()) != nil {
+			devices = append(devices, entry.Name())
+		}
+	}
+	return devices, nil
+}
+
+// Files lists the files a device has uploaded into an area
+func (b *BackupStore) Files(areaName, device string) ([]BackupFile, error) {
+	area, err := b.area(areaName)
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(device) == nil {
+		return nil, fmt.Errorf("invalid device address %q", device)
+	}
+	deviceDir := filepath.Join(b.serveDir, area.Dir, device)
+
+	var files []BackupFile
+	err = filepath.WalkDir(deviceDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() || !strings.HasSuffix(d.Name(), versionsSuffix) {
+			return nil
+		}
+		rel, err := filepath.Rel(deviceDir, strings.TrimSuffix(path, versionsSuffix))
+		if err != nil {
+			return err
+		}
+		versions, err := readVersions(path)
+		if err != nil {
+			return err
+		}
+		if len(versions) > 0 {
+			files = append(files, BackupFile{Area: area.Name, Device: device, Name: filepath.ToSlash(rel), Versions: versions})
+		}
+		return filepath.SkipDir
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
+
+// File returns one uploaded file and its versions
+func (b *BackupStore) File(areaName, device, name string) (BackupFile, error) {
+	area, err := b.area(areaName)
+	if err != nil {
+		return BackupFile{}, err
+	}
+	latestPath, err := b.filePath(area, device, name)
+	if err != nil {
+		return BackupFile{}, err
+	}
+	versions, err := readVersions(latestPath + versionsSuffix)
+	if err != nil {
+		return BackupFile{}, err
+	}
+	if len(versions) == 0 {
+		return BackupFile{}, fmt.Errorf("no versions of %s: %w", name, fs.ErrNotExist)
+	}
+	return BackupFile{Area: area.Name, Device: device, Name: name, Versions: versions}, nil
+}
+
+// ReadVersion returns the contents of one version of a file
+func (b *BackupStore) ReadVersion(areaName, device, name, id string) ([]byte, error) {
+	if _, err := time.Parse(versionLayout, id); err != nil {
+		return nil, fmt.Errorf("invalid version %q", id)
+	}
+	area, err := b.area(areaName)
+	if err != nil {
+		return nil, err
+	}
+	latestPath, err := b.filePath(area, device, name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(filepath.Join(latestPath+versionsSuffix, id))
+}
+
+// readVersions lists the versions in a version directory, newest first
+func readVersions(dir string) ([]BackupVersion, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var versions []BackupVersion
+	for _, entry := range entries {
+		uploadedAt, err := time.Parse(versionLayout, entry.Name())
+		if err != nil || entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		versions = append(versions, BackupVersion{ID: entry.Name(), UploadedAt: uploadedAt, Size: info.Size()})
+	}
+
+	sort.Slice(versions, func(i, j int) bool { return versions[i].UploadedAt.After(versions[j].UploadedAt) })
+	return versions, nil
+}
+
+// copyFile copies src to a new file at dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,163 @@
+package tftp
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseUploadArea(t *testing.T) {
+	tests := []struct {
+		input     string
+		expected  UploadArea
+		expectErr bool
+	}{
+		{"backups", UploadArea{Name: "backups", Dir: "backups"}, false},
+		{"switches=backups/switches", UploadArea{Name: "switches", Dir: "backups/switches"}, false},
+		{" routers = /backups/routers/ ", UploadArea{Name: "routers", Dir: "backups/routers"}, false},
+		{"=backups", UploadArea{}, true},
+		{"a/b=backups", UploadArea{}, true},
+		{"escape=../outside", UploadArea{}, true},
+		{"switches=", UploadArea{}, true},
+	}
+
+	for _, tt := range tests {
+		area, err := ParseUploadArea(tt.input)
+		if (err != nil) != tt.expectErr {
+			t.Errorf("ParseUploadArea(%q) error = %v, expectErr %v", tt.input, err, tt.expectErr)
+			continue
+		}
+		if area != tt.expected {
+			t.Errorf("ParseUploadArea(%q) = %+v, expected %+v", tt.input, area, tt.expected)
+		}
+	}
+}
+
+func TestWriteHandlerKeepsVersions(t *testing.T) {
+	serveDir := t.TempDir()
+	policy, err := NewUploadPolicy([]string{"switches=backups/switches"}, []string{"10.0.0.0/24"})
+	if err != nil {
+		t.Fatalf("NewUploadPolicy failed: %v", err)
+	}
+	policy.Versions = 2
+
+	server := NewServer(serveDir)
+	server.SetUploadPolicy(policy)
+	client := net.UDPAddr{IP: net.ParseIP("10.0.0.5"), Port: 2000}
+
+	for _, config := range []string{"hostname sw1\n", "hostname sw1\nvlan 10\n", "hostname sw1\nvlan 20\n"} {
+		if err := server.writeHandler("switches/core/sw1.cfg", &fakeUpload{addr: client, data: config}); err != nil {
+			t.Fatalf("writeHandler failed: %v", err)
+		}
+	}
+
+	latest, err := os.ReadFile(filepath.Join(serveDir, "backups", "switches", "10.0.0.5", "core", "sw1.cfg"))
+	if err != nil || string(latest) != "hostname sw1\nvlan 20\n" {
+		t.Errorf("Latest copy = %q, %v", latest, err)
+	}
+
+	store := NewBackupStore(serveDir, policy)
+	devices, err := store.Devices("switches")
+	if err != nil || len(devices) != 1 || devices[0] != "10.0.0.5" {
+		t.Fatalf("Devices = %v, %v; expected [10.0.0.5]", devices, err)
+	}
+	files, err := store.Files("switches", "10.0.0.5")
+	if err != nil || len(files) != 1 || files[0].Name != "core/sw1.cfg" {
+		t.Fatalf("Files = %+v, %v; expected core/sw1.cfg", files, err)
+	}
+	if len(files[0].Versions) != 2 {
+		t.Fatalf("Expected retention to keep 2 versions, got %d", len(files[0].Versions))
+	}
+
+	newest, err := store.ReadVersion("switches", "10.0.0.5", "core/sw1.cfg", files[0].Latest().ID)
+	if err != nil || string(newest) != "hostname sw1\nvlan 20\n" {
+		t.Errorf("Newest version = %q, %v", newest, err)
+	}
+	previous, err := store.ReadVersion("switches", "10.0.0.5", "core/sw1.cfg", files[0].Versions[1].ID)
+	if err != nil || string(previous) != "hostname sw1\nvlan 10\n" {
+		t.Errorf("Previous version = %q, %v", previous, err)
+	}
+
+	if _, err := store.ReadVersion("switches", "10.0.0.5", "core/sw1.cfg", "../../../pxelinux.0"); err == nil {
+		t.Error("Expected an invalid version ID to be rejected")
+	}
+	if _, err := store.File("switches", "not-an-ip", "core/sw1.cfg"); err == nil {
+		t.Error("Expected an invalid device to be rejected")
+	}
+}
+
+func TestReadHandlerProtectsBackups(t *testing.T) {
+	serveDir := t.TempDir()
+	policy, err := NewUploadPolicy([]string{"switches=backups/switches"}, []string{"10.0.0.0/24"})
+	if err != nil {
+		t.Fatalf("NewUploadPolicy failed: %v", err)
+	}
+	server := NewServer(serveDir)
+	server.SetUploadPolicy(policy)
+
+	device := net.UDPAddr{IP: net.ParseIP("10.0.0.5"), Port: 2000}
+	if err := server.writeHandler("switches/sw1.cfg", &fakeUpload{addr: device, data: "hostname sw1\n"}); err != nil {
+		t.Fatalf("writeHandler failed: %v", err)
+	}
+	versions, err := os.ReadDir(filepath.Join(serveDir, "backups", "switches", "10.0.0.5", "sw1.cfg"+versionsSuffix))
+	if err != nil || len(versions) != 1 {
+		t.Fatalf("Expected one stored version, got %d (%v)", len(versions), err)
+	}
+
+	other := net.UDPAddr{IP: net.ParseIP("10.0.0.6"), Port: 2000}
+	tests := []struct {
+		name    string
+		client  net.UDPAddr
+		allowed bool
+	}{
+		{"backups/switches/10.0.0.5/sw1.cfg", device, true},
+		{"backups/switches/10.0.0.5/sw1.cfg", other, false},
+		{"backups/switches/10.0.0.5/sw1.cfg.versions/" + versions[0].Name(), device, false},
+		{"backups/switches/10.0.0.5/sw1.cfg.versions/" + versions[0].Name(), other, false},
+	}
+	for _, tt := range tests {
+		err := server.readHandler(tt.name, &fakeTransfer{addr: tt.client})
+		if tt.allowed && err != nil {
+			t.Errorf("Read of %s by %s failed: %v", tt.name, tt.client.IP, err)
+		}
+		if !tt.allowed && !errors.Is(err, errReadDenied) {
+			t.Errorf("Expected read of %s by %s to be denied, got %v", tt.name, tt.client.IP, err)
+		}
+	}
+}
+
+func TestBackupStoreMaxAge(t *testing.T) {
+	serveDir := t.TempDir()
+	policy := UploadPolicy{Areas: []UploadArea{{Name: "backups", Dir: "backups"}}, MaxAge: 24 * time.Hour}
+	store := NewBackupStore(serveDir, policy)
+
+	_, latestPath, err := store.resolve("backups/router.cfg", net.ParseIP("10.0.0.1"))
+	if err != nil {
+		t.Fatalf("resolve failed: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(latestPath), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	now := time.Now()
+	for _, uploadedAt := range []time.Time{now.Add(-72 * time.Hour), now.Add(-48 * time.Hour), now} {
+		tmp := filepath.Join(filepath.Dir(latestPath), ".upload-test")
+		if err := os.WriteFile(tmp, []byte(uploadedAt.String()), 0644); err != nil {
+			t.Fatalf("Failed to write upload: %v", err)
+		}
+		if err := store.save(latestPath, tmp, uploadedAt); err != nil {
+			t.Fatalf("save failed: %v", err)
+		}
+	}
+
+	file, err := store.File("backups", "10.0.0.1", "router.cfg")
+	if err != nil {
+		t.Fatalf("File failed: %v", err)
+	}
+	if len(file.Versions) != 1 || !file.Latest().UploadedAt.Equal(now) {
+		t.Errorf("Expected only the newest version to survive, got %+v", file.Versions)
+	}
+}
@@ -0,0 +1,144 @@
+package tftp
+
+import (
+	"container/list"
+	"errors"
+	"io"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// errNotCacheable is returned for files too large to keep in the cache
+var errNotCacheable = errors.New("file too large to cache")
+
+// CacheStats reports how effective the file cache has been
+type CacheStats struct {
+	Hits          uint64  `json:"hits"`
+	Misses        uint64  `json:"misses"`
+	Evictions     uint64  `json:"evictions"`
+	Invalidations uint64  `json:"invalidations"`
+	Entries       int     `json:"entries"`
+	Bytes         int64   `json:"bytes"`
+	MaxBytes      int64   `json:"max_bytes"`
+	HitRate       float64 `json:"hit_rate"`
+}
+
+// cacheEntry holds the contents of one file as of its modification time
+type cacheEntry struct {
+	path    string
+	modTime time.Time
+	size    int64
+	data    []byte
+}
+
+// FileCache keeps the contents of recently served files in memory, evicting
+// the least recently used files to stay under a size limit. Entries are
+// revalidated against the file's modification time and size on every read.
+type FileCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	bytes    int64
+	entries  map[string]*list.Element
+	lru      *list.List
+	stats    CacheStats
+}
+
+// NewFileCache creates a FileCache holding up to maxBytes of file contents
+func NewFileCache(maxBytes int64) *FileCache {
+	return &FileCache{
+		maxBytes: maxBytes,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// Read returns the contents of an open file, stored under key, from memory if
+// the cached copy is still current. Files larger than the cache return
+// errNotCacheable and should be streamed instead.
+func (c *FileCache) Read(key string, file fs.File) ([]byte, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if data, ok := c.lookup(key, info); ok {
+		return data, nil
+	}
+	if info.Size() > c.maxBytes {
+		return nil, errNotCacheable
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	c.store(&cacheEntry{path: key, modTime: info.ModTime(), size: int64(len(data)), data: data})
+	return data, nil
+}
+
+// lookup returns the cached contents of path if they match info
+func (c *FileCache) lookup(path string, info fs.FileInfo) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[path]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+
+	entry := element.Value.(*cacheEntry)
+	if !entry.modTime.Equal(info.ModTime()) || entry.size != info.Size() {
+		c.remove(element)
+		c.stats.Invalidations++
+		c.stats.Misses++
+		return nil, false
+	}
+
+	c.lru.MoveToFront(element)
+	c.stats.Hits++
+	return entry.data, true
+}
+
+// store adds an entry, evicting the least recently used entries to make room
+func (c *FileCache) store(entry *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Another transfer may have loaded the same file meanwhile
+	if element, ok := c.entries[entry.path]; ok {
+		c.remove(element)
+	}
+
+	for c.bytes+entry.size > c.maxBytes && c.lru.Len() > 0 {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+
+	c.entries[entry.path] = c.lru.PushFront(entry)
+	c.bytes += entry.size
+}
+
+// remove drops an entry; the caller holds the lock
+func (c *FileCache) remove(element *list.Element) {
+	entry := element.Value.(*cacheEntry)
+	c.lru.Remove(element)
+	delete(c.entries, entry.path)
+	c.bytes -= entry.size
+}
+
+// Stats returns the cache counters and current usage
+func (c *FileCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	stats.Bytes = c.bytes
+	stats.MaxBytes = c.maxBytes
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(total)
+	}
+	return stats
+}
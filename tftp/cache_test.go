@@ -0,0 +1,165 @@
+package tftp
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readCached opens name under dir and reads it through the cache
+func readCached(t *testing.T, cache *FileCache, dir, name string) (string, error) {
+	t.Helper()
+	file, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", name, err)
+	}
+	defer file.Close()
+	data, err := cache.Read(file.Name(), file)
+	return string(data), err
+}
+
+func writeTestFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+}
+
+func TestFileCacheHitsAndInvalidation(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "pxelinux.0", "version 1")
+	cache := NewFileCache(1024)
+
+	for i := 0; i < 3; i++ {
+		data, err := readCached(t, cache, dir, "pxelinux.0")
+		if err != nil || data != "version 1" {
+			t.Fatalf("Read = %q, %v; expected %q", data, err, "version 1")
+		}
+	}
+	stats := cache.Stats()
+	if stats.Hits != 2 || stats.Misses != 1 || stats.Entries != 1 {
+		t.Errorf("Expected 2 hits, 1 miss and 1 entry, got %+v", stats)
+	}
+
+	// A changed file is read again
+	writeTestFile(t, dir, "pxelinux.0", "version 2!")
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(dir, "pxelinux.0"), future, future); err != nil {
+		t.Fatalf("Failed to touch file: %v", err)
+	}
+	data, err := readCached(t, cache, dir, "pxelinux.0")
+	if err != nil || data != "version 2!" {
+		t.Fatalf("Read after change = %q, %v; expected %q", data, err, "version 2!")
+	}
+	if stats := cache.Stats(); stats.Invalidations != 1 || stats.Bytes != int64(len("version 2!")) {
+		t.Errorf("Expected one invalidation and the new size, got %+v", stats)
+	}
+}
+
+func TestFileCacheEviction(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b", "c"} {
+		writeTestFile(t, dir, name, strings.Repeat(name, 40))
+	}
+	writeTestFile(t, dir, "big", strings.Repeat("x", 200))
+	cache := NewFileCache(100)
+
+	readCached(t, cache, dir, "a")
+	readCached(t, cache, dir, "b")
+	readCached(t, cache, dir, "a") // a is now the most recently used
+	readCached(t, cache, dir, "c") // evicts b
+
+	stats := cache.Stats()
+	if stats.Evictions != 1 || stats.Entries != 2 || stats.Bytes != 80 {
+		t.Fatalf("Expected one eviction leaving 80 bytes in 2 entries, got %+v", stats)
+	}
+	readCached(t, cache, dir, "a")
+	if hits := cache.Stats().Hits; hits != 2 {
+		t.Errorf("Expected a to still be cached, got %d hits", hits)
+	}
+
+	if _, err := readCached(t, cache, dir, "big"); err != errNotCacheable {
+		t.Errorf("Expected errNotCacheable for a file larger than the cache, got %v", err)
+	}
+}
+
+func TestReadHandlerUsesCache(t *testing.T) {
+	serveDir := t.TempDir()
+	writeTestFile(t, serveDir, "pxelinux.0", "bootloader")
+	writeTestFile(t, serveDir, "initrd.img", strings.Repeat("i", 64))
+
+	server := NewServer(serveDir)
+	server.SetCache(NewFileCache(32))
+
+	for _, name := range []string{"pxelinux.0", "pxelinux.0", "initrd.img"} {
+		transfer := &fakeTransfer{addr: net.UDPAddr{IP: net.ParseIP("10.0.0.5"), Port: 2000}}
+		if err := server.readHandler(name, transfer); err != nil {
+			t.Fatalf("readHandler(%s) failed: %v", name, err)
+		}
+		expected, _ := os.ReadFile(filepath.Join(serveDir, name))
+		if string(transfer.data) != string(expected) {
+			t.Errorf("readHandler(%s) = %q, expected %q", name, transfer.data, expected)
+		}
+	}
+
+	if stats := server.cache.Stats(); stats.Hits != 1 || stats.Entries != 1 {
+		t.Errorf("Expected one hit and the large file left uncached, got %+v", stats)
+	}
+}
+
+// discardTransfer sends file contents nowhere, as fast as possible
+type discardTransfer struct{}
+
+func (discardTransfer) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(io.Discard, r)
+}
+
+func (discardTransfer) RemoteAddr() net.UDPAddr {
+	return net.UDPAddr{IP: net.ParseIP("10.0.0.5"), Port: 2000}
+}
+
+// BenchmarkConcurrentReads simulates a boot storm of clients fetching the same
+// boot files, with and without the cache.
+func BenchmarkConcurrentReads(b *testing.B) {
+	serveDir := b.TempDir()
+	files := map[string]int{
+		"pxelinux.0":  42 << 10,
+		"ldlinux.c32": 120 << 10,
+		"initrd.img":  8 << 20,
+	}
+	var names []string
+	var total int64
+	for name, size := range files {
+		if err := os.WriteFile(filepath.Join(serveDir, name), make([]byte, size), 0644); err != nil {
+			b.Fatalf("Failed to write %s: %v", name, err)
+		}
+		names = append(names, name)
+		total += int64(size)
+	}
+
+	for _, cacheSize := range []int64{0, 64 << 20} {
+		b.Run(fmt.Sprintf("cache=%dMB", cacheSize>>20), func(b *testing.B) {
+			server := NewServer(serveDir)
+			if cacheSize > 0 {
+				server.SetCache(NewFileCache(cacheSize))
+			}
+			b.SetBytes(total / int64(len(names)))
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					if err := server.readHandler(names[i%len(names)], discardTransfer{}); err != nil {
+						b.Error(err)
+					}
+					i++
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package tftp
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed defaults
+var defaultAssets embed.FS
+
+// DefaultAssets returns the boot menus and scripts built into the binary, so
+// PXE clients get a usable menu before any files are added to the TFTP directory.
+func DefaultAssets() fs.FS {
+	assets, err := fs.Sub(defaultAssets, "defaults")
+	if err != nil {
+		panic(err)
+	}
+	return assets
+}
@@ -0,0 +1,199 @@
+package tftp
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+
+	"ignite/security"
+)
+
+// Layer names, reported for each file so operators can tell where it came from
+const (
+	LayerOverride = "override" // Operator directory checked before everything else
+	LayerNetwork  = "network"  // Per-network root of the client's DHCP server
+	LayerShared   = "shared"   // The TFTP directory shared by all clients
+	LayerDefault  = "default"  // Assets built into the binary
+)
+
+// Layer is one named filesystem in a LayeredFS
+type Layer struct {
+	Name string
+	FS   fs.FS
+}
+
+// DirLayer returns a layer serving dir, confined the same way TFTP reads are:
+// traversal, hidden files and symlinks leading outside dir are refused.
+func DirLayer(name, dir string) Layer {
+	return Layer{Name: name, FS: dirFS{dir: dir, validator: security.NewTFTPSecurityValidator(dir)}}
+}
+
+// Path returns where name lives on disk, for layers created by DirLayer
+func (layer Layer) Path(name string) (string, error) {
+	d, ok := layer.FS.(dirFS)
+	if !ok {
+		return "", &fs.PathError{Op: "path", Path: name, Err: errors.ErrUnsupported}
+	}
+	return d.resolve("path", name)
+}
+
+// Entry is a directory entry together with the layer that provides it
+type Entry struct {
+	fs.DirEntry
+	Layer string
+}
+
+// LayeredFS is an fs.FS that looks each name up in its layers in order, so
+// files in earlier layers hide files of the same name in later ones.
+type LayeredFS struct {
+	layers []Layer
+}
+
+// NewLayeredFS creates a LayeredFS from layers, highest priority first.
+// Layers without a filesystem are skipped.
+func NewLayeredFS(layers ...Layer) *LayeredFS {
+	l := &LayeredFS{}
+	for _, layer := range layers {
+		if layer.FS != nil {
+			l.layers = append(l.layers, layer)
+		}
+	}
+	return l
+}
+
+// Layers returns the layers searched, highest priority first
+func (l *LayeredFS) Layers() []Layer {
+	return l.layers
+}
+
+// Open opens name from the first layer that has it
+func (l *LayeredFS) Open(name string) (fs.File, error) {
+	file, _, err := l.OpenLayer(name)
+	return file, err
+}
+
+// OpenLayer opens name from the first layer that has it and reports that layer
+func (l *LayeredFS) OpenLayer(name string) (fs.File, Layer, error) {
+	if !fs.ValidPath(name) {
+		return nil, Layer{}, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	for _, layer := range l.layers {
+		file, err := layer.FS.Open(name)
+		if err == nil {
+			return file, layer, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, layer, err
+		}
+	}
+	return nil, Layer{}, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// Locate returns the layer that serves name
+func (l *LayeredFS) Locate(name string) (Layer, error) {
+	file, layer, err := l.OpenLayer(name)
+	if err != nil {
+		return Layer{}, err
+	}
+	file.Close()
+	return layer, nil
+}
+
+// ReadDir merges the entries of name across all layers, sorted by name
+func (l *LayeredFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := l.Entries(name)
+	if err != nil {
+		return nil, err
+	}
+	dirEntries := make([]fs.DirEntry, len(entries))
+	for i, entry := range entries {
+		dirEntries[i] = entry.DirEntry
+	}
+	return dirEntries, nil
+}
+
+// Entries lists the directory name as clients see it, with each entry taken
+// from the first layer that has it.
+func (l *LayeredFS) Entries(name string) ([]Entry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	seen := make(map[string]bool)
+	var entries []Entry
+	found := false
+	for _, layer := range l.layers {
+		dirEntries, err := fs.ReadDir(layer.FS, name)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		found = true
+		for _, entry := range dirEntries {
+			if seen[entry.Name()] {
+				continue
+			}
+			seen[entry.Name()] = true
+			entries = append(entries, Entry{DirEntry: entry, Layer: layer.Name})
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// dirFS is an fs.FS over a directory that applies the TFTP path checks
+type dirFS struct {
+	dir       string
+	validator *security.TFTPSecurityValidator
+}
+
+// resolve maps name to a path inside the directory
+func (d dirFS) resolve(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return d.dir, nil
+	}
+	path, err := d.validator.ResolveTFTPPath(d.dir, name)
+	if err != nil {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return path, nil
+}
+
+func (d dirFS) Open(name string) (fs.File, error) {
+	path, err := d.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+// ReadDir lists a directory, leaving out hidden entries since they can't be read
+func (d dirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	path, err := d.resolve("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	visible := entries[:0]
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), ".") {
+			visible = append(visible, entry)
+		}
+	}
+	return visible, nil
+}
@@ -0,0 +1,142 @@
+package tftp
+
+import (
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLayeredFS(t *testing.T) {
+	override := t.TempDir()
+	shared := t.TempDir()
+	writeTestFile(t, override, "boot.ipxe", "operator")
+	writeTestFile(t, shared, "boot.ipxe", "shared")
+	writeTestFile(t, shared, "pxelinux.0", "bootloader")
+	defaults := fstest.MapFS{
+		"boot.ipxe":                      {Data: []byte("default")},
+		"grub.cfg":                       {Data: []byte("default grub")},
+		"boot-bios/pxelinux.cfg/default": {Data: []byte("default menu")},
+	}
+
+	files := NewLayeredFS(
+		DirLayer(LayerOverride, override),
+		Layer{}, // layers without a filesystem are skipped
+		DirLayer(LayerShared, shared),
+		Layer{Name: LayerDefault, FS: defaults},
+	)
+
+	tests := []struct {
+		name     string
+		expected string
+		layer    string
+	}{
+		{"boot.ipxe", "operator", LayerOverride},
+		{"pxelinux.0", "bootloader", LayerShared},
+		{"boot-bios/pxelinux.cfg/default", "default menu", LayerDefault},
+	}
+	for _, tt := range tests {
+		data, err := fs.ReadFile(files, tt.name)
+		if err != nil || string(data) != tt.expected {
+			t.Errorf("ReadFile(%s) = %q, %v; expected %q", tt.name, data, err, tt.expected)
+		}
+		if layer, err := files.Locate(tt.name); err != nil || layer.Name != tt.layer {
+			t.Errorf("Locate(%s) = %q, %v; expected %q", tt.name, layer.Name, err, tt.layer)
+		}
+	}
+
+	entries, err := files.Entries(".")
+	if err != nil {
+		t.Fatalf("Entries failed: %v", err)
+	}
+	expected := map[string]string{
+		"boot-bios":  LayerDefault,
+		"boot.ipxe":  LayerOverride,
+		"grub.cfg":   LayerDefault,
+		"pxelinux.0": LayerShared,
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %d entries, got %d", len(expected), len(entries))
+	}
+	for _, entry := range entries {
+		if expected[entry.Name()] != entry.Layer {
+			t.Errorf("Entry %s from layer %q, expected %q", entry.Name(), entry.Layer, expected[entry.Name()])
+		}
+	}
+
+	if _, err := files.Open("../etc/passwd"); err == nil {
+		t.Error("Expected paths outside the layers to be rejected")
+	}
+	if _, err := files.Open("missing.cfg"); !os.IsNotExist(err) {
+		t.Errorf("Expected a not-exist error for a missing file, got %v", err)
+	}
+}
+
+func TestLayerPath(t *testing.T) {
+	dir := t.TempDir()
+	path, err := DirLayer(LayerShared, dir).Path("pxelinux.cfg/default")
+	if err != nil || path != filepath.Join(dir, "pxelinux.cfg", "default") {
+		t.Errorf("Path = %q, %v", path, err)
+	}
+	if _, err := (Layer{Name: LayerDefault, FS: DefaultAssets()}).Path("boot.ipxe"); err == nil {
+		t.Error("Expected embedded files to have no path on disk")
+	}
+}
+
+func TestDefaultAssets(t *testing.T) {
+	for _, name := range []string{"boot.ipxe", "grub.cfg", "boot-bios/pxelinux.cfg/default", "boot-efi/pxelinux.cfg/default"} {
+		if _, err := fs.Stat(DefaultAssets(), name); err != nil {
+			t.Errorf("Expected default asset %s: %v", name, err)
+		}
+	}
+}
+
+func TestReadHandlerLayers(t *testing.T) {
+	serveDir := t.TempDir()
+	override := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(serveDir, "racks", "r100"), 0755); err != nil {
+		t.Fatalf("Failed to create rack directory: %v", err)
+	}
+	writeTestFile(t, serveDir, "racks/r100/grub.cfg", "rack grub")
+	writeTestFile(t, serveDir, "pxelinux.0", "shared bootloader")
+	writeTestFile(t, override, "pxelinux.0", "patched bootloader")
+
+	server := NewServer(serveDir)
+	server.SetOverrideDir(override)
+	server.SetDefaults(DefaultAssets())
+	server.SetCache(NewFileCache(1 << 20))
+	server.SetRootResolver(func(ip net.IP) string {
+		if ip.Equal(net.ParseIP("10.100.0.50")) {
+			return "racks/r100"
+		}
+		return ""
+	})
+
+	defaultGrub, _ := fs.ReadFile(DefaultAssets(), "grub.cfg")
+	tests := []struct {
+		client   string
+		filename string
+		expected string
+	}{
+		{"10.100.0.50", "pxelinux.0", "patched bootloader"},
+		{"10.100.0.50", "grub.cfg", "rack grub"},
+		{"10.200.0.50", "grub.cfg", string(defaultGrub)},
+		{"10.200.0.50", "/grub.cfg", string(defaultGrub)},
+	}
+	for _, tt := range tests {
+		transfer := &fakeTransfer{addr: net.UDPAddr{IP: net.ParseIP(tt.client), Port: 2000}}
+		if err := server.readHandler(tt.filename, transfer); err != nil {
+			t.Fatalf("readHandler(%s) for %s failed: %v", tt.filename, tt.client, err)
+		}
+		if string(transfer.data) != tt.expected {
+			t.Errorf("readHandler(%s) for %s = %q, expected %q", tt.filename, tt.client, transfer.data, tt.expected)
+		}
+	}
+
+	transfer := &fakeTransfer{addr: net.UDPAddr{IP: net.ParseIP("10.200.0.50"), Port: 2000}}
+	if err := server.readHandler("boot-bios", transfer); err == nil {
+		t.Error("Expected reading a directory to fail")
+	}
+}
@@ -0,0 +1,352 @@
+package tftp
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"ignite/security"
+)
+
+// errExtractLimit stops an extraction whose contents exceed the size limit
+var errExtractLimit = errors.New("archive contents exceed the extraction limit")
+
+// FileManager changes the files in the TFTP directory. Every path it is given
+// is relative to that directory and goes through the TFTP path checks.
+type FileManager struct {
+	root       string
+	maxExtract int64
+	validator  *security.TFTPSecurityValidator
+}
+
+// NewFileManager creates a FileManager for root that extracts archives of at
+// most maxExtract bytes of contents, or of any size when maxExtract is 0
+func NewFileManager(root string, maxExtract int64) *FileManager {
+	return &FileManager{
+		root:       root,
+		maxExtract: maxExtract,
+		validator:  security.NewTFTPSecurityValidator(root),
+	}
+}
+
+// resolve maps a relative path to a path inside the TFTP directory. The
+// directory itself is refused, so no operation can remove or replace it.
+func (m *FileManager) resolve(name string) (string, error) {
+	name = strings.Trim(security.NormalizeTFTPFilename(name), "/")
+	if name == "" || path.Clean(name) == "." {
+		return "", fmt.Errorf("the TFTP directory itself cannot be changed")
+	}
+	full, err := m.validator.ResolveTFTPPath(m.root, name)
+	if err != nil {
+		return "", fmt.Errorf("invalid path %q: %w", name, err)
+	}
+	return full, nil
+}
+
+// resolveDir is like resolve but also accepts the TFTP directory itself
+func (m *FileManager) resolveDir(name string) (string, error) {
+	name = strings.Trim(security.NormalizeTFTPFilename(name), "/")
+	if name == "" || path.Clean(name) == "." {
+		return m.root, nil
+	}
+	return m.resolve(name)
+}
+
+// CreateDirectory creates a directory and any missing parents
+func (m *FileManager) CreateDirectory(name string) error {
+	dir, err := m.resolve(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	return nil
+}
+
+// DeleteDirectory removes a directory and everything in it
+func (m *FileManager) DeleteDirectory(name string) error {
+	dir, err := m.resolve(name)
+	if err != nil {
+		return err
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", name)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to delete directory: %w", err)
+	}
+	return nil
+}
+
+// GetDirectorySize returns the total size of the files below a directory
+func (m *FileManager) GetDirectorySize(name string) (int64, error) {
+	dir, err := m.resolveDir(name)
+	if err != nil {
+		return 0, err
+	}
+
+	var size int64
+	err = filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to measure directory: %w", err)
+	}
+	return size, nil
+}
+
+// Move renames a file or directory. A destination that is an existing
+// directory receives the source inside it; other existing files are not replaced.
+func (m *FileManager) Move(from, to string) error {
+	src, err := m.resolve(from)
+	if err != nil {
+		return err
+	}
+	dst, err := m.resolveDir(to)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(src); err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(dst); err == nil && info.IsDir() {
+		if dst, err = m.resolve(path.Join(strings.Trim(security.NormalizeTFTPFilename(to), "/"), filepath.Base(src))); err != nil {
+			return err
+		}
+	}
+	if _, err := os.Lstat(dst); err == nil {
+		return fmt.Errorf("%s already exists", to)
+	}
+	if dst == src || strings.HasPrefix(dst, src+string(filepath.Separator)) {
+		return fmt.Errorf("cannot move %s into itself", from)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("failed to create destination directory: %w", err)
+	}
+	if err := os.Rename(src, dst); err != nil {
+		return fmt.Errorf("failed to move: %w", err)
+	}
+	return nil
+}
+
+// IsArchive reports whether Extract can unpack the named file
+func IsArchive(name string) bool {
+	return archiveFormat(name) != ""
+}
+
+// archiveFormat names the archive format of a file by its extension
+func archiveFormat(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip"
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tar.gz"
+	case strings.HasSuffix(lower, ".tar"):
+		return "tar"
+	default:
+		return ""
+	}
+}
+
+// Extract unpacks a tar, tar.gz or zip archive into dest, creating it if
+// needed, and returns the number of files written. Entries that would land
+// outside dest, hidden entries and links are skipped or refused, and existing
+// files are overwritten.
+func (m *FileManager) Extract(archive, dest string) (int, error) {
+	src, err := m.resolve(archive)
+	if err != nil {
+		return 0, err
+	}
+	destDir, err := m.resolveDir(dest)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return 0, fmt.Errorf("failed to create destination directory: %w", err)
+	}
+
+	x := &extractor{manager: m, dest: destDir, remaining: m.maxExtract}
+	switch archiveFormat(archive) {
+	case "zip":
+		err = x.zip(src)
+	case "tar.gz":
+		err = x.tar(src, true)
+	case "tar":
+		err = x.tar(src, false)
+	default:
+		return 0, fmt.Errorf("%s is not a tar or zip archive", archive)
+	}
+	if err != nil {
+		return x.files, fmt.Errorf("failed to extract %s: %w", archive, err)
+	}
+	return x.files, nil
+}
+
+// extractor writes archive entries below dest
+type extractor struct {
+	manager   *FileManager
+	dest      string
+	remaining int64
+	files     int
+}
+
+func (x *extractor) tar(src string, gzipped bool) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if gzipped {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = x.dir(header.Name)
+		case tar.TypeReg:
+			err = x.file(header.Name, header.FileInfo().Mode(), tr)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (x *extractor) zip(src string) error {
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, entry := range zr.File {
+		if entry.FileInfo().IsDir() {
+			if err := x.dir(entry.Name); err != nil {
+				return err
+			}
+			continue
+		}
+		if !entry.Mode().IsRegular() {
+			continue
+		}
+		rc, err := entry.Open()
+		if err != nil {
+			return err
+		}
+		err = x.file(entry.Name, entry.Mode(), rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// target resolves an entry name inside dest, reporting false for hidden
+// entries such as macOS resource forks, which are skipped
+func (x *extractor) target(name string) (string, bool, error) {
+	name = strings.Trim(security.NormalizeTFTPFilename(name), "/")
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") && part != "." && part != ".." {
+			return "", false, nil
+		}
+	}
+	if name == "" || path.Clean(name) == "." {
+		return "", false, nil
+	}
+	full, err := x.manager.validator.ResolveTFTPPath(x.dest, name)
+	if err != nil {
+		return "", false, fmt.Errorf("unsafe archive entry %q: %w", name, err)
+	}
+	return full, true, nil
+}
+
+func (x *extractor) dir(name string) error {
+	dir, ok, err := x.target(name)
+	if err != nil || !ok {
+		return err
+	}
+	return os.MkdirAll(dir, 0755)
+}
+
+func (x *extractor) file(name string, mode fs.FileMode, r io.Reader) error {
+	target, ok, err := x.target(name)
+	if err != nil || !ok {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	// Archived permissions are kept only as far as the executable bit
+	perm := fs.FileMode(0644)
+	if mode&0111 != 0 {
+		perm = 0755
+	}
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	if x.manager.maxExtract > 0 {
+		r = io.LimitReader(r, x.remaining+1)
+	}
+	written, err := io.Copy(out, r)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if x.manager.maxExtract > 0 {
+		x.remaining -= written
+		if x.remaining < 0 {
+			os.Remove(target)
+			return errExtractLimit
+		}
+	}
+	x.files++
+	return nil
+}
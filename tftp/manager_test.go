@@ -0,0 +1,161 @@
+package tftp
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileManagerDirectories(t *testing.T) {
+	root := t.TempDir()
+	m := NewFileManager(root, 0)
+
+	if err := m.CreateDirectory("images/ubuntu"); err != nil {
+		t.Fatalf("CreateDirectory failed: %v", err)
+	}
+	writeTestFile(t, filepath.Join(root, "images", "ubuntu"), "vmlinuz", "12345")
+	writeTestFile(t, filepath.Join(root, "images"), "README.txt", "123")
+
+	size, err := m.GetDirectorySize("images")
+	if err != nil || size != 8 {
+		t.Errorf("GetDirectorySize = %d, %v; expected 8", size, err)
+	}
+	if size, err := m.GetDirectorySize(""); err != nil || size != 8 {
+		t.Errorf("GetDirectorySize of the root = %d, %v; expected 8", size, err)
+	}
+
+	if err := m.DeleteDirectory("images/README.txt"); err == nil {
+		t.Errorf("DeleteDirectory removed a file")
+	}
+	if err := m.DeleteDirectory("images"); err != nil {
+		t.Fatalf("DeleteDirectory failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "images")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Directory still exists after DeleteDirectory")
+	}
+}
+
+func TestFileManagerRefusesUnsafePaths(t *testing.T) {
+	root := t.TempDir()
+	m := NewFileManager(root, 0)
+	writeTestFile(t, root, "pxelinux.0", "boot")
+
+	tests := []struct {
+		name string
+		op   func() error
+	}{
+		{"Create outside root", func() error { return m.CreateDirectory("../escape") }},
+		{"Create hidden", func() error { return m.CreateDirectory(".uploads") }},
+		{"Delete root", func() error { return m.DeleteDirectory("") }},
+		{"Delete outside root", func() error { return m.DeleteDirectory("../") }},
+		{"Size outside root", func() error { _, err := m.GetDirectorySize("../.."); return err }},
+		{"Move outside root", func() error { return m.Move("pxelinux.0", "../pxelinux.0") }},
+		{"Move root", func() error { return m.Move(".", "elsewhere") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.op(); err == nil {
+				t.Errorf("Expected an error")
+			}
+		})
+	}
+}
+
+func TestFileManagerMove(t *testing.T) {
+	root := t.TempDir()
+	m := NewFileManager(root, 0)
+	writeTestFile(t, root, "pxelinux.0", "boot")
+	writeTestFile(t, root, "ldlinux.c32", "module")
+	if err := m.CreateDirectory("bios"); err != nil {
+		t.Fatalf("CreateDirectory failed: %v", err)
+	}
+
+	if err := m.Move("pxelinux.0", "bios"); err != nil {
+		t.Fatalf("Move into directory failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "bios", "pxelinux.0")); err != nil {
+		t.Errorf("File not moved into directory: %v", err)
+	}
+
+	if err := m.Move("ldlinux.c32", "bios/ldlinux-6.c32"); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	writeTestFile(t, root, "other.c32", "other")
+	if err := m.Move("other.c32", "bios/ldlinux-6.c32"); err == nil {
+		t.Errorf("Move replaced an existing file")
+	}
+	if err := m.Move("bios", "bios/nested"); err == nil {
+		t.Errorf("Moved a directory into itself")
+	}
+}
+
+func TestFileManagerExtract(t *testing.T) {
+	root := t.TempDir()
+	m := NewFileManager(root, 0)
+
+	var tarball bytes.Buffer
+	gz := gzip.NewWriter(&tarball)
+	tw := tar.NewWriter(gz)
+	for name, content := range map[string]string{
+		"syslinux/pxelinux.0":  "boot",
+		"syslinux/ldlinux.c32": "module",
+		"._pxelinux.0":         "resource fork",
+	} {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(content))
+	}
+	tw.WriteHeader(&tar.Header{Name: "syslinux/escape", Linkname: "/etc/passwd", Typeflag: tar.TypeSymlink})
+	tw.Close()
+	gz.Close()
+	writeTestFile(t, root, "syslinux.tar.gz", tarball.String())
+
+	count, err := m.Extract("syslinux.tar.gz", "boot-bios")
+	if err != nil || count != 2 {
+		t.Fatalf("Extract = %d, %v; expected 2 files", count, err)
+	}
+	data, err := os.ReadFile(filepath.Join(root, "boot-bios", "syslinux", "pxelinux.0"))
+	if err != nil || string(data) != "boot" {
+		t.Errorf("Extracted file = %q, %v", data, err)
+	}
+	if _, err := os.Lstat(filepath.Join(root, "boot-bios", "syslinux", "escape")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Symlink entry was extracted")
+	}
+	if _, err := os.Stat(filepath.Join(root, "boot-bios", "._pxelinux.0")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Hidden entry was extracted")
+	}
+}
+
+func TestFileManagerExtractRefusesUnsafeZips(t *testing.T) {
+	root := t.TempDir()
+
+	zipWith := func(name, content string) string {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		w, _ := zw.Create(name)
+		w.Write([]byte(content))
+		zw.Close()
+		return buf.String()
+	}
+	writeTestFile(t, root, "slip.zip", zipWith("../../evil.cfg", "pwned"))
+	writeTestFile(t, root, "bomb.zip", zipWith("big.img", string(make([]byte, 4096))))
+
+	if _, err := NewFileManager(root, 0).Extract("slip.zip", "out"); err == nil {
+		t.Errorf("Extracted an entry escaping the destination")
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(root), "evil.cfg")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Traversal entry written outside the TFTP directory")
+	}
+
+	if _, err := NewFileManager(root, 1024).Extract("bomb.zip", "out"); !errors.Is(err, errExtractLimit) {
+		t.Errorf("Extract over the limit returned %v, expected errExtractLimit", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "out", "big.img")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("File over the limit was kept")
+	}
+}
@@ -0,0 +1,242 @@
+package tftp
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"ignite/dhcp"
+)
+
+// Transfer directions
+const (
+	DirectionRead  = "read"
+	DirectionWrite = "write"
+)
+
+// Transfer outcomes
+const (
+	OutcomeSuccess  = "success"
+	OutcomeNotFound = "not_found"
+	OutcomeDenied   = "denied"
+	OutcomeFailed   = "failed"
+)
+
+// stateSource identifies TFTP driven changes in lease state history
+const stateSource = "tftp"
+
+// Transfer records a single TFTP transfer once it has finished
+type Transfer struct {
+	ClientIP  net.IP        `json:"client_ip"`
+	Filename  string        `json:"filename"`
+	Direction string        `json:"direction"`
+	Bytes     int64         `json:"bytes"`
+	Duration  time.Duration `json:"duration"`
+	BlockSize int           `json:"block_size"`
+	Outcome   string        `json:"outcome"`
+	Error     string        `json:"error,omitempty"`
+	StartedAt time.Time     `json:"started_at"`
+}
+
+// TransferObserver is called for every transfer the server finishes
+type TransferObserver func(Transfer)
+
+// AddTransferObserver registers an observer for finished transfers.
+func (s *Server) AddTransferObserver(observer TransferObserver) {
+	s.observers = append(s.observers, observer)
+}
+
+// recordTransfer passes a finished transfer to the observers
+func (s *Server) recordTransfer(transfer Transfer) {
+	for _, observer := range s.observers {
+		observer(transfer)
+	}
+}
+
+// meteredReader counts the bytes sent to a client. The TFTP library reads one
+// block at a time, so the largest read is the negotiated block size.
+type meteredReader struct {
+	r         io.Reader
+	bytes     int64
+	blockSize int
+}
+
+func (m *meteredReader) Read(p []byte) (int, error) {
+	if len(p) > m.blockSize {
+		m.blockSize = len(p)
+	}
+	n, err := m.r.Read(p)
+	m.bytes += int64(n)
+	return n, err
+}
+
+// meteredReadSeeker is a meteredReader over a seekable source. It keeps the
+// Seeker visible so the TFTP library can still answer tsize requests.
+type meteredReadSeeker struct {
+	*meteredReader
+	seeker io.Seeker
+}
+
+func (m *meteredReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	return m.seeker.Seek(offset, whence)
+}
+
+// meter wraps r to count the bytes read from it, forwarding Seek when r
+// supports it
+func meter(r io.Reader) (io.Reader, *meteredReader) {
+	m := &meteredReader{r: r}
+	if seeker, ok := r.(io.Seeker); ok {
+		return &meteredReadSeeker{m, seeker}, m
+	}
+	return m, m
+}
+
+// meteredWriter counts the bytes received from a client, one block per write
+type meteredWriter struct {
+	w         io.Writer
+	bytes     int64
+	blockSize int
+}
+
+func (m *meteredWriter) Write(p []byte) (int, error) {
+	if len(p) > m.blockSize {
+		m.blockSize = len(p)
+	}
+	n, err := m.w.Write(p)
+	m.bytes += int64(n)
+	return n, err
+}
+
+// TransferLog keeps the most recent transfers of each client in memory
+type TransferLog struct {
+	mu      sync.RWMutex
+	perHost int
+	hosts   map[string][]Transfer
+}
+
+// NewTransferLog creates a TransferLog keeping up to perHost transfers per client
+func NewTransferLog(perHost int) *TransferLog {
+	return &TransferLog{
+		perHost: perHost,
+		hosts:   make(map[string][]Transfer),
+	}
+}
+
+// Record adds a transfer to its client's history. It satisfies TransferObserver.
+func (l *TransferLog) Record(transfer Transfer) {
+	if transfer.ClientIP == nil {
+		return
+	}
+	key := transfer.ClientIP.String()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	history := append(l.hosts[key], transfer)
+	if len(history) > l.perHost {
+		history = history[len(history)-l.perHost:]
+	}
+	l.hosts[key] = history
+}
+
+// History returns the transfers of a client, newest first
+func (l *TransferLog) History(ip net.IP) []Transfer {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	history := l.hosts[ip.String()]
+	result := make([]Transfer, len(history))
+	for i, transfer := range history {
+		result[len(history)-1-i] = transfer
+	}
+	return result
+}
+
+// LeaseStateTracker advances lease state from the files a host fetches
+type LeaseStateTracker struct {
+	leaseService dhcp.LeaseService
+}
+
+// NewLeaseStateTracker creates a new LeaseStateTracker
+func NewLeaseStateTracker(leaseService dhcp.LeaseService) *LeaseStateTracker {
+	return &LeaseStateTracker{leaseService: leaseService}
+}
+
+// Record moves the client's lease to pxe_requested when it fetches a boot
+// loader and to booting when it fetches a kernel or initrd. It satisfies
+// TransferObserver.
+func (t *LeaseStateTracker) Record(transfer Transfer) {
+	if transfer.Direction != DirectionRead || transfer.Outcome != OutcomeSuccess || transfer.ClientIP == nil {
+		return
+	}
+
+	var newState string
+	switch ClassifyFile(transfer.Filename) {
+	case FileBootLoader:
+		newState = dhcp.StatePXERequested
+	case FileKernel, FileInitrd:
+		newState = dhcp.StateBooting
+	default:
+		return
+	}
+
+	ctx := context.Background()
+	lease, err := t.leaseService.GetLeaseByIP(ctx, transfer.ClientIP)
+	if err != nil {
+		return // Not one of our clients
+	}
+	if !advancesTo(lease.State, newState) {
+		return
+	}
+
+	if err := t.leaseService.UpdateLeaseState(ctx, lease.MAC, newState, stateSource); err != nil {
+		log.Printf("Failed to update lease state for %s: %v", lease.MAC, err)
+	}
+}
+
+// advancesTo reports whether a TFTP fetch should move a lease from its current
+// state. Installed hosts that chain through the boot loader on every reboot
+// keep their state until they fetch a kernel again.
+func advancesTo(current, next string) bool {
+	if current == next {
+		return false
+	}
+	if next == dhcp.StatePXERequested {
+		switch current {
+		case dhcp.StateImaging, dhcp.StateImaged, dhcp.StateConfiguring, dhcp.StateComplete:
+			return false
+		}
+	}
+	return true
+}
+
+// Kinds of files fetched during a network boot
+const (
+	FileBootLoader = "bootloader"
+	FileKernel     = "kernel"
+	FileInitrd     = "initrd"
+	FileOther      = "other"
+)
+
+// ClassifyFile guesses what part of the boot process a file belongs to from its name
+func ClassifyFile(filename string) string {
+	base := strings.ToLower(path.Base(strings.ReplaceAll(filename, "\\", "/")))
+
+	switch {
+	case strings.HasPrefix(base, "vmlinuz") || strings.HasPrefix(base, "bzimage") ||
+		base == "linux" || base == "kernel" || strings.HasSuffix(base, ".kernel"):
+		return FileKernel
+	case strings.HasPrefix(base, "initrd") || strings.HasPrefix(base, "initramfs") ||
+		strings.HasSuffix(base, ".initrd"):
+		return FileInitrd
+	case strings.HasSuffix(base, ".0") || strings.HasSuffix(base, ".pxe") || strings.HasSuffix(base, ".kpxe") ||
+		strings.HasSuffix(base, ".efi") || strings.HasSuffix(base, ".kkpxe"):
+		return FileBootLoader
+	}
+	return FileOther
+}
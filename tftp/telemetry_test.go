@@ -0,0 +1,174 @@
+package tftp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ignite/dhcp"
+)
+
+func TestClassifyFile(t *testing.T) {
+	tests := []struct {
+		filename string
+		expected string
+	}{
+		{"pxelinux.0", FileBootLoader},
+		{"boot-bios/pxelinux.0", FileBootLoader},
+		{"undionly.kpxe", FileBootLoader},
+		{"boot-efi/syslinux.efi", FileBootLoader},
+		{"ubuntu/22.04/vmlinuz", FileKernel},
+		{"centos\\vmlinuz-5.14", FileKernel},
+		{"ubuntu/22.04/initrd.img", FileInitrd},
+		{"nixos/initramfs.cpio", FileInitrd},
+		{"pxelinux.cfg/default", FileOther},
+		{"ldlinux.c32", FileOther},
+	}
+
+	for _, tt := range tests {
+		if got := ClassifyFile(tt.filename); got != tt.expected {
+			t.Errorf("ClassifyFile(%s) = %s, expected %s", tt.filename, got, tt.expected)
+		}
+	}
+}
+
+func TestReadHandlerRecordsTransfers(t *testing.T) {
+	serveDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(serveDir, "pxelinux.0"), []byte("bootloader"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	server := NewServer(serveDir)
+	transferLog := NewTransferLog(10)
+	server.AddTransferObserver(transferLog.Record)
+
+	client := net.ParseIP("10.0.0.5")
+	if err := server.readHandler("pxelinux.0", &fakeTransfer{addr: net.UDPAddr{IP: client, Port: 2000}}); err != nil {
+		t.Fatalf("readHandler failed: %v", err)
+	}
+	if err := server.readHandler("missing.0", &fakeTransfer{addr: net.UDPAddr{IP: client, Port: 2001}}); err == nil {
+		t.Fatal("Expected an error for a missing file")
+	}
+
+	history := transferLog.History(client)
+	if len(history) != 2 {
+		t.Fatalf("Expected 2 transfers, got %d", len(history))
+	}
+
+	// Newest first
+	if history[0].Filename != "missing.0" || history[0].Outcome != OutcomeNotFound {
+		t.Errorf("Unexpected failed transfer: %+v", history[0])
+	}
+	if history[1].Filename != "pxelinux.0" || history[1].Outcome != OutcomeSuccess || history[1].Bytes != int64(len("bootloader")) {
+		t.Errorf("Unexpected successful transfer: %+v", history[1])
+	}
+	if history[1].Direction != DirectionRead || history[1].BlockSize == 0 {
+		t.Errorf("Expected a read with a block size, got %+v", history[1])
+	}
+
+	if other := transferLog.History(net.ParseIP("10.0.0.6")); len(other) != 0 {
+		t.Errorf("Expected no transfers for another client, got %d", len(other))
+	}
+}
+
+func TestMeterForwardsSeek(t *testing.T) {
+	src, counts := meter(strings.NewReader("bootloader"))
+	seeker, ok := src.(io.Seeker)
+	if !ok {
+		t.Fatal("Expected the meter to keep the Seeker the library uses for tsize")
+	}
+	if size, err := seeker.Seek(0, io.SeekEnd); err != nil || size != int64(len("bootloader")) {
+		t.Errorf("Expected size %d, got %d (%v)", len("bootloader"), size, err)
+	}
+	seeker.Seek(0, io.SeekStart)
+	if data, _ := io.ReadAll(src); string(data) != "bootloader" || counts.bytes != int64(len(data)) {
+		t.Errorf("Expected the full file to be read and counted, got %q and %d bytes", data, counts.bytes)
+	}
+
+	src, _ = meter(io.MultiReader(strings.NewReader("x")))
+	if _, ok := src.(io.Seeker); ok {
+		t.Error("Expected no Seeker for a source that cannot seek")
+	}
+}
+
+func TestTransferLogLimit(t *testing.T) {
+	transferLog := NewTransferLog(3)
+	client := net.ParseIP("10.0.0.5")
+	for i := 0; i < 5; i++ {
+		transferLog.Record(Transfer{ClientIP: client, Filename: string(rune('a' + i))})
+	}
+
+	history := transferLog.History(client)
+	if len(history) != 3 {
+		t.Fatalf("Expected 3 transfers, got %d", len(history))
+	}
+	if history[0].Filename != "e" || history[2].Filename != "c" {
+		t.Errorf("Expected the newest transfers, got %+v", history)
+	}
+}
+
+// fakeLeaseService serves a single lease and records state changes
+type fakeLeaseService struct {
+	dhcp.LeaseService
+	lease   *dhcp.Lease
+	updates []string
+}
+
+func (f *fakeLeaseService) GetLeaseByIP(ctx context.Context, ip net.IP) (*dhcp.Lease, error) {
+	if f.lease != nil && f.lease.IP.Equal(ip) {
+		return f.lease, nil
+	}
+	return nil, errors.New("lease not found")
+}
+
+func (f *fakeLeaseService) GetLeaseByMAC(ctx context.Context, mac string) (*dhcp.Lease, error) {
+	if f.lease != nil && f.lease.MAC == mac {
+		return f.lease, nil
+	}
+	return nil, errors.New("lease not found")
+}
+
+func (f *fakeLeaseService) UpdateLeaseState(ctx context.Context, mac string, newState string, source string) error {
+	f.updates = append(f.updates, newState)
+	f.lease.UpdateState(newState, source)
+	return nil
+}
+
+func TestLeaseStateTracker(t *testing.T) {
+	client := net.ParseIP("10.0.0.5")
+	leases := &fakeLeaseService{lease: &dhcp.Lease{MAC: "aa:bb:cc:dd:ee:ff", IP: client, State: dhcp.StateAssigned}}
+	tracker := NewLeaseStateTracker(leases)
+
+	read := func(filename, outcome string) {
+		tracker.Record(Transfer{ClientIP: client, Filename: filename, Direction: DirectionRead, Outcome: outcome, StartedAt: time.Now()})
+	}
+
+	read("pxelinux.0", OutcomeNotFound)
+	read("pxelinux.cfg/default", OutcomeSuccess)
+	if len(leases.updates) != 0 {
+		t.Fatalf("Expected no state changes, got %v", leases.updates)
+	}
+
+	read("pxelinux.0", OutcomeSuccess)
+	read("ubuntu/vmlinuz", OutcomeSuccess)
+	read("ubuntu/initrd.img", OutcomeSuccess)
+	if len(leases.updates) != 2 || leases.updates[0] != dhcp.StatePXERequested || leases.updates[1] != dhcp.StateBooting {
+		t.Fatalf("Expected pxe_requested then booting, got %v", leases.updates)
+	}
+
+	// Installed hosts passing through PXE on reboot keep their state
+	leases.lease.State = dhcp.StateComplete
+	read("pxelinux.0", OutcomeSuccess)
+	if leases.lease.State != dhcp.StateComplete {
+		t.Errorf("Expected complete host to stay complete, got %s", leases.lease.State)
+	}
+
+	// Unknown clients are ignored
+	tracker.Record(Transfer{ClientIP: net.ParseIP("10.0.0.9"), Filename: "pxelinux.0", Direction: DirectionRead, Outcome: OutcomeSuccess})
+}
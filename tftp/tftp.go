@@ -1,38 +1,228 @@
 package tftp
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"net"
 	"os"
+	"path"
+	"path/filepath"
 	"time"
 
+	"ignite/security"
+
 	v3 "github.com/pin/tftp/v3"
 )
 
+// errWriteDenied is sent to clients whose write requests are refused
+var errWriteDenied = errors.New("access violation: writes are not permitted")
+
+// RootResolver returns the directory, relative to the serve directory, that a
+// client's reads are served from. An empty string means the shared root.
+type RootResolver func(clientIP net.IP) string
+
+// UploadPolicy controls where and from whom TFTP writes are accepted and how
+// many versions of each upload are kept. The zero value refuses every write.
+type UploadPolicy struct {
+	Areas    []UploadArea  // Named directories that accept writes
+	Subnets  []*net.IPNet  // Client networks allowed to write
+	Versions int           // Versions kept per uploaded file, 0 keeps all
+	MaxAge   time.Duration // Versions older than this are removed, 0 keeps them forever
+}
+
+// NewUploadPolicy builds an upload policy from upload areas, written as
+// "name=dir" or a bare directory, and client CIDRs
+func NewUploadPolicy(areas []string, subnets []string) (UploadPolicy, error) {
+	var policy UploadPolicy
+	for _, a := range areas {
+		area, err := ParseUploadArea(a)
+		if err != nil {
+			return UploadPolicy{}, err
+		}
+		policy.Areas = append(policy.Areas, area)
+	}
+	for _, cidr := range subnets {
+		_, subnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return UploadPolicy{}, fmt.Errorf("invalid upload subnet %q: %w", cidr, err)
+		}
+		policy.Subnets = append(policy.Subnets, subnet)
+	}
+	return policy, nil
+}
+
+// allowsClient reports whether ip may write at all
+func (p UploadPolicy) allowsClient(ip net.IP) bool {
+	if len(p.Areas) == 0 || ip == nil {
+		return false
+	}
+	for _, subnet := range p.Subnets {
+		if subnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// VirtualFiles renders files on request instead of reading them from disk.
+// Render returns an error wrapping fs.ErrNotExist for names it does not
+// provide, in which case the file is served from disk as usual.
+type VirtualFiles interface {
+	Render(filename string, clientIP net.IP) ([]byte, error)
+}
+
+// DefaultPort is the well-known TFTP port
+const DefaultPort = 69
+
+// ListenerConfig controls where the server listens and how it paces transfers.
+type ListenerConfig struct {
+	Address      string        // Address to bind, empty for all IPv4 addresses
+	Port         int           // UDP port, 0 picks a free port
+	MaxBlockSize int           // Largest blocksize granted to clients, 0 leaves it to the client and path MTU
+	Timeout      time.Duration // ACK timeout before retransmitting, 0 for the library default
+	Retries      int           // Retransmissions before giving up, 0 for the library default
+	SinglePort   bool          // Serve all transfers from the listening port
+}
+
 // Server manages the TFTP server, handling file read and write operations.
 type Server struct {
-	serveDir   string
-	listener   *net.UDPConn
-	tftpServer *v3.Server
+	serveDir     string
+	override     Layer
+	defaults     Layer
+	uploads      UploadPolicy
+	backups      *BackupStore
+	access       AccessPolicy
+	rootResolver RootResolver
+	virtualFiles VirtualFiles
+	observers    []TransferObserver
+	cache        *FileCache
+	listen       ListenerConfig
+	listener     *net.UDPConn
+	tftpServer   *v3.Server
 }
 
 // NewServer creates and returns a new TFTP server instance with the specified directory for serving files.
+// The server is read-only until an upload policy is set.
 func NewServer(serveDir string) *Server {
 	return &Server{
 		serveDir: serveDir,
+		listen:   ListenerConfig{Port: DefaultPort},
 	}
 }
 
-// Start initiates the TFTP server, listening for incoming connections on port 69.
+// SetOverrideDir serves files from dir ahead of every other layer, letting
+// operators replace any file without touching the TFTP directory.
+func (s *Server) SetOverrideDir(dir string) {
+	s.override = Layer{}
+	if dir != "" {
+		s.override = DirLayer(LayerOverride, dir)
+	}
+}
+
+// SetDefaults serves files from assets when no directory on disk has them.
+func (s *Server) SetDefaults(assets fs.FS) {
+	s.defaults = Layer{Name: LayerDefault, FS: assets}
+}
+
+// Files returns the layered filesystem a client's reads are served from: the
+// override directory, the client's network root, the serve directory and
+// finally the built-in defaults.
+func (s *Server) Files(clientIP net.IP) *LayeredFS {
+	var network Layer
+	if s.rootResolver != nil && clientIP != nil {
+		if root := s.rootResolver(clientIP); root != "" {
+			network = DirLayer(LayerNetwork, filepath.Join(s.serveDir, root))
+		}
+	}
+	return NewLayeredFS(s.override, network, DirLayer(LayerShared, s.serveDir), s.defaults)
+}
+
+// SetCache serves files through an in-memory cache.
+func (s *Server) SetCache(cache *FileCache) {
+	s.cache = cache
+}
+
+// SetListenerConfig changes the listening address and transfer tuning. It
+// takes effect on the next Start.
+func (s *Server) SetListenerConfig(cfg ListenerConfig) {
+	s.listen = cfg
+}
+
+// Addr returns the address the server is listening on, or nil if it is not running.
+func (s *Server) Addr() net.Addr {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.LocalAddr()
+}
+
+// SetUploadPolicy allows writes into the policy's upload areas from its subnets.
+func (s *Server) SetUploadPolicy(policy UploadPolicy) {
+	s.uploads = policy
+	s.backups = NewBackupStore(s.serveDir, policy)
+}
+
+// SetAccessPolicy restricts which clients may read which files.
+func (s *Server) SetAccessPolicy(policy AccessPolicy) {
+	s.access = policy
+}
+
+// CheckRead returns why ip may not read name, a cleaned path relative to the
+// served tree, or nil if it may. It applies the access policy and keeps
+// device backups from other clients.
+func (s *Server) CheckRead(name string, ip net.IP) error {
+	if err := s.access.Check(name, ip); err != nil {
+		return err
+	}
+	if s.backups != nil {
+		return s.backups.CheckRead(name, ip)
+	}
+	return nil
+}
+
+// SetRootResolver scopes reads to per-client directories, such as one per VLAN.
+func (s *Server) SetRootResolver(resolver RootResolver) {
+	s.rootResolver = resolver
+}
+
+// SetVirtualFiles serves files rendered by v ahead of files on disk.
+func (s *Server) SetVirtualFiles(v VirtualFiles) {
+	s.virtualFiles = v
+}
+
+// Start initiates the TFTP server, listening on the configured address and port.
 func (s *Server) Start() error {
+	addr := &net.UDPAddr{Port: s.listen.Port}
+	network := "udp4"
+	if s.listen.Address != "" {
+		addr.IP = net.ParseIP(s.listen.Address)
+		if addr.IP == nil {
+			return fmt.Errorf("invalid listen address %q", s.listen.Address)
+		}
+		if addr.IP.To4() == nil {
+			network = "udp6"
+		}
+	}
+
 	var err error
-	s.listener, err = net.ListenUDP("udp4", &net.UDPAddr{Port: 69})
+	s.listener, err = net.ListenUDP(network, addr)
 	if err != nil {
 		return err
 	}
 
 	s.tftpServer = v3.NewServer(s.readHandler, s.writeHandler)
+	s.tftpServer.SetTimeout(s.listen.Timeout)
+	s.tftpServer.SetRetries(s.listen.Retries)
+	if s.listen.MaxBlockSize > 0 {
+		s.tftpServer.SetBlockSize(s.listen.MaxBlockSize)
+	}
+	if s.listen.SinglePort {
+		s.tftpServer.EnableSinglePort()
+	}
 
 	errChan := make(chan error, 1)
 	go func() {
@@ -61,25 +251,153 @@ func (s *Server) Stop() {
 
 // readHandler serves file read requests by opening and reading from the specified file in the server's directory.
 func (s *Server) readHandler(filename string, rf io.ReaderFrom) error {
-	file, err := os.Open(s.serveDir + "/" + filename)
+	transfer := Transfer{ClientIP: clientIP(rf), Filename: filename, Direction: DirectionRead, StartedAt: time.Now()}
+	err := s.serveRead(&transfer, rf)
+	s.finishTransfer(&transfer, err)
+	return err
+}
+
+// serveRead sends a rendered or on-disk file to the client
+func (s *Server) serveRead(transfer *Transfer, rf io.ReaderFrom) error {
+	filename, ip := transfer.Filename, transfer.ClientIP
+	name := path.Clean(security.NormalizeTFTPFilename(filename))
+
+	if err := s.CheckRead(name, ip); err != nil {
+		log.Printf("TFTP read of %s from %s denied: %v", filename, ip, err)
+		transfer.Outcome = OutcomeDenied
+		return errReadDenied
+	}
+
+	if s.virtualFiles != nil {
+		data, err := s.virtualFiles.Render(name, ip)
+		if err == nil {
+			return s.send(transfer, rf, bytes.NewReader(data))
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("TFTP render of %s for %s failed: %v", filename, ip, err)
+		}
+	}
+
+	file, layer, err := s.Files(ip).OpenLayer(name)
+	if err == nil {
+		if info, statErr := file.Stat(); statErr != nil || !info.Mode().IsRegular() {
+			file.Close()
+			err = fmt.Errorf("%s is not a regular file", name)
+		}
+	}
 	if err != nil {
-		return err
+		log.Printf("TFTP read of %s from %s failed: %v", filename, ip, err)
+		transfer.Outcome = OutcomeNotFound
+		return fmt.Errorf("file not found: %s", filename)
 	}
 	defer file.Close()
-	_, err = rf.ReadFrom(file)
+
+	if s.cache != nil {
+		data, err := s.cache.Read(cacheKey(layer, name), file)
+		if err == nil {
+			return s.send(transfer, rf, bytes.NewReader(data))
+		}
+		if !errors.Is(err, errNotCacheable) {
+			return err
+		}
+	}
+	if r, ok := file.(io.ReadSeeker); ok {
+		return s.send(transfer, rf, r)
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	return s.send(transfer, rf, bytes.NewReader(data))
+}
+
+// cacheKey identifies name within a layer, using the path on disk so files
+// from different network roots never share an entry
+func cacheKey(layer Layer, name string) string {
+	if path, err := layer.Path(name); err == nil {
+		return path
+	}
+	return layer.Name + ":" + name
+}
+
+// send streams r to the client, recording the bytes and block size used
+func (s *Server) send(transfer *Transfer, rf io.ReaderFrom, r io.Reader) error {
+	src, counts := meter(r)
+	_, err := rf.ReadFrom(src)
+	transfer.Bytes, transfer.BlockSize = counts.bytes, counts.blockSize
 	return err
 }
 
-// writeHandler handles file write requests by creating a new file or overwriting an existing one in the server's directory.
+// finishTransfer fills in the outcome of a transfer and records it
+func (s *Server) finishTransfer(transfer *Transfer, err error) {
+	transfer.Duration = time.Since(transfer.StartedAt)
+	if err != nil {
+		transfer.Error = err.Error()
+		if transfer.Outcome == "" {
+			transfer.Outcome = OutcomeFailed
+		}
+	} else {
+		transfer.Outcome = OutcomeSuccess
+	}
+	s.recordTransfer(*transfer)
+}
+
+// clientIP returns the address of the peer behind a transfer, if known.
+func clientIP(transfer any) net.IP {
+	if peer, ok := transfer.(interface{ RemoteAddr() net.UDPAddr }); ok {
+		addr := peer.RemoteAddr()
+		return addr.IP
+	}
+	return nil
+}
+
+// writeHandler handles file write requests by storing them in an upload area under the client's own directory.
+// Writes are only accepted into upload areas from allowed subnets, and land
+// via a temporary file so a failed transfer never leaves a partial file. Each
+// upload is also kept as a timestamped version.
 func (s *Server) writeHandler(filename string, wt io.WriterTo) error {
-	log.Printf("Write request for %s", filename)
+	transfer := Transfer{ClientIP: clientIP(wt), Filename: filename, Direction: DirectionWrite, StartedAt: time.Now()}
+	err := s.serveWrite(&transfer, wt)
+	s.finishTransfer(&transfer, err)
+	return err
+}
+
+// serveWrite stores an upload from the client if the upload policy allows it
+func (s *Server) serveWrite(transfer *Transfer, wt io.WriterTo) error {
+	filename, ip := transfer.Filename, transfer.ClientIP
 
-	file, err := os.Create(s.serveDir + "/" + filename)
+	if !s.uploads.allowsClient(ip) {
+		log.Printf("TFTP write of %s from %s denied: client not allowed to upload", filename, ip)
+		transfer.Outcome = OutcomeDenied
+		return errWriteDenied
+	}
+	area, latestPath, err := s.backups.resolve(filename, ip)
 	if err != nil {
-		return err
+		log.Printf("TFTP write of %s from %s denied: %v", filename, ip, err)
+		transfer.Outcome = OutcomeDenied
+		return errWriteDenied
 	}
-	defer file.Close()
 
-	_, err = wt.WriteTo(file)
-	return err
+	log.Printf("TFTP write of %s from %s into upload area %s", filename, ip, area.Name)
+
+	if err := os.MkdirAll(filepath.Dir(latestPath), 0755); err != nil {
+		return fmt.Errorf("failed to create upload directory: %w", err)
+	}
+	file, err := os.CreateTemp(filepath.Dir(latestPath), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create upload file: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	meter := &meteredWriter{w: file}
+	_, err = wt.WriteTo(meter)
+	transfer.Bytes, transfer.BlockSize = meter.bytes, meter.blockSize
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return s.backups.save(latestPath, file.Name(), transfer.StartedAt)
 }
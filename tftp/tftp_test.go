@@ -1,10 +1,16 @@
 package tftp
 
 import (
+	"io"
+	"io/fs"
 	"net"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	v3 "github.com/pin/tftp/v3"
 )
 
 func TestNewServer(t *testing.T) {
@@ -98,3 +104,273 @@ func TestTFTPServerCreation(t *testing.T) {
 }
 
 // Removed mock types as we're now testing public interface only
+
+// fakeTransfer records what a read handler sends to a client
+type fakeTransfer struct {
+	addr net.UDPAddr
+	data []byte
+}
+
+func (f *fakeTransfer) ReadFrom(r io.Reader) (int64, error) {
+	data, err := io.ReadAll(r)
+	f.data = data
+	return int64(len(data)), err
+}
+
+func (f *fakeTransfer) RemoteAddr() net.UDPAddr { return f.addr }
+
+func TestReadHandlerRootResolver(t *testing.T) {
+	serveDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(serveDir, "racks", "r100"), 0755); err != nil {
+		t.Fatalf("Failed to create rack directory: %v", err)
+	}
+	files := map[string]string{
+		"boot.cfg":                "shared",
+		"pxelinux.0":              "bootloader",
+		"racks/r100/boot.cfg":     "rack 100",
+		"racks/r100/unused.other": "unused",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(serveDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	server := NewServer(serveDir)
+	server.SetRootResolver(func(ip net.IP) string {
+		if ip.Equal(net.ParseIP("10.100.0.50")) {
+			return "racks/r100"
+		}
+		return ""
+	})
+
+	tests := []struct {
+		client   string
+		filename string
+		expected string
+	}{
+		{"10.100.0.50", "boot.cfg", "rack 100"},
+		{"10.100.0.50", "pxelinux.0", "bootloader"},
+		{"10.200.0.50", "boot.cfg", "shared"},
+	}
+
+	for _, tt := range tests {
+		transfer := &fakeTransfer{addr: net.UDPAddr{IP: net.ParseIP(tt.client), Port: 2000}}
+		if err := server.readHandler(tt.filename, transfer); err != nil {
+			t.Fatalf("readHandler(%s) for %s failed: %v", tt.filename, tt.client, err)
+		}
+		if string(transfer.data) != tt.expected {
+			t.Errorf("readHandler(%s) for %s = %q, expected %q", tt.filename, tt.client, transfer.data, tt.expected)
+		}
+	}
+}
+
+// fakeUpload feeds data to a write handler as a client would
+type fakeUpload struct {
+	addr net.UDPAddr
+	data string
+}
+
+func (f *fakeUpload) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, f.data)
+	return int64(n), err
+}
+
+func (f *fakeUpload) RemoteAddr() net.UDPAddr { return f.addr }
+
+func TestReadHandlerConfinement(t *testing.T) {
+	serveDir := t.TempDir()
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret.cfg"), []byte("secret"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret.cfg"), filepath.Join(serveDir, "escape.cfg")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(serveDir, "pxelinux.cfg"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	server := NewServer(serveDir)
+	for _, filename := range []string{"../" + filepath.Base(outside) + "/secret.cfg", "..\\..\\etc\\passwd", "escape.cfg", "pxelinux.cfg"} {
+		transfer := &fakeTransfer{addr: net.UDPAddr{IP: net.ParseIP("10.0.0.5"), Port: 2000}}
+		err := server.readHandler(filename, transfer)
+		if err == nil {
+			t.Errorf("readHandler(%s) succeeded, expected it to be refused", filename)
+			continue
+		}
+		if strings.Contains(err.Error(), serveDir) {
+			t.Errorf("readHandler(%s) error leaks the serve directory: %v", filename, err)
+		}
+	}
+}
+
+func TestWriteHandlerPolicy(t *testing.T) {
+	serveDir := t.TempDir()
+	server := NewServer(serveDir)
+	client := net.UDPAddr{IP: net.ParseIP("10.0.0.5"), Port: 2000}
+
+	// Read-only by default
+	if err := server.writeHandler("backups/switch1.cfg", &fakeUpload{addr: client, data: "config"}); err == nil {
+		t.Fatal("Expected writes to be refused without an upload policy")
+	}
+
+	policy, err := NewUploadPolicy([]string{"backups"}, []string{"10.0.0.0/24"})
+	if err != nil {
+		t.Fatalf("NewUploadPolicy failed: %v", err)
+	}
+	server.SetUploadPolicy(policy)
+
+	tests := []struct {
+		name      string
+		client    string
+		filename  string
+		stored    string
+		expectErr bool
+	}{
+		{"Allowed client in upload area", "10.0.0.5", "backups/switch1.cfg", "backups/10.0.0.5/switch1.cfg", false},
+		{"Client outside subnets", "10.0.1.5", "backups/switch2.cfg", "backups/10.0.1.5/switch2.cfg", true},
+		{"Outside upload area", "10.0.0.5", "pxelinux.0", "pxelinux.0", true},
+		{"Traversal out of upload area", "10.0.0.5", "backups/../pxelinux.0", "pxelinux.0", true},
+		{"Version history", "10.0.0.5", "backups/switch1.cfg.versions/x", "backups/10.0.0.5/switch1.cfg.versions/x", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upload := &fakeUpload{addr: net.UDPAddr{IP: net.ParseIP(tt.client), Port: 2000}, data: "config"}
+			err := server.writeHandler(tt.filename, upload)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("writeHandler(%s) from %s error = %v, expectErr %v", tt.filename, tt.client, err, tt.expectErr)
+			}
+			_, statErr := os.Stat(filepath.Join(serveDir, tt.stored))
+			if tt.expectErr != os.IsNotExist(statErr) {
+				t.Errorf("writeHandler(%s) from %s left file state %v", tt.filename, tt.client, statErr)
+			}
+		})
+	}
+
+	data, err := os.ReadFile(filepath.Join(serveDir, "backups", "10.0.0.5", "switch1.cfg"))
+	if err != nil || string(data) != "config" {
+		t.Errorf("Uploaded file = %q, %v; expected %q", data, err, "config")
+	}
+}
+
+func TestNewUploadPolicyInvalidSubnet(t *testing.T) {
+	if _, err := NewUploadPolicy([]string{"backups"}, []string{"not-a-cidr"}); err == nil {
+		t.Error("Expected an error for an invalid subnet")
+	}
+}
+
+// fakeVirtualFiles renders a fixed set of files
+type fakeVirtualFiles map[string]string
+
+func (f fakeVirtualFiles) Render(filename string, clientIP net.IP) ([]byte, error) {
+	if content, ok := f[filename]; ok {
+		return []byte(content), nil
+	}
+	return nil, fs.ErrNotExist
+}
+
+func TestReadHandlerVirtualFiles(t *testing.T) {
+	serveDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(serveDir, "pxelinux.cfg"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	files := map[string]string{
+		"pxelinux.cfg/01-aa-bb-cc-dd-ee-ff": "stale",
+		"pxelinux.cfg/default":              "default menu",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(serveDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	server := NewServer(serveDir)
+	server.SetVirtualFiles(fakeVirtualFiles{"pxelinux.cfg/01-aa-bb-cc-dd-ee-ff": "rendered"})
+
+	tests := []struct {
+		filename string
+		expected string
+	}{
+		{"pxelinux.cfg/01-aa-bb-cc-dd-ee-ff", "rendered"},
+		{"/pxelinux.cfg/01-aa-bb-cc-dd-ee-ff", "rendered"},
+		{"pxelinux.cfg/default", "default menu"},
+	}
+
+	for _, tt := range tests {
+		transfer := &fakeTransfer{addr: net.UDPAddr{IP: net.ParseIP("10.0.0.5"), Port: 2000}}
+		if err := server.readHandler(tt.filename, transfer); err != nil {
+			t.Fatalf("readHandler(%s) failed: %v", tt.filename, err)
+		}
+		if string(transfer.data) != tt.expected {
+			t.Errorf("readHandler(%s) = %q, expected %q", tt.filename, transfer.data, tt.expected)
+		}
+	}
+}
+
+func TestServerListenerConfig(t *testing.T) {
+	serveDir := t.TempDir()
+	content := strings.Repeat("x", 5000)
+	if err := os.WriteFile(filepath.Join(serveDir, "pxelinux.0"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	for _, singlePort := range []bool{false, true} {
+		server := NewServer(serveDir)
+		server.SetListenerConfig(ListenerConfig{
+			Address:      "127.0.0.1",
+			MaxBlockSize: 1024,
+			Timeout:      time.Second,
+			Retries:      3,
+			SinglePort:   singlePort,
+		})
+		transfers := make(chan Transfer, 1)
+		server.AddTransferObserver(func(transfer Transfer) { transfers <- transfer })
+
+		if err := server.Start(); err != nil {
+			t.Fatalf("Failed to start server: %v", err)
+		}
+
+		client, err := v3.NewClient(server.Addr().String())
+		if err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+		client.SetBlockSize(8192)
+		client.RequestTSize(true)
+
+		wt, err := client.Receive("pxelinux.0", "octet")
+		if err != nil {
+			t.Fatalf("Receive failed (single port %t): %v", singlePort, err)
+		}
+		if size, ok := wt.(v3.IncomingTransfer).Size(); !ok || size != int64(len(content)) {
+			t.Errorf("Expected tsize %d, got %d (%t)", len(content), size, ok)
+		}
+		var received strings.Builder
+		if _, err := wt.WriteTo(&received); err != nil {
+			t.Fatalf("WriteTo failed: %v", err)
+		}
+		if received.String() != content {
+			t.Errorf("Received %d bytes, expected %d", received.Len(), len(content))
+		}
+
+		select {
+		case transfer := <-transfers:
+			if transfer.BlockSize != 1024 || transfer.Outcome != OutcomeSuccess {
+				t.Errorf("Expected a successful transfer capped at blocksize 1024, got %+v", transfer)
+			}
+		case <-time.After(2 * time.Second):
+			t.Error("Transfer was not recorded")
+		}
+		server.Stop()
+	}
+}
+
+func TestServerInvalidAddress(t *testing.T) {
+	server := NewServer(t.TempDir())
+	server.SetListenerConfig(ListenerConfig{Address: "not-an-ip"})
+	if err := server.Start(); err == nil {
+		server.Stop()
+		t.Error("Expected an error for an invalid listen address")
+	}
+}
@@ -0,0 +1,433 @@
+package upload
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"ignite/security"
+)
+
+// StagingDir is the hidden directory inside the TFTP directory holding
+// unfinished uploads, so completed files can be renamed into place
+const StagingDir = ".uploads"
+
+var (
+	ErrNotFound         = errors.New("upload not found")
+	ErrOffsetMismatch   = errors.New("upload offset does not match")
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	ErrTooLarge         = errors.New("upload exceeds its declared size")
+	ErrBusy             = errors.New("upload is already receiving data")
+)
+
+// Upload is a resumable upload of one file into the TFTP directory
+type Upload struct {
+	ID        string    `json:"id"`
+	Dir       string    `json:"dir"`
+	Filename  string    `json:"filename"`
+	Size      int64     `json:"size"`
+	Offset    int64     `json:"offset"`
+	Checksum  string    `json:"checksum,omitempty"` // Expected "algorithm:hex" digest of the whole file
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Complete reports whether every byte of the file has been received
+func (u Upload) Complete() bool {
+	return u.Offset >= u.Size
+}
+
+// Percent returns how much of the file has been received
+func (u Upload) Percent() float64 {
+	if u.Size == 0 {
+		return 100
+	}
+	return float64(u.Offset) * 100 / float64(u.Size)
+}
+
+// Store keeps resumable uploads on disk until they complete, then moves each
+// file to its target directory. Uploads survive restarts of the server.
+type Store struct {
+	root      string
+	staging   string
+	maxSize   int64
+	expiry    time.Duration
+	validator *security.TFTPSecurityValidator
+
+	mu   sync.Mutex
+	busy map[string]bool
+}
+
+// NewStore creates a Store for uploads into root of at most maxSize bytes each,
+// or of any size when maxSize is 0. Uploads idle for longer than expiry are
+// discarded when the next one is created.
+func NewStore(root string, maxSize int64, expiry time.Duration) *Store {
+	return &Store{
+		root:      root,
+		staging:   filepath.Join(root, StagingDir),
+		maxSize:   maxSize,
+		expiry:    expiry,
+		validator: security.NewTFTPSecurityValidator(root),
+		busy:      make(map[string]bool),
+	}
+}
+
+// Create starts an upload of size bytes to filename in dir. checksum, if set,
+// is verified once the upload completes.
+func (s *Store) Create(dir, filename string, size int64, checksum string) (Upload, error) {
+	if size < 0 {
+		return Upload{}, fmt.Errorf("invalid upload size %d", size)
+	}
+	if s.maxSize > 0 && size > s.maxSize {
+		return Upload{}, fmt.Errorf("file too large (max %d bytes): %d", s.maxSize, size)
+	}
+	if _, err := s.validator.ResolveUploadTarget(s.root, dir, filename); err != nil {
+		return Upload{}, fmt.Errorf("invalid upload target: %w", err)
+	}
+	if checksum != "" {
+		if _, _, err := ParseChecksum(checksum); err != nil {
+			return Upload{}, err
+		}
+	}
+
+	if err := os.MkdirAll(s.staging, 0755); err != nil {
+		return Upload{}, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	if s.expiry > 0 {
+		if err := s.Expire(s.expiry); err != nil {
+			log.Printf("Failed to discard expired uploads: %v", err)
+		}
+	}
+
+	now := time.Now()
+	u := Upload{
+		ID:        uuid.New().String(),
+		Dir:       strings.Trim(security.NormalizeTFTPFilename(dir), "/"),
+		Filename:  filename,
+		Size:      size,
+		Checksum:  checksum,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := os.WriteFile(s.dataPath(u.ID), nil, 0644); err != nil {
+		return Upload{}, fmt.Errorf("failed to create upload: %w", err)
+	}
+	if err := s.saveInfo(u); err != nil {
+		os.Remove(s.dataPath(u.ID))
+		return Upload{}, err
+	}
+
+	if size == 0 {
+		return s.finish(u)
+	}
+	return u, nil
+}
+
+// Get returns an unfinished upload and how much of it has been received
+func (s *Store) Get(id string) (Upload, error) {
+	if err := uuid.Validate(id); err != nil {
+		return Upload{}, ErrNotFound
+	}
+
+	data, err := os.ReadFile(s.infoPath(id))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return Upload{}, ErrNotFound
+		}
+		return Upload{}, err
+	}
+	var u Upload
+	if err := json.Unmarshal(data, &u); err != nil {
+		return Upload{}, fmt.Errorf("failed to read upload %s: %w", id, err)
+	}
+
+	info, err := os.Stat(s.dataPath(id))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return Upload{}, ErrNotFound
+		}
+		return Upload{}, err
+	}
+	u.Offset = info.Size()
+	u.UpdatedAt = info.ModTime()
+	return u, nil
+}
+
+// List returns the unfinished uploads, oldest first
+func (s *Store) List() ([]Upload, error) {
+	entries, err := os.ReadDir(s.staging)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var uploads []Upload
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		u, err := s.Get(id)
+		if err != nil {
+			continue
+		}
+		uploads = append(uploads, u)
+	}
+
+	sort.Slice(uploads, func(i, j int) bool { return uploads[i].CreatedAt.Before(uploads[j].CreatedAt) })
+	return uploads, nil
+}
+
+// Write appends data received at offset to an upload. If chunkChecksum is
+// set, written as "algorithm base64-digest", the data is discarded unless it
+// matches. Once the last byte arrives the file is verified and moved into place.
+func (s *Store) Write(id string, offset int64, data io.Reader, chunkChecksum string) (Upload, error) {
+	var chunkHash hash.Hash
+	var chunkSum []byte
+	if chunkChecksum != "" {
+		algorithm, encoded, _ := strings.Cut(chunkChecksum, " ")
+		var err error
+		if chunkHash, err = newHash(algorithm); err != nil {
+			return Upload{}, err
+		}
+		if chunkSum, err = base64.StdEncoding.DecodeString(encoded); err != nil {
+			return Upload{}, fmt.Errorf("invalid chunk checksum: %w", err)
+		}
+	}
+
+	if !s.acquire(id) {
+		return Upload{}, ErrBusy
+	}
+	defer s.release(id)
+
+	u, err := s.Get(id)
+	if err != nil {
+		return Upload{}, err
+	}
+	if offset != u.Offset {
+		return u, ErrOffsetMismatch
+	}
+
+	file, err := os.OpenFile(s.dataPath(id), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return u, fmt.Errorf("failed to open upload: %w", err)
+	}
+
+	// Read one byte past the declared size to detect oversized uploads
+	var w io.Writer = file
+	if chunkHash != nil {
+		w = io.MultiWriter(file, chunkHash)
+	}
+	written, copyErr := io.Copy(w, io.LimitReader(data, u.Size-u.Offset+1))
+
+	discard := copyErr == nil && u.Offset+written > u.Size
+	mismatch := copyErr == nil && !discard && chunkHash != nil && !bytes.Equal(chunkHash.Sum(nil), chunkSum)
+	if discard || mismatch || (copyErr != nil && chunkHash != nil) {
+		// Partial or rejected chunks are dropped so the client can resend them
+		if err := file.Truncate(u.Offset); err != nil {
+			file.Close()
+			return u, fmt.Errorf("failed to discard rejected data: %w", err)
+		}
+		written = 0
+	}
+	if err := file.Close(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+	u.Offset += written
+	u.UpdatedAt = time.Now()
+
+	switch {
+	case discard:
+		return u, ErrTooLarge
+	case mismatch:
+		return u, ErrChecksumMismatch
+	case copyErr != nil:
+		return u, fmt.Errorf("failed to receive upload data: %w", copyErr)
+	case u.Complete():
+		return s.finish(u)
+	}
+	return u, nil
+}
+
+// Delete abandons an upload and removes the data received so far
+func (s *Store) Delete(id string) error {
+	if !s.acquire(id) {
+		return ErrBusy
+	}
+	defer s.release(id)
+
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	return s.remove(id)
+}
+
+// Expire removes uploads that have received no data for longer than maxAge
+func (s *Store) Expire(maxAge time.Duration) error {
+	uploads, err := s.List()
+	if err != nil {
+		return err
+	}
+	for _, u := range uploads {
+		if time.Since(u.UpdatedAt) > maxAge {
+			if err := s.Delete(u.ID); err != nil && !errors.Is(err, ErrBusy) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// finish verifies a completed upload and moves it to its target directory
+func (s *Store) finish(u Upload) (Upload, error) {
+	if u.Checksum != "" {
+		if err := verifyChecksum(s.dataPath(u.ID), u.Checksum); err != nil {
+			s.remove(u.ID)
+			return u, err
+		}
+	}
+
+	target, err := s.validator.ResolveUploadTarget(s.root, u.Dir, u.Filename)
+	if err != nil {
+		return u, fmt.Errorf("invalid upload target: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return u, fmt.Errorf("failed to create target directory: %w", err)
+	}
+	if err := os.Rename(s.dataPath(u.ID), target); err != nil {
+		return u, fmt.Errorf("failed to move upload into place: %w", err)
+	}
+	if err := os.Remove(s.infoPath(u.ID)); err != nil {
+		return u, fmt.Errorf("failed to remove upload record: %w", err)
+	}
+	return u, nil
+}
+
+// remove deletes an upload's data and record
+func (s *Store) remove(id string) error {
+	if err := os.Remove(s.dataPath(id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove upload data: %w", err)
+	}
+	if err := os.Remove(s.infoPath(id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove upload record: %w", err)
+	}
+	return nil
+}
+
+// saveInfo records an upload's target and expected size
+func (s *Store) saveInfo(u Upload) error {
+	u.Offset = 0
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.infoPath(u.ID), data, 0644); err != nil {
+		return fmt.Errorf("failed to save upload: %w", err)
+	}
+	return nil
+}
+
+// acquire marks an upload as receiving data, reporting false if it already is
+func (s *Store) acquire(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.busy[id] {
+		return false
+	}
+	s.busy[id] = true
+	return true
+}
+
+// release allows an upload to receive data again
+func (s *Store) release(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.busy, id)
+}
+
+func (s *Store) dataPath(id string) string {
+	return filepath.Join(s.staging, id+".part")
+}
+
+func (s *Store) infoPath(id string) string {
+	return filepath.Join(s.staging, id+".json")
+}
+
+// ParseChecksum parses an expected digest written as "algorithm:hex", such as
+// "sha256:9f86d0...", as published alongside most OS images
+func ParseChecksum(checksum string) (string, []byte, error) {
+	algorithm, digest, ok := strings.Cut(strings.TrimSpace(checksum), ":")
+	if !ok {
+		return "", nil, fmt.Errorf("invalid checksum %q: expected algorithm:hex", checksum)
+	}
+	algorithm = strings.ToLower(algorithm)
+	h, err := newHash(algorithm)
+	if err != nil {
+		return "", nil, err
+	}
+	sum, err := hex.DecodeString(digest)
+	if err != nil || len(sum) != h.Size() {
+		return "", nil, fmt.Errorf("invalid %s digest %q", algorithm, digest)
+	}
+	return algorithm, sum, nil
+}
+
+// verifyChecksum checks the digest of the file at path
+func verifyChecksum(path, checksum string) error {
+	algorithm, expected, err := ParseChecksum(checksum)
+	if err != nil {
+		return err
+	}
+	h, _ := newHash(algorithm)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := io.Copy(h, file); err != nil {
+		return fmt.Errorf("failed to read upload: %w", err)
+	}
+
+	if !bytes.Equal(h.Sum(nil), expected) {
+		return fmt.Errorf("%w: %s of the upload is %x", ErrChecksumMismatch, algorithm, h.Sum(nil))
+	}
+	return nil
+}
+
+// newHash returns a hash for a checksum algorithm name
+func newHash(algorithm string) (hash.Hash, error) {
+	switch strings.ToLower(algorithm) {
+	case "md5":
+		return md5.New(), nil
+	case "sha1":
+		return sha1.New(), nil
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported checksum algorithm %q", algorithm)
+	}
+}
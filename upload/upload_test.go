@@ -0,0 +1,148 @@
+package upload
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// chunkChecksum returns the Upload-Checksum value for data
+func chunkChecksum(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return "sha256 " + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// fileChecksum returns the expected checksum of a whole file
+func fileChecksum(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func TestStoreResumesAndCompletes(t *testing.T) {
+	root := t.TempDir()
+	content := "kernel image contents"
+	store := NewStore(root, 0, time.Hour)
+
+	u, err := store.Create("images/ubuntu", "vmlinuz", int64(len(content)), fileChecksum(content))
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	if _, err := store.Write(u.ID, 0, strings.NewReader(content[:6]), chunkChecksum(content[:6])); err != nil {
+		t.Fatalf("Write of first chunk failed: %v", err)
+	}
+
+	// A new store sees the same progress, as after a restart
+	store = NewStore(root, 0, time.Hour)
+	u, err = store.Get(u.ID)
+	if err != nil || u.Offset != 6 {
+		t.Fatalf("Get = %+v, %v; expected offset 6", u, err)
+	}
+
+	if _, err := store.Write(u.ID, 0, strings.NewReader(content), ""); !errors.Is(err, ErrOffsetMismatch) {
+		t.Errorf("Write at a stale offset returned %v, expected ErrOffsetMismatch", err)
+	}
+
+	u, err = store.Write(u.ID, 6, strings.NewReader(content[6:]), "")
+	if err != nil || !u.Complete() {
+		t.Fatalf("Write of last chunk = %+v, %v; expected a complete upload", u, err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, "images", "ubuntu", "vmlinuz"))
+	if err != nil || string(data) != content {
+		t.Errorf("Uploaded file = %q, %v", data, err)
+	}
+	if uploads, _ := store.List(); len(uploads) != 0 {
+		t.Errorf("Expected no unfinished uploads, got %+v", uploads)
+	}
+}
+
+func TestStoreRejectsBadChunks(t *testing.T) {
+	store := NewStore(t.TempDir(), 0, time.Hour)
+	u, err := store.Create("", "boot.cfg", 8, "")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	u, err = store.Write(u.ID, 0, strings.NewReader("abcd"), chunkChecksum("abce"))
+	if !errors.Is(err, ErrChecksumMismatch) || u.Offset != 0 {
+		t.Errorf("Corrupted chunk: offset %d, error %v; expected it to be discarded", u.Offset, err)
+	}
+
+	u, err = store.Write(u.ID, 0, strings.NewReader("abcdefghij"), "")
+	if !errors.Is(err, ErrTooLarge) || u.Offset != 0 {
+		t.Errorf("Oversized chunk: offset %d, error %v; expected it to be discarded", u.Offset, err)
+	}
+}
+
+func TestStoreVerifiesFileChecksum(t *testing.T) {
+	root := t.TempDir()
+	store := NewStore(root, 0, time.Hour)
+	u, err := store.Create("", "boot.cfg", 4, fileChecksum("good"))
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	if _, err := store.Write(u.ID, 0, strings.NewReader("evil"), ""); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("Write returned %v, expected ErrChecksumMismatch", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "boot.cfg")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("File failing verification was moved into place")
+	}
+	if _, err := store.Get(u.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Upload failing verification was kept: %v", err)
+	}
+}
+
+func TestStoreCreateValidation(t *testing.T) {
+	store := NewStore(t.TempDir(), 1024, time.Hour)
+
+	tests := []struct {
+		name     string
+		dir      string
+		filename string
+		size     int64
+		checksum string
+	}{
+		{"Too large", "", "ubuntu.iso", 2048, ""},
+		{"Traversal", "../..", "ubuntu.iso", 10, ""},
+		{"Staging directory", StagingDir, "ubuntu.iso", 10, ""},
+		{"Unsafe filename", "", "a/b.iso", 10, ""},
+		{"Unknown checksum algorithm", "", "ubuntu.iso", 10, "crc32:00000000"},
+		{"Malformed checksum", "", "ubuntu.iso", 10, "sha256:abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := store.Create(tt.dir, tt.filename, tt.size, tt.checksum); err == nil {
+				t.Errorf("Create(%q, %q) succeeded, expected an error", tt.dir, tt.filename)
+			}
+		})
+	}
+}
+
+func TestStoreExpire(t *testing.T) {
+	store := NewStore(t.TempDir(), 0, time.Hour)
+	u, err := store.Create("", "boot.cfg", 4, "")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	stale := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(store.dataPath(u.ID), stale, stale); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+
+	if err := store.Expire(time.Hour); err != nil {
+		t.Fatalf("Expire failed: %v", err)
+	}
+	if _, err := store.Get(u.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stale upload was kept: %v", err)
+	}
+}